@@ -1,19 +1,39 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"io"
+	"monkey/internal/ast"
+	"monkey/internal/cache"
+	"monkey/internal/compiler"
+	"monkey/internal/diagnostics"
 	"monkey/internal/evaluator"
 	"monkey/internal/lexer"
+	"monkey/internal/module"
 	"monkey/internal/object"
 	"monkey/internal/parser"
+	"monkey/internal/vm"
 	"os"
+	"strings"
+)
+
+var (
+	strict       = flag.Bool("strict", false, "require every statement to be terminated by a semicolon")
+	maxCallDepth = flag.Int("max-call-depth", evaluator.DefaultMaxCallDepth, "how many calls can be in progress at once")
+	checked      = flag.Bool("checked", false, "make integer overflows errors instead of wrapping around")
+	build        = flag.String("build", "", "compile the file to bytecode written to this .mbc file instead of running it")
+	engine       = flag.String("engine", "eval", "what runs the file: eval walks its tree, vm compiles it to bytecode for the virtual machine")
+	cacheDir     = flag.String("cache", defaultCacheDir(), "keep the bytecode of -engine=vm in this directory, to not compile files again while unchanged; empty not to")
+	optimize     = flag.Bool("optimize", true, "optimize the bytecode compiled, -optimize=false to debug the compiler")
 )
 
 func readFirstArg() string {
-	if len(os.Args) <= 1 {
+	if flag.NArg() < 1 {
 		panic("call the repel main")
 	}
-	return os.Args[1]
+	return flag.Arg(0)
 }
 
 func readFile(filename string) (string, error) {
@@ -25,33 +45,136 @@ func readFile(filename string) (string, error) {
 	return string(file), nil
 }
 
-func printParserErrors(out io.Writer, errs []string) {
-	for _, msg := range errs {
-		io.WriteString(out, "\t"+msg+"\n")
+func main() {
+	flag.Parse()
+	if *engine != "eval" && *engine != "vm" {
+		fmt.Fprintf(os.Stderr, "unknown engine %q: want eval or vm\n", *engine)
+		os.Exit(2)
 	}
-}
 
-func main() {
 	environment := object.NewEnv()
+	e := evaluator.New(evaluator.Config{MaxCallDepth: *maxCallDepth, CheckedIntegers: *checked})
 
 	filename := readFirstArg()
+	if strings.HasSuffix(filename, ".mbc") {
+		runBytecode(filename, e)
+		return
+	}
+
 	fileContent, err := readFile(filename)
 	if err != nil {
 		panic(err)
 	}
 
+	mode := parser.Mode(0)
+	if *strict {
+		mode |= parser.StrictSemicolons
+	}
+	if *engine == "vm" && *build == "" && *cacheDir != "" && *optimize {
+		runCached(fileContent, mode, e)
+		return
+	}
+
 	l := lexer.New(fileContent)
-	p := parser.New(l)
+	p := parser.NewWithMode(l, mode)
 
 	program := p.ParseProgram()
+	diagnostics.RenderAll(os.Stderr, fileContent, p.Warnings())
 	if len(p.Errors()) != 0 {
-		printParserErrors(os.Stdout, p.Errors())
+		diagnostics.RenderAll(os.Stdout, fileContent, p.Diagnostics())
 		return
 	}
 
-	evaluated := evaluator.Eval(program, environment)
-	if evaluated != nil {
+	if *build != "" {
+		buildBytecode(program, fileContent, *build)
+		return
+	}
+	if *engine == "vm" {
+		printResult(vm.New(compileProgram(program, fileContent), e).Run())
+		return
+	}
+
+	// the modules the file imports with relative paths are found from its directory
+	evaluated := e.EvalContext(evaluator.InFile(context.Background(), module.File{Name: filename}), program, environment)
+	if err, ok := evaluated.(*object.Error); ok && err.Token != nil {
+		diagnostics.RenderTrace(os.Stdout, fileContent, diagnostics.At(err.Token, "%s", err.Message), err.StackLines())
+	} else if evaluated != nil {
 		io.WriteString(os.Stdout, evaluated.Inspect())
 		io.WriteString(os.Stdout, "\n")
 	}
 }
+
+// compileProgram compiles the program to bytecode, rendering why it can't be compiled and exiting if it can't
+func compileProgram(program *ast.Program, source string) *compiler.Bytecode {
+	c := compiler.New()
+	c.Optimize(*optimize)
+	if err := c.Compile(program); err != nil {
+		compiler.RenderError(os.Stdout, source, err)
+		os.Exit(1)
+	}
+
+	return c.Bytecode()
+}
+
+// runCached runs the source on the virtual machine, with its bytecode from the cache if it didn't change since it
+// was last compiled
+func runCached(source string, mode parser.Mode, e *evaluator.Evaluator) {
+	bytecode, err := cache.New(*cacheDir).Compile(source, mode)
+	if err != nil {
+		compiler.RenderError(os.Stdout, source, err)
+		os.Exit(1)
+	}
+
+	printResult(vm.New(bytecode, e).Run())
+}
+
+// defaultCacheDir returns the directory the bytecode is kept in by default, none if the user has no cache directory
+func defaultCacheDir() string {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return ""
+	}
+
+	return dir
+}
+
+// buildBytecode compiles the program and writes its bytecode to the file, to run it later without parsing and
+// compiling it again
+func buildBytecode(program *ast.Program, source, filename string) {
+	bytecode := compileProgram(program, source)
+
+	file, err := os.Create(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	if _, err := bytecode.WriteTo(file); err != nil {
+		panic(err)
+	}
+}
+
+// runBytecode runs the bytecode of the .mbc file on the virtual machine
+func runBytecode(filename string, e *evaluator.Evaluator) {
+	file, err := os.Open(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	bytecode, err := compiler.ReadBytecode(file)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "ERROR: %s: %s\n", filename, err)
+		return
+	}
+
+	printResult(vm.New(bytecode, e).Run())
+}
+
+// printResult prints what the virtual machine returned, nothing for a program without statements
+func printResult(result object.Object) {
+	if result != nil {
+		io.WriteString(os.Stdout, result.Inspect())
+		io.WriteString(os.Stdout, "\n")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"monkey/internal/astgraph"
+	"monkey/internal/diagnostics"
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"os"
+)
+
+// runAST prints the parse tree of the file: as an indented outline, a Graphviz digraph with -dot or a Mermaid
+// flowchart with -mermaid. The exit status is 1 if the file can't be parsed.
+func runAST(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ExitOnError)
+	dot := flags.Bool("dot", false, "print the tree in the DOT language of Graphviz")
+	mermaid := flags.Bool("mermaid", false, "print the tree as a Mermaid flowchart")
+	strict := flags.Bool("strict", false, "require every statement to be terminated by a semicolon")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: monkey ast [-dot | -mermaid] [-strict] file\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || *dot && *mermaid {
+		flags.Usage()
+		return 2
+	}
+
+	filename := flags.Arg(0)
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	mode := parser.Mode(0)
+	if *strict {
+		mode |= parser.StrictSemicolons
+	}
+	p := parser.NewWithMode(lexer.New(string(source)), mode)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprintf(os.Stderr, "%s:\n", filename)
+		diagnostics.RenderAll(os.Stderr, string(source), p.Diagnostics())
+		return 1
+	}
+
+	write := astgraph.Outline
+	if *dot {
+		write = astgraph.Dot
+	} else if *mermaid {
+		write = astgraph.Mermaid
+	}
+	if err := write(os.Stdout, program); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"monkey/internal/evaluator"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"os"
+	"regexp"
+	"time"
+)
+
+// maxIterations is how many times a benchmark is called in a round at most
+const maxIterations = 1_000_000_000
+
+// runBench times the benchmarks the _test.mk files declare, found like the tests of runTest. Each is called more
+// and more times, until the calls take long enough to be timed reliably. The exit status is 1 if a benchmark or a
+// file failed.
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	strict := flags.Bool("strict", false, "require every statement to be terminated by a semicolon")
+	run := flags.String("run", "", "only run the benchmarks whose name matches this regular expression")
+	benchtime := flags.Duration("benchtime", time.Second, "how long the calls of each benchmark take at least")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: monkey bench [-strict] [-run regexp] [-benchtime d] [file or directory ...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey bench: invalid -run: %s\n", err)
+		return 2
+	}
+	mode := parser.Mode(0)
+	if *strict {
+		mode |= parser.StrictSemicolons
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	filenames, err := testFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	status := 0
+	for _, filename := range filenames {
+		if !benchFile(filename, mode, filter, *benchtime) {
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// benchFile times the benchmarks of the file matching the filter, printing the time per call of each, and returns
+// false if one of them or the file failed
+func benchFile(filename string, mode parser.Mode, filter *regexp.Regexp, benchtime time.Duration) bool {
+	var benchmarks []declared
+	source, _, e, ok := loadFile(filename, mode, evaluator.Config{Bench: func(name string, fn object.Object) {
+		benchmarks = append(benchmarks, declared{name, fn})
+	}})
+	if !ok {
+		return false
+	}
+
+	ok = true
+	for _, bench := range benchmarks {
+		if !filter.MatchString(bench.name) {
+			continue
+		}
+
+		n, elapsed, err := benchmark(e, bench.fn, benchtime)
+		if err != nil {
+			fmt.Fprintf(os.Stdout, "--- FAIL: %s (%s)\n", bench.name, filename)
+			renderError(source, err)
+			ok = false
+			continue
+		}
+
+		perOp := float64(elapsed.Nanoseconds()) / float64(n)
+		fmt.Fprintf(os.Stdout, "%-30s %10d %14.0f ns/op %14.1f ops/s\n", bench.name, n, perOp, 1e9/perOp)
+	}
+
+	return ok
+}
+
+// benchmark calls the function more and more times, until the calls take at least benchtime, and returns how many
+// times it was called the last round and how long that took, or the error the function returned
+func benchmark(e *evaluator.Evaluator, fn object.Object, benchtime time.Duration) (int, time.Duration, *object.Error) {
+	n := 1
+	for {
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			if err, ok := e.Call(fn).(*object.Error); ok {
+				return 0, 0, err
+			}
+		}
+		elapsed := time.Since(start)
+		if elapsed >= benchtime || n >= maxIterations {
+			return n, elapsed, nil
+		}
+
+		// aim past benchtime from how long this round took, growing at most a hundredfold at once
+		next := 100 * n
+		if elapsed > 0 {
+			next = int(1.2 * float64(n) * float64(benchtime) / float64(elapsed))
+		}
+		n = min(max(next, n+1), 100*n, maxIterations)
+	}
+}
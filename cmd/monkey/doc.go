@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"monkey/internal/diagnostics"
+	"monkey/internal/doc"
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runDoc prints the documentation of the files, and of the .mk files in the directories and their subdirectories
+// except for the tests, as Markdown or HTML. Without files, or with -builtins, it documents the builtins too.
+func runDoc(args []string) int {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+	html := flags.Bool("html", false, "print HTML instead of Markdown")
+	builtins := flags.Bool("builtins", false, "document the builtins after the files")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: monkey doc [-html] [-builtins] [file or directory ...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	filenames, err := sourceFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var pages []doc.Page
+	for _, filename := range filenames {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		p := parser.New(lexer.New(string(source)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			fmt.Fprintf(os.Stderr, "%s:\n", filename)
+			diagnostics.RenderAll(os.Stderr, string(source), p.Diagnostics())
+			return 1
+		}
+
+		pages = append(pages, doc.Page{Title: filename, Entries: doc.Program(program)})
+	}
+	if len(filenames) == 0 || *builtins {
+		pages = append(pages, doc.Page{Title: "Builtins", Entries: doc.Builtins()})
+	}
+
+	write := doc.Markdown
+	if *html {
+		write = doc.HTML
+	}
+	if err := write(os.Stdout, pages); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// sourceFiles returns the files given and the .mk files in the directories given, except for the _test.mk ones
+func sourceFiles(paths []string) ([]string, error) {
+	var filenames []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			filenames = append(filenames, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if name := d.Name(); !d.IsDir() && strings.HasSuffix(name, ".mk") && !strings.HasSuffix(name, "_test.mk") {
+				filenames = append(filenames, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return filenames, nil
+}
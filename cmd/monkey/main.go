@@ -0,0 +1,57 @@
+// Command monkey runs the tools working on Monkey programs:
+//
+//	monkey <command> [arguments]
+//
+// Run monkey without arguments for the list of commands.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a command of the tool, run with its arguments to return the exit status
+type command struct {
+	short string
+	run   func(args []string) int
+}
+
+var commands = map[string]command{
+	"ast":       {"print the parse tree of a file, as a graph with -dot or -mermaid", runAST},
+	"bench":     {"time the benchmarks of the _test.mk files", runBench},
+	"doc":       {"print the documentation of the files or of the builtins", runDoc},
+	"profile":   {"run a file timing its calls, for a report or a flame graph", runProfile},
+	"test":      {"run the tests of the _test.mk files", runTest},
+	"transpile": {"translate a file to a Go program to build into a native binary, or to JavaScript", runTranspile},
+	"vet":       {"report the suspicious constructs of the files", runVet},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "monkey: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	os.Exit(cmd.run(os.Args[2:]))
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: monkey <command> [arguments]\n\ncommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\t%-8s %s\n", name, commands[name].short)
+	}
+}
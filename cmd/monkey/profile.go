@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"monkey/internal/diagnostics"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"monkey/internal/profile"
+	"os"
+)
+
+// runProfile runs the file while timing its calls, then prints the functions taking the most time to the standard
+// error and writes the folded stacks of the calls for flame graph tools. The exit status is 1 if the file fails.
+func runProfile(args []string) int {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	strict := flags.Bool("strict", false, "require every statement to be terminated by a semicolon")
+	folded := flags.String("folded", "", "write the folded stacks of the calls to this file, for tools like flamegraph.pl")
+	top := flags.Int("top", 10, "how many functions to report, 0 for all of them")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: monkey profile [-strict] [-folded file] [-top n] file\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	filename := flags.Arg(0)
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	mode := parser.Mode(0)
+	if *strict {
+		mode |= parser.StrictSemicolons
+	}
+	p := parser.NewWithMode(lexer.New(string(source)), mode)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		diagnostics.RenderAll(os.Stdout, string(source), p.Diagnostics())
+		return 1
+	}
+
+	profiler := profile.New()
+	e := evaluator.New(evaluator.Config{Hooks: profiler.Hooks()})
+	status := 0
+	if err, ok := e.Eval(program, object.NewEnv()).(*object.Error); ok {
+		renderError(string(source), err)
+		status = 1
+	}
+
+	profiler.WriteTop(os.Stderr, *top)
+	if *folded != "" {
+		file, err := os.Create(*folded)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+
+		if err := profiler.WriteFolded(file); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	return status
+}
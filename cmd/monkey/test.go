@@ -0,0 +1,213 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"monkey/internal/ast"
+	"monkey/internal/cover"
+	"monkey/internal/diagnostics"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type (
+	// declared is a test or a benchmark a file declared with the test or the bench builtin
+	declared struct {
+		name string
+		fn   object.Object
+	}
+
+	// testRun holds the settings of a run of monkey test
+	testRun struct {
+		mode    parser.Mode
+		filter  *regexp.Regexp
+		verbose bool
+		cover   bool      // print the share of the statements of every file that ran
+		report  io.Writer // where the sources annotated with the statements that ran go, nil for nowhere
+	}
+)
+
+// runTest runs the tests the _test.mk files declare, the ones found in the directories and their subdirectories,
+// the current one by default, and the files given. Every file is evaluated in its own environment, then its tests
+// are called in the order they were declared. The exit status is 1 if a test or a file failed.
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	strict := flags.Bool("strict", false, "require every statement to be terminated by a semicolon")
+	run := flags.String("run", "", "only run the tests whose name matches this regular expression")
+	verbose := flags.Bool("v", false, "print the name of every test run, not only the ones failing")
+	cover := flags.Bool("cover", false, "print the share of the statements of every file that ran")
+	coverReport := flags.String("coverreport", "", "write the files annotated with the statements that ran to this file, - for the output")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: monkey test [-strict] [-run regexp] [-v] [-cover] [-coverreport file] [file or directory ...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey test: invalid -run: %s\n", err)
+		return 2
+	}
+	r := &testRun{filter: filter, verbose: *verbose, cover: *cover}
+	if *strict {
+		r.mode |= parser.StrictSemicolons
+	}
+	if *coverReport == "-" {
+		r.report = os.Stdout
+	} else if *coverReport != "" {
+		file, err := os.Create(*coverReport)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		r.report = file
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	filenames, err := testFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	passed, failed := 0, 0
+	for _, filename := range filenames {
+		p, f := r.file(filename)
+		passed += p
+		failed += f
+	}
+
+	fmt.Fprintf(os.Stdout, "%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// testFiles returns the files given and the _test.mk files in the directories given
+func testFiles(paths []string) ([]string, error) {
+	var filenames []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			filenames = append(filenames, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(d.Name(), "_test.mk") {
+				filenames = append(filenames, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return filenames, nil
+}
+
+// file runs the tests of the file matching the filter and returns how many passed and failed. A file that can't
+// be read, parsed or evaluated counts as one failure.
+func (r *testRun) file(filename string) (passed, failed int) {
+	var tests []declared
+	config := evaluator.Config{Test: func(name string, fn object.Object) {
+		tests = append(tests, declared{name, fn})
+	}}
+	profile := cover.New()
+	if r.cover || r.report != nil {
+		config.Hooks.Statement = profile.Record
+	}
+
+	source, program, e, ok := loadFile(filename, r.mode, config)
+	if !ok {
+		return 0, 1
+	}
+
+	for _, test := range tests {
+		if !r.filter.MatchString(test.name) {
+			continue
+		}
+
+		result := e.Call(test.fn)
+		if isError(result) {
+			fmt.Fprintf(os.Stdout, "--- FAIL: %s (%s)\n", test.name, filename)
+			renderError(source, result.(*object.Error))
+			failed++
+			continue
+		}
+
+		if r.verbose {
+			fmt.Fprintf(os.Stdout, "--- PASS: %s (%s)\n", test.name, filename)
+		}
+		passed++
+	}
+
+	if r.cover {
+		fmt.Fprintf(os.Stdout, "coverage of %s: %.1f%% of statements\n", filename, profile.Percent(program))
+	}
+	if r.report != nil {
+		fmt.Fprintf(r.report, "%s:\n", filename)
+		profile.Annotate(r.report, program, source)
+	}
+	return passed, failed
+}
+
+// loadFile evaluates the file with an evaluator of the config, in an environment of its own, and returns its source,
+// its program and the evaluator. It prints why the file failed and returns false if it can't be read, parsed or
+// evaluated.
+func loadFile(filename string, mode parser.Mode, config evaluator.Config) (string, *ast.Program, *evaluator.Evaluator, bool) {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "FAIL %s\n\t%s\n", filename, err)
+		return "", nil, nil, false
+	}
+
+	p := parser.NewWithMode(lexer.New(string(source)), mode)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprintf(os.Stdout, "FAIL %s\n", filename)
+		diagnostics.RenderAll(os.Stdout, string(source), p.Diagnostics())
+		return "", nil, nil, false
+	}
+
+	e := evaluator.New(config)
+	if result := e.Eval(program, object.NewEnv()); isError(result) {
+		fmt.Fprintf(os.Stdout, "FAIL %s\n", filename)
+		renderError(string(source), result.(*object.Error))
+		return "", nil, nil, false
+	}
+
+	return string(source), program, e, true
+}
+
+// renderError renders where the error happened in the source and the calls that led to it
+func renderError(source string, err *object.Error) {
+	if err.Token == nil {
+		fmt.Fprintf(os.Stdout, "%s\n", err.Inspect())
+		return
+	}
+
+	diagnostics.RenderTrace(os.Stdout, source, diagnostics.At(err.Token, "%s", err.Message), err.StackLines())
+}
+
+func isError(obj object.Object) bool {
+	_, ok := obj.(*object.Error)
+	return ok
+}
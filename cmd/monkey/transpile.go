@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"monkey/internal/ast"
+	"monkey/internal/diagnostics"
+	"monkey/internal/gogen"
+	"monkey/internal/jsgen"
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"os"
+)
+
+// runTranspile translates the file to the source of a program in another language, written to the output or to
+// the -o file. The exit status is 1 if the file can't be translated.
+func runTranspile(args []string) int {
+	flags := flag.NewFlagSet("transpile", flag.ExitOnError)
+	lang := flags.String("lang", "go", "the language to translate to: go or js")
+	output := flags.String("o", "", "write the source to this file instead of the output")
+	strict := flags.Bool("strict", false, "require every statement to be terminated by a semicolon")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: monkey transpile [-lang go|js] [-o file] [-strict] file\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	generate, ok := generators[*lang]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "monkey transpile: unknown language %q\n", *lang)
+		return 2
+	}
+
+	filename := flags.Arg(0)
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	mode := parser.Mode(0)
+	if *strict {
+		mode |= parser.StrictSemicolons
+	}
+	p := parser.NewWithMode(lexer.New(string(source)), mode)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprintf(os.Stderr, "%s:\n", filename)
+		diagnostics.RenderAll(os.Stderr, string(source), p.Diagnostics())
+		return 1
+	}
+
+	translated, err := generate(program, filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+		return 1
+	}
+
+	if *output == "" {
+		os.Stdout.Write(translated)
+		return 0
+	}
+	if err := os.WriteFile(*output, translated, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// generators translate programs to the languages of runTranspile
+var generators = map[string]func(program *ast.Program, name string) ([]byte, error){
+	"go": gogen.Generate,
+	"js": jsgen.Generate,
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"monkey/internal/diagnostics"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"monkey/internal/vet"
+	"os"
+)
+
+// runVet reports what package vet finds in the files, along with the errors and warnings of the parser. The exit
+// status is 1 if it reports anything.
+func runVet(args []string) int {
+	flags := flag.NewFlagSet("vet", flag.ExitOnError)
+	strict := flags.Bool("strict", false, "require every statement to be terminated by a semicolon")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: monkey vet [-strict] [file ...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	mode := parser.Mode(0)
+	if *strict {
+		mode |= parser.StrictSemicolons
+	}
+
+	status := 0
+	for _, filename := range flags.Args() {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		p := parser.NewWithMode(lexer.New(string(source)), mode)
+		program := p.ParseProgram()
+
+		ds := append(p.Diagnostics(), p.Warnings()...)
+		if len(p.Errors()) == 0 {
+			ds = append(ds, vet.Check(program, evaluator.BuiltinNames()...)...)
+		}
+		if len(ds) > 0 {
+			fmt.Fprintf(os.Stdout, "%s:\n", filename)
+			diagnostics.RenderAll(os.Stdout, string(source), ds)
+			status = 1
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is how many unchanged lines a hunk of a diff shows around the changed ones
+const contextLines = 3
+
+// edit is a line of a diff: kept, removed from the old text or added by the new one
+type edit struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff returns the unified diff turning old into new, the formatted version of the file.
+func unifiedDiff(filename, old, new string) string {
+	edits := diffLines(splitLines(old), splitLines(new))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", filename, filename)
+
+	for start := 0; start < len(edits); {
+		// a hunk goes from the context before the first change to the context after the last change close to it
+		first := start
+		for first < len(edits) && edits[first].kind == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+
+		last := first
+		for i := first; i < len(edits) && i-last <= 2*contextLines; i++ {
+			if edits[i].kind != ' ' {
+				last = i
+			}
+		}
+
+		from, to := max(first-contextLines, start), min(last+contextLines+1, len(edits))
+		writeHunk(&out, edits, from, to)
+		start = to
+	}
+
+	return out.String()
+}
+
+// writeHunk writes the edits from the index from up to to, with the lines they start at in the old and new texts
+func writeHunk(out *strings.Builder, edits []edit, from, to int) {
+	oldLine, newLine := 1, 1
+	for _, e := range edits[:from] {
+		if e.kind != '+' {
+			oldLine++
+		}
+		if e.kind != '-' {
+			newLine++
+		}
+	}
+
+	oldCount, newCount := 0, 0
+	for _, e := range edits[from:to] {
+		if e.kind != '+' {
+			oldCount++
+		}
+		if e.kind != '-' {
+			newCount++
+		}
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+	for _, e := range edits[from:to] {
+		out.WriteByte(e.kind)
+		out.WriteString(e.line)
+		out.WriteString("\n")
+	}
+}
+
+// hunkRange returns the lines of a hunk as a unified diff writes them, the line before the hunk for an empty one
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// diffLines returns the edits turning the old lines into the new ones, keeping as many lines as it can
+func diffLines(old, new []string) []edit {
+	// kept[i][j] is how many lines old[i:] and new[j:] have in common
+	kept := make([][]int, len(old)+1)
+	for i := range kept {
+		kept[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				kept[i][j] = kept[i+1][j+1] + 1
+			} else {
+				kept[i][j] = max(kept[i+1][j], kept[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && old[i] == new[j]:
+			edits = append(edits, edit{' ', old[i]})
+			i++
+			j++
+		case j == len(new) || (i < len(old) && kept[i+1][j] >= kept[i][j+1]):
+			edits = append(edits, edit{'-', old[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', new[j]})
+			j++
+		}
+	}
+
+	return edits
+}
+
+// splitLines returns the lines of the text, without their line breaks
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
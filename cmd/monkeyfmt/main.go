@@ -0,0 +1,117 @@
+// Command monkeyfmt formats Monkey source in the canonical style of package printer, like gofmt does for Go.
+//
+// Without files it formats the standard input to the standard output. The files it is given are rewritten in place,
+// unless -l or -d only check them: -l lists the files whose formatting differs, -d prints how they differ.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/internal/ast"
+	"monkey/internal/diagnostics"
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"monkey/internal/printer"
+	"os"
+)
+
+var (
+	list = flag.Bool("l", false, "list the files whose formatting differs, without rewriting them")
+	diff = flag.Bool("d", false, "print the diffs of the files whose formatting differs, without rewriting them")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: monkeyfmt [-l] [-d] [file ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		formatted, ok := format("<stdin>", string(source))
+		if !ok {
+			os.Exit(2)
+		}
+		io.WriteString(os.Stdout, formatted)
+		return
+	}
+
+	status := 0
+	for _, filename := range flag.Args() {
+		if !formatFile(filename) {
+			status = 2
+		}
+	}
+	os.Exit(status)
+}
+
+// formatFile formats the file, rewriting it or reporting how its formatting differs. It returns false if the file
+// couldn't be formatted.
+func formatFile(filename string) bool {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+
+	formatted, ok := format(filename, string(source))
+	if !ok {
+		return false
+	}
+	if formatted == string(source) {
+		return true
+	}
+
+	if *list {
+		fmt.Fprintln(os.Stdout, filename)
+	}
+	if *diff {
+		io.WriteString(os.Stdout, unifiedDiff(filename, string(source), formatted))
+	}
+	if *list || *diff {
+		return true
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	if err := os.WriteFile(filename, []byte(formatted), info.Mode().Perm()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+
+	return true
+}
+
+// format returns the source formatted, or reports why it can't be and returns false: a source that doesn't parse
+// isn't formatted, and neither is one the printer would change the meaning of.
+func format(filename, source string) (string, bool) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprintf(os.Stderr, "%s:\n", filename)
+		diagnostics.RenderAll(os.Stderr, source, p.Diagnostics())
+		return "", false
+	}
+
+	var out bytes.Buffer
+	printer.Fprint(&out, program)
+
+	reparsed := parser.New(lexer.New(out.String()))
+	if !ast.Equal(program, reparsed.ParseProgram()) || len(reparsed.Errors()) != 0 {
+		fmt.Fprintf(os.Stderr, "%s: formatting would change what the program means, leaving it as it is\n", filename)
+		return "", false
+	}
+
+	return out.String(), true
+}
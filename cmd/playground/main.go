@@ -0,0 +1,97 @@
+//go:build js && wasm
+
+// Command playground runs Monkey in the browser. Built for js/wasm, it exposes a monkey object to JavaScript with
+// the functions of the playground page:
+//
+//	monkey.lex(source)    // the tokens: [{type, literal, line, column}, ...]
+//	monkey.parse(source)  // {program, errors}: the program in the canonical style and the parse errors
+//	monkey.eval(source)   // {output, result, errors}: what it printed, its value and the errors
+//
+// Programs are evaluated in a sandbox, as the page has no input for them to read.
+package main
+
+import (
+	"bytes"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"monkey/internal/printer"
+	"monkey/internal/token"
+	"syscall/js"
+)
+
+func main() {
+	js.Global().Set("monkey", js.ValueOf(map[string]interface{}{
+		"lex":   js.FuncOf(lex),
+		"parse": js.FuncOf(parse),
+		"eval":  js.FuncOf(eval),
+	}))
+
+	select {} // the functions are called for as long as the page is open
+}
+
+func lex(this js.Value, args []js.Value) interface{} {
+	l := lexer.New(source(args))
+
+	var tokens []interface{}
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		tokens = append(tokens, map[string]interface{}{
+			"type":    tok.Type,
+			"literal": tok.Literal,
+			"line":    tok.Line,
+			"column":  tok.Column,
+		})
+	}
+
+	return tokens
+}
+
+func parse(this js.Value, args []js.Value) interface{} {
+	p := parser.New(lexer.New(source(args)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return map[string]interface{}{"program": "", "errors": diagnostics(p)}
+	}
+
+	return map[string]interface{}{"program": printer.Sprint(program), "errors": []interface{}{}}
+}
+
+func eval(this js.Value, args []js.Value) interface{} {
+	p := parser.New(lexer.New(source(args)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return map[string]interface{}{"output": "", "result": "", "errors": diagnostics(p)}
+	}
+
+	var out bytes.Buffer
+	e := evaluator.New(evaluator.Config{Stdout: &out, Stdin: &bytes.Buffer{}, Sandbox: &evaluator.Sandbox{}})
+	result := e.Eval(program, object.NewEnv())
+
+	response := map[string]interface{}{"output": out.String(), "result": "", "errors": []interface{}{}}
+	if err, ok := result.(*object.Error); ok {
+		response["errors"] = []interface{}{err.Inspect()}
+	} else if result != nil {
+		response["result"] = result.Inspect()
+	}
+	return response
+}
+
+// source returns the source the function was called with
+func source(args []js.Value) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	return args[0].String()
+}
+
+// diagnostics returns the errors of the parser, one string each
+func diagnostics(p *parser.Parser) []interface{} {
+	var errors []interface{}
+	for _, d := range p.Diagnostics() {
+		errors = append(errors, d.String())
+	}
+
+	return errors
+}
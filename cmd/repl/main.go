@@ -2,21 +2,41 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
+	"monkey/internal/ast"
+	"monkey/internal/compiler"
+	"monkey/internal/diagnostics"
 	"monkey/internal/evaluator"
 	"monkey/internal/lexer"
 	"monkey/internal/object"
 	"monkey/internal/parser"
+	"monkey/internal/vm"
 	"os"
 	user "os/user"
+	"strings"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
+var engine = flag.String("engine", "eval", "what runs the lines: eval walks their tree, vm compiles them to bytecode for the virtual machine")
+
+// the commands of the repl, which aren't evaluated
+const (
+	undoCommand  = ":undo"  // forget what the last line that was evaluated did to the environment
+	resetCommand = ":reset" // forget everything
+	saveCommand  = ":save"  // :save file writes the environment to the file
+	loadCommand  = ":load"  // :load file reads the environment written by :save back
+)
+
+// Start runs the lines read from in, with the evaluator or with the virtual machine if engine is "vm".
+func Start(in io.Reader, out io.Writer, engine string) {
 	scanner := bufio.NewScanner(in)
 	environment := object.NewEnv()
+	e := evaluator.New(evaluator.Config{Stdout: out})
+	history := []*object.Snapshot{environment.Snapshot()} // the environment before every line evaluated
+	machine := newMachine()
 
 	for {
 		fmt.Fprintf(out, PROMPT)
@@ -26,30 +46,116 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		line := scanner.Text()
+		if engine == "vm" {
+			if command, _, _ := strings.Cut(strings.TrimSpace(line), " "); command == resetCommand {
+				machine = newMachine()
+				continue
+			} else if command == undoCommand || command == saveCommand || command == loadCommand {
+				fmt.Fprintf(out, "%s: not supported by the vm engine\n", command)
+				continue
+			}
+		}
+
+		switch strings.TrimSpace(line) {
+		case undoCommand:
+			if len(history) > 1 {
+				environment.Restore(history[len(history)-1])
+				history = history[:len(history)-1]
+			}
+			continue
+		case resetCommand:
+			environment.Restore(history[0])
+			history = history[:1]
+			continue
+		}
+		if command, filename, ok := strings.Cut(strings.TrimSpace(line), " "); ok && (command == saveCommand || command == loadCommand) {
+			if err := saveOrLoad(environment, command, strings.TrimSpace(filename)); err != nil {
+				fmt.Fprintf(out, "%s: %s\n", command, err)
+			}
+			continue
+		}
+
 		l := lexer.New(line)
 		p := parser.New(l)
 
 		program := p.ParseProgram()
+		diagnostics.RenderAll(out, line, p.Warnings())
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			diagnostics.RenderAll(out, line, p.Diagnostics())
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, environment)
-		if evaluated != nil {
+		var evaluated object.Object
+		if engine == "vm" {
+			evaluated = machine.run(program, line, e, out)
+		} else {
+			history = append(history, environment.Snapshot())
+			evaluated = e.Eval(program, environment)
+		}
+		if err, ok := evaluated.(*object.Error); ok && err.Token != nil {
+			diagnostics.RenderTrace(out, line, diagnostics.At(err.Token, "%s", err.Message), err.StackLines())
+		} else if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
 	}
 }
 
-func printParserErrors(out io.Writer, errs []string) {
-	for _, msg := range errs {
-		io.WriteString(out, "\t"+msg+"\n")
+// machine keeps the state of the compiler and of the virtual machine from one line to the next
+type machine struct {
+	symbols   *compiler.SymbolTable
+	constants []object.Object
+	globals   []object.Object
+}
+
+func newMachine() *machine {
+	return &machine{symbols: compiler.NewSymbolTable(), globals: make([]object.Object, compiler.GlobalsSize)}
+}
+
+// run compiles the program and runs it on the virtual machine. It writes why to out and returns nil if the program
+// can't be compiled.
+func (m *machine) run(program *ast.Program, line string, e *evaluator.Evaluator, out io.Writer) object.Object {
+	c := compiler.NewWithState(m.symbols, m.constants)
+	if err := c.Compile(program); err != nil {
+		compiler.RenderError(out, line, err)
+		return nil
+	}
+	m.constants = c.Bytecode().Constants
+
+	return vm.NewWithGlobals(c.Bytecode(), e, m.globals).Run()
+}
+
+// saveOrLoad saves the environment to the file, or loads it from the file
+func saveOrLoad(environment *object.Environment, command, filename string) error {
+	if command == loadCommand {
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return environment.Load(file)
 	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := environment.Save(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
 }
 
 func main() {
+	flag.Parse()
+	if *engine != "eval" && *engine != "vm" {
+		fmt.Fprintf(os.Stderr, "unknown engine %q: want eval or vm\n", *engine)
+		os.Exit(2)
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		fmt.Printf(err.Error())
@@ -58,5 +164,5 @@ func main() {
 
 	fmt.Printf("Hello %s! this is the Monkey programming language!\n", user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	Start(os.Stdin, os.Stdout)
+	Start(os.Stdin, os.Stdout, *engine)
 }
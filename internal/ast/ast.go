@@ -26,9 +26,61 @@ type (
 	// Program is the root node of any program we will every parse. Statements are what a program composed of.
 	Program struct {
 		Statements []Statement
+		Comments   []*CommentGroup // every comment in the source, in order, including unattached ones
+	}
+
+	// Comment is a single `//` comment, or a `///` doc comment. Text holds the comment including the leading
+	// slashes.
+	Comment struct {
+		Token *token.Token
+		Text  string
+	}
+
+	// CommentGroup is a run of comments with no statement between them.
+	CommentGroup struct {
+		List []*Comment
+	}
+
+	// CommentAttachment holds the comments the parser attached to a statement. It is embedded by the statements
+	// that can carry comments.
+	CommentAttachment struct {
+		Leading  *CommentGroup // comments on the lines before the statement
+		Trailing *CommentGroup // comments after the statement on the line it ends on
+
+		// Doc holds the `///` comments ending the leading ones, which document what the statement declares,
+		// like the function of a let. They are part of Leading too.
+		Doc *CommentGroup
+	}
+
+	// Commented is implemented by every statement that comments can be attached to.
+	Commented interface {
+		Statement
+		Comments() *CommentAttachment
 	}
 )
 
+// Comments returns the comments attached to the statement.
+func (c *CommentAttachment) Comments() *CommentAttachment { return c }
+
+// Text returns the text of the comment group with the comment markers, `//`, `///` or `/* */`, and surrounding
+// spaces removed, one line per comment, or more for a block comment spanning lines.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+
+	lines := make([]string, 0, len(g.List))
+	for _, c := range g.List {
+		if strings.HasPrefix(c.Text, "/*") {
+			lines = append(lines, strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(c.Text, "/*"), "*/")))
+			continue
+		}
+		lines = append(lines, strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(c.Text, "//"), "/")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 func (p *Program) TokenLiteral() string {
 	if len(p.Statements) == 0 {
 		return ""
@@ -52,6 +104,7 @@ type (
 
 	// LetStatement is a let declaration ast node
 	LetStatement struct {
+		CommentAttachment
 		Token *token.Token // the token to which this statement points to
 		Name  Expression   // name of the variable
 		Value Expression
@@ -59,9 +112,29 @@ type (
 
 	// ReturnStatement is a return statement ast node
 	ReturnStatement struct {
+		CommentAttachment
 		Token       *token.Token // the token to which this statement points to
 		ReturnValue Expression
 	}
+	// BreakStatement ends the innermost loop it is in
+	BreakStatement struct {
+		CommentAttachment
+		Token *token.Token
+	}
+
+	// ContinueStatement goes on with the next iteration of the innermost loop it is in
+	ContinueStatement struct {
+		CommentAttachment
+		Token *token.Token
+	}
+
+	// ThrowStatement like "throw x;", failing with the value for a catch to handle
+	ThrowStatement struct {
+		CommentAttachment
+		Token *token.Token // the throw token
+		Value Expression
+	}
+
 	// ExpressionStatement is any type of expression
 	// ex:
 	// foobar;
@@ -69,6 +142,7 @@ type (
 	// 1 + 1;
 	// 1 + add(1, foobar);
 	ExpressionStatement struct {
+		CommentAttachment
 		Token      *token.Token // the first token of the expression
 		Expression Expression
 	}
@@ -82,8 +156,9 @@ type (
 	}
 
 	BlockStatement struct {
-		Token      *token.Token
+		Token      *token.Token // the {
 		Statements []Statement
+		Rbrace     *token.Token // the closing }, nil for blocks that weren't parsed
 	}
 
 	Boolean struct {
@@ -101,6 +176,11 @@ type (
 		Value string
 	}
 
+	FloatLiteral struct {
+		Token *token.Token
+		Value float64
+	}
+
 	FunctionLiteral struct {
 		Token      *token.Token
 		Parameters []*Identifier
@@ -139,6 +219,33 @@ type (
 		Alternative *BlockStatement
 	}
 
+	// AssignExpression like "i = i + 1", giving a new value to a variable that was already declared, or like
+	// "h.name = v" and "h[key] = v", setting a key of a hash
+	AssignExpression struct {
+		Token  *token.Token // the = token
+		Target Expression   // an *Identifier, or an *IndexExpression for a key of a hash
+		Value  Expression
+	}
+
+	// TryExpression like "try { ... } catch (e) { ... } finally { ... }", having at least one of the catch and
+	// finally blocks. Param is the name the catch block gets the thrown value as, nil without a catch block.
+	TryExpression struct {
+		Token   *token.Token // the try token
+		Body    *BlockStatement
+		Param   *Identifier
+		Catch   *BlockStatement
+		Finally *BlockStatement
+	}
+
+	// ForExpression like "for (let i = 0; i < 10; i = i + 1) { ... }", any of the three clauses can be left out
+	ForExpression struct {
+		Token     *token.Token
+		Init      Statement // a let or expression statement, nil if left out
+		Condition Expression
+		Post      Expression
+		Body      *BlockStatement
+	}
+
 	IndexExpression struct {
 		Token *token.Token
 		Left  Expression
@@ -181,6 +288,18 @@ func (r *ReturnStatement) String() string {
 	return out.String()
 }
 
+func (b *BreakStatement) statementNode()       {}
+func (b *BreakStatement) TokenLiteral() string { return b.Token.Literal }
+func (b *BreakStatement) String() string       { return "break;" }
+
+func (c *ContinueStatement) statementNode()       {}
+func (c *ContinueStatement) TokenLiteral() string { return c.Token.Literal }
+func (c *ContinueStatement) String() string       { return "continue;" }
+
+func (t *ThrowStatement) statementNode()       {}
+func (t *ThrowStatement) TokenLiteral() string { return t.Token.Literal }
+func (t *ThrowStatement) String() string       { return "throw " + t.Value.String() + ";" }
+
 func (r *ExpressionStatement) statementNode()       {}
 func (r *ExpressionStatement) TokenLiteral() string { return r.Token.Literal }
 func (e *ExpressionStatement) String() string {
@@ -199,6 +318,10 @@ func (i *IntegerLiteral) expressionNode()      {}
 func (i *IntegerLiteral) TokenLiteral() string { return i.Token.Literal }
 func (i *IntegerLiteral) String() string       { return i.Token.Literal }
 
+func (f *FloatLiteral) expressionNode()      {}
+func (f *FloatLiteral) TokenLiteral() string { return f.Token.Literal }
+func (f *FloatLiteral) String() string       { return f.Token.Literal }
+
 func (i *StringLiteral) expressionNode()      {}
 func (i *StringLiteral) TokenLiteral() string { return i.Token.Literal }
 func (i *StringLiteral) String() string       { return i.Token.Literal }
@@ -241,12 +364,58 @@ func (i *IfExpression) String() string {
 	out.WriteString(" ")
 	out.WriteString(i.Consequence.String())
 	if i.Alternative != nil {
-		out.WriteString("else ")
+		out.WriteString(" else ")
 		out.WriteString(i.Alternative.String())
 	}
 
 	return out.String()
 }
+
+func (a *AssignExpression) expressionNode()      {}
+func (a *AssignExpression) TokenLiteral() string { return a.Token.Literal }
+func (a *AssignExpression) String() string {
+	return "(" + a.Target.String() + " = " + a.Value.String() + ")"
+}
+
+func (t *TryExpression) expressionNode()      {}
+func (t *TryExpression) TokenLiteral() string { return t.Token.Literal }
+func (t *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try " + t.Body.String())
+	if t.Catch != nil {
+		out.WriteString(" catch (" + t.Param.String() + ") " + t.Catch.String())
+	}
+	if t.Finally != nil {
+		out.WriteString(" finally " + t.Finally.String())
+	}
+
+	return out.String()
+}
+
+func (f *ForExpression) expressionNode()      {}
+func (f *ForExpression) TokenLiteral() string { return f.Token.Literal }
+func (f *ForExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if f.Init != nil {
+		out.WriteString(strings.TrimSuffix(f.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if f.Condition != nil {
+		out.WriteString(f.Condition.String())
+	}
+	out.WriteString("; ")
+	if f.Post != nil {
+		out.WriteString(f.Post.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(f.Body.String())
+
+	return out.String()
+}
+
 func (i *FunctionLiteral) expressionNode()      {}
 func (i *FunctionLiteral) TokenLiteral() string { return i.Token.Literal }
 func (i *FunctionLiteral) String() string {
@@ -270,11 +439,9 @@ func (i *BlockStatement) statementNode()       {}
 func (i *BlockStatement) TokenLiteral() string { return i.Token.Literal }
 func (i *BlockStatement) String() string {
 	var out bytes.Buffer
-	out.WriteString("{\n")
 	for _, s := range i.Statements {
-		out.WriteString("\t" + s.String() + "\n")
+		out.WriteString(s.String())
 	}
-	out.WriteString("}\n")
 
 	return out.String()
 }
@@ -319,6 +486,10 @@ func (i *IndexExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(i.Left.String())
+	if i.Token != nil && i.Token.Type == token.PERIOD {
+		out.WriteString("." + i.Index.String() + ")")
+		return out.String()
+	}
 	out.WriteString("[")
 	out.WriteString(i.Index.String())
 	out.WriteString("])")
@@ -332,8 +503,8 @@ func (i *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	vals := make([]string, 0, len(i.Hash))
-	for key, value := range i.Hash {
-		vals = append(vals, fmt.Sprintf("%s: %s", key, value))
+	for _, key := range i.Keys() {
+		vals = append(vals, fmt.Sprintf("%s: %s", key, i.Hash[key]))
 	}
 
 	out.WriteString("{")
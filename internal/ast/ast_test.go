@@ -1,7 +1,10 @@
 package ast
 
 import (
+	"fmt"
+	"math"
 	"monkey/internal/token"
+	"strings"
 	"testing"
 )
 
@@ -26,3 +29,368 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. get=%q", program.String())
 	}
 }
+
+func TestInspect(t *testing.T) {
+	tok := func(literal string) *token.Token { return &token.Token{Literal: literal} }
+	x := &Identifier{Token: tok("x"), Value: "x"}
+
+	// let f = fn(x) { if (x) { -x } else { [x, {"k": 1}][0] } }; f(2)
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: tok("let"),
+				Name:  &Identifier{Token: tok("f"), Value: "f"},
+				Value: &FunctionLiteral{
+					Token:      tok("fn"),
+					Parameters: []*Identifier{x},
+					Body: &BlockStatement{Token: tok("{"), Statements: []Statement{
+						&ExpressionStatement{Token: tok("if"), Expression: &IfExpression{
+							Token:     tok("if"),
+							Condition: x,
+							Consequence: &BlockStatement{Token: tok("{"), Statements: []Statement{
+								&ExpressionStatement{Token: tok("-"), Expression: &PrefixExpression{Token: tok("-"), Operator: "-", Right: x}},
+							}},
+							Alternative: &BlockStatement{Token: tok("{"), Statements: []Statement{
+								&ExpressionStatement{Token: tok("["), Expression: &IndexExpression{
+									Token: tok("["),
+									Left: &ArrayLiteral{Token: tok("["), Elements: []Expression{
+										x,
+										&HashLiteral{Token: tok("{"), Hash: map[Expression]Expression{
+											&StringLiteral{Token: tok("k"), Value: "k"}: &IntegerLiteral{Token: tok("1"), Value: 1},
+										}},
+									}},
+									Index: &IntegerLiteral{Token: tok("0"), Value: 0},
+								}},
+							}},
+						}},
+					}},
+				},
+			},
+			&ExpressionStatement{Token: tok("f"), Expression: &CallExpression{
+				Token:     tok("("),
+				Function:  &Identifier{Token: tok("f"), Value: "f"},
+				Arguments: []Expression{&InfixExpression{Token: tok("+"), Operator: "+", Left: &IntegerLiteral{Token: tok("1"), Value: 1}, Right: &Boolean{Token: tok("true"), Value: true}}},
+			}},
+		},
+	}
+
+	var visited []string
+	depth, maxDepth := 0, 0
+	Inspect(program, func(node Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		visited = append(visited, fmt.Sprintf("%T", node)[5:])
+		return true
+	})
+
+	expected := []string{
+		"Program", "LetStatement", "Identifier", "FunctionLiteral", "Identifier", "BlockStatement",
+		"ExpressionStatement", "IfExpression", "Identifier", "BlockStatement", "ExpressionStatement",
+		"PrefixExpression", "Identifier", "BlockStatement", "ExpressionStatement", "IndexExpression", "ArrayLiteral",
+		"Identifier", "HashLiteral", "StringLiteral", "IntegerLiteral", "IntegerLiteral", "ExpressionStatement",
+		"CallExpression", "Identifier", "InfixExpression", "IntegerLiteral", "Boolean",
+	}
+	if strings.Join(visited, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong visiting order.\nexpected=%v\ngot=     %v", expected, visited)
+	}
+
+	if depth != 0 || maxDepth != 12 {
+		t.Errorf("unbalanced or wrong depth. got depth=%d max=%d", depth, maxDepth)
+	}
+
+	// returning false skips the children
+	count := 0
+	Inspect(program, func(node Node) bool {
+		if node != nil {
+			count++
+		}
+		_, isFn := node.(*FunctionLiteral)
+		return !isFn
+	})
+	if count != 10 {
+		t.Errorf("expected 10 nodes outside of the function body. got=%d", count)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tok := func(literal string) *token.Token { return &token.Token{Literal: literal} }
+	ident := func(name string) *Identifier { return &Identifier{Token: tok(name), Value: name} }
+	integer := func(value int64) *IntegerLiteral {
+		return &IntegerLiteral{Token: tok(fmt.Sprint(value)), Value: value}
+	}
+
+	// let x = 1 + 2; drop; fn(a) { a * (3 + 4) }; [x]
+	kept := &ExpressionStatement{Token: tok("["), Expression: &ArrayLiteral{Token: tok("["), Elements: []Expression{ident("x")}}}
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: tok("let"),
+				Name:  ident("x"),
+				Value: &InfixExpression{Token: tok("+"), Operator: "+", Left: integer(1), Right: integer(2)},
+			},
+			&ExpressionStatement{Token: tok("drop"), Expression: ident("drop")},
+			&ExpressionStatement{Token: tok("fn"), Expression: &FunctionLiteral{
+				Token:      tok("fn"),
+				Parameters: []*Identifier{ident("a")},
+				Body: &BlockStatement{Token: tok("{"), Statements: []Statement{
+					&ExpressionStatement{Token: tok("a"), Expression: &InfixExpression{
+						Token:    tok("*"),
+						Operator: "*",
+						Left:     ident("a"),
+						Right:    &InfixExpression{Token: tok("+"), Operator: "+", Left: integer(3), Right: integer(4)},
+					}},
+				}},
+			}},
+			kept,
+		},
+	}
+	before := program.String()
+
+	rewritten := Rewrite(program, func(node Node) Node {
+		switch node := node.(type) {
+		case *InfixExpression:
+			// the operands were rewritten first, so nested sums fold too
+			left, lok := node.Left.(*IntegerLiteral)
+			right, rok := node.Right.(*IntegerLiteral)
+			if lok && rok && node.Operator == "+" {
+				return integer(left.Value + right.Value)
+			}
+		case *ExpressionStatement:
+			if ident, ok := node.Expression.(*Identifier); ok && ident.Value == "drop" {
+				return nil
+			}
+		case *Identifier:
+			if node.Value == "a" {
+				return ident("b")
+			}
+		}
+		return node
+	}).(*Program)
+
+	if got := rewritten.String(); got != "let x = 3;fn(b)(b * 7)[x]" {
+		t.Errorf("wrong rewritten program. got=%q", got)
+	}
+	if program.String() != before {
+		t.Errorf("the original program was modified. got=%q", program.String())
+	}
+	if rewritten.Statements[2] != kept {
+		t.Errorf("unchanged statements should be shared with the original program")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic replacing an expression with a statement")
+		}
+	}()
+	Rewrite(program, func(node Node) Node {
+		if _, ok := node.(*IntegerLiteral); ok {
+			return &ExpressionStatement{Token: tok("x"), Expression: ident("x")}
+		}
+		return node
+	})
+}
+
+func TestCloneAndEqual(t *testing.T) {
+	tok := func(literal string, offset int) *token.Token { return &token.Token{Literal: literal, Offset: offset} }
+	comment := &CommentGroup{List: []*Comment{{Token: tok("// c", 0), Text: "// c"}}}
+
+	// // c
+	// let h = {"a": 1, "b": fn(x) { if (x) { x } }};
+	let := &LetStatement{
+		CommentAttachment: CommentAttachment{Leading: comment},
+		Token:             tok("let", 5),
+		Name:              &Identifier{Token: tok("h", 9), Value: "h"},
+		Value: &HashLiteral{Token: tok("{", 13), Hash: map[Expression]Expression{
+			&StringLiteral{Token: tok("a", 14), Value: "a"}: &IntegerLiteral{Token: tok("1", 19), Value: 1},
+			&StringLiteral{Token: tok("b", 22), Value: "b"}: &FunctionLiteral{
+				Token:      tok("fn", 27),
+				Parameters: []*Identifier{{Token: tok("x", 30), Value: "x"}},
+				Body: &BlockStatement{Token: tok("{", 33), Statements: []Statement{
+					&ExpressionStatement{Token: tok("if", 35), Expression: &IfExpression{
+						Token:     tok("if", 35),
+						Condition: &Identifier{Token: tok("x", 39), Value: "x"},
+						Consequence: &BlockStatement{Token: tok("{", 42), Statements: []Statement{
+							&ExpressionStatement{Token: tok("x", 44), Expression: &Identifier{Token: tok("x", 44), Value: "x"}},
+						}},
+					}},
+				}},
+			},
+		}},
+	}
+	program := &Program{Statements: []Statement{let}, Comments: []*CommentGroup{comment}}
+
+	clone := program.Clone()
+	if !Equal(program, clone) || clone.String() != program.String() {
+		t.Fatalf("the clone differs from the original. got=%q", clone.String())
+	}
+
+	cloned := clone.Statements[0].(*LetStatement)
+	if cloned == let || cloned.Token == let.Token || cloned.Value == let.Value {
+		t.Errorf("the clone shares nodes or tokens with the original")
+	}
+	if cloned.Leading == comment || cloned.Leading != clone.Comments[0] {
+		t.Errorf("the comment groups of the clone should be copies shared by the statement and the program")
+	}
+
+	cloned.Token.Offset = 100
+	cloned.Name.(*Identifier).Value = "g"
+	if let.Token.Offset != 5 || let.Name.(*Identifier).Value != "h" {
+		t.Errorf("changing the clone changed the original")
+	}
+	if Equal(program, clone) {
+		t.Errorf("expected the renamed clone to differ from the original")
+	}
+
+	// positions and the order of hash pairs don't matter
+	a := &HashLiteral{Token: tok("{", 0), Hash: map[Expression]Expression{
+		&Identifier{Token: tok("k", 1), Value: "k"}:    &Boolean{Token: tok("true", 4), Value: true},
+		&IntegerLiteral{Token: tok("2", 10), Value: 2}: &Boolean{Token: tok("false", 13), Value: false},
+	}}
+	b := &HashLiteral{Token: tok("{", 50), Hash: map[Expression]Expression{
+		&IntegerLiteral{Token: tok("2", 51), Value: 2}: &Boolean{Token: tok("false", 54), Value: false},
+		&Identifier{Token: tok("k", 61), Value: "k"}:   &Boolean{Token: tok("true", 64), Value: true},
+	}}
+	if !Equal(a, b) {
+		t.Errorf("expected hashes with the same pairs to be equal")
+	}
+
+	tests := []struct {
+		a, b Node
+	}{
+		{&IntegerLiteral{Value: 1}, &IntegerLiteral{Value: 2}},
+		{&IntegerLiteral{Value: 1}, &StringLiteral{Value: "1"}},
+		{&PrefixExpression{Operator: "-", Right: &IntegerLiteral{Value: 1}}, &PrefixExpression{Operator: "!", Right: &IntegerLiteral{Value: 1}}},
+		{&IfExpression{Condition: &Boolean{Value: true}, Consequence: &BlockStatement{}},
+			&IfExpression{Condition: &Boolean{Value: true}, Consequence: &BlockStatement{}, Alternative: &BlockStatement{}}},
+		{&CallExpression{Function: &Identifier{Value: "f"}}, &CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{&Identifier{Value: "x"}}}},
+	}
+
+	for _, tt := range tests {
+		if Equal(tt.a, tt.b) || Equal(tt.b, tt.a) {
+			t.Errorf("expected %T %q and %T %q to differ", tt.a, tt.a.String(), tt.b, tt.b.String())
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	at := func(literal string) *token.Token { return &token.Token{Literal: literal, Line: 1, Column: 1} }
+	integer := func(value int64) Expression { return &IntegerLiteral{Token: at(fmt.Sprint(value)), Value: value} }
+	str := func(value string) Expression { return &StringLiteral{Token: at(value), Value: value} }
+	boolean := func(value bool) Expression { return &Boolean{Token: at(fmt.Sprint(value)), Value: value} }
+	infix := func(left Expression, operator string, right Expression) Expression {
+		return &InfixExpression{Token: at(operator), Operator: operator, Left: left, Right: right}
+	}
+	prefix := func(operator string, right Expression) Expression {
+		return &PrefixExpression{Token: at(operator), Operator: operator, Right: right}
+	}
+	x := &Identifier{Token: at("x"), Value: "x"}
+
+	tests := []struct {
+		exp      Expression
+		expected Expression
+	}{
+		{infix(infix(integer(2), "*", integer(3)), "+", integer(1)), integer(7)},
+		{prefix("!", infix(infix(integer(2), "*", integer(3)), "==", integer(6))), boolean(false)},
+		{prefix("-", infix(integer(1), "-", integer(3))), integer(2)},
+		{infix(str("a"), "+", infix(str("b"), "*", integer(2))), str("abb")},
+		{infix(str("a"), "!=", str("b")), boolean(true)},
+		{infix(boolean(true), "!=", boolean(false)), boolean(true)},
+		{infix(boolean(true), ">", boolean(false)), boolean(true)},
+		{infix(boolean(true), "<", boolean(false)), boolean(false)},
+		{infix(boolean(false), "<", boolean(true)), boolean(true)},
+		{prefix("!", str("")), boolean(false)},
+		{infix(x, "+", infix(integer(1), "+", integer(1))), infix(x, "+", integer(2))},
+		// these fail at run time, and still should
+		{infix(integer(1), "/", infix(integer(1), "-", integer(1))), infix(integer(1), "/", integer(0))},
+		{infix(integer(1), "+", boolean(true)), infix(integer(1), "+", boolean(true))},
+		{infix(str("a"), "*", integer(-1)), infix(str("a"), "*", integer(-1))},
+		// and these when the evaluator checks integers
+		{infix(integer(math.MaxInt64), "+", integer(1)), infix(integer(math.MaxInt64), "+", integer(1))},
+		{infix(integer(math.MinInt64), "-", integer(1)), infix(integer(math.MinInt64), "-", integer(1))},
+		{infix(integer(1<<62), "*", integer(2)), infix(integer(1<<62), "*", integer(2))},
+		{infix(integer(math.MinInt64), "/", integer(-1)), infix(integer(math.MinInt64), "/", integer(-1))},
+		{prefix("-", infix(integer(-math.MaxInt64), "-", integer(1))), prefix("-", integer(math.MinInt64))},
+	}
+
+	for _, tt := range tests {
+		program := &Program{Statements: []Statement{&ExpressionStatement{Token: at(""), Expression: tt.exp}}}
+		before := program.String()
+
+		folded := Fold(program).Statements[0].(*ExpressionStatement).Expression
+		if !Equal(folded, tt.expected) {
+			t.Errorf("wrong fold of %s. expected=%s, got=%s", before, tt.expected, folded)
+		}
+		if program.String() != before {
+			t.Errorf("Fold changed the program to %s", program.String())
+		}
+		if tok := TokenOf(folded); tok == nil || tok.Line != 1 {
+			t.Errorf("folded %s lost its position", before)
+		}
+	}
+
+	// FoldScalars leaves the strings to build at run time, but not the booleans comparing them
+	exp := infix(infix(str("a"), "*", integer(2)), "==", str("aa"))
+	program := &Program{Statements: []Statement{&ExpressionStatement{Token: at(""), Expression: exp}}}
+	if folded := FoldScalars(program).Statements[0].(*ExpressionStatement).Expression; !Equal(folded, exp) {
+		t.Errorf("wrong scalar fold of %s. got=%s", exp, folded)
+	}
+	exp = infix(str("a"), "==", str("a"))
+	program = &Program{Statements: []Statement{&ExpressionStatement{Token: at(""), Expression: exp}}}
+	if folded := FoldScalars(program).Statements[0].(*ExpressionStatement).Expression; !Equal(folded, boolean(true)) {
+		t.Errorf("wrong scalar fold of %s. got=%s", exp, folded)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	line := 0
+	at := func(literal string) *token.Token { return &token.Token{Literal: literal, Line: line, Column: 1} }
+	ident := func(name string) *Identifier { return &Identifier{Token: at(name), Value: name} }
+	integer := func(value int64) *IntegerLiteral { return &IntegerLiteral{Token: at(fmt.Sprint(value)), Value: value} }
+	let := func(name string, value Expression) Statement {
+		line++
+		return &LetStatement{Token: at("let"), Name: ident(name), Value: value}
+	}
+	call := func(args ...Expression) Statement {
+		line++
+		return &ExpressionStatement{Token: at("f"), Expression: &CallExpression{Token: at("("), Function: ident("f"), Arguments: args}}
+	}
+
+	// let a = 1; let b = 2; f(a, b)
+	old := &Program{Statements: []Statement{let("a", integer(1)), let("b", integer(2)), call(ident("a"), ident("b"))}}
+
+	// let a = 1; let c = 0; let b = 3; f(a)
+	line = 10
+	new := &Program{Statements: []Statement{let("a", integer(1)), let("c", integer(0)), let("b", integer(3)), call(ident("a"))}}
+
+	var got []string
+	for _, change := range Diff(old, new) {
+		got = append(got, change.String())
+	}
+
+	expected := []string{
+		"12:1: added let c = 0;",
+		"1:1: changed 2 to 3 at 12:1", // literals are created before the line of their statement is counted
+		"2:1: removed b",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong changes.\nexpected=%q\ngot=     %q", expected, got)
+	}
+
+	if changes := Diff(old, Clone(old)); changes != nil {
+		t.Errorf("expected no changes between a tree and its clone. got=%v", changes)
+	}
+
+	// a change of operator is a change of the whole expression
+	sum := &InfixExpression{Token: at("+"), Operator: "+", Left: ident("x"), Right: integer(1)}
+	product := &InfixExpression{Token: at("*"), Operator: "*", Left: ident("x"), Right: integer(1)}
+	if changes := Diff(sum, product); len(changes) != 1 || changes[0].Kind != Changed || changes[0].Old != sum {
+		t.Errorf("expected the infix expression to change. got=%v", changes)
+	}
+}
@@ -0,0 +1,234 @@
+package ast
+
+import "monkey/internal/token"
+
+// Clone returns a deep copy of the node: every node, token and attached comment is copied, so nothing the copy
+// points to is shared with the original. Clone(nil) returns nil.
+func Clone(node Node) Node {
+	c := cloner{tokens: map[*token.Token]*token.Token{}, groups: map[*CommentGroup]*CommentGroup{}}
+	return c.node(node)
+}
+
+// Clone returns a deep copy of the program, see Clone.
+func (p *Program) Clone() *Program {
+	return Clone(p).(*Program)
+}
+
+// cloner copies tokens and comment groups only once, so what the original shares, like the comment groups of a
+// program and its statements, the copy shares as well
+type cloner struct {
+	tokens map[*token.Token]*token.Token
+	groups map[*CommentGroup]*CommentGroup
+}
+
+func (c *cloner) token(tok *token.Token) *token.Token {
+	if tok == nil {
+		return nil
+	}
+
+	if copied, ok := c.tokens[tok]; ok {
+		return copied
+	}
+
+	copied := *tok
+	c.tokens[tok] = &copied
+	return &copied
+}
+
+func (c *cloner) group(group *CommentGroup) *CommentGroup {
+	if group == nil {
+		return nil
+	}
+
+	if copied, ok := c.groups[group]; ok {
+		return copied
+	}
+
+	copied := &CommentGroup{List: make([]*Comment, len(group.List))}
+	for i, comment := range group.List {
+		copied.List[i] = &Comment{Token: c.token(comment.Token), Text: comment.Text}
+	}
+
+	c.groups[group] = copied
+	return copied
+}
+
+func (c *cloner) comments(attachment CommentAttachment) CommentAttachment {
+	return CommentAttachment{
+		Leading:  c.group(attachment.Leading),
+		Trailing: c.group(attachment.Trailing),
+		Doc:      c.group(attachment.Doc),
+	}
+}
+
+func (c *cloner) node(node Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		return c.program(n)
+	case Statement:
+		return c.statement(n)
+	case Expression:
+		return c.expression(n)
+	default:
+		return nil
+	}
+}
+
+func (c *cloner) program(p *Program) *Program {
+	copied := &Program{Statements: c.statements(p.Statements)}
+	if p.Comments != nil {
+		copied.Comments = make([]*CommentGroup, len(p.Comments))
+		for i, group := range p.Comments {
+			copied.Comments[i] = c.group(group)
+		}
+	}
+
+	return copied
+}
+
+func (c *cloner) statements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+
+	copied := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		copied[i] = c.statement(stmt)
+	}
+
+	return copied
+}
+
+func (c *cloner) statement(stmt Statement) Statement {
+	switch s := stmt.(type) {
+	case *LetStatement:
+		return &LetStatement{
+			CommentAttachment: c.comments(s.CommentAttachment),
+			Token:             c.token(s.Token),
+			Name:              c.expression(s.Name),
+			Value:             c.expression(s.Value),
+		}
+	case *ReturnStatement:
+		return &ReturnStatement{
+			CommentAttachment: c.comments(s.CommentAttachment),
+			Token:             c.token(s.Token),
+			ReturnValue:       c.expression(s.ReturnValue),
+		}
+	case *ThrowStatement:
+		return &ThrowStatement{
+			CommentAttachment: c.comments(s.CommentAttachment),
+			Token:             c.token(s.Token),
+			Value:             c.expression(s.Value),
+		}
+	case *BreakStatement:
+		return &BreakStatement{CommentAttachment: c.comments(s.CommentAttachment), Token: c.token(s.Token)}
+	case *ContinueStatement:
+		return &ContinueStatement{CommentAttachment: c.comments(s.CommentAttachment), Token: c.token(s.Token)}
+	case *ExpressionStatement:
+		return &ExpressionStatement{
+			CommentAttachment: c.comments(s.CommentAttachment),
+			Token:             c.token(s.Token),
+			Expression:        c.expression(s.Expression),
+		}
+	case *BlockStatement:
+		return c.block(s)
+	default:
+		return nil
+	}
+}
+
+func (c *cloner) block(b *BlockStatement) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+
+	return &BlockStatement{Token: c.token(b.Token), Statements: c.statements(b.Statements), Rbrace: c.token(b.Rbrace)}
+}
+
+func (c *cloner) identifier(i *Identifier) *Identifier {
+	if i == nil {
+		return nil
+	}
+
+	return &Identifier{Token: c.token(i.Token), Value: i.Value}
+}
+
+func (c *cloner) expressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+
+	copied := make([]Expression, len(exps))
+	for i, exp := range exps {
+		copied[i] = c.expression(exp)
+	}
+
+	return copied
+}
+
+func (c *cloner) expression(exp Expression) Expression {
+	switch e := exp.(type) {
+	case *Identifier:
+		return c.identifier(e)
+	case *Boolean:
+		return &Boolean{Token: c.token(e.Token), Value: e.Value}
+	case *IntegerLiteral:
+		return &IntegerLiteral{Token: c.token(e.Token), Value: e.Value}
+	case *StringLiteral:
+		return &StringLiteral{Token: c.token(e.Token), Value: e.Value}
+	case *FloatLiteral:
+		return &FloatLiteral{Token: c.token(e.Token), Value: e.Value}
+	case *FunctionLiteral:
+		var params []*Identifier
+		if e.Parameters != nil {
+			params = make([]*Identifier, len(e.Parameters))
+			for i, param := range e.Parameters {
+				params[i] = c.identifier(param)
+			}
+		}
+		return &FunctionLiteral{Token: c.token(e.Token), Parameters: params, Body: c.block(e.Body)}
+	case *CallExpression:
+		return &CallExpression{Token: c.token(e.Token), Function: c.expression(e.Function), Arguments: c.expressions(e.Arguments)}
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: c.token(e.Token), Elements: c.expressions(e.Elements)}
+	case *PrefixExpression:
+		return &PrefixExpression{Token: c.token(e.Token), Operator: e.Operator, Right: c.expression(e.Right)}
+	case *InfixExpression:
+		return &InfixExpression{Token: c.token(e.Token), Operator: e.Operator, Left: c.expression(e.Left), Right: c.expression(e.Right)}
+	case *IfExpression:
+		return &IfExpression{
+			Token:       c.token(e.Token),
+			Condition:   c.expression(e.Condition),
+			Consequence: c.block(e.Consequence),
+			Alternative: c.block(e.Alternative),
+		}
+	case *AssignExpression:
+		return &AssignExpression{Token: c.token(e.Token), Target: c.expression(e.Target), Value: c.expression(e.Value)}
+	case *TryExpression:
+		return &TryExpression{
+			Token:   c.token(e.Token),
+			Body:    c.block(e.Body),
+			Param:   c.identifier(e.Param),
+			Catch:   c.block(e.Catch),
+			Finally: c.block(e.Finally),
+		}
+	case *ForExpression:
+		return &ForExpression{
+			Token:     c.token(e.Token),
+			Init:      c.statement(e.Init),
+			Condition: c.expression(e.Condition),
+			Post:      c.expression(e.Post),
+			Body:      c.block(e.Body),
+		}
+	case *IndexExpression:
+		return &IndexExpression{Token: c.token(e.Token), Left: c.expression(e.Left), Index: c.expression(e.Index)}
+	case *HashLiteral:
+		hash := make(map[Expression]Expression, len(e.Hash))
+		for key, value := range e.Hash {
+			hash[c.expression(key)] = c.expression(value)
+		}
+		return &HashLiteral{Token: c.token(e.Token), Hash: hash}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,316 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ChangeKind tells how a node differs between two trees.
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Changed
+)
+
+// Change is a difference between two trees. Old is nil for added nodes and New is nil for removed ones.
+type Change struct {
+	Kind ChangeKind
+	Old  Node
+	New  Node
+}
+
+// String describes the change with the positions of the nodes, like:
+//
+//	3:5: changed x + 1 to x + 2 at 3:5
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("%s: added %s", position(c.New), c.New)
+	case Removed:
+		return fmt.Sprintf("%s: removed %s", position(c.Old), c.Old)
+	default:
+		return fmt.Sprintf("%s: changed %s to %s at %s", position(c.Old), c.Old, c.New, position(c.New))
+	}
+}
+
+func position(node Node) string {
+	tok := TokenOf(node)
+	if tok == nil {
+		return "-"
+	}
+
+	return fmt.Sprintf("%d:%d", tok.Line, tok.Column)
+}
+
+// Diff returns the structural differences between the two trees, ignoring what Equal ignores: positions and
+// comments. The changes are as deep in the trees as they can be, a program only differing in the value of one
+// literal has one change for that literal. Statements and the elements of lists are matched up by a longest
+// common subsequence, so inserting a statement shows up as one addition rather than a change of everything after
+// it. Diff returns nil for equal trees.
+func Diff(old, new Node) []Change {
+	var changes []Change
+	diff(old, new, &changes)
+
+	return changes
+}
+
+func diff(old, new Node, changes *[]Change) {
+	if Equal(old, new) {
+		return
+	}
+
+	if isNil(old) {
+		*changes = append(*changes, Change{Kind: Added, New: new})
+		return
+	}
+	if isNil(new) {
+		*changes = append(*changes, Change{Kind: Removed, Old: old})
+		return
+	}
+
+	switch o := old.(type) {
+	case *Program:
+		if n, ok := new.(*Program); ok {
+			diffList(statementNodes(o.Statements), statementNodes(n.Statements), changes)
+			return
+		}
+	case *LetStatement:
+		if n, ok := new.(*LetStatement); ok {
+			diff(o.Name, n.Name, changes)
+			diff(o.Value, n.Value, changes)
+			return
+		}
+	case *ReturnStatement:
+		if n, ok := new.(*ReturnStatement); ok {
+			diff(o.ReturnValue, n.ReturnValue, changes)
+			return
+		}
+	case *ThrowStatement:
+		if n, ok := new.(*ThrowStatement); ok {
+			diff(o.Value, n.Value, changes)
+			return
+		}
+	case *ExpressionStatement:
+		if n, ok := new.(*ExpressionStatement); ok {
+			diff(o.Expression, n.Expression, changes)
+			return
+		}
+	case *BlockStatement:
+		if n, ok := new.(*BlockStatement); ok {
+			diffList(statementNodes(o.Statements), statementNodes(n.Statements), changes)
+			return
+		}
+	case *FunctionLiteral:
+		if n, ok := new.(*FunctionLiteral); ok {
+			diffList(identifierNodes(o.Parameters), identifierNodes(n.Parameters), changes)
+			diff(o.Body, n.Body, changes)
+			return
+		}
+	case *CallExpression:
+		if n, ok := new.(*CallExpression); ok {
+			diff(o.Function, n.Function, changes)
+			diffList(expressionNodes(o.Arguments), expressionNodes(n.Arguments), changes)
+			return
+		}
+	case *ArrayLiteral:
+		if n, ok := new.(*ArrayLiteral); ok {
+			diffList(expressionNodes(o.Elements), expressionNodes(n.Elements), changes)
+			return
+		}
+	case *PrefixExpression:
+		if n, ok := new.(*PrefixExpression); ok && o.Operator == n.Operator {
+			diff(o.Right, n.Right, changes)
+			return
+		}
+	case *InfixExpression:
+		if n, ok := new.(*InfixExpression); ok && o.Operator == n.Operator {
+			diff(o.Left, n.Left, changes)
+			diff(o.Right, n.Right, changes)
+			return
+		}
+	case *IfExpression:
+		if n, ok := new.(*IfExpression); ok {
+			diff(o.Condition, n.Condition, changes)
+			diff(o.Consequence, n.Consequence, changes)
+			diff(o.Alternative, n.Alternative, changes)
+			return
+		}
+	case *AssignExpression:
+		if n, ok := new.(*AssignExpression); ok {
+			diff(o.Target, n.Target, changes)
+			diff(o.Value, n.Value, changes)
+			return
+		}
+	case *TryExpression:
+		if n, ok := new.(*TryExpression); ok {
+			diff(o.Body, n.Body, changes)
+			diff(o.Param, n.Param, changes)
+			diff(o.Catch, n.Catch, changes)
+			diff(o.Finally, n.Finally, changes)
+			return
+		}
+	case *ForExpression:
+		if n, ok := new.(*ForExpression); ok {
+			diff(o.Init, n.Init, changes)
+			diff(o.Condition, n.Condition, changes)
+			diff(o.Post, n.Post, changes)
+			diff(o.Body, n.Body, changes)
+			return
+		}
+	case *IndexExpression:
+		if n, ok := new.(*IndexExpression); ok {
+			diff(o.Left, n.Left, changes)
+			diff(o.Index, n.Index, changes)
+			return
+		}
+	case *HashLiteral:
+		if n, ok := new.(*HashLiteral); ok {
+			diffHashes(o, n, changes)
+			return
+		}
+	}
+
+	*changes = append(*changes, Change{Kind: Changed, Old: old, New: new})
+}
+
+// diffList matches up the equal nodes of both lists. The nodes between two matches are matched up again, with
+// the ones that look alike being diffed, and whatever is left over was removed or added.
+func diffList(old, new []Node, changes *[]Change) {
+	var removed, added []Node
+	flush := func() {
+		align(removed, added, similar, func(o, n Node) { diff(o, n, changes) })
+		removed, added = nil, nil
+	}
+
+	align(old, new, Equal, func(o, n Node) {
+		switch {
+		case o == nil:
+			added = append(added, n)
+		case n == nil:
+			removed = append(removed, o)
+		default:
+			flush()
+		}
+	})
+	flush()
+}
+
+// align calls emit in order for the longest common subsequence of the lists by match: with both nodes for the
+// ones that match, with a nil new node for the rest of old and a nil old node for the rest of new
+func align(old, new []Node, match func(a, b Node) bool, emit func(o, n Node)) {
+	// lcs[i][j] is the length of the longest common subsequence of old[i:] and new[j:]
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if match(old[i], new[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(old) && j < len(new) {
+		switch {
+		case match(old[i], new[j]) && lcs[i][j] == lcs[i+1][j+1]+1:
+			emit(old[i], new[j])
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			emit(old[i], nil)
+			i++
+		default:
+			emit(nil, new[j])
+			j++
+		}
+	}
+	for ; i < len(old); i++ {
+		emit(old[i], nil)
+	}
+	for ; j < len(new); j++ {
+		emit(nil, new[j])
+	}
+}
+
+// similar reports whether the nodes look like two versions of the same thing, like two lets of the same name,
+// in which case the differences between them say more than replacing one by the other
+func similar(a, b Node) bool {
+	switch a := a.(type) {
+	case *LetStatement:
+		b, ok := b.(*LetStatement)
+		return ok && Equal(a.Name, b.Name)
+	case *ExpressionStatement:
+		b, ok := b.(*ExpressionStatement)
+		return ok && similar(a.Expression, b.Expression)
+	case *CallExpression:
+		b, ok := b.(*CallExpression)
+		return ok && Equal(a.Function, b.Function)
+	case *PrefixExpression:
+		b, ok := b.(*PrefixExpression)
+		return ok && a.Operator == b.Operator
+	case *InfixExpression:
+		b, ok := b.(*InfixExpression)
+		return ok && a.Operator == b.Operator
+	default:
+		return reflect.TypeOf(a) == reflect.TypeOf(b)
+	}
+}
+
+// diffHashes matches up the pairs by their keys, the values of keys found in both hashes are diffed
+func diffHashes(old, new *HashLiteral, changes *[]Change) {
+	matched := map[Expression]bool{}
+	for _, key := range old.Keys() {
+		found := false
+		for _, other := range new.Keys() {
+			if !matched[other] && Equal(key, other) {
+				matched[other], found = true, true
+				diff(old.Hash[key], new.Hash[other], changes)
+				break
+			}
+		}
+
+		if !found {
+			*changes = append(*changes, Change{Kind: Removed, Old: key})
+		}
+	}
+
+	for _, key := range new.Keys() {
+		if !matched[key] {
+			*changes = append(*changes, Change{Kind: Added, New: key})
+		}
+	}
+}
+
+func statementNodes(stmts []Statement) []Node {
+	nodes := make([]Node, len(stmts))
+	for i, stmt := range stmts {
+		nodes[i] = stmt
+	}
+
+	return nodes
+}
+
+func expressionNodes(exps []Expression) []Node {
+	nodes := make([]Node, len(exps))
+	for i, exp := range exps {
+		nodes[i] = exp
+	}
+
+	return nodes
+}
+
+func identifierNodes(idents []*Identifier) []Node {
+	nodes := make([]Node, len(idents))
+	for i, ident := range idents {
+		nodes[i] = ident
+	}
+
+	return nodes
+}
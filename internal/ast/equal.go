@@ -0,0 +1,166 @@
+package ast
+
+// Equal reports whether the two trees have the same structure and values. Positions, tokens and comments are
+// ignored, so a tree is equal to the one parsed from its printed source, and hash literals are equal when they
+// have the same pairs in any order.
+func Equal(a, b Node) bool {
+	if isNil(a) || isNil(b) {
+		return isNil(a) && isNil(b)
+	}
+
+	switch a := a.(type) {
+	case *Program:
+		b, ok := b.(*Program)
+		return ok && equalStatements(a.Statements, b.Statements)
+	case *LetStatement:
+		b, ok := b.(*LetStatement)
+		return ok && Equal(a.Name, b.Name) && Equal(a.Value, b.Value)
+	case *ReturnStatement:
+		b, ok := b.(*ReturnStatement)
+		return ok && Equal(a.ReturnValue, b.ReturnValue)
+	case *ThrowStatement:
+		b, ok := b.(*ThrowStatement)
+		return ok && Equal(a.Value, b.Value)
+	case *BreakStatement:
+		_, ok := b.(*BreakStatement)
+		return ok
+	case *ContinueStatement:
+		_, ok := b.(*ContinueStatement)
+		return ok
+	case *ExpressionStatement:
+		b, ok := b.(*ExpressionStatement)
+		return ok && Equal(a.Expression, b.Expression)
+	case *BlockStatement:
+		b, ok := b.(*BlockStatement)
+		return ok && equalStatements(a.Statements, b.Statements)
+	case *Identifier:
+		b, ok := b.(*Identifier)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *IntegerLiteral:
+		b, ok := b.(*IntegerLiteral)
+		return ok && a.Value == b.Value
+	case *StringLiteral:
+		b, ok := b.(*StringLiteral)
+		return ok && a.Value == b.Value
+	case *FloatLiteral:
+		b, ok := b.(*FloatLiteral)
+		return ok && a.Value == b.Value
+	case *FunctionLiteral:
+		b, ok := b.(*FunctionLiteral)
+		if !ok || len(a.Parameters) != len(b.Parameters) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !Equal(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		return Equal(a.Body, b.Body)
+	case *CallExpression:
+		b, ok := b.(*CallExpression)
+		return ok && Equal(a.Function, b.Function) && equalExpressions(a.Arguments, b.Arguments)
+	case *ArrayLiteral:
+		b, ok := b.(*ArrayLiteral)
+		return ok && equalExpressions(a.Elements, b.Elements)
+	case *PrefixExpression:
+		b, ok := b.(*PrefixExpression)
+		return ok && a.Operator == b.Operator && Equal(a.Right, b.Right)
+	case *InfixExpression:
+		b, ok := b.(*InfixExpression)
+		return ok && a.Operator == b.Operator && Equal(a.Left, b.Left) && Equal(a.Right, b.Right)
+	case *IfExpression:
+		b, ok := b.(*IfExpression)
+		return ok && Equal(a.Condition, b.Condition) && Equal(a.Consequence, b.Consequence) &&
+			Equal(a.Alternative, b.Alternative)
+	case *AssignExpression:
+		b, ok := b.(*AssignExpression)
+		return ok && Equal(a.Target, b.Target) && Equal(a.Value, b.Value)
+	case *TryExpression:
+		b, ok := b.(*TryExpression)
+		return ok && Equal(a.Body, b.Body) && Equal(a.Param, b.Param) && Equal(a.Catch, b.Catch) &&
+			Equal(a.Finally, b.Finally)
+	case *ForExpression:
+		b, ok := b.(*ForExpression)
+		return ok && Equal(a.Init, b.Init) && Equal(a.Condition, b.Condition) && Equal(a.Post, b.Post) &&
+			Equal(a.Body, b.Body)
+	case *IndexExpression:
+		b, ok := b.(*IndexExpression)
+		return ok && Equal(a.Left, b.Left) && Equal(a.Index, b.Index)
+	case *HashLiteral:
+		b, ok := b.(*HashLiteral)
+		return ok && equalHashes(a, b)
+	default:
+		return false
+	}
+}
+
+// isNil reports whether the node is nil, including nil pointers of the node types, like a missing Alternative
+func isNil(node Node) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+	case *BlockStatement:
+		return n == nil
+	case *Identifier:
+		return n == nil
+	case *Program:
+		return n == nil
+	default:
+		return false
+	}
+}
+
+func equalStatements(a, b []Statement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalExpressions(a, b []Expression) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalHashes matches every pair of a with a different pair of b
+func equalHashes(a, b *HashLiteral) bool {
+	if len(a.Hash) != len(b.Hash) {
+		return false
+	}
+
+	matched := map[Expression]bool{}
+	for key, value := range a.Hash {
+		found := false
+		for other, otherValue := range b.Hash {
+			if !matched[other] && Equal(key, other) && Equal(value, otherValue) {
+				matched[other], found = true, true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
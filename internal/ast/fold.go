@@ -0,0 +1,200 @@
+package ast
+
+import (
+	"math"
+	"monkey/internal/token"
+	"strconv"
+	"strings"
+)
+
+// maxFoldedString is the longest string a repetition like "ab" * 3 is folded into, longer ones are left for the
+// evaluator to build so the tree doesn't grow
+const maxFoldedString = 4096
+
+// Fold returns the program with the expressions that only operate on literals replaced by their value, like
+// `2 * 3 + 1` by `7`, `"a" + "b"` by `"ab"` and `!(1 < 2)` by `false`. Expressions that would fail to evaluate,
+// like a division by zero or a type mismatch, are left as they are so they fail the same way at run time, and so
+// are the integer operations overflowing, which fail only when the evaluator checks integers. The program passed
+// in is not modified, see Rewrite.
+func Fold(program *Program) *Program {
+	return Rewrite(program, func(node Node) Node { return fold(node, true) }).(*Program)
+}
+
+// FoldScalars folds the program like Fold, but for the operations giving strings, which are left for the evaluator
+// or the virtual machine running the program to build, under their limit on the length of strings and their count
+// of the objects created.
+func FoldScalars(program *Program) *Program {
+	return Rewrite(program, func(node Node) Node { return fold(node, false) }).(*Program)
+}
+
+// fold returns the value of the node if it operates on literals only, the node itself otherwise or if the value is
+// a string and strs is false
+func fold(node Node, strs bool) Node {
+	var folded Expression
+	switch n := node.(type) {
+	case *PrefixExpression:
+		folded = foldPrefix(n)
+	case *InfixExpression:
+		folded = foldInfix(n)
+	}
+
+	if _, isString := folded.(*StringLiteral); folded == nil || isString && !strs {
+		return node
+	}
+	return folded
+}
+
+func foldPrefix(n *PrefixExpression) Expression {
+	switch n.Operator {
+	case "!":
+		switch right := n.Right.(type) {
+		case *Boolean:
+			return foldedBoolean(!right.Value, n.Token)
+		case *IntegerLiteral, *FloatLiteral, *StringLiteral:
+			return foldedBoolean(false, n.Token) // everything but false and null is truthy
+		}
+	case "-":
+		if right, ok := n.Right.(*IntegerLiteral); ok && right.Value != math.MinInt64 {
+			return foldedInteger(-right.Value, n.Token)
+		}
+	}
+
+	return nil
+}
+
+func foldInfix(n *InfixExpression) Expression {
+	at := TokenOf(n.Left)
+
+	switch left := n.Left.(type) {
+	case *IntegerLiteral:
+		if right, ok := n.Right.(*IntegerLiteral); ok {
+			return foldIntegers(n.Operator, left.Value, right.Value, at)
+		}
+	case *Boolean:
+		if right, ok := n.Right.(*Boolean); ok {
+			return foldBooleans(n.Operator, left.Value, right.Value, at)
+		}
+	case *StringLiteral:
+		switch right := n.Right.(type) {
+		case *StringLiteral:
+			return foldStrings(n.Operator, left.Value, right.Value, at)
+		case *IntegerLiteral:
+			if n.Operator == "*" && right.Value >= 0 && int64(len(left.Value))*right.Value <= maxFoldedString {
+				return foldedString(strings.Repeat(left.Value, int(right.Value)), at)
+			}
+		}
+	}
+
+	return nil
+}
+
+func foldIntegers(operator string, left, right int64, at *token.Token) Expression {
+	if Overflows(operator, left, right) {
+		return nil
+	}
+
+	switch operator {
+	case "+":
+		return foldedInteger(left+right, at)
+	case "-":
+		return foldedInteger(left-right, at)
+	case "*":
+		return foldedInteger(left*right, at)
+	case "/":
+		if right != 0 {
+			return foldedInteger(left/right, at)
+		}
+	case "==":
+		return foldedBoolean(left == right, at)
+	case "!=":
+		return foldedBoolean(left != right, at)
+	case "<":
+		return foldedBoolean(left < right, at)
+	case ">":
+		return foldedBoolean(left > right, at)
+	}
+
+	return nil
+}
+
+// Overflows reports whether the arithmetic operator applied to the integers doesn't fit in 64 bits, which folding
+// leaves to the evaluator and the evaluator checking integers fails with.
+func Overflows(operator string, left, right int64) bool {
+	switch operator {
+	case "+":
+		sum := left + right
+		return (left^sum)&(right^sum) < 0
+	case "-":
+		difference := left - right
+		return (left^right)&(left^difference) < 0
+	case "*":
+		if left == 0 || right == 0 {
+			return false
+		}
+		product := left * right
+		return product/right != left || left == -1 && right == math.MinInt64 || right == -1 && left == math.MinInt64
+	case "/":
+		return left == math.MinInt64 && right == -1
+	default:
+		return false
+	}
+}
+
+func foldBooleans(operator string, left, right bool, at *token.Token) Expression {
+	switch operator {
+	case "==":
+		return foldedBoolean(left == right, at)
+	case "!=":
+		return foldedBoolean(left != right, at)
+	case "<":
+		return foldedBoolean(!left && right, at) // false orders before true
+	case ">":
+		return foldedBoolean(left && !right, at)
+	case "&&":
+		return foldedBoolean(left && right, at)
+	case "||":
+		return foldedBoolean(left || right, at)
+	}
+
+	return nil
+}
+
+func foldStrings(operator, left, right string, at *token.Token) Expression {
+	switch operator {
+	case "+":
+		return foldedString(left+right, at)
+	case "==":
+		return foldedBoolean(left == right, at)
+	case "!=":
+		return foldedBoolean(left != right, at)
+	}
+
+	return nil
+}
+
+// foldedToken returns a token for a folded value, positioned where the expression it replaces started
+func foldedToken(t token.TokenType, literal string, at *token.Token) *token.Token {
+	tok := &token.Token{Type: t, Literal: literal}
+	if at != nil {
+		tok.Line, tok.Column, tok.Offset = at.Line, at.Column, at.Offset
+	}
+
+	return tok
+}
+
+func foldedInteger(value int64, at *token.Token) *IntegerLiteral {
+	literal := strconv.FormatInt(value, 10)
+	return &IntegerLiteral{Token: foldedToken(token.INT, literal, at), Value: value}
+}
+
+func foldedBoolean(value bool, at *token.Token) *Boolean {
+	if value {
+		return &Boolean{Token: foldedToken(token.TRUE, "true", at), Value: true}
+	}
+
+	return &Boolean{Token: foldedToken(token.FALSE, "false", at), Value: false}
+}
+
+func foldedString(value string, at *token.Token) *StringLiteral {
+	return &StringLiteral{Token: foldedToken(token.STRING, value, at), Value: value}
+}
@@ -0,0 +1,244 @@
+package ast
+
+import "fmt"
+
+// Rewrite returns the tree with every node replaced by what f returns for it. The children of a node are rewritten
+// before the node itself, so f sees the node with its children already rewritten and returns it to keep it.
+//
+// The tree passed in is not modified: a node with a replaced child is copied, the nodes that didn't change are
+// shared by both trees. f can return nil for a statement of a program or block, or for the init of a for loop, to
+// remove it; anywhere else it has to return a node that fits in the place of the old one, an Expression for an
+// expression, an Identifier for a parameter, of a function or a catch, and a BlockStatement for a block, or Rewrite panics.
+func Rewrite(node Node, f func(Node) Node) Node {
+	return f(rewriteChildren(node, f))
+}
+
+// rewriteChildren returns the node with its children rewritten, or the node itself if none of them were replaced
+func rewriteChildren(node Node, f func(Node) Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		if stmts, changed := rewriteStatements(n.Statements, f); changed {
+			c := *n
+			c.Statements = stmts
+			return &c
+		}
+	case *LetStatement:
+		name, value := rewriteExpression(n.Name, f), rewriteExpression(n.Value, f)
+		if name != n.Name || value != n.Value {
+			c := *n
+			c.Name, c.Value = name, value
+			return &c
+		}
+	case *ReturnStatement:
+		if value := rewriteExpression(n.ReturnValue, f); value != n.ReturnValue {
+			c := *n
+			c.ReturnValue = value
+			return &c
+		}
+	case *ThrowStatement:
+		if value := rewriteExpression(n.Value, f); value != n.Value {
+			c := *n
+			c.Value = value
+			return &c
+		}
+	case *ExpressionStatement:
+		if exp := rewriteExpression(n.Expression, f); exp != n.Expression {
+			c := *n
+			c.Expression = exp
+			return &c
+		}
+	case *BlockStatement:
+		if stmts, changed := rewriteStatements(n.Statements, f); changed {
+			c := *n
+			c.Statements = stmts
+			return &c
+		}
+	case *FunctionLiteral:
+		params, changed := rewriteIdentifiers(n.Parameters, f)
+		body := rewriteBlock(n.Body, f)
+		if changed || body != n.Body {
+			c := *n
+			c.Parameters, c.Body = params, body
+			return &c
+		}
+	case *CallExpression:
+		function := rewriteExpression(n.Function, f)
+		args, changed := rewriteExpressions(n.Arguments, f)
+		if changed || function != n.Function {
+			c := *n
+			c.Function, c.Arguments = function, args
+			return &c
+		}
+	case *ArrayLiteral:
+		if elts, changed := rewriteExpressions(n.Elements, f); changed {
+			c := *n
+			c.Elements = elts
+			return &c
+		}
+	case *PrefixExpression:
+		if right := rewriteExpression(n.Right, f); right != n.Right {
+			c := *n
+			c.Right = right
+			return &c
+		}
+	case *InfixExpression:
+		left, right := rewriteExpression(n.Left, f), rewriteExpression(n.Right, f)
+		if left != n.Left || right != n.Right {
+			c := *n
+			c.Left, c.Right = left, right
+			return &c
+		}
+	case *IfExpression:
+		condition := rewriteExpression(n.Condition, f)
+		consequence, alternative := rewriteBlock(n.Consequence, f), rewriteBlock(n.Alternative, f)
+		if condition != n.Condition || consequence != n.Consequence || alternative != n.Alternative {
+			c := *n
+			c.Condition, c.Consequence, c.Alternative = condition, consequence, alternative
+			return &c
+		}
+	case *TryExpression:
+		body, catch, finally := rewriteBlock(n.Body, f), rewriteBlock(n.Catch, f), rewriteBlock(n.Finally, f)
+		param := n.Param
+		if param != nil {
+			params, _ := rewriteIdentifiers([]*Identifier{param}, f)
+			param = params[0]
+		}
+		if body != n.Body || param != n.Param || catch != n.Catch || finally != n.Finally {
+			c := *n
+			c.Body, c.Param, c.Catch, c.Finally = body, param, catch, finally
+			return &c
+		}
+	case *AssignExpression:
+		target, value := rewriteExpression(n.Target, f), rewriteExpression(n.Value, f)
+		if target != n.Target || value != n.Value {
+			c := *n
+			c.Target, c.Value = target, value
+			return &c
+		}
+	case *ForExpression:
+		init, condition, post := rewriteStatement(n.Init, f), rewriteExpression(n.Condition, f), rewriteExpression(n.Post, f)
+		body := rewriteBlock(n.Body, f)
+		if init != n.Init || condition != n.Condition || post != n.Post || body != n.Body {
+			c := *n
+			c.Init, c.Condition, c.Post, c.Body = init, condition, post, body
+			return &c
+		}
+	case *IndexExpression:
+		left, index := rewriteExpression(n.Left, f), rewriteExpression(n.Index, f)
+		if left != n.Left || index != n.Index {
+			c := *n
+			c.Left, c.Index = left, index
+			return &c
+		}
+	case *HashLiteral:
+		hash := make(map[Expression]Expression, len(n.Hash))
+		changed := false
+		for _, key := range n.Keys() {
+			k, v := rewriteExpression(key, f), rewriteExpression(n.Hash[key], f)
+			changed = changed || k != key || v != n.Hash[key]
+			hash[k] = v
+		}
+		if changed {
+			c := *n
+			c.Hash = hash
+			return &c
+		}
+	}
+
+	return node
+}
+
+func rewriteExpression(exp Expression, f func(Node) Node) Expression {
+	if exp == nil {
+		return nil
+	}
+
+	replaced, ok := Rewrite(exp, f).(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast: Rewrite replaced the expression %q with %T", exp.String(), replaced))
+	}
+
+	return replaced
+}
+
+func rewriteBlock(block *BlockStatement, f func(Node) Node) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+
+	replaced, ok := Rewrite(block, f).(*BlockStatement)
+	if !ok || replaced == nil {
+		panic(fmt.Sprintf("ast: Rewrite replaced a block with %T", replaced))
+	}
+
+	return replaced
+}
+
+// rewriteStatement returns the rewritten statement, nil if f removed it
+func rewriteStatement(stmt Statement, f func(Node) Node) Statement {
+	if stmt == nil {
+		return nil
+	}
+
+	replaced := Rewrite(stmt, f)
+	if replaced == nil {
+		return nil
+	}
+
+	s, ok := replaced.(Statement)
+	if !ok {
+		panic(fmt.Sprintf("ast: Rewrite replaced the statement %q with %T", stmt.String(), replaced))
+	}
+
+	return s
+}
+
+// rewriteStatements returns the rewritten statements without the ones f removed, and whether anything changed
+func rewriteStatements(stmts []Statement, f func(Node) Node) ([]Statement, bool) {
+	rewritten := make([]Statement, 0, len(stmts))
+	changed := false
+	for _, stmt := range stmts {
+		replaced := Rewrite(stmt, f)
+		if replaced == nil {
+			changed = true
+			continue
+		}
+
+		s, ok := replaced.(Statement)
+		if !ok {
+			panic(fmt.Sprintf("ast: Rewrite replaced the statement %q with %T", stmt.String(), replaced))
+		}
+		changed = changed || s != stmt
+		rewritten = append(rewritten, s)
+	}
+
+	return rewritten, changed
+}
+
+// rewriteExpressions returns the rewritten expressions, and whether any of them changed
+func rewriteExpressions(exps []Expression, f func(Node) Node) ([]Expression, bool) {
+	rewritten := make([]Expression, len(exps))
+	changed := false
+	for i, exp := range exps {
+		rewritten[i] = rewriteExpression(exp, f)
+		changed = changed || rewritten[i] != exp
+	}
+
+	return rewritten, changed
+}
+
+// rewriteIdentifiers returns the rewritten identifiers, and whether any of them changed
+func rewriteIdentifiers(idents []*Identifier, f func(Node) Node) ([]*Identifier, bool) {
+	rewritten := make([]*Identifier, len(idents))
+	changed := false
+	for i, ident := range idents {
+		replaced, ok := Rewrite(ident, f).(*Identifier)
+		if !ok || replaced == nil {
+			panic(fmt.Sprintf("ast: Rewrite replaced the parameter %q with %T", ident.Value, replaced))
+		}
+		rewritten[i] = replaced
+		changed = changed || replaced != ident
+	}
+
+	return rewritten, changed
+}
@@ -0,0 +1,198 @@
+package ast
+
+import (
+	"monkey/internal/token"
+	"sort"
+)
+
+// Visitor is called by Walk for every node. If Visit returns a non nil visitor w, Walk visits each child of the
+// node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree in depth first order: it starts by calling v.Visit(node); node must not be nil. Comments
+// are not visited, they hang off of the statements and the Program.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+	case *LetStatement:
+		Walk(v, n.Name)
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			Walk(v, n.ReturnValue)
+		}
+	case *ThrowStatement:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+	case *Identifier, *Boolean, *IntegerLiteral, *StringLiteral:
+		// nothing to do
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		Walk(v, n.Body)
+	case *CallExpression:
+		Walk(v, n.Function)
+		for _, arg := range n.Arguments {
+			Walk(v, arg)
+		}
+	case *ArrayLiteral:
+		for _, elt := range n.Elements {
+			Walk(v, elt)
+		}
+	case *PrefixExpression:
+		Walk(v, n.Right)
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+	case *AssignExpression:
+		Walk(v, n.Target)
+		Walk(v, n.Value)
+	case *TryExpression:
+		Walk(v, n.Body)
+		if n.Catch != nil {
+			Walk(v, n.Param)
+			Walk(v, n.Catch)
+		}
+		if n.Finally != nil {
+			Walk(v, n.Finally)
+		}
+	case *ForExpression:
+		if n.Init != nil {
+			Walk(v, n.Init)
+		}
+		if n.Condition != nil {
+			Walk(v, n.Condition)
+		}
+		if n.Post != nil {
+			Walk(v, n.Post)
+		}
+		Walk(v, n.Body)
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+	case *HashLiteral:
+		for _, key := range n.Keys() {
+			Walk(v, key)
+			Walk(v, n.Hash[key])
+		}
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+
+	return nil
+}
+
+// Inspect traverses the tree in depth first order: it starts by calling f(node); node must not be nil. If f
+// returns true, Inspect invokes f for each child of the node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// TokenOf returns the token a node was created from: the first token for statements and literals, the operator
+// for prefix, infix, call and index expressions. It returns nil for a Program.
+func TokenOf(node Node) *token.Token {
+	switch n := node.(type) {
+	case *LetStatement:
+		return n.Token
+	case *ReturnStatement:
+		return n.Token
+	case *BreakStatement:
+		return n.Token
+	case *ContinueStatement:
+		return n.Token
+	case *ThrowStatement:
+		return n.Token
+	case *ExpressionStatement:
+		return n.Token
+	case *BlockStatement:
+		return n.Token
+	case *Identifier:
+		return n.Token
+	case *Boolean:
+		return n.Token
+	case *IntegerLiteral:
+		return n.Token
+	case *StringLiteral:
+		return n.Token
+	case *FloatLiteral:
+		return n.Token
+	case *FunctionLiteral:
+		return n.Token
+	case *CallExpression:
+		return n.Token
+	case *ArrayLiteral:
+		return n.Token
+	case *PrefixExpression:
+		return n.Token
+	case *InfixExpression:
+		return n.Token
+	case *IfExpression:
+		return n.Token
+	case *AssignExpression:
+		return n.Token
+	case *TryExpression:
+		return n.Token
+	case *ForExpression:
+		return n.Token
+	case *IndexExpression:
+		return n.Token
+	case *HashLiteral:
+		return n.Token
+	default:
+		return nil
+	}
+}
+
+// Keys returns the keys of the hash literal in the order they appear in the source.
+func (h *HashLiteral) Keys() []Expression {
+	keys := make([]Expression, 0, len(h.Hash))
+	for key := range h.Hash {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := TokenOf(keys[i]), TokenOf(keys[j])
+		if a == nil || b == nil || a.Offset == b.Offset {
+			return keys[i].String() < keys[j].String()
+		}
+
+		return a.Offset < b.Offset
+	})
+
+	return keys
+}
@@ -0,0 +1,124 @@
+// Package astgraph draws the trees of package ast: as graphs in the DOT language of Graphviz, as Mermaid
+// flowcharts, or as indented outlines. Every node is labeled with its kind, what it holds, like the name of an
+// identifier or an operator, and where it starts in the source.
+package astgraph
+
+import (
+	"fmt"
+	"io"
+	"monkey/internal/ast"
+	"strconv"
+	"strings"
+)
+
+// vertex is a node of the tree, numbered in depth first order
+type vertex struct {
+	label  string
+	depth  int
+	parent int // -1 for the root
+}
+
+// vertices returns the nodes of the tree in depth first order
+func vertices(root ast.Node) []vertex {
+	var vs []vertex
+	var parents []int
+	ast.Inspect(root, func(node ast.Node) bool {
+		if node == nil {
+			parents = parents[:len(parents)-1]
+			return false
+		}
+
+		parent := -1
+		if len(parents) > 0 {
+			parent = parents[len(parents)-1]
+		}
+		vs = append(vs, vertex{label: Label(node), depth: len(parents), parent: parent})
+		parents = append(parents, len(vs)-1)
+		return true
+	})
+
+	return vs
+}
+
+// Label returns the label of the node, like `Identifier x 1:5` or `InfixExpression + 2:3`.
+func Label(node ast.Node) string {
+	kind := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+
+	var detail string
+	switch n := node.(type) {
+	case *ast.Identifier:
+		detail = n.Value
+	case *ast.Boolean:
+		detail = strconv.FormatBool(n.Value)
+	case *ast.IntegerLiteral:
+		detail = strconv.FormatInt(n.Value, 10)
+	case *ast.FloatLiteral:
+		detail = strconv.FormatFloat(n.Value, 'g', -1, 64)
+	case *ast.StringLiteral:
+		detail = strconv.Quote(n.Value)
+	case *ast.PrefixExpression:
+		detail = n.Operator
+	case *ast.InfixExpression:
+		detail = n.Operator
+	}
+
+	parts := []string{kind}
+	if detail != "" {
+		parts = append(parts, detail)
+	}
+	if tok := ast.TokenOf(node); tok != nil {
+		parts = append(parts, fmt.Sprintf("%d:%d", tok.Line, tok.Column))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Dot writes the tree as a Graphviz digraph, to render with a command like dot -Tsvg.
+func Dot(w io.Writer, root ast.Node) error {
+	var out strings.Builder
+	out.WriteString("digraph ast {\n\tnode [shape=box, fontname=\"monospace\"];\n")
+	vs := vertices(root)
+	for i, v := range vs {
+		label := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v.label)
+		fmt.Fprintf(&out, "\tn%d [label=\"%s\"];\n", i, label)
+	}
+	for i, v := range vs {
+		if v.parent >= 0 {
+			fmt.Fprintf(&out, "\tn%d -> n%d;\n", v.parent, i)
+		}
+	}
+	out.WriteString("}\n")
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// Mermaid writes the tree as a Mermaid flowchart, which Markdown renderers like GitHub's draw.
+func Mermaid(w io.Writer, root ast.Node) error {
+	var out strings.Builder
+	out.WriteString("flowchart TD\n")
+	vs := vertices(root)
+	for i, v := range vs {
+		label := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(v.label)
+		fmt.Fprintf(&out, "\tn%d[\"%s\"]\n", i, label)
+	}
+	for i, v := range vs {
+		if v.parent >= 0 {
+			fmt.Fprintf(&out, "\tn%d --> n%d\n", v.parent, i)
+		}
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// Outline writes the tree one node per line, indented by its depth.
+func Outline(w io.Writer, root ast.Node) error {
+	var out strings.Builder
+	for _, v := range vertices(root) {
+		out.WriteString(strings.Repeat("  ", v.depth) + v.label + "\n")
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
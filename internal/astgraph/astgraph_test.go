@@ -0,0 +1,58 @@
+package astgraph
+
+import (
+	"bytes"
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const source = `let x = -1;
+x < "a"`
+
+func TestOutline(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, Outline(&out, parser.New(lexer.New(source)).ParseProgram()))
+	assert.Equal(t, `Program
+  LetStatement 1:1
+    Identifier x 1:5
+    PrefixExpression - 1:9
+      IntegerLiteral 1 1:10
+  ExpressionStatement 2:1
+    InfixExpression < 2:3
+      Identifier x 2:1
+      StringLiteral "a" 2:5
+`, out.String())
+}
+
+func TestDot(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, Dot(&out, parser.New(lexer.New(`"a"`)).ParseProgram()))
+	assert.Equal(t, `digraph ast {
+	node [shape=box, fontname="monospace"];
+	n0 [label="Program"];
+	n1 [label="ExpressionStatement 1:1"];
+	n2 [label="StringLiteral \"a\" 1:1"];
+	n0 -> n1;
+	n1 -> n2;
+}
+`, out.String())
+}
+
+func TestMermaid(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, Mermaid(&out, parser.New(lexer.New(`1 < "a"`)).ParseProgram()))
+	assert.Equal(t, `flowchart TD
+	n0["Program"]
+	n1["ExpressionStatement 1:1"]
+	n2["InfixExpression #lt; 1:3"]
+	n3["IntegerLiteral 1 1:1"]
+	n4["StringLiteral #quot;a#quot; 1:5"]
+	n0 --> n1
+	n1 --> n2
+	n2 --> n3
+	n2 --> n4
+`, out.String())
+}
@@ -0,0 +1,218 @@
+// Package cache keeps the programs parsed and compiled from sources, keyed by the hash of the source, so that a
+// source that didn't change isn't parsed and compiled again: a file run again and again, a program importing the
+// same module as another, or the scripts a server embedding the language runs for every request.
+//
+// The trees and the bytecode are kept in memory, and the bytecode can also be kept on disk, in a directory like the
+// one of DefaultDir, for the next process compiling the same source. A cache can be used by several goroutines at
+// once, and so can what it returns, which must not be changed.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"monkey/internal/ast"
+	"monkey/internal/compiler"
+	"monkey/internal/diagnostics"
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+type (
+	// Key is the hash of a source, along with how it is parsed.
+	Key [sha256.Size]byte
+
+	// Parsed is a source parsed, with what the parser reported about it.
+	Parsed struct {
+		Program  *ast.Program
+		Errors   []diagnostics.Diagnostic
+		Warnings []diagnostics.Diagnostic
+	}
+
+	// Cache keeps the programs parsed and compiled, see the package documentation.
+	Cache struct {
+		dir string // where the bytecode is kept on disk, none if empty
+
+		mu      sync.Mutex
+		entries map[Key]*entry
+	}
+
+	// entry is what the cache keeps of a source
+	entry struct {
+		parsed     *Parsed
+		bytecode   *compiler.Bytecode
+		compileErr error // why the source can't be compiled, kept so that it isn't compiled again either
+	}
+)
+
+// KeyOf returns the key of the source parsed with the mode.
+func KeyOf(source string, mode parser.Mode) Key {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatUint(uint64(mode), 10) + "\x00"))
+	h.Write([]byte(source))
+
+	var key Key
+	h.Sum(key[:0])
+	return key
+}
+
+func (k Key) String() string {
+	return hex.EncodeToString(k[:])
+}
+
+// New returns a cache keeping the bytecode it compiles in the directory too, created if it doesn't exist, or only in
+// memory if dir is empty.
+func New(dir string) *Cache {
+	return &Cache{dir: dir, entries: map[Key]*entry{}}
+}
+
+// DefaultDir returns the directory to keep bytecode in for the user, monkey in the cache directory of the user
+// like ~/.cache/monkey.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "monkey"), nil
+}
+
+// Parse returns the source parsed with the mode, parsing it only if it wasn't already.
+func (c *Cache) Parse(source string, mode parser.Mode) *Parsed {
+	e := c.entry(KeyOf(source, mode))
+
+	c.mu.Lock()
+	parsed := e.parsed
+	c.mu.Unlock()
+	if parsed != nil {
+		return parsed
+	}
+
+	p := parser.NewWithMode(lexer.New(source), mode)
+	program := p.ParseProgram()
+	parsed = &Parsed{Program: program, Errors: p.Diagnostics(), Warnings: p.Warnings()}
+
+	c.mu.Lock()
+	e.parsed = parsed
+	c.mu.Unlock()
+	return parsed
+}
+
+// Compile returns the bytecode of the source parsed with the mode, from memory or from disk if it was already
+// compiled, or else compiling it. A source that can't be parsed or compiled returns a *compiler.Error with why.
+//
+// Failing to keep the bytecode on disk isn't an error: the source is compiled again next time.
+func (c *Cache) Compile(source string, mode parser.Mode) (*compiler.Bytecode, error) {
+	key := KeyOf(source, mode)
+	e := c.entry(key)
+
+	c.mu.Lock()
+	bytecode, err := e.bytecode, e.compileErr
+	c.mu.Unlock()
+	if bytecode != nil || err != nil {
+		return bytecode, err
+	}
+
+	if bytecode = c.read(key); bytecode == nil {
+		bytecode, err = c.compile(source, mode)
+		if err == nil {
+			c.write(key, bytecode)
+		}
+	}
+
+	c.mu.Lock()
+	e.bytecode, e.compileErr = bytecode, err
+	c.mu.Unlock()
+	return bytecode, err
+}
+
+// entry returns the entry of the key, adding it if there's none
+func (c *Cache) entry(key Key) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		e = &entry{}
+		c.entries[key] = e
+	}
+
+	return e
+}
+
+func (c *Cache) compile(source string, mode parser.Mode) (*compiler.Bytecode, error) {
+	parsed := c.Parse(source, mode)
+	if len(parsed.Errors) > 0 {
+		return nil, &compiler.Error{Diagnostics: parsed.Errors}
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(parsed.Program); err != nil {
+		return nil, err
+	}
+
+	return comp.Bytecode(), nil
+}
+
+// path returns the file the bytecode of the key is kept in, "" when it isn't kept on disk
+func (c *Cache) path(key Key) string {
+	if c.dir == "" {
+		return ""
+	}
+
+	return filepath.Join(c.dir, key.String()+".mbc")
+}
+
+// read returns the bytecode of the key kept on disk, nil if there's none or if it can't be read, like the bytecode
+// of another version
+func (c *Cache) read(key Key) *compiler.Bytecode {
+	path := c.path(key)
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	bytecode, err := compiler.ReadBytecode(file)
+	if err != nil {
+		return nil
+	}
+
+	return bytecode
+}
+
+// write keeps the bytecode of the key on disk. The file is written aside and moved in place, so that a process
+// reading it at the same time never reads half of it.
+func (c *Cache) write(key Key, bytecode *compiler.Bytecode) error {
+	path := c.path(key)
+	if path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(c.dir, key.String()+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = bytecode.WriteTo(file)
+	err = errors.Join(err, file.Close())
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+
+	return err
+}
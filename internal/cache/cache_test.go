@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"monkey/internal/compiler"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	c := New("")
+
+	parsed := c.Parse("let a = 1; a", 0)
+	assert.Empty(t, parsed.Errors)
+	assert.Same(t, parsed, c.Parse("let a = 1; a", 0))
+	assert.NotSame(t, parsed, c.Parse("let a = 1; a ", 0))
+
+	assert.NotEmpty(t, c.Parse("let = 1", 0).Errors)
+}
+
+func TestCompile(t *testing.T) {
+	c := New("")
+
+	bytecode, err := c.Compile("let a = 1; a + 2", 0)
+	if assert.NoError(t, err) {
+		again, _ := c.Compile("let a = 1; a + 2", 0)
+		assert.Same(t, bytecode, again)
+	}
+
+	_, err = c.Compile("let = 1", 0)
+	assert.IsType(t, &compiler.Error{}, err)
+
+	_, err = c.Compile("a + 1", 0)
+	assert.EqualError(t, err, "line 1, column 1: identifier not found: a")
+}
+
+func TestCompileOnDisk(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "monkey")
+	source := `let f = fn(x) { x * 2 }; f("ab")`
+
+	bytecode, err := New(dir).Compile(source, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	path := filepath.Join(dir, KeyOf(source, 0).String()+".mbc")
+	assert.FileExists(t, path)
+
+	// another cache, like the one of the next process, reads the bytecode back instead of compiling it
+	read, err := New(dir).Compile(source, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, bytecode.Instructions, read.Instructions)
+		assert.Equal(t, bytecode.Constants, read.Constants)
+		assert.Equal(t, bytecode.Globals, read.Globals)
+	}
+
+	// bytecode that can't be read is compiled again, and replaced
+	assert.NoError(t, os.WriteFile(path, []byte("MBC\x00garbage"), 0o644))
+	read, err = New(dir).Compile(source, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, bytecode.Instructions, read.Instructions)
+	}
+	file, err := os.Open(path)
+	if assert.NoError(t, err) {
+		defer file.Close()
+		_, err = compiler.ReadBytecode(file)
+		assert.NoError(t, err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+}
+
+func TestKeyOf(t *testing.T) {
+	assert.Equal(t, KeyOf("1", 0), KeyOf("1", 0))
+	assert.NotEqual(t, KeyOf("1", 0), KeyOf("2", 0))
+	assert.NotEqual(t, KeyOf("1", 0), KeyOf("1", 1))
+}
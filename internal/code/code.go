@@ -0,0 +1,232 @@
+// Package code defines the bytecode the compiler emits and the virtual machine runs: instructions are an opcode
+// byte followed by its operands, big endian, each as wide as the definition of the opcode says.
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions are a sequence of encoded instructions.
+type Instructions []byte
+
+// Opcode is the first byte of an instruction, telling what it does.
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // pushes the constant at the index of its operand in the pool
+	OpPop                    // pops the top of the stack, the value of an expression statement
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpGreaterThan
+
+	OpMinus
+	OpBang
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpJumpNotTruthy // pops the condition and jumps to the offset of its operand if it isn't truthy
+	OpJump          // jumps to the offset of its operand
+
+	OpGetGlobal // pushes the global at the index of its operand
+	OpSetGlobal // sets the global at the index of its operand to the top of the stack, which stays there
+
+	OpArray // pops as many elements as its operand and pushes the array of them
+	OpHash  // pops as many keys and values as its operand, alternating, and pushes the hash of them
+	OpIndex // pops the index and what is indexed, and pushes the element
+	OpField // pops a hash and pushes the value of the field named by the constant of its operand
+
+	OpCall        // calls the function under the arguments on top of the stack, as many as its operand
+	OpReturnValue // returns the top of the stack
+
+	OpGetLocal // pushes the local at the index of its operand
+	OpSetLocal // sets the local at the index of its operand to the top of the stack, which stays there
+
+	// the locals closures capture are kept in bindings, which the closures share with the call
+	OpGetCell // pushes the value of the binding of the local at the index of its operand
+	OpSetCell // sets the binding of the local at the index of its operand to the top of the stack, which stays there
+
+	OpClosure // pushes a closure of the function constant at the index of its operand
+	OpGetFree // pushes the value of the free variable at the index of its operand
+
+	OpGetBuiltin // pushes the builtin at the index of its operand in the names of the builtins of the bytecode
+
+	// the instructions the optimizations of the compiler fuse pairs of instructions into
+	OpPopGlobal  // OpSetGlobal then OpPop: pops the top of the stack into the global at the index of its operand
+	OpPopLocal   // OpSetLocal then OpPop
+	OpPopCell    // OpSetCell then OpPop
+	OpJumpTruthy // OpBang then OpJumpNotTruthy: pops the condition and jumps to the offset of its operand if it is truthy
+)
+
+// Definition tells how an opcode is written out: its name and the width in bytes of each of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+	OpField: {"OpField", []int{2}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+
+	OpGetLocal: {"OpGetLocal", []int{1}},
+	OpSetLocal: {"OpSetLocal", []int{1}},
+
+	OpGetCell: {"OpGetCell", []int{1}},
+	OpSetCell: {"OpSetCell", []int{1}},
+
+	OpClosure: {"OpClosure", []int{2}},
+	OpGetFree: {"OpGetFree", []int{1}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+
+	OpPopGlobal:  {"OpPopGlobal", []int{2}},
+	OpPopLocal:   {"OpPopLocal", []int{1}},
+	OpPopCell:    {"OpPopCell", []int{1}},
+	OpJumpTruthy: {"OpJumpTruthy", []int{2}},
+}
+
+// Lookup returns the definition of the opcode.
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make returns the instruction of the opcode with the operands, empty for an undefined opcode.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 1:
+			instruction[offset] = byte(o)
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction of the definition, ins starting right after the opcode,
+// and returns them with the number of bytes they take.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint8 decodes a one byte operand.
+func ReadUint8(ins Instructions) uint8 { return ins[0] }
+
+// ReadUint16 decodes a two byte operand.
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// String disassembles the instructions, one per line prefixed with its offset.
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
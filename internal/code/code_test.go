@@ -0,0 +1,79 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpJump, []int{258}, []byte{byte(OpJump), 1, 2}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, Make(tt.op, tt.operands...))
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpField, 1),
+	}
+
+	expected := `0000 OpAdd
+0001 OpConstant 2
+0004 OpConstant 65535
+0007 OpField 1
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	assert.Equal(t, expected, concatted.String())
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpPop, []int{}, 0},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		assert.Equal(t, tt.bytesRead, n)
+		assert.Equal(t, tt.operands, operandsRead)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	def, err := Lookup(byte(OpJumpNotTruthy))
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Definition{"OpJumpNotTruthy", []int{2}}, def)
+	}
+
+	_, err = Lookup(255)
+	assert.EqualError(t, err, "opcode 255 undefined")
+}
@@ -0,0 +1,230 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/internal/object"
+)
+
+// Version is the version of the bytecode the compiler emits. It changes whenever the opcodes or the way bytecode
+// is written out do, so that bytecode written by another version isn't run with the wrong meaning.
+const Version = 4
+
+// magic starts every file of bytecode, the .mbc files
+var magic = []byte("MBC\x00")
+
+// the kinds of constants in a file
+const (
+	dataConstant     byte = iota // marshaled with object.Marshal
+	functionConstant             // a compiled function, as the JSON of an encodedFunction
+)
+
+// encodedFunction is the JSON form of a compiled function
+type encodedFunction struct {
+	Instructions []byte                `json:"instructions"`
+	Parameters   []string              `json:"parameters"`
+	Locals       []string              `json:"locals"`
+	Free         []object.FreeVariable `json:"free,omitempty"`
+	Body         string                `json:"body"`
+	Name         string                `json:"name,omitempty"`
+	Doc          string                `json:"doc,omitempty"`
+}
+
+// WriteTo writes the bytecode out: the magic and the version, then the instructions, the constants and the names
+// of the globals and of the builtins, each preceded by its length. ReadBytecode reads it back.
+func (b *Bytecode) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	buf.Write(magic)
+	writeUint32(&buf, Version)
+
+	writeUint32(&buf, uint32(len(b.Instructions)))
+	buf.Write(b.Instructions)
+
+	writeUint32(&buf, uint32(len(b.Constants)))
+	for i, constant := range b.Constants {
+		kind, data, err := encodeConstant(constant)
+		if err != nil {
+			return 0, fmt.Errorf("constant %d: %w", i, err)
+		}
+		buf.WriteByte(kind)
+		writeUint32(&buf, uint32(len(data)))
+		buf.Write(data)
+	}
+
+	writeNames(&buf, b.Globals)
+	writeNames(&buf, b.Builtins)
+
+	return buf.WriteTo(w)
+}
+
+// ReadBytecode reads the bytecode WriteTo wrote. It returns an error for bytecode of another version.
+func ReadBytecode(r io.Reader) (*Bytecode, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, header); err != nil || !bytes.Equal(header, magic) {
+		return nil, errors.New("not monkey bytecode")
+	}
+
+	version, err := readUint32(br)
+	if err != nil {
+		return nil, err
+	}
+	if version != Version {
+		return nil, fmt.Errorf("bytecode version %d isn't supported, want %d: compile the program again", version, Version)
+	}
+
+	instructions, err := readBytes(br)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := readUint32(br)
+	if err != nil {
+		return nil, err
+	}
+	var constants []object.Object
+	for i := 0; i < int(count); i++ {
+		kind, err := br.ReadByte()
+		if err != nil {
+			return nil, truncated(err)
+		}
+		data, err := readBytes(br)
+		if err != nil {
+			return nil, err
+		}
+		constant, err := decodeConstant(kind, data)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+		constants = append(constants, constant)
+	}
+
+	globals, err := readNames(br)
+	if err != nil {
+		return nil, err
+	}
+	builtins, err := readNames(br)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bytecode{Instructions: instructions, Constants: constants, Globals: globals, Builtins: builtins}, nil
+}
+
+// writeNames writes the names, preceded by how many there are
+func writeNames(buf *bytes.Buffer, names []string) {
+	writeUint32(buf, uint32(len(names)))
+	for _, name := range names {
+		writeUint32(buf, uint32(len(name)))
+		buf.WriteString(name)
+	}
+}
+
+func readNames(r io.Reader) ([]string, error) {
+	count, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for i := 0; i < int(count); i++ {
+		name, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, string(name))
+	}
+
+	return names, nil
+}
+
+// encodeConstant returns the kind of the constant and its encoded form
+func encodeConstant(constant object.Object) (byte, []byte, error) {
+	fn, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		data, err := object.Marshal(constant)
+		return dataConstant, data, err
+	}
+
+	data, err := json.Marshal(encodedFunction{
+		Instructions: fn.Instructions,
+		Parameters:   fn.Parameters,
+		Locals:       fn.Locals,
+		Free:         fn.Free,
+		Body:         fn.Body,
+		Name:         fn.Name,
+		Doc:          fn.Doc,
+	})
+	return functionConstant, data, err
+}
+
+func decodeConstant(kind byte, data []byte) (object.Object, error) {
+	switch kind {
+	case dataConstant:
+		return object.Unmarshal(data)
+	case functionConstant:
+		var fn encodedFunction
+		if err := json.Unmarshal(data, &fn); err != nil {
+			return nil, err
+		}
+		return &object.CompiledFunction{
+			Instructions: fn.Instructions,
+			Parameters:   fn.Parameters,
+			Locals:       fn.Locals,
+			Free:         fn.Free,
+			Body:         fn.Body,
+			Name:         fn.Name,
+			Doc:          fn.Doc,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown kind %d", kind)
+	}
+}
+
+func writeUint32(buf *bytes.Buffer, n uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], n)
+	buf.Write(b[:])
+}
+
+func readUint32(r io.Reader) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, truncated(err)
+	}
+
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+// readBytes reads bytes preceded by their length
+func readBytes(r io.Reader) ([]byte, error) {
+	n, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// not allocating the length up front, which a corrupted file could make huge
+	b, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != int(n) {
+		return nil, truncated(io.ErrUnexpectedEOF)
+	}
+
+	return b, nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New("truncated bytecode")
+	}
+
+	return err
+}
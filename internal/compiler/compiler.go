@@ -0,0 +1,740 @@
+// Package compiler compiles trees to the bytecode of package code, which the virtual machine runs faster than the
+// evaluator walks the tree. The compiler walks the tree once, emitting the instructions of every node after the
+// ones of its children, and puts the values of literals in a pool of constants the instructions refer to.
+//
+// Programs are resolved before they are compiled, so that the uses of names that can't work, like a name that
+// isn't declared, are reported before the program runs rather than when the virtual machine gets to them.
+//
+// The compiler optimizes as it goes, unless told not to: it folds the operations on constants with ast.FoldScalars
+// first, leaves out the branches of conditions known ahead and the statements whose value isn't used or that never
+// run, and fuses pairs of instructions that often come together into one.
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"monkey/internal/ast"
+	"monkey/internal/code"
+	"monkey/internal/diagnostics"
+	"monkey/internal/evaluator"
+	"monkey/internal/object"
+	"monkey/internal/resolver"
+	"monkey/internal/token"
+	"strings"
+)
+
+// GlobalsSize is how many globals a program can declare, as many as the operand of OpGetGlobal can tell apart.
+const GlobalsSize = 1 << 16
+
+// The limits of the operands of the instructions using locals and calling functions.
+const (
+	MaxLocals    = 1 << 8
+	MaxArguments = 1<<8 - 1
+)
+
+type (
+	// Compiler compiles trees to bytecode. Compiling several programs with the same compiler, or with compilers
+	// sharing their state, appends them to the same bytecode.
+	Compiler struct {
+		constants   []object.Object
+		symbolTable *SymbolTable
+		builtins    []string
+		info        *resolver.Info // of the program being compiled
+		optimize    bool
+
+		scopes     []CompilationScope
+		scopeIndex int
+	}
+
+	// CompilationScope holds the instructions emitted for the program or for the function being compiled.
+	CompilationScope struct {
+		instructions        code.Instructions
+		lastInstruction     EmittedInstruction
+		previousInstruction EmittedInstruction
+
+		captured map[string]bool // the locals of the function that closures capture, kept in bindings
+		target   int             // the last position a jump was pointed to, which can't be fused with what's before
+	}
+
+	// EmittedInstruction is an instruction the compiler emitted, kept to change it afterwards.
+	EmittedInstruction struct {
+		Opcode   code.Opcode
+		Position int
+	}
+
+	// Bytecode is what the compiler emitted: the instructions and the constants they refer to.
+	Bytecode struct {
+		Instructions code.Instructions
+		Constants    []object.Object
+		Globals      []string // the names of the globals, by their index
+		Builtins     []string // the names of the builtins, by their index
+	}
+
+	// Error is the error of compiling a program whose uses of names can't work, with a diagnostic for each.
+	Error struct {
+		Diagnostics []diagnostics.Diagnostic
+	}
+)
+
+func (e *Error) Error() string {
+	lines := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		lines[i] = d.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// RenderError writes why the source couldn't be compiled to w: the diagnostics of an *Error under the lines they
+// point at, or any other error on a line of its own.
+func RenderError(w io.Writer, source string, err error) {
+	if cerr, ok := err.(*Error); ok {
+		diagnostics.RenderAll(w, source, cerr.Diagnostics)
+		return
+	}
+
+	fmt.Fprintf(w, "ERROR: %s\n", err)
+}
+
+// fusedPops are the instructions the instructions setting a name are fused into when followed by OpPop
+var fusedPops = map[code.Opcode]code.Opcode{
+	code.OpSetGlobal: code.OpPopGlobal,
+	code.OpSetLocal:  code.OpPopLocal,
+	code.OpSetCell:   code.OpPopCell,
+}
+
+// operators are the opcodes of the infix operators
+var operators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), nil)
+}
+
+// NewWithState returns a compiler that goes on with the symbols and constants of another one, like the repl does
+// for every line.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	builtins := evaluator.BuiltinNames()
+	for i, name := range builtins {
+		s.DefineBuiltin(i, name)
+	}
+
+	return &Compiler{
+		constants:   constants,
+		symbolTable: s,
+		builtins:    builtins,
+		optimize:    true,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// Optimize turns the optimizations of the compiler on or off, see the package documentation. They are on by
+// default: without them, the instructions follow the tree node by node, which helps to debug the compiler.
+func (c *Compiler) Optimize(on bool) {
+	c.optimize = on
+}
+
+// Compile emits the instructions of the node. It returns an error for the nodes that can't be compiled, like an
+// identifier that isn't declared.
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		if c.optimize {
+			node = ast.FoldScalars(node)
+		}
+		if err := c.resolve(node); err != nil {
+			return err
+		}
+
+		c.declareLets(node.Statements)
+		return c.compileStatements(node.Statements)
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		return c.compileStatements(node.Statements)
+	case *ast.LetStatement:
+		name, ok := node.Name.(*ast.Identifier)
+		if !ok {
+			return fmt.Errorf("cannot assign to %s", node.Name)
+		}
+
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			if err := c.compileFunction(fn, name.Value, node.Doc.Text()); err != nil {
+				return err
+			}
+		} else if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		symbol := c.symbolTable.Define(name.Value)
+		switch {
+		case symbol.Scope == GlobalScope:
+			if symbol.Index >= GlobalsSize {
+				return fmt.Errorf("too many globals: more than %d", GlobalsSize)
+			}
+			c.emit(code.OpSetGlobal, symbol.Index)
+		case c.scopes[c.scopeIndex].captured[symbol.Name]:
+			c.emit(code.OpSetCell, symbol.Index)
+		default:
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+		c.emit(code.OpPop) // the value of the let is the value of the statement, like for expressions
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("identifier not found: %s", node.Value)
+		}
+		return c.loadSymbol(symbol)
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "", "")
+	case *ast.CallExpression:
+		if len(node.Arguments) > MaxArguments {
+			return fmt.Errorf("too many arguments: more than %d", MaxArguments)
+		}
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, arg := range node.Arguments {
+			if err := c.Compile(arg); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(object.NewInteger(node.Value)))
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogical(node)
+		}
+		op, ok := operators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+	case *ast.IfExpression:
+		return c.compileIf(node)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		// the pairs are compiled in the order they appear in the source, each key before its value
+		keys := node.Keys()
+		for _, key := range keys {
+			if err := c.Compile(key); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Hash[key]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(keys)*2)
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if node.Token != nil && node.Token.Type == token.PERIOD {
+			name := node.Index.(*ast.Identifier).Value
+			c.emit(code.OpField, c.addConstant(&object.String{Value: name}))
+			return nil
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.ForExpression:
+		return unsupported(node, "for loops")
+	case *ast.AssignExpression:
+		return unsupported(node, "assignments")
+	case *ast.BreakStatement:
+		return unsupported(node, "break statements")
+	case *ast.ContinueStatement:
+		return unsupported(node, "continue statements")
+	case *ast.TryExpression:
+		return unsupported(node, "try expressions")
+	case *ast.ThrowStatement:
+		return unsupported(node, "throw statements")
+	default:
+		return fmt.Errorf("cannot compile %T yet", node)
+	}
+
+	return nil
+}
+
+// unsupported returns the error of compiling a node the virtual machine has no instructions for, pointing at it
+func unsupported(node ast.Node, what string) error {
+	return &Error{Diagnostics: []diagnostics.Diagnostic{
+		diagnostics.At(ast.TokenOf(node), "%s are not supported by the virtual machine yet", what),
+	}}
+}
+
+// compileStatements emits the statements of a program or block. Optimizing, it leaves out the statements after a
+// return, which never run, and the expressions that can't fail whose value isn't used, which are all but the last.
+func (c *Compiler) compileStatements(stmts []ast.Statement) error {
+	for i, s := range stmts {
+		if c.optimize && i < len(stmts)-1 {
+			if s, ok := s.(*ast.ExpressionStatement); ok && c.pure(s.Expression) {
+				continue
+			}
+		}
+
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+
+		if _, ok := s.(*ast.ReturnStatement); ok && c.optimize {
+			break
+		}
+	}
+
+	return nil
+}
+
+// pure reports whether evaluating the expression can't fail or have effects, so that it can be left out when its
+// value isn't used. The operations on constants are literals once folded.
+func (c *Compiler) pure(node ast.Expression) bool {
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean, *ast.FunctionLiteral:
+		return true
+	}
+
+	return false
+}
+
+// constant returns the value of a literal, nil for other expressions
+func (c *Compiler) constant(node ast.Expression) object.Object {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return object.NewInteger(node.Value)
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.Boolean:
+		if node.Value {
+			return object.TRUE
+		}
+		return object.FALSE
+	}
+
+	return nil
+}
+
+// resolve reports the uses of names in the program that can't work, with the builtins and the globals of the
+// programs compiled before it declared
+func (c *Compiler) resolve(program *ast.Program) error {
+	predeclared := evaluator.BuiltinNames()
+	for name := range c.symbolTable.store {
+		predeclared = append(predeclared, name)
+	}
+
+	c.info = resolver.Resolve(program, predeclared...)
+	if errs := c.info.Errors(); len(errs) > 0 {
+		return &Error{Diagnostics: errs}
+	}
+
+	return nil
+}
+
+// declareLets declares the names the statements declare with let ahead, not looking into the functions in them
+func (c *Compiler) declareLets(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.FunctionLiteral:
+				return false
+			case *ast.LetStatement:
+				if name, ok := n.Name.(*ast.Identifier); ok {
+					c.symbolTable.Declare(name.Value)
+				}
+			}
+
+			return true
+		})
+	}
+}
+
+// loadSymbol emits the instruction pushing the value of the symbol
+func (c *Compiler) loadSymbol(s Symbol) error {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		if c.scopes[c.scopeIndex].captured[s.Name] {
+			c.emit(code.OpGetCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocal, s.Index)
+		}
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	}
+
+	return nil
+}
+
+// captured returns the locals of the function that the functions nested in it capture, as the resolver found
+func (c *Compiler) captured(node *ast.FunctionLiteral) map[string]bool {
+	captured := map[string]bool{}
+	if c.info == nil {
+		return captured
+	}
+
+	scope := c.info.Scopes[node]
+	if scope == nil {
+		return captured
+	}
+	for _, child := range scope.Children {
+		for _, sym := range child.Free {
+			if sym.Scope == scope {
+				captured[sym.Name] = true
+			}
+		}
+	}
+
+	return captured
+}
+
+// compileFunction emits the function of the literal, with the name and doc of the let declaring it if any
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name, doc string) error {
+	if len(node.Parameters) > MaxArguments {
+		return fmt.Errorf("too many parameters: more than %d", MaxArguments)
+	}
+
+	c.enterScope()
+	captured := c.captured(node)
+	c.scopes[c.scopeIndex].captured = captured
+
+	params := make([]string, len(node.Parameters))
+	for i, param := range node.Parameters {
+		symbol := c.symbolTable.Define(param.Value)
+		params[i] = param.Value
+
+		if captured[param.Value] {
+			// moving the argument to the binding closures capture
+			c.emit(code.OpGetLocal, symbol.Index)
+			c.emit(code.OpSetCell, symbol.Index)
+			c.emit(code.OpPop)
+		}
+	}
+	c.declareLets(node.Body.Statements)
+	if c.symbolTable.NumDefinitions() > MaxLocals {
+		c.leaveScope()
+		return fmt.Errorf("too many locals: more than %d", MaxLocals)
+	}
+
+	if err := c.compileBlockValue(node.Body); err != nil {
+		c.leaveScope()
+		return err
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturnValue)
+	}
+
+	locals := c.symbolTable.Names()
+	freeSymbols := c.symbolTable.FreeSymbols
+	instructions := c.leaveScope()
+
+	var free []object.FreeVariable
+	for _, s := range freeSymbols {
+		free = append(free, object.FreeVariable{Name: s.Name, Local: s.Scope == LocalScope, Index: s.Index})
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions: instructions,
+		Parameters:   params,
+		Locals:       locals,
+		Free:         free,
+		Body:         node.Body.String(),
+		Name:         name,
+		Doc:          doc,
+	}
+	c.emit(code.OpClosure, c.addConstant(fn))
+
+	return nil
+}
+
+// compileIf emits the condition, the consequence and the alternative, null if there's none, with jumps around
+// the one not taken. Optimizing, a condition known at compile time only emits the branch taken.
+func (c *Compiler) compileIf(node *ast.IfExpression) error {
+	if condition := c.constant(node.Condition); c.optimize && condition != nil {
+		switch {
+		case evaluator.IsTruthy(condition):
+			return c.compileBlockValue(node.Consequence)
+		case node.Alternative == nil:
+			c.emit(code.OpNull)
+			return nil
+		default:
+			return c.compileBlockValue(node.Alternative)
+		}
+	}
+
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+
+	// a consequence that returns doesn't need to jump over the alternative
+	jumpPos := -1
+	if !c.optimize || !c.lastInstructionIs(code.OpReturnValue) || c.jumpedTo() {
+		jumpPos = c.emit(code.OpJump, 9999)
+	}
+	c.jumpHere(jumpNotTruthyPos)
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative); err != nil {
+		return err
+	}
+	if jumpPos >= 0 {
+		c.jumpHere(jumpPos)
+	}
+
+	return nil
+}
+
+// compileLogical emits && and || with jumps, so that the right side only runs when the left one doesn't decide the
+// result already: the left side jumps to the result it decides, the right side to false when it isn't truthy.
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	var toTrue, toFalse []int
+	if node.Operator == "||" {
+		toTrue = append(toTrue, c.emit(code.OpJumpTruthy, 9999))
+	} else {
+		toFalse = append(toFalse, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	toFalse = append(toFalse, c.emit(code.OpJumpNotTruthy, 9999))
+
+	for _, pos := range toTrue {
+		c.jumpHere(pos)
+	}
+	c.emit(code.OpTrue)
+	end := c.emit(code.OpJump, 9999)
+
+	for _, pos := range toFalse {
+		c.jumpHere(pos)
+	}
+	c.emit(code.OpFalse)
+	c.jumpHere(end)
+
+	return nil
+}
+
+// compileBlockValue emits the block leaving the value of its last statement on the stack, null if it is empty
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if len(block.Statements) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) || c.lastInstructionPops() {
+		c.removeLastPop()
+	}
+
+	return nil
+}
+
+// Bytecode returns what the compiler emitted so far.
+func (c *Compiler) Bytecode() *Bytecode {
+	global := c.symbolTable
+	for global.Outer != nil {
+		global = global.Outer
+	}
+
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		Globals:      global.Names(),
+		Builtins:     c.builtins,
+	}
+}
+
+// SymbolTable returns the symbols of the programs compiled so far, see NewWithState.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// enterScope starts emitting the instructions of a function, with its symbols
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveScope returns the instructions of the function, going back to the scope enclosing it
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit appends the instruction and returns its position. Optimizing, it fuses the instruction with the last one
+// when they often come together, unless a jump points between them.
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	scope := &c.scopes[c.scopeIndex]
+	if c.optimize && len(scope.instructions) > 0 && !c.jumpedTo() {
+		last := scope.lastInstruction
+		if fused, ok := fusedPops[last.Opcode]; ok && op == code.OpPop {
+			// the fused instruction has the same operand as the one setting the name
+			scope.instructions[last.Position] = byte(fused)
+			scope.lastInstruction.Opcode = fused
+			return last.Position
+		}
+		if last.Opcode == code.OpBang && op == code.OpJumpNotTruthy {
+			scope.instructions = scope.instructions[:last.Position]
+			scope.lastInstruction = scope.previousInstruction
+			op = code.OpJumpTruthy
+		}
+	}
+
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = EmittedInstruction{Opcode: op, Position: pos}
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	return len(c.currentInstructions()) > 0 && c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+// lastInstructionPops reports whether the last instruction is one fused with OpPop
+func (c *Compiler) lastInstructionPops() bool {
+	for _, fused := range fusedPops {
+		if c.lastInstructionIs(fused) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeLastPop removes the last OpPop, or splits it off of the instruction it was fused with
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	for set, fused := range fusedPops {
+		if scope.lastInstruction.Opcode == fused {
+			scope.instructions[scope.lastInstruction.Position] = byte(set)
+			scope.lastInstruction.Opcode = set
+			return
+		}
+	}
+
+	scope.instructions = scope.instructions[:scope.lastInstruction.Position]
+	scope.lastInstruction = scope.previousInstruction
+}
+
+// replaceInstruction overwrites the instruction at pos with one of the same length
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	copy(c.currentInstructions()[pos:], newInstruction)
+}
+
+// jumpHere points the jump at pos to the end of the instructions, where the next instruction goes
+func (c *Compiler) jumpHere(pos int) {
+	target := len(c.currentInstructions())
+	c.changeOperand(pos, target)
+	c.scopes[c.scopeIndex].target = target
+}
+
+// jumpedTo reports whether a jump points to the end of the instructions
+func (c *Compiler) jumpedTo() bool {
+	scope := c.scopes[c.scopeIndex]
+	return scope.target == len(scope.instructions) && scope.target > 0
+}
+
+// changeOperand changes the operand of the instruction at pos, like the target of a jump once it is known
+func (c *Compiler) changeOperand(pos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[pos])
+	c.replaceInstruction(pos, code.Make(op, operand))
+}
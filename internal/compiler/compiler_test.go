@@ -0,0 +1,706 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/internal/ast"
+	"monkey/internal/code"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if !assert.Empty(t, p.Errors(), "input: %q", input) {
+		t.FailNow()
+	}
+
+	return program
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		compiler := New()
+		compiler.Optimize(false) // the instructions of every node, TestOptimizations tests what they become
+		if !assert.NoError(t, compiler.Compile(parse(t, tt.input)), "input: %q", tt.input) {
+			continue
+		}
+
+		bytecode := compiler.Bytecode()
+		assert.Equal(t, concatInstructions(tt.expectedInstructions).String(), bytecode.Instructions.String(), "input: %q", tt.input)
+		assert.Equal(t, len(tt.expectedConstants), len(bytecode.Constants), "input: %q", tt.input)
+		for i, constant := range tt.expectedConstants {
+			if i >= len(bytecode.Constants) {
+				break
+			}
+			switch constant := constant.(type) {
+			case int:
+				assert.Equal(t, object.NewInteger(int64(constant)), bytecode.Constants[i], "input: %q", tt.input)
+			case string:
+				assert.Equal(t, &object.String{Value: constant}, bytecode.Constants[i], "input: %q", tt.input)
+			case []code.Instructions:
+				fn, ok := bytecode.Constants[i].(*object.CompiledFunction)
+				if assert.True(t, ok, "constant %d is not a function. input: %q", i, tt.input) {
+					assert.Equal(t, concatInstructions(constant).String(), fn.Instructions.String(), "input: %q", tt.input)
+				}
+			}
+		}
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "2 / 1 * 3",
+			expectedConstants: []interface{}{2, 1, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDiv),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1 - 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSub),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true; false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// < keeps its operands in order, the left one is evaluated first
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "!(1 != 2) == true",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpNotEqual),
+				code.Make(code.OpBang),
+				code.Make(code.OpTrue),
+				code.Make(code.OpEqual),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 10), // 0001
+				code.Make(code.OpConstant, 0),       // 0004
+				code.Make(code.OpJump, 11),          // 0007
+				code.Make(code.OpNull),              // 0010
+				code.Make(code.OpPop),               // 0011
+				code.Make(code.OpConstant, 1),       // 0012
+				code.Make(code.OpPop),               // 0015
+			},
+		},
+		{
+			input:             "if (true) { 10 } else { 20 }; 3333;",
+			expectedConstants: []interface{}{10, 20, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 10), // 0001
+				code.Make(code.OpConstant, 0),       // 0004
+				code.Make(code.OpJump, 13),          // 0007
+				code.Make(code.OpConstant, 1),       // 0010
+				code.Make(code.OpPop),               // 0013
+				code.Make(code.OpConstant, 2),       // 0014
+				code.Make(code.OpPop),               // 0017
+			},
+		},
+		{
+			input:             "if (true) { } else { let x = 1 }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 8), // 0001
+				code.Make(code.OpNull),             // 0004
+				code.Make(code.OpJump, 14),         // 0005
+				code.Make(code.OpConstant, 0),      // 0008
+				code.Make(code.OpSetGlobal, 0),     // 0011
+				code.Make(code.OpPop),              // 0014
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; let two = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let one = 1; let one = one; one",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStringsArraysAndHashes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"mon", "key"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2][0]",
+			expectedConstants: []interface{}{1, 2, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `{"b": 1, "a": 2}.a`,
+			expectedConstants: []interface{}{"b", 1, "a", 2, "a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpField, 4),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x + 1", "line 1, column 1: identifier not found: x"},
+		{"x; let x = 1; y", "line 1, column 1: x used before it is declared on line 1\nline 1, column 15: identifier not found: y"},
+		{"let n = 0; for (;;) { n }", "line 1, column 12: for loops are not supported by the virtual machine yet"},
+		{"let n = 0;\nn = n + 1", "line 2, column 3: assignments are not supported by the virtual machine yet"},
+		{"try { 1 } catch (e) { e }", "line 1, column 1: try expressions are not supported by the virtual machine yet"},
+		{"let f = fn() { throw \"no\" }; f()", "line 1, column 16: throw statements are not supported by the virtual machine yet"},
+	}
+
+	for _, tt := range tests {
+		assert.EqualError(t, New().Compile(parse(t, tt.input)), tt.expected, "input: %q", tt.input)
+	}
+
+	// break and continue only parse in loops, which are reported first, so they are compiled on their own
+	loop := parse(t, "for (;;) { break; continue; }").Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ForExpression)
+	assert.EqualError(t, New().Compile(loop.Body.Statements[0]), "line 1, column 12: break statements are not supported by the virtual machine yet")
+	assert.EqualError(t, New().Compile(loop.Body.Statements[1]), "line 1, column 19: continue statements are not supported by the virtual machine yet")
+
+	var out bytes.Buffer
+	RenderError(&out, "x + 1", New().Compile(parse(t, "x + 1")))
+	assert.Equal(t, "line 1, column 1: identifier not found: x\n    x + 1\n    ^\n", out.String())
+
+	out.Reset()
+	RenderError(&out, "", fmt.Errorf("cache: %w", os.ErrPermission))
+	assert.Equal(t, "ERROR: cache: permission denied\n", out.String())
+}
+
+func TestCompilerState(t *testing.T) {
+	first := New()
+	assert.NoError(t, first.Compile(parse(t, "let x = 1;")))
+
+	second := NewWithState(first.SymbolTable(), first.Bytecode().Constants)
+	assert.NoError(t, second.Compile(parse(t, "x + 2")))
+	assert.Equal(t, []object.Object{object.NewInteger(1), object.NewInteger(2)}, second.Bytecode().Constants)
+	assert.Equal(t, concatInstructions([]code.Instructions{
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpAdd),
+		code.Make(code.OpPop),
+	}), second.Bytecode().Instructions)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "let f = fn(a) { let b = a; b }; f(1)",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }; fn() { return 1; }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpNull),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a global declared after the function is already declared in it
+			input: "let f = fn() { g }; let g = 1;",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// x is the global until the let of the function declares it
+			input: "let x = 1; fn() { let y = x; let x = 2; }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	c := New()
+	assert.NoError(t, c.Compile(parse(t, "/// adds\nlet add = fn(a, b) { let c = a + b; c };")))
+	assert.Equal(t, &object.CompiledFunction{
+		Instructions: c.Bytecode().Constants[0].(*object.CompiledFunction).Instructions,
+		Parameters:   []string{"a", "b"},
+		Locals:       []string{"a", "b", "c"},
+		Body:         "let c = (a + b);c",
+		Name:         "add",
+		Doc:          "adds",
+	}, c.Bytecode().Constants[0])
+	assert.Equal(t, []string{"add"}, c.Bytecode().Globals)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetCell, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpClosure, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the innermost function captures a from the closure in between
+			input: "fn(a) { let b = 1; fn() { fn() { a + b } } }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetCell, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetCell, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpClosure, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `len("a")`,
+			expectedConstants: []interface{}{"a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, indexOf(evaluator.BuiltinNames(), "len")),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	c := New()
+	assert.NoError(t, c.Compile(parse(t, "fn(a) { let b = 1; fn() { fn() { a + b } } }")))
+	assert.Equal(t, []object.FreeVariable{{Name: "a", Local: false, Index: 0}, {Name: "b", Local: false, Index: 1}},
+		c.Bytecode().Constants[1].(*object.CompiledFunction).Free)
+	assert.Equal(t, []object.FreeVariable{{Name: "a", Local: true, Index: 0}, {Name: "b", Local: true, Index: 1}},
+		c.Bytecode().Constants[2].(*object.CompiledFunction).Free)
+	assert.Equal(t, evaluator.BuiltinNames(), c.Bytecode().Builtins)
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func TestOptimizations(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string // the disassembly of the program
+		function  string // the disassembly of its last function, if it has one
+		constants []object.Object
+	}{
+		{
+			input:     "1 + 2 * 3",
+			expected:  "0000 OpConstant 0\n0003 OpPop\n",
+			constants: []object.Object{object.NewInteger(7)},
+		},
+		{
+			input:    `-(5 - 10) == 5; "a" != "a"`,
+			expected: "0000 OpFalse\n0001 OpPop\n",
+		},
+		{
+			// the result depends on whether the evaluator checks integers, or is an error
+			input: "9223372036854775807 + 1; 1 / 0",
+			expected: "0000 OpConstant 0\n0003 OpConstant 1\n0006 OpAdd\n0007 OpPop\n" +
+				"0008 OpConstant 2\n0011 OpConstant 3\n0014 OpDiv\n0015 OpPop\n",
+			constants: []object.Object{
+				object.NewInteger(9223372036854775807), object.NewInteger(1), object.NewInteger(1), object.NewInteger(0),
+			},
+		},
+		{
+			// the string could be longer than the evaluator allows
+			input:     `"a" + "b"`,
+			expected:  "0000 OpConstant 0\n0003 OpConstant 1\n0006 OpAdd\n0007 OpPop\n",
+			constants: []object.Object{&object.String{Value: "a"}, &object.String{Value: "b"}},
+		},
+		{
+			input:    "(true > false) == (false < true)",
+			expected: "0000 OpTrue\n0001 OpPop\n",
+		},
+		{
+			input:     "if (1 > 2) { 10 } else { 20 }; if (false) { 30 }",
+			expected:  "0000 OpConstant 0\n0003 OpPop\n0004 OpNull\n0005 OpPop\n",
+			constants: []object.Object{object.NewInteger(20)},
+		},
+		{
+			input:     `1; "a"; fn() { }; let a = 2; a`,
+			expected:  "0000 OpConstant 0\n0003 OpPopGlobal 0\n0006 OpGetGlobal 0\n0009 OpPop\n",
+			constants: []object.Object{object.NewInteger(2)},
+		},
+		{
+			input:     "let x = true; if (!x) { 1 }",
+			expected:  "0000 OpTrue\n0001 OpPopGlobal 0\n0004 OpGetGlobal 0\n0007 OpJumpTruthy 16\n0010 OpConstant 0\n0013 OpJump 17\n0016 OpNull\n0017 OpPop\n",
+			constants: []object.Object{object.NewInteger(1)},
+		},
+		{
+			// the jump over the alternative points between ! and the condition jump, so they aren't fused
+			input: "let x = true; if (if (x) { false } else { !x }) { 1 }",
+			expected: "0000 OpTrue\n0001 OpPopGlobal 0\n0004 OpGetGlobal 0\n0007 OpJumpNotTruthy 14\n0010 OpFalse\n" +
+				"0011 OpJump 18\n0014 OpGetGlobal 0\n0017 OpBang\n0018 OpJumpNotTruthy 27\n0021 OpConstant 0\n" +
+				"0024 OpJump 28\n0027 OpNull\n0028 OpPop\n",
+			constants: []object.Object{object.NewInteger(1)},
+		},
+		{
+			input:    "fn(a) { let b = a; b }",
+			expected: "0000 OpClosure 0\n0003 OpPop\n",
+			function: "0000 OpGetLocal 0\n0002 OpPopLocal 1\n0004 OpGetLocal 1\n0006 OpReturnValue\n",
+		},
+		{
+			input:    "fn(a) { let b = a }",
+			expected: "0000 OpClosure 0\n0003 OpPop\n",
+			function: "0000 OpGetLocal 0\n0002 OpSetLocal 1\n0004 OpReturnValue\n",
+		},
+		{
+			// the consequence returns, and nothing runs after a return
+			input:    "fn(a) { if (a) { return 1; } return 2; 3 }",
+			expected: "0000 OpClosure 2\n0003 OpPop\n",
+			function: "0000 OpGetLocal 0\n0002 OpJumpNotTruthy 9\n0005 OpConstant 0\n0008 OpReturnValue\n" +
+				"0009 OpNull\n0010 OpPop\n0011 OpConstant 1\n0014 OpReturnValue\n",
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		if !assert.NoError(t, compiler.Compile(parse(t, tt.input)), "input: %q", tt.input) {
+			continue
+		}
+
+		bytecode := compiler.Bytecode()
+		assert.Equal(t, tt.expected, bytecode.Instructions.String(), "input: %q", tt.input)
+		if tt.function != "" {
+			fn := bytecode.Constants[len(bytecode.Constants)-1].(*object.CompiledFunction)
+			assert.Equal(t, tt.function, fn.Instructions.String(), "input: %q", tt.input)
+		}
+		if tt.constants != nil {
+			assert.Equal(t, tt.constants, bytecode.Constants, "input: %q", tt.input)
+		}
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	assert.Equal(t, Symbol{Name: "a", Scope: GlobalScope, Index: 0}, global.Define("a"))
+	assert.Equal(t, Symbol{Name: "b", Scope: GlobalScope, Index: 1}, global.Define("b"))
+	assert.Equal(t, Symbol{Name: "a", Scope: GlobalScope, Index: 0}, global.Define("a"))
+	global.DefineBuiltin(0, "len")
+
+	first := NewEnclosedSymbolTable(global)
+	assert.Equal(t, Symbol{Name: "c", Scope: LocalScope, Index: 0}, first.Define("c"))
+	assert.Equal(t, Symbol{Name: "a", Scope: LocalScope, Index: 1}, first.Declare("a"))
+
+	second := NewEnclosedSymbolTable(first)
+	assert.Equal(t, Symbol{Name: "e", Scope: LocalScope, Index: 0}, second.Define("e"))
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{global, "b", Symbol{Name: "b", Scope: GlobalScope, Index: 1}},
+		{global, "len", Symbol{Name: "len", Scope: BuiltinScope, Index: 0}},
+		{first, "b", Symbol{Name: "b", Scope: GlobalScope, Index: 1}},
+		{first, "len", Symbol{Name: "len", Scope: BuiltinScope, Index: 0}},
+		{first, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}}, // declared ahead, not defined yet
+		{second, "e", Symbol{Name: "e", Scope: LocalScope, Index: 0}},
+		{second, "c", Symbol{Name: "c", Scope: FreeScope, Index: 0}},
+		{second, "a", Symbol{Name: "a", Scope: FreeScope, Index: 1}}, // nested functions see it already
+		{second, "c", Symbol{Name: "c", Scope: FreeScope, Index: 0}},
+	}
+
+	for _, tt := range tests {
+		symbol, ok := tt.table.Resolve(tt.name)
+		if assert.True(t, ok, tt.name) {
+			assert.Equal(t, tt.expected, symbol)
+		}
+	}
+	assert.Equal(t, []Symbol{{Name: "c", Scope: LocalScope, Index: 0}, {Name: "a", Scope: LocalScope, Index: 1}}, second.FreeSymbols)
+
+	first.Define("a")
+	symbol, _ := first.Resolve("a")
+	assert.Equal(t, Symbol{Name: "a", Scope: LocalScope, Index: 1}, symbol)
+
+	_, ok := second.Resolve("z")
+	assert.False(t, ok)
+}
+
+func TestBytecodeFiles(t *testing.T) {
+	compiler := New()
+	assert.NoError(t, compiler.Compile(parse(t, `let h = {"a": [1, "b"]}; let f = fn(x) { fn(y) { h.a[0] + x + y } }; f(2)(3)`)))
+
+	var buf bytes.Buffer
+	_, err := compiler.Bytecode().WriteTo(&buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	written := buf.Bytes()
+
+	read, err := ReadBytecode(bytes.NewReader(written))
+	if assert.NoError(t, err) {
+		assert.Equal(t, compiler.Bytecode().Instructions.String(), read.Instructions.String())
+		assert.Equal(t, compiler.Bytecode().Constants, read.Constants)
+		assert.Equal(t, []string{"h", "f"}, read.Globals)
+		assert.Equal(t, evaluator.BuiltinNames(), read.Builtins)
+	}
+
+	otherVersion := append([]byte(nil), written...)
+	otherVersion[7] = Version + 1
+	_, err = ReadBytecode(bytes.NewReader(otherVersion))
+	assert.EqualError(t, err, fmt.Sprintf("bytecode version %d isn't supported, want %d: compile the program again", Version+1, Version))
+
+	_, err = ReadBytecode(bytes.NewReader(written[:len(written)-3]))
+	assert.EqualError(t, err, "truncated bytecode")
+
+	_, err = ReadBytecode(bytes.NewReader([]byte("let x = 1;")))
+	assert.EqualError(t, err, "not monkey bytecode")
+}
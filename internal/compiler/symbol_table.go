@@ -0,0 +1,146 @@
+package compiler
+
+// SymbolScope tells where the value of a symbol is kept.
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"  // in the globals of the virtual machine
+	LocalScope   SymbolScope = "LOCAL"   // in the slots of the call of the function
+	FreeScope    SymbolScope = "FREE"    // captured from an enclosing function by the closure
+	BuiltinScope SymbolScope = "BUILTIN" // a builtin of the evaluator
+)
+
+// Symbol is a name the compiler resolved: where its value is kept, and at which index.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable holds the names declared in a scope: the program, with the builtins, or a function, enclosed by
+// the scope the function is declared in. The symbol table of the program is kept from one program to the next,
+// like from one line of the repl to the next, so that later programs can use what the earlier ones declared.
+//
+// A name is looked up like the evaluator looks it up in its environments. The lets of a scope are declared
+// ahead, before compiling its statements: they only count in the scope itself once their let is compiled, until
+// then the name still refers to what it refers to outside of the scope, but the functions nested in the scope
+// can already use them, like a function using a global declared after it.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	pending        map[string]bool // the names declared ahead, whose let wasn't compiled yet
+	numDefinitions int
+
+	// FreeSymbols holds the symbols of enclosing functions used in the scope, in the order of their index
+	FreeSymbols []Symbol
+	free        map[string]Symbol
+
+	builtins map[string]Symbol // for the program only
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		store:    map[string]Symbol{},
+		pending:  map[string]bool{},
+		free:     map[string]Symbol{},
+		builtins: map[string]Symbol{},
+	}
+}
+
+// NewEnclosedSymbolTable returns the symbol table of a function declared in the scope of outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define returns the symbol of the name, declaring it if it isn't yet. Declaring a name again keeps its index,
+// like a let binding a name again changes the value of the same binding in the evaluator.
+func (s *SymbolTable) Define(name string) Symbol {
+	delete(s.pending, name)
+	return s.define(name)
+}
+
+// Declare declares the name ahead, see SymbolTable. Define defines it once its let is compiled.
+func (s *SymbolTable) Declare(name string) Symbol {
+	if _, ok := s.store[name]; !ok {
+		s.pending[name] = true
+	}
+
+	return s.define(name)
+}
+
+func (s *SymbolTable) define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Scope: GlobalScope, Index: s.numDefinitions}
+	if s.Outer != nil {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// DefineBuiltin declares the builtin with the name, at the index of the builtin.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.builtins[name] = symbol
+	return symbol
+}
+
+// defineFree returns the symbol capturing the original one, of an enclosing function, in the closure
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.free[original.Name] = symbol
+	return symbol
+}
+
+// Resolve returns the symbol of the name, false if it isn't declared. A name of an enclosing function is captured
+// as a free symbol of every function in between.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	return s.resolve(name, false)
+}
+
+// resolve resolves the name, for a nested scope if nested: the names declared ahead count then
+func (s *SymbolTable) resolve(name string, nested bool) (Symbol, bool) {
+	if symbol, ok := s.store[name]; ok && (nested || !s.pending[name]) {
+		return symbol, true
+	}
+	if symbol, ok := s.free[name]; ok {
+		return symbol, true
+	}
+
+	if s.Outer == nil {
+		symbol, ok := s.builtins[name]
+		return symbol, ok
+	}
+
+	symbol, ok := s.Outer.resolve(name, true)
+	if !ok || symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// NumDefinitions returns how many names the scope declares, the number of globals or of slots of a call.
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// Names returns the names the scope declares, by their index.
+func (s *SymbolTable) Names() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		names[symbol.Index] = name
+	}
+
+	return names
+}
@@ -0,0 +1,99 @@
+// Package cover measures the coverage of programs: which of their statements ran, as told by the Statement hook of
+// an evaluator. Blocks aren't statements of their own here, the statements in them are.
+package cover
+
+import (
+	"fmt"
+	"io"
+	"monkey/internal/ast"
+	"strings"
+	"sync"
+)
+
+// Profile records the statements that ran. It is safe to record from several goroutines at once.
+type Profile struct {
+	mu  sync.Mutex
+	ran map[ast.Statement]bool
+}
+
+// New returns an empty profile.
+func New() *Profile {
+	return &Profile{ran: map[ast.Statement]bool{}}
+}
+
+// Record records that the statement ran, it is meant to be the Statement hook of an evaluator.
+func (p *Profile) Record(stmt ast.Statement) {
+	p.mu.Lock()
+	p.ran[stmt] = true
+	p.mu.Unlock()
+}
+
+// Ran reports whether the statement ran.
+func (p *Profile) Ran(stmt ast.Statement) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ran[stmt]
+}
+
+// Coverage returns how many of the statements of the program ran, and how many there are.
+func (p *Profile) Coverage(program *ast.Program) (ran, total int) {
+	for _, stmt := range statements(program) {
+		if p.Ran(stmt) {
+			ran++
+		}
+		total++
+	}
+
+	return ran, total
+}
+
+// Percent returns the share of the statements of the program that ran, 100 for a program without statements.
+func (p *Profile) Percent(program *ast.Program) float64 {
+	ran, total := p.Coverage(program)
+	if total == 0 {
+		return 100
+	}
+
+	return 100 * float64(ran) / float64(total)
+}
+
+// Annotate writes the source of the program one numbered line at a time, marked with + when the statements
+// starting on it all ran, with - when some didn't, and left unmarked without statements.
+func (p *Profile) Annotate(w io.Writer, program *ast.Program, source string) error {
+	marks := map[int]byte{}
+	for _, stmt := range statements(program) {
+		line := ast.TokenOf(stmt).Line
+		if !p.Ran(stmt) {
+			marks[line] = '-'
+		} else if marks[line] == 0 {
+			marks[line] = '+'
+		}
+	}
+
+	var out strings.Builder
+	for i, line := range strings.Split(strings.TrimSuffix(source, "\n"), "\n") {
+		mark := marks[i+1]
+		if mark == 0 {
+			mark = ' '
+		}
+		fmt.Fprintf(&out, "%c %4d  %s\n", mark, i+1, line)
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// statements returns the statements of the program, nested ones included, in source order
+func statements(program *ast.Program) []ast.Statement {
+	var stmts []ast.Statement
+	ast.Inspect(program, func(node ast.Node) bool {
+		if stmt, ok := node.(ast.Statement); ok {
+			if _, isBlock := stmt.(*ast.BlockStatement); !isBlock {
+				stmts = append(stmts, stmt)
+			}
+		}
+		return node != nil
+	})
+
+	return stmts
+}
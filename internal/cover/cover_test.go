@@ -0,0 +1,46 @@
+package cover
+
+import (
+	"bytes"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const source = `let abs = fn(x) {
+	if (x < 0) {
+		return -x;
+	}
+	x
+};
+abs(2)
+`
+
+func TestProfile(t *testing.T) {
+	program := parser.New(lexer.New(source)).ParseProgram()
+	profile := New()
+	e := evaluator.New(evaluator.Config{Hooks: evaluator.Hooks{Statement: profile.Record}})
+	e.Eval(program, object.NewEnv())
+
+	ran, total := profile.Coverage(program)
+	assert.Equal(t, 4, ran)
+	assert.Equal(t, 5, total)
+	assert.Equal(t, 80.0, profile.Percent(program))
+
+	var out bytes.Buffer
+	assert.NoError(t, profile.Annotate(&out, program, source))
+	assert.Equal(t, `+    1  let abs = fn(x) {
++    2  	if (x < 0) {
+-    3  		return -x;
+     4  	}
++    5  	x
+     6  };
++    7  abs(2)
+`, out.String())
+
+	assert.Equal(t, 100.0, New().Percent(parser.New(lexer.New("")).ParseProgram()))
+}
@@ -0,0 +1,112 @@
+package diagnostics
+
+import (
+	"fmt"
+	"io"
+	"monkey/internal/token"
+	"strings"
+)
+
+// Severity tells whether a diagnostic stops the program from running.
+type Severity int
+
+const (
+	Error   Severity = iota // the source can't be run
+	Warning                 // the source runs but probably doesn't do what was intended
+)
+
+// Diagnostic is a message about a position in a source file.
+type Diagnostic struct {
+	Line     int // line of the offending token, starting at 1
+	Column   int // column of the offending token, starting at 1
+	Message  string
+	Severity Severity
+}
+
+// At creates an error diagnostic pointing at the token.
+func At(tok *token.Token, format string, a ...interface{}) Diagnostic {
+	return Diagnostic{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, a...)}
+}
+
+// WarningAt creates a warning diagnostic pointing at the token.
+func WarningAt(tok *token.Token, format string, a ...interface{}) Diagnostic {
+	d := At(tok, format, a...)
+	d.Severity = Warning
+	return d
+}
+
+// String returns the diagnostic on a single line without the source.
+func (d Diagnostic) String() string {
+	if d.Severity == Warning {
+		return fmt.Sprintf("line %d, column %d: warning: %s", d.Line, d.Column, d.Message)
+	}
+
+	return fmt.Sprintf("line %d, column %d: %s", d.Line, d.Column, d.Message)
+}
+
+// Render writes the diagnostic followed by the offending source line with a ^ under the column, like:
+//
+//	line 1, column 15: expected next token to be ), got ; instead
+//	    let x = (1 + 2;
+//	                  ^
+func Render(w io.Writer, source string, d Diagnostic) {
+	io.WriteString(w, d.String()+"\n")
+
+	line, ok := sourceLine(source, d.Line)
+	if !ok {
+		return
+	}
+
+	io.WriteString(w, "    "+line+"\n")
+	io.WriteString(w, "    "+caretPadding(line, d.Column)+"^\n")
+}
+
+// RenderTrace renders the diagnostic followed by the trace, one indented line each, like the calls that led to a
+// runtime error:
+//
+//	line 1, column 20: identifier not found: foobar
+//	    let f = fn() { 1 + foobar };
+//	                       ^
+//	    f called at line 2, column 2
+func RenderTrace(w io.Writer, source string, d Diagnostic, trace []string) {
+	Render(w, source, d)
+	for _, line := range trace {
+		io.WriteString(w, "    "+line+"\n")
+	}
+}
+
+// RenderAll renders every diagnostic in order.
+func RenderAll(w io.Writer, source string, ds []Diagnostic) {
+	for _, d := range ds {
+		Render(w, source, d)
+	}
+}
+
+// sourceLine returns the nth line of the source, starting at 1
+func sourceLine(source string, n int) (string, bool) {
+	if n < 1 {
+		return "", false
+	}
+
+	lines := strings.Split(source, "\n")
+	if n > len(lines) {
+		return "", false
+	}
+
+	return strings.TrimRight(lines[n-1], "\r"), true
+}
+
+// caretPadding returns the whitespace that puts a caret under the column. Tabs are kept so the caret lines up
+// however wide the terminal renders them.
+func caretPadding(line string, column int) string {
+	var out strings.Builder
+	for i := 0; i < column-1; i++ {
+		if i < len(line) && line[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+
+	return out.String()
+}
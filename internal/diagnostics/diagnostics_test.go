@@ -0,0 +1,57 @@
+package diagnostics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		source     string
+		diagnostic Diagnostic
+		expected   string
+	}{
+		{
+			"let x = (1 + 2;",
+			Diagnostic{Line: 1, Column: 15, Message: "expected next token to be ), got ; instead"},
+			"line 1, column 15: expected next token to be ), got ; instead\n" +
+				"    let x = (1 + 2;\n" +
+				"                  ^\n",
+		},
+		{
+			"let a = 1;\n\tlet b = ;\n",
+			Diagnostic{Line: 2, Column: 10, Message: "no prefix parser function for ; found"},
+			"line 2, column 10: no prefix parser function for ; found\n" +
+				"    \tlet b = ;\n" +
+				"    \t        ^\n",
+		},
+		{
+			"let",
+			Diagnostic{Line: 4, Column: 1, Message: "somewhere else"},
+			"line 4, column 1: somewhere else\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Render(&out, tt.source, tt.diagnostic)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong rendering. expected=\n%s\ngot=\n%s", tt.expected, out.String())
+		}
+	}
+}
+
+func TestRenderTrace(t *testing.T) {
+	var out bytes.Buffer
+	d := Diagnostic{Line: 1, Column: 20, Message: "identifier not found: foobar"}
+	RenderTrace(&out, "let f = fn() { 1 + foobar };\nf()", d, []string{"f called at line 2, column 2"})
+
+	expected := "line 1, column 20: identifier not found: foobar\n" +
+		"    let f = fn() { 1 + foobar };\n" +
+		"                       ^\n" +
+		"    f called at line 2, column 2\n"
+	if out.String() != expected {
+		t.Errorf("wrong rendering. expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,138 @@
+// Package doc extracts the documentation of Monkey programs and of the builtins, and renders it as Markdown or
+// HTML. What a program documents are its top-level lets: the functions they declare, and the other values
+// preceded by `///` doc comments.
+package doc
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"monkey/internal/ast"
+	"monkey/internal/evaluator"
+	"monkey/internal/object"
+	"strings"
+)
+
+type (
+	// Entry documents a declaration of a program, or a builtin.
+	Entry struct {
+		Name      string
+		Signature string // like "fn add(a, b)", "let answer" or "builtin len(x)"
+		Doc       string // the text of the doc comments
+		Line      int    // where the declaration is, 0 for the builtins
+	}
+
+	// Page documents a program, or the builtins.
+	Page struct {
+		Title   string
+		Entries []Entry
+	}
+)
+
+// Program returns the documentation of the top-level lets of the program, in source order.
+func Program(program *ast.Program) []Entry {
+	var entries []Entry
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+
+		name := let.Name.(*ast.Identifier).Value
+		entry := Entry{Name: name, Signature: "let " + name, Doc: let.Doc.Text(), Line: let.Token.Line}
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok {
+			params := make([]string, len(fn.Parameters))
+			for i, p := range fn.Parameters {
+				params[i] = p.Value
+			}
+			entry.Signature = "fn " + name + "(" + strings.Join(params, ", ") + ")"
+		} else if entry.Doc == "" {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// Builtins returns the documentation of the builtins and of the names of the types, sorted by name.
+func Builtins() []Entry {
+	e := evaluator.New(evaluator.Config{})
+
+	var entries []Entry
+	for _, name := range evaluator.BuiltinNames() {
+		builtin, ok := e.Builtin(name).(*object.Builtin)
+		if !ok {
+			doc := fmt.Sprintf("%s is the name of a type, what type returns for the objects of the type.", name)
+			entries = append(entries, Entry{Name: name, Signature: "let " + name, Doc: doc})
+			continue
+		}
+		entries = append(entries, Entry{Name: name, Signature: builtin.Signature(), Doc: builtin.Doc})
+	}
+
+	return entries
+}
+
+// Markdown writes the pages as Markdown: a heading per page, then one per entry followed by its signature and doc.
+func Markdown(w io.Writer, pages []Page) error {
+	var out strings.Builder
+	for i, page := range pages {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "# %s\n", page.Title)
+
+		for _, entry := range page.Entries {
+			fmt.Fprintf(&out, "\n## %s\n\n```\n%s\n```\n", entry.Name, entry.Signature)
+			if entry.Doc != "" {
+				fmt.Fprintf(&out, "\n%s\n", entry.Doc)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+var page = template.Must(template.New("doc").Funcs(template.FuncMap{"paragraphs": paragraphs}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{with index . 0}}{{.Title}}{{end}}</title>
+</head>
+<body>
+{{- range .}}
+<h1>{{.Title}}</h1>
+{{- range .Entries}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<pre>{{.Signature}}</pre>
+{{- range paragraphs .Doc}}
+<p>{{.}}</p>
+{{- end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// HTML writes the pages as a standalone HTML document, titled by the first page.
+func HTML(w io.Writer, pages []Page) error {
+	if len(pages) == 0 {
+		pages = []Page{{Title: "Documentation"}}
+	}
+
+	return page.Execute(w, pages)
+}
+
+// paragraphs splits the doc into its paragraphs, separated by blank lines
+func paragraphs(doc string) []string {
+	var ps []string
+	for _, p := range strings.Split(doc, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			ps = append(ps, p)
+		}
+	}
+
+	return ps
+}
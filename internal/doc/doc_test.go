@@ -0,0 +1,60 @@
+package doc
+
+import (
+	"bytes"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const source = `/// add returns the sum of a and b.
+let add = fn(a, b) { a + b };
+
+/// answer is <42>.
+let answer = 42;
+let undocumented = 1;
+let helper = fn() { answer };
+add(1, 2)`
+
+func TestProgram(t *testing.T) {
+	program := parser.New(lexer.New(source)).ParseProgram()
+
+	assert.Equal(t, []Entry{
+		{Name: "add", Signature: "fn add(a, b)", Doc: "add returns the sum of a and b.", Line: 2},
+		{Name: "answer", Signature: "let answer", Doc: "answer is <42>.", Line: 5},
+		{Name: "helper", Signature: "fn helper()", Line: 7},
+	}, Program(program))
+}
+
+func TestBuiltins(t *testing.T) {
+	entries := Builtins()
+
+	assert.Len(t, entries, len(evaluator.BuiltinNames()))
+	assert.Contains(t, entries, Entry{Name: "len", Signature: "builtin len(x)", Doc: "len returns the length of a string, an array, bytes or a range."})
+	assert.Contains(t, entries, Entry{Name: "HASH", Signature: "let HASH", Doc: "HASH is the name of a type, what type returns for the objects of the type."})
+}
+
+func TestMarkdown(t *testing.T) {
+	pages := []Page{{Title: "math.mk", Entries: Program(parser.New(lexer.New(source)).ParseProgram())[:2]}}
+
+	var out bytes.Buffer
+	assert.NoError(t, Markdown(&out, pages))
+	assert.Equal(t, "# math.mk\n\n## add\n\n```\nfn add(a, b)\n```\n\nadd returns the sum of a and b.\n\n"+
+		"## answer\n\n```\nlet answer\n```\n\nanswer is <42>.\n", out.String())
+}
+
+func TestHTML(t *testing.T) {
+	pages := []Page{{Title: "math.mk", Entries: []Entry{{Name: "answer", Signature: "let answer", Doc: "answer is <42>.\n\nSecond."}}}}
+
+	var out bytes.Buffer
+	assert.NoError(t, HTML(&out, pages))
+	html := out.String()
+	assert.Contains(t, html, "<title>math.mk</title>")
+	assert.Contains(t, html, `<h2 id="answer">answer</h2>`)
+	assert.Contains(t, html, "<p>answer is &lt;42&gt;.</p>\n<p>Second.</p>")
+	assert.True(t, strings.HasSuffix(html, "</html>\n"))
+}
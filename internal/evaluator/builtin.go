@@ -1,57 +1,1392 @@
 package evaluator
 
 import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"math"
 	"monkey/internal/object"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
+// newBuiltins returns the builtins of the evaluator, which follow its config: they print to its Stdout and Stderr,
+// read their input from stdin and keep to its size limits
+func newBuiltins(e *Evaluator, stdin *bufio.Reader) map[string]*object.Builtin {
+	var reading sync.Mutex // the evaluations running at once share stdin
+	stdout, stderr, test, bench := e.config.Stdout, e.config.Stderr, e.config.Test, e.config.Bench
 
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			default:
-				return newError("argument to `len` is not supported. got %s", args[0].Type())
-			}
+	builtins := map[string]*object.Builtin{
+		"len": {
+			Params: []string{"x"},
+			Doc:    "len returns the length of a string, an array, bytes or a range.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `len`. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *object.String:
+					return object.NewInteger(int64(len(arg.Value)))
+				case *object.Array:
+					return object.NewInteger(int64(len(arg.Elements)))
+				case *object.Bytes:
+					return object.NewInteger(int64(len(arg.Value)))
+				case *object.Range:
+					return object.NewInteger(arg.Len())
+				default:
+					return newError("argument to `len` is not supported. got %s", args[0].Type())
+				}
+			},
 		},
-	},
-	"printf": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) == 0 {
-				return newError("wrong number of arguments. got=%d", len(args))
-			}
+		"first": {
+			Params: []string{"arr"},
+			Doc:    "first returns the first element of the array, null if it's empty.",
+			Fn: func(args ...object.Object) object.Object {
+				elements, err := arrayArgument("first", args)
+				if err != nil {
+					return err
+				}
 
-			argsInterface := make([]interface{}, 0, len(args))
-			for i, arg := range args {
-				if i > 0 {
-					argsInterface = append(argsInterface, arg.Inspect())
+				if len(elements) == 0 {
+					return NULL
+				}
+				return elements[0]
+			},
+		},
+		"last": {
+			Params: []string{"arr"},
+			Doc:    "last returns the last element of the array, null if it's empty.",
+			Fn: func(args ...object.Object) object.Object {
+				elements, err := arrayArgument("last", args)
+				if err != nil {
+					return err
+				}
+
+				if len(elements) == 0 {
+					return NULL
+				}
+				return elements[len(elements)-1]
+			},
+		},
+		"rest": {
+			Params: []string{"arr"},
+			Doc:    "rest returns a new array of the elements of the array but the first, null if it's empty.",
+			Fn: func(args ...object.Object) object.Object {
+				elements, err := arrayArgument("rest", args)
+				if err != nil {
+					return err
+				}
+
+				if len(elements) == 0 {
+					return NULL
+				}
+				return &object.Array{Elements: append([]object.Object(nil), elements[1:]...)}
+			},
+		},
+		"push": {
+			Params: []string{"arr", "value"},
+			Doc:    "push returns a new array of the elements of the array followed by the value. The array doesn't change.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `push`. got=%d, want=2", len(args))
+				}
+				elements, err := arrayArgument("push", args[:1])
+				if err != nil {
+					return err
+				}
+				if err := e.checkArrayLength(len(elements) + 1); err != nil {
+					return err
+				}
+
+				pushed := make([]object.Object, len(elements), len(elements)+1)
+				copy(pushed, elements)
+				return &object.Array{Elements: append(pushed, args[1])}
+			},
+		},
+		"pop": {
+			Params: []string{"arr"},
+			Doc:    "pop returns a new array of the elements of the array but the last, null if it's empty. The array doesn't change.",
+			Fn: func(args ...object.Object) object.Object {
+				elements, err := arrayArgument("pop", args)
+				if err != nil {
+					return err
+				}
+
+				if len(elements) == 0 {
+					return NULL
+				}
+				return &object.Array{Elements: append([]object.Object(nil), elements[:len(elements)-1]...)}
+			},
+		},
+		"type": {
+			Params: []string{"x"},
+			Doc:    "type returns the name of the type of x, like \"INTEGER\". The names are predeclared too, type(x) == INTEGER tells whether x is an integer.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `type`. got=%d, want=1", len(args))
+				}
+
+				return &object.String{Value: string(args[0].Type())}
+			},
+		},
+		"int": {
+			Params: []string{"x"},
+			Doc:    "int returns the integer of a string of decimal digits like \"-42\", or of a number, a float losing its fraction.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `int`. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *object.Integer:
+					return arg
+				case *object.Float:
+					if math.IsNaN(arg.Value) || arg.Value < math.MinInt64 || arg.Value >= math.MaxInt64 {
+						return newError("%s is out of the range of integers", arg.Inspect())
+					}
+					return object.NewInteger(int64(arg.Value))
+				case *object.String:
+					value, err := strconv.ParseInt(arg.Value, 10, 64)
+					if err != nil {
+						return newError("could not parse %q as an integer", arg.Value)
+					}
+					return object.NewInteger(value)
+				default:
+					return newError("argument to `int` is not supported. got %s", args[0].Type())
+				}
+			},
+		},
+		"str": {
+			Params: []string{"x"},
+			Doc:    "str returns the string of x, like println prints it. A string is its own.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `str`. got=%d, want=1", len(args))
+				}
+
+				if s, ok := args[0].(*object.String); ok {
+					return s
+				}
+				s := args[0].Inspect()
+				if err := e.checkStringLength(len(s)); err != nil {
+					return err
+				}
+				return &object.String{Value: s}
+			},
+		},
+		"bool": {
+			Params: []string{"x"},
+			Doc:    "bool returns whether x is truthy, like for the condition of an if: everything is but false and null.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `bool`. got=%d, want=1", len(args))
+				}
+
+				return nativeBoolToBooleanObject(isTruthy(args[0]))
+			},
+		},
+		"printf": {
+			Params: []string{"format", "args..."},
+			Doc:    "printf prints the arguments as formatted by the format, like Go's fmt.Printf.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) == 0 {
+					return newError("wrong number of arguments to `printf`. got=%d", len(args))
 				}
-			}
 
-			fmt.Printf(args[0].Inspect(), argsInterface...)
-			return NULL
+				argsInterface := make([]interface{}, 0, len(args))
+				for i, arg := range args {
+					if i > 0 {
+						argsInterface = append(argsInterface, arg.Inspect())
+					}
+				}
+
+				fmt.Fprintf(stdout, args[0].Inspect(), argsInterface...)
+				return NULL
+			},
+		},
+		"println": {
+			Params: []string{"args..."},
+			Doc:    "println prints the arguments separated by spaces, followed by a newline.",
+			Fn:     printLine("println", stdout),
+		},
+		"print": {
+			Params: []string{"args..."},
+			Doc:    "print prints the arguments separated by spaces, without a newline after them.",
+			Fn: func(args ...object.Object) object.Object {
+				parts := make([]string, len(args))
+				for i, arg := range args {
+					parts[i] = arg.Inspect()
+				}
+
+				fmt.Fprint(stdout, strings.Join(parts, " "))
+				return NULL
+			},
+		},
+		"puts": {
+			Params: []string{"args..."},
+			Doc:    "puts prints every argument on a line of its own.",
+			Fn: func(args ...object.Object) object.Object {
+				var out strings.Builder
+				for _, arg := range args {
+					out.WriteString(arg.Inspect() + "\n")
+				}
+
+				io.WriteString(stdout, out.String())
+				return NULL
+			},
+		},
+		"eprintln": {
+			Params: []string{"args..."},
+			Doc:    "eprintln prints the arguments like println, to the error output.",
+			Fn:     printLine("eprintln", stderr),
+		},
+		"memo": {
+			Params: []string{"f"},
+			Doc:    "memo returns a function remembering what f returns for the arguments it was called with. f must not have side effects.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `memo`. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *object.Function, *object.Closure:
+					return object.NewMemo(arg)
+				case *object.Memo:
+					return arg
+				default:
+					return newError("argument to `memo` must be a function. got %s", args[0].Type())
+				}
+			},
+		},
+		"spawn": {
+			Params: []string{"f", "args..."},
+			Doc:    "spawn calls f with the arguments on a goroutine of its own and returns its task right away, for wait to get what f returns.",
+			Run:    spawn,
+		},
+		"wait": {
+			Params: []string{"task"},
+			Doc:    "wait waits for the function of the task to return, and returns what it returned.",
+			Run: func(ctx context.Context, _ object.Caller, args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `wait`. got=%d, want=1", len(args))
+				}
+
+				task, ok := args[0].(*object.Task)
+				if !ok {
+					return newError("argument to `wait` must be a task. got %s", args[0].Type())
+				}
+				select {
+				case <-task.Done:
+					return task.Result
+				case <-ctx.Done():
+					return newKindError(object.InterruptedError, "interrupted: %s", ctx.Err())
+				}
+			},
+		},
+		"future": {
+			Params: []string{"f"},
+			Doc:    "future calls f, a function without parameters, on a goroutine of its own and returns its future right away, for await to get what f returns.",
+			Run: func(_ context.Context, call object.Caller, args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `future`. got=%d, want=1", len(args))
+				}
+				if !share(args[0]) {
+					return newError("argument to `future` must be a function. got %s", args[0].Type())
+				}
+
+				return start(call, args[0], nil)
+			},
+		},
+		"await": {
+			Params: []string{"f", "timeout?"},
+			Doc:    "await waits for the future f to be done and returns what its function returned, or for every one of an array of futures and returns the array of what they returned. It returns the first error of them, and an error once timeout milliseconds passed, when given.",
+			Run:    await,
+		},
+		"map": {
+			Params: []string{"arr", "f"},
+			Doc:    "map calls f with every element of the array in order, and returns the array of what f returned.",
+			Run: func(_ context.Context, call object.Caller, args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `map`. got=%d, want=2", len(args))
+				}
+				elements, err := iterationArguments("map", args[0], args[1])
+				if err != nil {
+					return err
+				}
+
+				results := make([]object.Object, len(elements))
+				for i, element := range elements {
+					results[i] = call(args[1], element)
+					if isError(results[i]) {
+						return results[i]
+					}
+				}
+				return &object.Array{Elements: results}
+			},
+		},
+		"filter": {
+			Params: []string{"arr", "f"},
+			Doc:    "filter calls f with every element of the array in order, and returns the array of the elements f returned a truthy value for.",
+			Run: func(_ context.Context, call object.Caller, args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `filter`. got=%d, want=2", len(args))
+				}
+				elements, err := iterationArguments("filter", args[0], args[1])
+				if err != nil {
+					return err
+				}
+
+				var kept []object.Object
+				for _, element := range elements {
+					result := call(args[1], element)
+					if isError(result) {
+						return result
+					}
+					if isTruthy(result) {
+						kept = append(kept, element)
+					}
+				}
+				return &object.Array{Elements: kept}
+			},
+		},
+		"reduce": {
+			Params: []string{"arr", "f", "initial?"},
+			Doc:    "reduce calls f with what it returned so far and every element of the array in order, starting with the initial value or else the first element, and returns what f returned last. It returns null for an empty array without an initial value.",
+			Run: func(_ context.Context, call object.Caller, args ...object.Object) object.Object {
+				if len(args) < 2 || len(args) > 3 {
+					return newError("wrong number of arguments to `reduce`. got=%d, want=2 or 3", len(args))
+				}
+				elements, err := iterationArguments("reduce", args[0], args[1])
+				if err != nil {
+					return err
+				}
+
+				var result object.Object = NULL
+				if len(args) == 3 {
+					result = args[2]
+				} else if len(elements) > 0 {
+					result, elements = elements[0], elements[1:]
+				}
+				for _, element := range elements {
+					result = call(args[1], result, element)
+					if isError(result) {
+						return result
+					}
+				}
+				return result
+			},
+		},
+		"pmap": {
+			Params: []string{"arr", "f"},
+			Doc:    "pmap calls f with every element of the array on goroutines of their own, as many at once as there are CPUs, and returns the array of what f returned, in the order of the elements.",
+			Run: func(ctx context.Context, call object.Caller, args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `pmap`. got=%d, want=2", len(args))
+				}
+
+				return parallelMap(ctx, call, "pmap", runtime.GOMAXPROCS(0), args[0], args[1])
+			},
+		},
+		"pool": {
+			Params: []string{"n", "arr", "f"},
+			Doc:    "pool calls f with every element of the array like pmap, on n goroutines at most, and returns the array of what f returned.",
+			Run: func(ctx context.Context, call object.Caller, args ...object.Object) object.Object {
+				if len(args) != 3 {
+					return newError("wrong number of arguments to `pool`. got=%d, want=3", len(args))
+				}
+				n, ok := args[0].(*object.Integer)
+				if !ok || n.Value < 1 {
+					return newError("first argument to `pool` must be an integer of at least 1. got %s", args[0].Inspect())
+				}
+
+				workers := n.Value
+				if array, ok := args[1].(*object.Array); ok && workers > int64(len(array.Elements)) {
+					workers = int64(len(array.Elements))
+				}
+				return parallelMap(ctx, call, "pool", int(workers), args[1], args[2])
+			},
+		},
+		"chan": {
+			Params: []string{"size?"},
+			Doc:    "chan returns a channel holding up to size values sent but not received yet, none by default: sending then waits for a task to receive.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments to `chan`. got=%d, want=0 or 1", len(args))
+				}
+
+				size := int64(0)
+				if len(args) == 1 {
+					integer, ok := args[0].(*object.Integer)
+					if !ok || integer.Value < 0 {
+						return newError("argument to `chan` must be an integer of at least 0. got %s", args[0].Inspect())
+					}
+					size = integer.Value
+				}
+				if size > int64(e.config.MaxArrayLength) {
+					return newKindError(object.ResourceLimitError, "resource limit exceeded: channels can't hold more than %d values", e.config.MaxArrayLength)
+				}
+
+				return object.NewChannel(int(size))
+			},
+		},
+		"send": {
+			Params: []string{"c", "value"},
+			Doc:    "send sends the value on the channel, waiting for room for it. Sending on a closed channel is an error.",
+			Run: func(ctx context.Context, _ object.Caller, args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `send`. got=%d, want=2", len(args))
+				}
+				c, err := channelArgument("send", args[0])
+				if err != nil {
+					return err
+				}
+
+				select {
+				case <-c.Closed:
+					return newError("send on a closed channel")
+				default:
+				}
+				select {
+				case c.Values <- args[1]:
+					return NULL
+				case <-c.Closed:
+					return newError("send on a closed channel")
+				case <-ctx.Done():
+					return newKindError(object.InterruptedError, "interrupted: %s", ctx.Err())
+				}
+			},
+		},
+		"recv": {
+			Params: []string{"c"},
+			Doc:    "recv receives a value from the channel, waiting for one to be sent. It returns null once the channel is closed and every value sent was received.",
+			Run: func(ctx context.Context, _ object.Caller, args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `recv`. got=%d, want=1", len(args))
+				}
+				c, err := channelArgument("recv", args[0])
+				if err != nil {
+					return err
+				}
+
+				select {
+				case value := <-c.Values:
+					return value
+				case <-c.Closed:
+					return drain(c)
+				case <-ctx.Done():
+					return newKindError(object.InterruptedError, "interrupted: %s", ctx.Err())
+				}
+			},
+		},
+		"close": {
+			Params: []string{"c"},
+			Doc:    "close closes the channel: values can't be sent on it anymore, and recv returns null once the ones sent were received.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `close`. got=%d, want=1", len(args))
+				}
+				c, err := channelArgument("close", args[0])
+				if err != nil {
+					return err
+				}
+
+				if !c.Close() {
+					return newError("close of a closed channel")
+				}
+				return NULL
+			},
+		},
+		"select": {
+			Params: []string{"channels", "timeout?"},
+			Doc:    "select receives a value from whichever of the array of channels has one first and returns [i, value], i being the index of the channel. value is null for a closed channel, like for recv. select returns null if none had a value after timeout milliseconds, when given.",
+			Run:    selectChannels,
+		},
+		"bytes": {
+			Params: []string{"x"},
+			Doc:    "bytes returns the bytes of a string, or of an array of integers from 0 to 255.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `bytes`. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *object.String:
+					return &object.Bytes{Value: []byte(arg.Value)}
+				case *object.Bytes:
+					return arg
+				case *object.Array:
+					value := make([]byte, len(arg.Elements))
+					for i, element := range arg.Elements {
+						integer, ok := element.(*object.Integer)
+						if !ok || integer.Value < 0 || integer.Value > 255 {
+							return newError("argument to `bytes` must only hold integers from 0 to 255. got %s", element.Inspect())
+						}
+						value[i] = byte(integer.Value)
+					}
+					return &object.Bytes{Value: value}
+				default:
+					return newError("argument to `bytes` is not supported. got %s", args[0].Type())
+				}
+			},
+		},
+		"text": {
+			Params: []string{"b"},
+			Doc:    "text returns the string of the bytes.",
+			Fn: func(args ...object.Object) object.Object {
+				b, err := bytesArgument("text", args)
+				if err != nil {
+					return err
+				}
+
+				return &object.String{Value: string(b)}
+			},
+		},
+		"toHex": {
+			Params: []string{"b"},
+			Doc:    "toHex returns the bytes encoded as hex.",
+			Fn: func(args ...object.Object) object.Object {
+				b, err := bytesArgument("toHex", args)
+				if err != nil {
+					return err
+				}
+				if err := e.checkStringLength(hex.EncodedLen(len(b))); err != nil {
+					return err
+				}
+
+				return &object.String{Value: hex.EncodeToString(b)}
+			},
+		},
+		"fromHex": {
+			Params: []string{"s"},
+			Doc:    "fromHex returns the bytes of a hex string.",
+			Fn: func(args ...object.Object) object.Object {
+				s, err := stringArgument("fromHex", args)
+				if err != nil {
+					return err
+				}
+
+				b, decodeErr := hex.DecodeString(s)
+				if decodeErr != nil {
+					return newError("invalid hex: %s", decodeErr)
+				}
+				return &object.Bytes{Value: b}
+			},
+		},
+		"toBase64": {
+			Params: []string{"b"},
+			Doc:    "toBase64 returns the bytes encoded as base64.",
+			Fn: func(args ...object.Object) object.Object {
+				b, err := bytesArgument("toBase64", args)
+				if err != nil {
+					return err
+				}
+				if err := e.checkStringLength(base64.StdEncoding.EncodedLen(len(b))); err != nil {
+					return err
+				}
+
+				return &object.String{Value: base64.StdEncoding.EncodeToString(b)}
+			},
+		},
+		"fromBase64": {
+			Params: []string{"s"},
+			Doc:    "fromBase64 returns the bytes of a base64 string.",
+			Fn: func(args ...object.Object) object.Object {
+				s, err := stringArgument("fromBase64", args)
+				if err != nil {
+					return err
+				}
+
+				b, decodeErr := base64.StdEncoding.DecodeString(s)
+				if decodeErr != nil {
+					return newError("invalid base64: %s", decodeErr)
+				}
+				return &object.Bytes{Value: b}
+			},
+		},
+		"slice": {
+			Params: []string{"x", "start", "end"},
+			Doc:    "slice returns the part of a string, an array or bytes from start up to end, end excluded.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 3 {
+					return newError("wrong number of arguments to `slice`. got=%d, want=3", len(args))
+				}
+
+				start, ok := args[1].(*object.Integer)
+				if !ok {
+					return newError("start of `slice` must be INTEGER. got %s", args[1].Type())
+				}
+				end, ok := args[2].(*object.Integer)
+				if !ok {
+					return newError("end of `slice` must be INTEGER. got %s", args[2].Type())
+				}
+
+				var length int
+				switch arg := args[0].(type) {
+				case *object.Bytes:
+					length = len(arg.Value)
+				case *object.String:
+					length = len(arg.Value)
+				case *object.Array:
+					length = len(arg.Elements)
+				default:
+					return newError("argument to `slice` is not supported. got %s", args[0].Type())
+				}
+				if start.Value < 0 || start.Value > end.Value || end.Value > int64(length) {
+					return newError("slice bounds out of range [%d:%d] with length %d", start.Value, end.Value, length)
+				}
+
+				switch arg := args[0].(type) {
+				case *object.Bytes:
+					return &object.Bytes{Value: arg.Value[start.Value:end.Value]}
+				case *object.String:
+					return &object.String{Value: arg.Value[start.Value:end.Value]}
+				default:
+					elements := arg.(*object.Array).Elements[start.Value:end.Value]
+					return &object.Array{Elements: append([]object.Object(nil), elements...)}
+				}
+			},
 		},
-	},
-	"println": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) == 0 {
-				return newError("wrong number of arguments. got=%d", len(args))
+		"split": {
+			Params: []string{"s", "sep"},
+			Doc:    "split returns the array of the parts of the string separated by sep, or of its characters if sep is empty.",
+			Fn: func(args ...object.Object) object.Object {
+				s, err := stringArguments("split", args, 2)
+				if err != nil {
+					return err
+				}
+
+				count := strings.Count(s[0], s[1]) + 1
+				if s[1] == "" {
+					count = utf8.RuneCountInString(s[0])
+				}
+				if err := e.checkArrayLength(count); err != nil {
+					return err
+				}
+
+				parts := strings.Split(s[0], s[1])
+				elements := make([]object.Object, len(parts))
+				for i, part := range parts {
+					elements[i] = &object.String{Value: part}
+				}
+				return &object.Array{Elements: elements}
+			},
+		},
+		"join": {
+			Params: []string{"arr", "sep"},
+			Doc:    "join returns the strings of the array joined into one, with sep between them.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `join`. got=%d, want=2", len(args))
+				}
+				elements, err := arrayArgument("join", args[:1])
+				if err != nil {
+					return err
+				}
+				sep, err := stringArgument("join", args[1:])
+				if err != nil {
+					return err
+				}
+
+				parts := make([]string, len(elements))
+				length := 0
+				for i, element := range elements {
+					s, ok := element.(*object.String)
+					if !ok {
+						return newError("elements of the array given to `join` must be STRING. got %s", element.Type())
+					}
+					parts[i] = s.Value
+					length += len(s.Value)
+				}
+				if len(parts) > 1 {
+					length += len(sep) * (len(parts) - 1)
+				}
+				if err := e.checkStringLength(length); err != nil {
+					return err
+				}
+				return &object.String{Value: strings.Join(parts, sep)}
+			},
+		},
+		"trim": {
+			Params: []string{"s"},
+			Doc:    "trim returns the string without the white space it starts and ends with.",
+			Fn: func(args ...object.Object) object.Object {
+				s, err := stringArgument("trim", args)
+				if err != nil {
+					return err
+				}
+
+				return &object.String{Value: strings.TrimSpace(s)}
+			},
+		},
+		"replace": {
+			Params: []string{"s", "old", "new"},
+			Doc:    "replace returns the string with every old in it replaced by new.",
+			Fn: func(args ...object.Object) object.Object {
+				s, err := stringArguments("replace", args, 3)
+				if err != nil {
+					return err
+				}
+
+				if len(s[2]) > len(s[1]) {
+					growth := int64(strings.Count(s[0], s[1])) * int64(len(s[2])-len(s[1]))
+					if int64(len(s[0]))+growth > int64(e.config.MaxStringLength) {
+						return e.checkStringLength(e.config.MaxStringLength + 1)
+					}
+				}
+
+				return &object.String{Value: strings.ReplaceAll(s[0], s[1], s[2])}
+			},
+		},
+		"contains": {
+			Params: []string{"x", "value"},
+			Doc:    "contains returns whether the string contains the string value, or whether the array has an element equal to value.",
+			Fn: func(args ...object.Object) object.Object {
+				index := indexOf("contains", args)
+				if isError(index) {
+					return index
+				}
+
+				return nativeBoolToBooleanObject(index.(*object.Integer).Value >= 0)
+			},
+		},
+		"indexOf": {
+			Params: []string{"x", "value"},
+			Doc:    "indexOf returns the index of the first string value in the string, or of the first element of the array equal to value, -1 if there's none.",
+			Fn: func(args ...object.Object) object.Object {
+				return indexOf("indexOf", args)
+			},
+		},
+		"startsWith": {
+			Params: []string{"s", "prefix"},
+			Doc:    "startsWith returns whether the string starts with prefix.",
+			Fn: func(args ...object.Object) object.Object {
+				s, err := stringArguments("startsWith", args, 2)
+				if err != nil {
+					return err
+				}
+
+				return nativeBoolToBooleanObject(strings.HasPrefix(s[0], s[1]))
+			},
+		},
+		"endsWith": {
+			Params: []string{"s", "suffix"},
+			Doc:    "endsWith returns whether the string ends with suffix.",
+			Fn: func(args ...object.Object) object.Object {
+				s, err := stringArguments("endsWith", args, 2)
+				if err != nil {
+					return err
+				}
+
+				return nativeBoolToBooleanObject(strings.HasSuffix(s[0], s[1]))
+			},
+		},
+		"upper": {
+			Params: []string{"s"},
+			Doc:    "upper returns the string with its letters in upper case.",
+			Fn: func(args ...object.Object) object.Object {
+				s, err := stringArgument("upper", args)
+				if err != nil {
+					return err
+				}
+
+				return &object.String{Value: strings.ToUpper(s)}
+			},
+		},
+		"lower": {
+			Params: []string{"s"},
+			Doc:    "lower returns the string with its letters in lower case.",
+			Fn: func(args ...object.Object) object.Object {
+				s, err := stringArgument("lower", args)
+				if err != nil {
+					return err
+				}
+
+				return &object.String{Value: strings.ToLower(s)}
+			},
+		},
+		"range": {
+			Params: []string{"start?", "end", "step?"},
+			Doc:    "range returns the integers from start, 0 by default, up to end, end excluded, going by step, 1 by default.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 1 || len(args) > 3 {
+					return newError("wrong number of arguments to `range`. got=%d, want=1 to 3", len(args))
+				}
+
+				bounds := make([]int64, len(args))
+				for i, arg := range args {
+					integer, ok := arg.(*object.Integer)
+					if !ok {
+						return newError("arguments to `range` must be INTEGER. got %s", arg.Type())
+					}
+					bounds[i] = integer.Value
+				}
+
+				switch len(bounds) {
+				case 1:
+					return &object.Range{End: bounds[0], Step: 1}
+				case 2:
+					return &object.Range{Start: bounds[0], End: bounds[1], Step: 1}
+				default:
+					if bounds[2] == 0 {
+						return newError("step of `range` can't be 0")
+					}
+					return &object.Range{Start: bounds[0], End: bounds[1], Step: bounds[2]}
+				}
+			},
+		},
+		"help": {
+			Params: []string{"f"},
+			Doc:    "help prints the signature of the function and what it does.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `help`. got=%d, want=1", len(args))
+				}
+
+				signature, doc, ok := describe(args[0])
+				if !ok {
+					return newError("argument to `help` must be a function. got %s", args[0].Type())
+				}
+
+				fmt.Fprintln(stdout, signature)
+				if doc != "" {
+					fmt.Fprintln(stdout, "\t"+strings.ReplaceAll(doc, "\n", "\n\t"))
+				}
+				return NULL
+			},
+		},
+		"input": {
+			Params: []string{"prompt?"},
+			Doc:    "input prints the prompt and returns the line read from the input, null at the end of the input.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments to `input`. got=%d, want=0 or 1", len(args))
+				}
+
+				if len(args) == 1 {
+					io.WriteString(stdout, args[0].Inspect())
+				}
+
+				reading.Lock()
+				line, err := stdin.ReadString('\n')
+				reading.Unlock()
+				if err != nil && (err != io.EOF || line == "") {
+					return NULL
+				}
+
+				return &object.String{Value: strings.TrimRight(line, "\r\n")}
+			},
+		},
+		"import": {
+			Params: []string{"path"},
+			Doc:    "import returns a hash of what the module of the path exports: the names its program declares with let, but the ones starting with _. A module is evaluated once, importing it again returns the same hash.",
+			Run: func(ctx context.Context, _ object.Caller, args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `import`. got=%d, want=1", len(args))
+				}
+				path, ok := args[0].(*object.String)
+				if !ok {
+					return newError("argument to `import` must be STRING. got %s", args[0].Type())
+				}
+
+				return e.importModule(ctx, path.Value)
+			},
+		},
+		"test": {
+			Params: []string{"name", "f"},
+			Doc:    "test declares the test f, a function without parameters failing by returning an error, for monkey test to call.",
+			Fn:     declare("test", test),
+		},
+		"bench": {
+			Params: []string{"name", "f"},
+			Doc:    "bench declares the benchmark f, a function without parameters, for monkey bench to time.",
+			Fn:     declare("bench", bench),
+		},
+		"assert": {
+			Params: []string{"cond", "message?"},
+			Doc:    "assert returns an error, with the message if given, when cond isn't truthy.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `assert`. got=%d, want=1 or 2", len(args))
+				}
+
+				if IsTruthy(args[0]) {
+					return NULL
+				}
+				return assertionFailed(args[1:], "")
+			},
+		},
+		"assert_eq": {
+			Params: []string{"actual", "expected", "message?"},
+			Doc:    "assert_eq returns an error, with the message if given, when actual isn't equal to expected, like for ==.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 2 || len(args) > 3 {
+					return newError("wrong number of arguments to `assert_eq`. got=%d, want=2 or 3", len(args))
+				}
+
+				if equal(args[0], args[1]) {
+					return NULL
+				}
+				return assertionFailed(args[2:], fmt.Sprintf("got=%s, want=%s", args[0].Inspect(), args[1].Inspect()))
+			},
+		},
+	}
+
+	for name, builtin := range builtins {
+		builtin.Name = name
+	}
+
+	return builtins
+}
+
+// spawn is the spawn builtin. The function runs in an environment of its own enclosed in the one it was created
+// in, which goroutines share from then on. Other than the names, they share the objects the names are bound to:
+// the function must not change the ones the program spawning it uses, nor the other way around.
+func spawn(_ context.Context, call object.Caller, args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments to `spawn`. got=%d, want=1 or more", len(args))
+	}
+	if !share(args[0]) {
+		return newError("argument to `spawn` must be a function. got %s", args[0].Type())
+	}
+
+	return start(call, args[0], args[1:])
+}
+
+// start calls the function with the arguments on a goroutine of its own, and returns its task
+func start(call object.Caller, fn object.Object, args []object.Object) *object.Task {
+	task := &object.Task{Function: fn, Done: make(chan struct{})}
+	go func() {
+		defer close(task.Done)
+		task.Result = call(fn, args...)
+	}()
+
+	return task
+}
+
+// parallelMap calls the function with every element of the array on workers goroutines, and returns the array of
+// what it returned. If calls return errors, it returns the one of the only call that did, or an error listing them.
+func parallelMap(ctx context.Context, call object.Caller, builtin string, workers int, arr, fn object.Object) object.Object {
+	array, ok := arr.(*object.Array)
+	if !ok {
+		return newError("argument to `%s` must be an array. got %s", builtin, arr.Type())
+	}
+	if !share(fn) {
+		return newError("argument to `%s` must be a function. got %s", builtin, fn.Type())
+	}
+
+	results := make([]object.Object, len(array.Elements))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(results); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = call(fn, array.Elements[i])
 			}
+		}()
+	}
+	for i := range results {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
 
-			argsInterface := make([]interface{}, 0, len(args))
-			for _, arg := range args {
-				argsInterface = append(argsInterface, arg.Inspect())
+	if ctx.Err() != nil {
+		return newKindError(object.InterruptedError, "interrupted: %s", ctx.Err())
+	}
+
+	var errs []*object.Error
+	var failed []string
+	for i, result := range results {
+		if err, ok := result.(*object.Error); ok {
+			errs = append(errs, err)
+			failed = append(failed, fmt.Sprintf("element %d: %s", i, err.Message))
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return &object.Array{Elements: results}
+	case 1:
+		return errs[0]
+	default:
+		return newError("%d calls of `%s` failed: %s", len(errs), builtin, strings.Join(failed, "; "))
+	}
+}
+
+// await is the await builtin
+func await(ctx context.Context, _ object.Caller, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments to `await`. got=%d, want=1 or 2", len(args))
+	}
+
+	var tasks []*object.Task
+	switch arg := args[0].(type) {
+	case *object.Task:
+		tasks = []*object.Task{arg}
+	case *object.Array:
+		for _, element := range arg.Elements {
+			task, ok := element.(*object.Task)
+			if !ok {
+				return newError("first argument to `await` must be a future or an array of futures. got an array holding %s", element.Type())
 			}
-			fmt.Println(argsInterface...)
+			tasks = append(tasks, task)
+		}
+	default:
+		return newError("first argument to `await` must be a future or an array of futures. got %s", args[0].Type())
+	}
 
-			return NULL
-		},
-	},
+	var timeout <-chan time.Time // never, without a timeout
+	if len(args) == 2 {
+		ms, ok := args[1].(*object.Integer)
+		if !ok || ms.Value < 0 {
+			return newError("second argument to `await` must be an integer of at least 0. got %s", args[1].Inspect())
+		}
+		timer := time.NewTimer(time.Duration(ms.Value) * time.Millisecond)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	results := make([]object.Object, len(tasks))
+	for i, task := range tasks {
+		select {
+		case <-task.Done:
+		case <-ctx.Done():
+			return newKindError(object.InterruptedError, "interrupted: %s", ctx.Err())
+		case <-timeout:
+			return newError("await timed out after %s milliseconds", args[1].Inspect())
+		}
+
+		if isError(task.Result) {
+			return task.Result
+		}
+		results[i] = task.Result
+	}
+
+	if _, ok := args[0].(*object.Task); ok {
+		return results[0]
+	}
+	return &object.Array{Elements: results}
+}
+
+// selectChannels is the select builtin
+func selectChannels(ctx context.Context, _ object.Caller, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments to `select`. got=%d, want=1 or 2", len(args))
+	}
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `select` must be an array of channels. got %s", args[0].Type())
+	}
+	var timeout *object.Integer
+	if len(args) == 2 {
+		timeout, ok = args[1].(*object.Integer)
+		if !ok || timeout.Value < 0 {
+			return newError("second argument to `select` must be an integer of at least 0. got %s", args[1].Inspect())
+		}
+	}
+
+	// every channel has a case for its values and one for its closing, the context and the timeout come last. The
+	// channels ready right away are tried first, so that a timeout of 0 doesn't race with them.
+	channels := make([]*object.Channel, len(array.Elements))
+	cases := make([]reflect.SelectCase, 0, 2*len(channels)+2)
+	for i, element := range array.Elements {
+		c, err := channelArgument("select", element)
+		if err != nil {
+			return err
+		}
+		channels[i] = c
+		cases = append(cases,
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Values)},
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Closed)})
+	}
+	chosen, value, _ := reflect.Select(append(cases[:len(cases):len(cases)], reflect.SelectCase{Dir: reflect.SelectDefault}))
+	if chosen < len(cases) {
+		return selected(channels, chosen, value)
+	}
+
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+	if timeout != nil {
+		timer := time.NewTimer(time.Duration(timeout.Value) * time.Millisecond)
+		defer timer.Stop()
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)})
+	}
+
+	chosen, value, _ = reflect.Select(cases)
+	switch {
+	case chosen == 2*len(channels):
+		return newKindError(object.InterruptedError, "interrupted: %s", ctx.Err())
+	case chosen > 2*len(channels):
+		return NULL
+	default:
+		return selected(channels, chosen, value)
+	}
+}
+
+// selected returns what select returns for the case of the channels chosen, with the value it received
+func selected(channels []*object.Channel, chosen int, value reflect.Value) object.Object {
+	i := object.NewInteger(int64(chosen / 2))
+	if chosen%2 == 1 {
+		return &object.Array{Elements: []object.Object{i, drain(channels[chosen/2])}}
+	}
+
+	return &object.Array{Elements: []object.Object{i, value.Interface().(object.Object)}}
+}
+
+// channelArgument returns the argument of the builtin if it is a channel, an error otherwise
+func channelArgument(builtin string, arg object.Object) (*object.Channel, *object.Error) {
+	c, ok := arg.(*object.Channel)
+	if !ok {
+		return nil, newError("argument to `%s` must be a channel. got %s", builtin, arg.Type())
+	}
+
+	return c, nil
+}
+
+// drain returns a value left in the closed channel, null if none is
+func drain(c *object.Channel) object.Object {
+	select {
+	case value := <-c.Values:
+		return value
+	default:
+		return NULL
+	}
+}
+
+// share makes the environment of the function safe for goroutines to use at once, false if it isn't a function.
+// The virtual machine doesn't keep its globals in environments, only their slots are shared, and the bindings its
+// closures captured get locks. A memo guards its results itself, only its function needs sharing.
+func share(fn object.Object) bool {
+	switch fn := fn.(type) {
+	case *object.Function:
+		fn.Env.Share()
+		return true
+	case *object.Closure:
+		fn.Share()
+		return true
+	case *object.Memo:
+		return share(fn.Function)
+	case *object.Builtin:
+		return true
+	default:
+		return false
+	}
+}
+
+// describe returns the signature and doc of a function, false for other objects
+func describe(f object.Object) (signature, doc string, ok bool) {
+	switch f := f.(type) {
+	case *object.Function:
+		return f.Signature(), f.Doc, true
+	case *object.Closure:
+		return f.Fn.Signature(), f.Fn.Doc, true
+	case *object.Memo:
+		signature, doc, _ := describe(f.Function)
+		return "memo(" + signature + ")", doc, true
+	case *object.Builtin:
+		return f.Signature(), f.Doc, true
+	default:
+		return "", "", false
+	}
+}
+
+// typeNames are the names predeclared for the types of the objects programs can have, bound to the name of the
+// type, what the type builtin returns: INTEGER is "INTEGER".
+var typeNames = func() map[string]object.Object {
+	names := map[string]object.Object{}
+	for _, t := range []object.ObjectType{
+		object.INTEGER_OBJ, object.FLOAT_OBJ, object.STRING_OBJ, object.BOOLEAN_OBJ, object.NULL_OBJ,
+		object.FUNCTION_OBJ, object.BUILTIN_OBJ, object.ARRAY_OBJ, object.HASH_OBJ, object.BYTES_OBJ,
+		object.NATIVE_OBJ, object.RANGE_OBJ, object.TASK_OBJ, object.CHANNEL_OBJ,
+	} {
+		names[string(t)] = &object.String{Value: string(t)}
+	}
+	return names
+}()
+
+// builtinNames are the names of the builtins and of the types, sorted
+var builtinNames = func() []string {
+	var names []string
+	for name := range newBuiltins(&Evaluator{}, nil) {
+		names = append(names, name)
+	}
+	for name := range typeNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}()
+
+// BuiltinNames returns the names predeclared by evaluators, sorted: the builtins, including the ones a sandbox can
+// take away, and the names of the types.
+func BuiltinNames() []string {
+	return append([]string(nil), builtinNames...)
+}
+
+// printLine returns the function of a builtin like println, printing its arguments separated by spaces to w
+func printLine(builtin string, w io.Writer) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) == 0 {
+			return newError("wrong number of arguments to `%s`. got=%d", builtin, len(args))
+		}
+
+		argsInterface := make([]interface{}, 0, len(args))
+		for _, arg := range args {
+			argsInterface = append(argsInterface, arg.Inspect())
+		}
+		fmt.Fprintln(w, argsInterface...)
+
+		return NULL
+	}
+}
+
+// declare returns the function of a builtin like test, giving the name and the function it is called with to
+// declared, if not nil
+func declare(builtin string, declared func(name string, fn object.Object)) func(args ...object.Object) object.Object {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=2", builtin, len(args))
+		}
+
+		name, ok := args[0].(*object.String)
+		if !ok {
+			return newError("name of `%s` must be STRING. got %s", builtin, args[0].Type())
+		}
+		if _, _, ok := describe(args[1]); !ok {
+			return newError("argument to `%s` must be a function. got %s", builtin, args[1].Type())
+		}
+
+		if declared != nil {
+			declared(name.Value, args[1])
+		}
+		return NULL
+	}
+}
+
+// assertionFailed returns the error of a failed assertion, with the message if the arguments hold one and the
+// details of the failure if not empty
+func assertionFailed(message []object.Object, details string) *object.Error {
+	text := "assertion failed"
+	if len(message) > 0 {
+		if s, ok := message[0].(*object.String); ok {
+			text += ": " + s.Value
+		} else {
+			text += ": " + message[0].Inspect()
+		}
+	}
+	if details != "" {
+		text += ". " + details
+	}
+
+	return newError("%s", text)
+}
+
+// iterationArguments returns the elements of the array a builtin like map calls the function fn with, checking
+// that fn is a function
+func iterationArguments(builtin string, arr, fn object.Object) ([]object.Object, *object.Error) {
+	array, ok := arr.(*object.Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be an array. got %s", builtin, arr.Type())
+	}
+	if _, _, ok := describe(fn); !ok {
+		return nil, newError("argument to `%s` must be a function. got %s", builtin, fn.Type())
+	}
+
+	return array.Elements, nil
+}
+
+// stringArguments returns the values of the want arguments of the builtin, which must all be strings
+func stringArguments(builtin string, args []object.Object, want int) ([]string, *object.Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments to `%s`. got=%d, want=%d", builtin, len(args), want)
+	}
+
+	values := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(*object.String)
+		if !ok {
+			return nil, newError("arguments to `%s` must be STRING. got %s", builtin, arg.Type())
+		}
+		values[i] = s.Value
+	}
+
+	return values, nil
+}
+
+// indexOf returns the index of the value, the second argument, in the string or the array of the first one, or
+// -1 if it's not in it. It is the builtin of the name given, contains being another.
+func indexOf(builtin string, args []object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `%s`. got=%d, want=2", builtin, len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.String:
+		value, ok := args[1].(*object.String)
+		if !ok {
+			return newError("value to look for in a string with `%s` must be STRING. got %s", builtin, args[1].Type())
+		}
+		return object.NewInteger(int64(strings.Index(arg.Value, value.Value)))
+	case *object.Array:
+		for i, element := range arg.Elements {
+			if equal(element, args[1]) {
+				return object.NewInteger(int64(i))
+			}
+		}
+		return object.NewInteger(-1)
+	default:
+		return newError("argument to `%s` is not supported. got %s", builtin, args[0].Type())
+	}
+}
+
+// arrayArgument returns the elements of the only argument of the builtin, which must be an array
+func arrayArgument(builtin string, args []object.Object) ([]object.Object, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments to `%s`. got=%d, want=1", builtin, len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY. got %s", builtin, args[0].Type())
+	}
+
+	return arr.Elements, nil
+}
+
+// bytesArgument returns the value of the only argument of the builtin, which must be bytes
+func bytesArgument(builtin string, args []object.Object) ([]byte, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments to `%s`. got=%d, want=1", builtin, len(args))
+	}
+
+	b, ok := args[0].(*object.Bytes)
+	if !ok {
+		return nil, newError("argument to `%s` must be BYTES. got %s", builtin, args[0].Type())
+	}
+
+	return b.Value, nil
+}
+
+// stringArgument returns the value of the only argument of the builtin, which must be a string
+func stringArgument(builtin string, args []object.Object) (string, *object.Error) {
+	if len(args) != 1 {
+		return "", newError("wrong number of arguments to `%s`. got=%d, want=1", builtin, len(args))
+	}
+
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return "", newError("argument to `%s` must be STRING. got %s", builtin, args[0].Type())
+	}
+
+	return s.Value, nil
 }
@@ -0,0 +1,92 @@
+package evaluator
+
+import (
+	"monkey/internal/ast"
+	"monkey/internal/object"
+	"monkey/internal/token"
+)
+
+// scope is what the body of a function declares and uses
+type scope struct {
+	locals []string // the names declared with let, not looking into the functions in the body
+	free   []string // the names used before being declared in the function, parameters aside
+}
+
+// closure returns the function the literal evaluates to in env, which only captures the bindings of the names it
+// uses, so that a closure kept around doesn't keep everything else that was in scope with it.
+func (m *machine) closure(node *ast.FunctionLiteral, env *object.Environment) *object.Function {
+	s := m.scope(node.Parameters, node.Body)
+	return &object.Function{Body: node.Body, Parameters: node.Parameters, Env: env.Capture(s.free)}
+}
+
+// callEnv returns the environment of a call of the function, with the arguments bound to the parameters
+func (m *machine) callEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewCallEnvironment(fn.Env, m.scope(fn.Parameters, fn.Body).locals)
+	for paramIdx, param := range fn.Parameters {
+		env.Set(param.Value, args[paramIdx])
+	}
+
+	return env
+}
+
+// scope returns what the body of the function with the parameters declares and uses, which is worked out once
+// for every body
+func (m *machine) scope(params []*ast.Identifier, body *ast.BlockStatement) *scope {
+	if s, ok := m.scopes[body]; ok {
+		return s
+	}
+
+	s := &scope{}
+	declared := map[string]bool{} // the parameters and the names declared or found free so far
+	local := map[string]bool{}
+	for _, param := range params {
+		declared[param.Value] = true
+	}
+
+	// a name used before the function declares it is still looked up outside of it at that point
+	use := func(name string) {
+		if !declared[name] {
+			declared[name] = true
+			s.free = append(s.free, name)
+		}
+	}
+
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.LetStatement:
+			if n.Value != nil {
+				ast.Inspect(n.Value, visit)
+			}
+			if name, ok := n.Name.(*ast.Identifier); ok && !local[name.Value] {
+				local[name.Value] = true
+				declared[name.Value] = true
+				s.locals = append(s.locals, name.Value)
+			}
+			return false
+		case *ast.Identifier:
+			use(n.Value)
+		case *ast.FunctionLiteral:
+			for _, name := range m.scope(n.Parameters, n.Body).free {
+				use(name)
+			}
+			return false
+		case *ast.IndexExpression:
+			if n.Token != nil && n.Token.Type == token.PERIOD {
+				ast.Inspect(n.Left, visit)
+				return false // the name after the dot is a key, not a variable
+			}
+		}
+
+		return true
+	}
+	if body != nil {
+		ast.Inspect(body, visit)
+	}
+
+	if m.scopes == nil {
+		m.scopes = map[*ast.BlockStatement]*scope{}
+	}
+	m.scopes[body] = s
+	return s
+}
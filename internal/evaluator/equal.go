@@ -0,0 +1,95 @@
+package evaluator
+
+import (
+	"bytes"
+	"monkey/internal/object"
+)
+
+// equal reports whether the values are equal: integers and floats of the same value, arrays and hashes when their elements are, recursively, and
+// functions when they are the same function
+func equal(a, b object.Object) bool {
+	return (&comparison{}).equal(a, b)
+}
+
+// comparison compares values that can contain each other, like a hash holding itself
+type comparison struct {
+	// comparing holds the pairs of containers being compared, a pair found again inside itself is taken to be
+	// equal, the rest of the comparison deciding whether it is
+	comparing map[[2]object.Object]bool
+}
+
+func (c *comparison) equal(a, b object.Object) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	if isNumber(a) && isNumber(b) && a.Type() != b.Type() {
+		return floatValue(a) == floatValue(b)
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *object.Integer:
+		return a.Value == b.(*object.Integer).Value
+	case *object.Float:
+		return a.Value == b.(*object.Float).Value
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	case *object.Bytes:
+		return bytes.Equal(a.Value, b.(*object.Bytes).Value)
+	case *object.Boolean:
+		return a.Value == b.(*object.Boolean).Value
+	case *object.Null:
+		return true
+	case *object.Array:
+		b := b.(*object.Array)
+		if len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		if !c.enter(a, b) {
+			return true
+		}
+		for i := range a.Elements {
+			if !c.equal(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		b := b.(*object.Hash)
+		if len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		if !c.enter(a, b) {
+			return true
+		}
+		for key, pair := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !c.equal(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		// functions and builtins are only equal to themselves
+		return false
+	}
+}
+
+// enter records that the containers are being compared, it returns false if they already were
+func (c *comparison) enter(a, b object.Object) bool {
+	pair := [2]object.Object{a, b}
+	if c.comparing[pair] {
+		return false
+	}
+
+	if c.comparing == nil {
+		c.comparing = map[[2]object.Object]bool{}
+	}
+	c.comparing[pair] = true
+	return true
+}
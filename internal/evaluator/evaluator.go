@@ -1,164 +1,540 @@
 package evaluator
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"math"
 	"monkey/internal/ast"
+	"monkey/internal/module"
 	"monkey/internal/object"
+	"monkey/internal/token"
+	"os"
 	"strings"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+	NULL  = object.NULL
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func invalidIndexType(index object.Object) *object.Error {
 	return newError("invalid index type. got=" + string(index.Type()))
 }
 
+func unusableHashKey(key object.Object) *object.Error {
+	return newError("unusable as hash key: %s", key.Type())
+}
+
+// DefaultMaxCallDepth is the MaxCallDepth of a Config that doesn't set one. Calls don't use the Go stack, so this
+// only limits the memory a runaway recursion takes before it is stopped.
+const DefaultMaxCallDepth = 100000
+
+// MaxCallbackDepth is how many of the calls builtins like map make to functions can be in progress at once, inside
+// of one another. Unlike the other calls, those run on the Go stack, which a deeper recursion would overflow,
+// crashing the host. The calls count towards MaxCallDepth too.
+const MaxCallbackDepth = 1000
+
+// The default size limits of a Config, see Config.MaxStringLength.
+const (
+	DefaultMaxStringLength = 64 << 20
+	DefaultMaxArrayLength  = 16 << 20
+	DefaultMaxHashSize     = 16 << 20
+)
+
+type (
+	// Config holds the settings of an Evaluator, the zero value is the default configuration.
+	Config struct {
+		// MaxCallDepth is how many calls of Monkey functions can be in progress at once, DefaultMaxCallDepth if 0.
+		// A call going deeper evaluates to a stack overflow error.
+		MaxCallDepth int
+
+		// MaxStringLength, MaxArrayLength and MaxHashSize limit the size of the strings in bytes, of the arrays and
+		// of the hashes a program creates, the default ones if 0. Creating a bigger one evaluates to an error
+		// instead of taking the memory of the host.
+		MaxStringLength int
+		MaxArrayLength  int
+		MaxHashSize     int
+
+		// CheckedIntegers makes integer arithmetic overflowing 64 bits evaluate to an error, instead of wrapping
+		// around like it does by default.
+		CheckedIntegers bool
+
+		// StrictFields makes h.key evaluate to an error when h has no "key", instead of to null like h["key"].
+		StrictFields bool
+
+		// StrictKeys makes h[key] evaluate to an error when h has no key, instead of to null.
+		StrictKeys bool
+
+		Stdout io.Writer // where builtins like println write to, os.Stdout if nil
+		Stderr io.Writer // where eprintln writes to, os.Stderr if nil
+		Stdin  io.Reader // where the input builtin reads from, os.Stdin if nil
+
+		// Modules finds the modules programs import with the import builtin, module.NewResolver() if nil.
+		Modules *module.Resolver
+
+		// Sandbox restricts what programs can do, nil for no restrictions.
+		Sandbox *Sandbox
+
+		// Test is given the name and the function of every test a program declares with the test builtin, for a
+		// runner like monkey test to call them afterwards. The test builtin does nothing if nil, and neither does
+		// the bench builtin without Bench, given the benchmarks for monkey bench.
+		Test  func(name string, fn object.Object)
+		Bench func(name string, fn object.Object)
+
+		// Hooks observe what programs do as they are evaluated, like the statements that run for coverage.
+		Hooks Hooks
+
+		// Meter measures what programs use, and stops them once they use more than its quotas, nil not to.
+		Meter *Meter
+	}
+
+	// Hooks are functions an evaluator calls as it evaluates, to observe programs without changing what they do.
+	// Nil hooks aren't called. Hooks must be safe to call from several goroutines when several evaluate at once.
+	Hooks struct {
+		Statement func(stmt ast.Statement) // called before every statement runs, the ones of blocks included
+
+		// Call is called before a function or a builtin runs, with the frame it runs in, and Return once it
+		// returned, whatever it returned. Every Call is followed by a Return, innermost calls first.
+		Call   func(frame object.Frame)
+		Return func()
+	}
+
+	// Sandbox restricts what programs can do, to run programs that aren't trusted, like the snippets users send to a
+	// server. A sandboxed program can't import other programs, and only gets the builtins that keep to the
+	// evaluator: the ones reaching out to the host, like input, have to be allowed explicitly.
+	Sandbox struct {
+		Allow []string // when not empty, the only builtins available, including the ones reaching out to the host
+		Deny  []string // builtins that aren't available, even if allowed
+	}
+
+	// Evaluator evaluates trees with the settings of its Config. Several goroutines can evaluate with the same
+	// Evaluator at once, as long as each has its own environment: objects aren't safe to share between goroutines,
+	// except for the ones that can't change like integers, strings and booleans. Stdout has to be safe for
+	// concurrent writes then, input from Stdin goes to whichever evaluation asks first.
+	Evaluator struct {
+		config   Config
+		builtins map[string]*object.Builtin
+		disabled map[string]bool // the builtins the sandbox took away
+		removed  map[string]bool // the builtins the host took away with Remove
+		modules  *module.Loader  // the modules imported so far, shared by the evaluations
+	}
+)
+
+// hostBuiltins are the builtins that reach out of the evaluator to the host, which a sandbox takes away unless they
+// are allowed
+var hostBuiltins = map[string]bool{
+	"input":  true,
+	"import": true,
+}
+
+// New returns an evaluator with the config.
+func New(config Config) *Evaluator {
+	if config.MaxCallDepth <= 0 {
+		config.MaxCallDepth = DefaultMaxCallDepth
+	}
+	if config.MaxStringLength <= 0 {
+		config.MaxStringLength = DefaultMaxStringLength
+	}
+	if config.MaxArrayLength <= 0 {
+		config.MaxArrayLength = DefaultMaxArrayLength
+	}
+	if config.MaxHashSize <= 0 {
+		config.MaxHashSize = DefaultMaxHashSize
+	}
+	if config.Stdout == nil {
+		config.Stdout = os.Stdout
+	}
+	if config.Stderr == nil {
+		config.Stderr = os.Stderr
+	}
+	if config.Stdin == nil {
+		config.Stdin = os.Stdin
+	}
+	if config.Modules == nil {
+		config.Modules = module.NewResolver()
+	}
+
+	e := &Evaluator{config: config}
+	e.modules = module.NewLoader(config.Modules, e.evalModule)
+	e.builtins = newBuiltins(e, bufio.NewReader(config.Stdin))
+	if config.Sandbox != nil {
+		e.disabled = config.Sandbox.disabled(e.builtins)
+		for name := range e.disabled {
+			delete(e.builtins, name)
+		}
+	}
+
+	return e
+}
+
+// disabled returns the names of the builtins the sandbox takes away
+func (s *Sandbox) disabled(builtins map[string]*object.Builtin) map[string]bool {
+	allowed := map[string]bool{}
+	for _, name := range s.Allow {
+		allowed[name] = true
+	}
+
+	disabled := map[string]bool{}
+	for name := range builtins {
+		if len(s.Allow) > 0 && !allowed[name] || len(s.Allow) == 0 && hostBuiltins[name] {
+			disabled[name] = true
+		}
+	}
+	for _, name := range s.Deny {
+		if _, ok := builtins[name]; ok {
+			disabled[name] = true
+		}
+	}
+
+	return disabled
+}
+
+// Eval evaluates the node in env and returns its value.
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	return (&machine{evaluator: e}).run(node, env)
+}
+
+// Call calls the function with the arguments and returns what it returns, or the error that stopped it, like
+// the program calling it would. The function is one evaluated by the evaluator: a closure of the virtual machine
+// can't be called.
+func (e *Evaluator) Call(fn object.Object, args ...object.Object) object.Object {
+	return (&machine{evaluator: e}).call(fn, args)
+}
+
+// EvalContext evaluates the node in env like Eval, stopping with an error once the context is done. The context
+// is checked before every statement.
+func (e *Evaluator) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return (&machine{evaluator: e, ctx: ctx}).run(node, env)
+}
+
+// CallContext calls the function like Call, stopping with an error once the context is done, see EvalContext.
+func (e *Evaluator) CallContext(ctx context.Context, fn object.Object, args ...object.Object) object.Object {
+	return (&machine{evaluator: e, ctx: ctx}).call(fn, args)
+}
+
+// Eval evaluates the node in env with the default configuration and returns its value.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New(Config{}).Eval(node, env)
+}
+
+// step evaluates the node, scheduling the evaluation of its children and what's done with their values. Every
+// node ends up pushing exactly one value, nil for the nodes that don't have one.
+func (m *machine) step(node ast.Node, env *object.Environment) {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalStatements(node.Statements, env)
+		m.evalStatements(node.Statements, env, func(result object.Object) {
+			m.push(unwrapReturnValue(result))
+		})
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		m.eval(node.Expression, env)
 	case *ast.IntegerLiteral:
-		o := &object.Integer{Value: node.Value}
-		return o
+		m.push(m.literal(node, func() object.Object { return object.NewInteger(node.Value) }))
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		m.push(m.literal(node, func() object.Object { return &object.String{Value: node.Value} }))
+	case *ast.FloatLiteral:
+		m.push(m.literal(node, func() object.Object { return &object.Float{Value: node.Value} }))
 	case *ast.Boolean:
-		if node.Value {
-			return TRUE
-		}
-		return FALSE
+		m.push(nativeBoolToBooleanObject(node.Value))
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
-			return right
-		}
-
-		return evalPrefixExpression(node.Operator, right)
+		m.evalThen(node.Right, env, func(right object.Object) {
+			m.push(m.located(node, m.evaluator.evalPrefixExpression(node.Operator, right)))
+		})
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
-		}
-
-		right := Eval(node.Right, env)
-		if isError(right) {
-			return right
+		if node.Operator == "&&" || node.Operator == "||" {
+			m.evalLogical(node, env)
+			return
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		m.evalThen(node.Left, env, func(left object.Object) {
+			m.evalThen(node.Right, env, func(right object.Object) {
+				m.push(m.located(node, m.evaluator.evalInfixExpression(node.Operator, left, right)))
+			})
+		})
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
-	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		if len(node.Statements) == 0 {
+			m.push(NULL) // like an if without else, rather than no value at all
+			return
 		}
-
-		return applyFunction(function, args)
-
+		m.evalStatements(node.Statements, env, m.push)
+	case *ast.CallExpression:
+		m.evalThen(node.Function, env, func(function object.Object) {
+			m.evalList(node.Arguments, env, func(args []object.Object) {
+				m.apply(node, function, args)
+			})
+		})
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		m.evalThen(node.Condition, env, func(condition object.Object) {
+			if isTruthy(condition) {
+				m.eval(node.Consequence, env)
+			} else if node.Alternative != nil {
+				m.eval(node.Alternative, env)
+			} else {
+				m.push(NULL)
+			}
+		})
+	case *ast.AssignExpression:
+		m.evalAssign(node, env)
+	case *ast.ForExpression:
+		m.evalFor(node, env)
+	case *ast.TryExpression:
+		m.evalTry(node, env)
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
-			return val
-		}
-
-		name := node.Name.(*ast.Identifier).Value
-		env.Set(name, val)
-		return val
+		m.evalThen(node.Value, env, func(val object.Object) {
+			name := node.Name.(*ast.Identifier)
+			if fn, ok := val.(*object.Function); ok {
+				if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+					fn.Name, fn.Doc = name.Value, node.Doc.Text()
+				}
+			}
+			m.push(m.located(name, env.Set(name.Value, val)))
+		})
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
-
+		m.push(m.located(node, m.evaluator.evalIdentifier(node, env)))
 	case *ast.FunctionLiteral:
-		return &object.Function{Body: node.Body, Parameters: node.Parameters, Env: env}
-	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
-			return val
+		if err := m.evaluator.config.Meter.Object(); err != nil {
+			m.push(m.located(node, err))
+			return
 		}
-
-		return &object.ReturnValue{Value: val}
+		m.push(m.closure(node, env))
+	case *ast.ReturnStatement:
+		m.evalThen(node.ReturnValue, env, func(val object.Object) {
+			m.push(&object.ReturnValue{Value: val})
+		})
+	case *ast.ThrowStatement:
+		m.evalThen(node.Value, env, func(val object.Object) {
+			m.push(m.located(node, &object.Error{Message: val.Inspect(), Thrown: val}))
+		})
+	case *ast.BreakStatement:
+		m.push(BREAK)
+	case *ast.ContinueStatement:
+		m.push(CONTINUE)
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
-			return elements[0]
+		m.evalList(node.Elements, env, func(elements []object.Object) {
+			if err := m.evaluator.checkArrayLength(len(elements)); err != nil {
+				m.push(m.located(node, err))
+				return
+			}
+			if err := m.evaluator.config.Meter.Object(); err != nil {
+				m.push(m.located(node, err))
+				return
+			}
+			m.push(&object.Array{Elements: elements})
+		})
+	case *ast.HashLiteral:
+		m.evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		if node.Token != nil && node.Token.Type == token.PERIOD {
+			m.evalThen(node.Left, env, func(left object.Object) {
+				m.push(m.located(node, m.evaluator.evalFieldExpression(left, node.Index.(*ast.Identifier).Value)))
+			})
+			return
 		}
 
-		return &object.Array{Elements: elements}
-	case *ast.HashLiteral:
-		hash := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
-		for key, value := range node.Hash {
-			keyEval := Eval(key, env)
-			if isError(keyEval) {
-				return keyEval
-			}
+		m.evalThen(node.Left, env, func(left object.Object) {
+			m.evalThen(node.Index, env, func(index object.Object) {
+				m.push(m.located(node, m.evaluator.evalIndexExpression(left, index)))
+			})
+		})
+	default:
+		m.push(nil)
+	}
+}
 
-			hashableKey, ok := keyEval.(object.Hashable)
-			if !ok {
-				return invalidIndexType(keyEval)
+// evalAssign evaluates an assignment to a variable, or to a key of a hash. The hash and the key are evaluated
+// before the value, and the assignment evaluates to the value.
+func (m *machine) evalAssign(node *ast.AssignExpression, env *object.Environment) {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		m.evalThen(node.Value, env, func(val object.Object) {
+			result := env.Assign(target.Value, val)
+			if result == nil {
+				result = newError("identifier not found: %s", target.Value)
 			}
-
-			valueEval := Eval(value, env)
-			if isError(valueEval) {
-				return valueEval
+			m.push(m.located(target, result))
+		})
+	case *ast.IndexExpression:
+		m.evalThen(target.Left, env, func(left object.Object) {
+			if target.Token != nil && target.Token.Type == token.PERIOD {
+				name := target.Index.(*ast.Identifier).Value
+				m.evalThen(node.Value, env, func(val object.Object) {
+					m.push(m.located(target, m.evaluator.setField(left, name, val)))
+				})
+				return
 			}
 
-			hash.Pairs[hashableKey.HashKey()] = object.HashPair{
-				Key:   keyEval,
-				Value: valueEval,
-			}
+			m.evalThen(target.Index, env, func(index object.Object) {
+				m.evalThen(node.Value, env, func(val object.Object) {
+					m.push(m.located(target, m.evaluator.setIndex(left, index, val)))
+				})
+			})
+		})
+	default:
+		m.push(m.located(node, newError("cannot assign to %s", node.Target.String())))
+	}
+}
+
+// evalLogical evaluates && and ||, which only evaluate their right side when the left one doesn't decide the
+// result already. Like the other operators on booleans, they give a boolean whatever the values they're given.
+func (m *machine) evalLogical(node *ast.InfixExpression, env *object.Environment) {
+	m.evalThen(node.Left, env, func(left object.Object) {
+		if isTruthy(left) == (node.Operator == "||") {
+			m.push(nativeBoolToBooleanObject(isTruthy(left)))
+			return
 		}
 
-		return hash
-	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
+		m.evalThen(node.Right, env, func(right object.Object) {
+			m.push(nativeBoolToBooleanObject(isTruthy(right)))
+		})
+	})
+}
+
+// evalFor runs the loop in an environment of its own, so the names its init and body declare aren't seen after
+// it. The loop has no value, it's null unless its body returns or fails. Like statements, every iteration checks
+// whether the evaluation has to stop, so that even a loop with an empty body can be interrupted.
+func (m *machine) evalFor(node *ast.ForExpression, env *object.Environment) {
+	loop := object.NewEnclosedEnvironment(env)
+
+	var iterate, body func()
+	iterate = func() {
+		if m.ctx != nil && m.ctx.Err() != nil {
+			m.push(m.located(node, newKindError(object.InterruptedError, "interrupted: %s", m.ctx.Err())))
+			return
+		}
+		if err := m.evaluator.config.Meter.Step(); err != nil {
+			m.push(m.located(node, err))
+			return
 		}
 
-		index := Eval(node.Index, env)
-		if isError(index) {
-			return index
+		if node.Condition == nil {
+			body()
+			return
 		}
+		m.evalThen(node.Condition, loop, func(condition object.Object) {
+			if !isTruthy(condition) {
+				m.push(NULL)
+				return
+			}
+			body()
+		})
+	}
+	body = func() {
+		m.evalThen(node.Body, loop, func(result object.Object) {
+			if isReturnValue(result) {
+				m.push(result)
+				return
+			}
+			if result == BREAK {
+				m.push(NULL)
+				return
+			}
 
-		return evalIndexExpression(left, index)
+			if node.Post == nil {
+				iterate()
+				return
+			}
+			m.evalThen(node.Post, loop, func(object.Object) { iterate() })
+		})
 	}
 
-	return nil
+	if node.Init == nil {
+		iterate()
+		return
+	}
+	m.evalThen(node.Init, loop, func(object.Object) { iterate() })
 }
 
-func evalStatements(stmts []ast.Statement, env *object.Environment) object.Object {
-	var result object.Object
-	for _, stmt := range stmts {
-		result = Eval(stmt, env)
+// evalTry evaluates the body of a try, then the catch block if the body failed and the finally block whatever
+// happened. The catch block gets the value thrown, or the message of an error of the evaluation as a string.
+// An interrupted evaluation isn't caught. What the finally block evaluates to is dropped, unless it fails,
+// returns or breaks out of a loop itself.
+func (m *machine) evalTry(node *ast.TryExpression, env *object.Environment) {
+	finally := func(result object.Object) {
+		if node.Finally == nil {
+			m.push(result)
+			return
+		}
+		m.then(func() {
+			if obj := m.pop(); isError(obj) || isReturnValue(obj) || isLoopControl(obj) {
+				result = obj
+			}
+			m.push(result)
+		})
+		m.eval(node.Finally, env)
+	}
 
-		switch result := result.(type) {
-		case *object.ReturnValue:
-			return result.Value
-		case *object.Error:
-			return result
+	m.then(func() {
+		result := m.pop()
+		err, ok := result.(*object.Error)
+		if !ok || node.Catch == nil || (m.ctx != nil && m.ctx.Err() != nil) {
+			finally(result)
+			return
+		}
+
+		var thrown object.Object = &object.String{Value: err.Message}
+		if err.Thrown != nil {
+			thrown = err.Thrown
+		}
+		scope := object.NewEnclosedEnvironment(env)
+		scope.Set(node.Param.Value, thrown)
+
+		m.then(func() { finally(m.pop()) })
+		m.eval(node.Catch, scope)
+	})
+	m.eval(node.Body, env)
+}
+
+// evalHashLiteral evaluates the pairs in the order they appear in the source, each key before its value
+func (m *machine) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) {
+	if err := m.evaluator.config.Meter.Object(); err != nil {
+		m.push(m.located(node, err))
+		return
+	}
+	hash := object.NewHash()
+	keys := node.Keys()
+
+	var next func(i int)
+	next = func(i int) {
+		if i == len(keys) {
+			m.push(hash)
+			return
 		}
+
+		m.evalThen(keys[i], env, func(key object.Object) {
+			hashableKey, ok := key.(object.Hashable)
+			if !ok {
+				m.push(m.located(keys[i], unusableHashKey(key)))
+				return
+			}
+
+			m.evalThen(node.Hash[keys[i]], env, func(value object.Object) {
+				if _, ok := hash.Pairs[hashableKey.HashKey()]; !ok {
+					if err := m.evaluator.checkHashSize(len(hash.Pairs) + 1); err != nil {
+						m.push(m.located(node, err))
+						return
+					}
+				}
+				hash.Set(hashableKey, value)
+				next(i + 1)
+			})
+		})
 	}
 
-	return result
+	next(0)
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func (e *Evaluator) evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
+		if right, ok := right.(*object.Integer); ok && e.config.CheckedIntegers && right.Value == math.MinInt64 {
+			return newError("integer overflow: -(%d)", right.Value)
+		}
 		return evalMinusPrefixOperatorExpression(right)
 	default:
 		return newError("Unknown operator: %s%s", operator, right.Type())
@@ -179,52 +555,127 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	if right, ok := right.(*object.Float); ok {
+		return &object.Float{Value: -right.Value}
+	}
 	if right.Type() != object.INTEGER_OBJ {
 		return newError("unknown operator: -%s", right.Type())
 	}
 
-	// Why allocate a new object if you can just update?
-	right.(*object.Integer).Value = right.(*object.Integer).Value * -1
-	return right
+	return object.NewInteger(-right.(*object.Integer).Value)
 }
 
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	switch operator {
 	case "+":
-		return &object.Integer{Value: left.(*object.Integer).Value + right.(*object.Integer).Value}
+		return object.NewInteger(left.(*object.Integer).Value + right.(*object.Integer).Value)
 	case "-":
-		return &object.Integer{Value: left.(*object.Integer).Value - right.(*object.Integer).Value}
+		return object.NewInteger(left.(*object.Integer).Value - right.(*object.Integer).Value)
 	case "*":
-		return &object.Integer{Value: left.(*object.Integer).Value * right.(*object.Integer).Value}
+		return object.NewInteger(left.(*object.Integer).Value * right.(*object.Integer).Value)
 	case "/":
-		// todo handle error?
-		return &object.Integer{Value: left.(*object.Integer).Value / right.(*object.Integer).Value}
+		if right.(*object.Integer).Value == 0 {
+			return newError("division by zero")
+		}
+		return object.NewInteger(left.(*object.Integer).Value / right.(*object.Integer).Value)
 	case "==":
 		return nativeBoolToBooleanObject(left.(*object.Integer).Value == right.(*object.Integer).Value)
 	case "!=":
 		return nativeBoolToBooleanObject(left.(*object.Integer).Value != right.(*object.Integer).Value)
-	case "<":
-		return nativeBoolToBooleanObject(left.(*object.Integer).Value < right.(*object.Integer).Value)
-	case ">":
-		return nativeBoolToBooleanObject(left.(*object.Integer).Value > right.(*object.Integer).Value)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+// evalComparison evaluates < and > on comparable objects, it returns false if they aren't
+func evalComparison(operator string, left, right object.Object) (object.Object, bool) {
+	comparable, ok := left.(object.Comparable)
+	if _, rightOk := right.(object.Comparable); !ok || !rightOk {
+		return nil, false
+	}
+
+	order, err := comparable.Compare(right)
+	if err != nil {
+		if left.Type() != right.Type() && !(isNumber(left) && isNumber(right)) {
+			return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type()), true
+		}
+		return newError("%s", err), true
+	}
+
+	if operator == "<" {
+		return nativeBoolToBooleanObject(order < 0), true
+	}
+	return nativeBoolToBooleanObject(order > 0), true
+}
+
+// evalFloatInfixExpression evaluates an operation on two numbers, at least one of them a float: the integer is
+// converted to a float, and so is the result of arithmetic
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue, rightValue := floatValue(left), floatValue(right)
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftValue + rightValue}
+	case "-":
+		return &object.Float{Value: leftValue - rightValue}
+	case "*":
+		return &object.Float{Value: leftValue * rightValue}
+	case "/":
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: leftValue / rightValue}
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// floatValue returns the value of an integer or a float as a float
+func floatValue(obj object.Object) float64 {
+	if integer, ok := obj.(*object.Integer); ok {
+		return float64(integer.Value)
+	}
+
+	return obj.(*object.Float).Value
+}
+
+func (e *Evaluator) evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
 		if operator == "+" {
-			return &object.String{Value: left.(*object.String).Value + right.(*object.String).Value}
+			leftValue, rightValue := left.(*object.String).Value, right.(*object.String).Value
+			if err := e.checkStringLength(len(leftValue) + len(rightValue)); err != nil {
+				return err
+			}
+			if err := e.config.Meter.Object(); err != nil {
+				return err
+			}
+			return &object.String{Value: leftValue + rightValue}
 		} else if operator == "==" {
-			return &object.Boolean{Value: left.(*object.String).Value == right.(*object.String).Value}
+			return nativeBoolToBooleanObject(left.(*object.String).Value == right.(*object.String).Value)
 		} else if operator == "!=" {
-			return &object.Boolean{Value: left.(*object.String).Value != right.(*object.String).Value}
+			return nativeBoolToBooleanObject(left.(*object.String).Value != right.(*object.String).Value)
 		}
 	}
 
 	if left.Type() == object.STRING_OBJ && right.Type() == object.INTEGER_OBJ && operator == "*" {
-		return &object.String{Value: strings.Repeat(left.(*object.String).Value, int(right.(*object.Integer).Value))}
+		value, count := left.(*object.String).Value, right.(*object.Integer).Value
+		if count < 0 {
+			return newError("negative repeat count: %d", count)
+		}
+		if value != "" && count > int64(e.config.MaxStringLength/len(value)) {
+			return e.checkStringLength(e.config.MaxStringLength + 1)
+		}
+		if err := e.config.Meter.Object(); err != nil {
+			return err
+		}
+		return &object.String{Value: strings.Repeat(value, int(count))}
 	}
 
 	return newError("unknown operation: %s %s %s", left.Type(), operator, right.Type())
@@ -244,27 +695,6 @@ func evalBooleanInfixExpression(operator string, left, right object.Object) obje
 		return nativeBoolToBooleanObject(left.(*object.Boolean).Value == right.(*object.Boolean).Value)
 	case "!=":
 		return nativeBoolToBooleanObject(left.(*object.Boolean).Value != right.(*object.Boolean).Value)
-	case "<":
-		leftVal := 0
-		if left.(*object.Boolean).Value {
-			leftVal = 1
-		}
-		rightVal := 0
-		if right.(*object.Boolean).Value {
-			rightVal = 1
-		}
-		return nativeBoolToBooleanObject(leftVal < rightVal)
-	case ">":
-		leftVal := 0
-		if left.(*object.Boolean).Value {
-			leftVal = 1
-		}
-		rightVal := 0
-		if right.(*object.Boolean).Value {
-			rightVal = 1
-		}
-		return nativeBoolToBooleanObject(leftVal > rightVal)
-
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -272,27 +702,53 @@ func evalBooleanInfixExpression(operator string, left, right object.Object) obje
 
 func evalBoolToInt(boolean object.Object) object.Object {
 	if boolean.(*object.Boolean).Value {
-		return &object.Integer{Value: 1}
+		return object.NewInteger(1)
 	}
 
-	return &object.Integer{Value: 0}
+	return object.NewInteger(0)
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func (e *Evaluator) evalInfixExpression(operator string, left, right object.Object) object.Object {
 	//if left.Type() != right.Type() {
 	//	return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	//}
 
+	// with both sides evaluated already, as the callers of Infix have, && and || only have to combine them
+	switch operator {
+	case "&&":
+		return nativeBoolToBooleanObject(isTruthy(left) && isTruthy(right))
+	case "||":
+		return nativeBoolToBooleanObject(isTruthy(left) || isTruthy(right))
+	}
+
+	if operator == "<" || operator == ">" {
+		if result, ok := evalComparison(operator, left, right); ok {
+			return result
+		}
+	}
+
 	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
+		leftValue, rightValue := left.(*object.Integer).Value, right.(*object.Integer).Value
+		if e.config.CheckedIntegers && ast.Overflows(operator, leftValue, rightValue) {
+			return newError("integer overflow: %d %s %d", leftValue, operator, rightValue)
+		}
 		return evalIntegerInfixExpression(operator, left, right)
 	}
 
+	if isNumber(left) && isNumber(right) && (left.Type() == object.FLOAT_OBJ || right.Type() == object.FLOAT_OBJ) {
+		return evalFloatInfixExpression(operator, left, right)
+	}
+
 	if left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ {
 		return evalBooleanInfixExpression(operator, left, right)
 	}
 
 	if left.Type() == object.STRING_OBJ && (right.Type() == object.INTEGER_OBJ || right.Type() == object.STRING_OBJ) {
-		return evalStringInfixExpression(operator, left, right)
+		return e.evalStringInfixExpression(operator, left, right)
+	}
+
+	if (operator == "==" || operator == "!=") && left.Type() == right.Type() {
+		return nativeBoolToBooleanObject(equal(left, right) == (operator == "=="))
 	}
 
 	//if left.Type() == object.BOOLEAN_OBJ && right.Type() == object.INTEGER_OBJ {
@@ -306,20 +762,31 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
-		return condition
+// checkStringLength returns an error if a string of length bytes is longer than the config allows
+func (e *Evaluator) checkStringLength(length int) *object.Error {
+	if length > e.config.MaxStringLength {
+		return newKindError(object.ResourceLimitError, "resource limit exceeded: strings can't be longer than %d bytes", e.config.MaxStringLength)
 	}
 
-	if isTruthy(condition) {
-		e := Eval(ie.Consequence, env)
-		return e
-	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
-	} else {
-		return NULL
+	return nil
+}
+
+// checkArrayLength returns an error if an array of length elements is longer than the config allows
+func (e *Evaluator) checkArrayLength(length int) *object.Error {
+	if length > e.config.MaxArrayLength {
+		return newKindError(object.ResourceLimitError, "resource limit exceeded: arrays can't have more than %d elements", e.config.MaxArrayLength)
+	}
+
+	return nil
+}
+
+// checkHashSize returns an error if a hash of size pairs is bigger than the config allows
+func (e *Evaluator) checkHashSize(size int) *object.Error {
+	if size > e.config.MaxHashSize {
+		return newKindError(object.ResourceLimitError, "resource limit exceeded: hashes can't have more than %d pairs", e.config.MaxHashSize)
 	}
+
+	return nil
 }
 
 func isTruthy(obj object.Object) bool {
@@ -335,26 +802,19 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
-	var result object.Object
-
-	for _, statement := range block.Statements {
-		result = Eval(statement, env)
-
-		if result != nil && (result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ) {
-			return result
-		}
-	}
-
-	return result
-}
-
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{
 		Message: fmt.Sprintf(format, a...),
 	}
 }
 
+// newKindError returns an error stopping the program for the interpreter, of the kind
+func newKindError(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	err := newError(format, a...)
+	err.Kind = kind
+	return err
+}
+
 func isError(obj object.Object) bool {
 	if obj != nil {
 		return obj.Type() == object.ERROR_OBJ
@@ -363,36 +823,21 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+func (e *Evaluator) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
-		return builtin
-	}
-
-	return newError("identifier not found: " + node.Value)
-}
-
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
-	var results []object.Object
-
-	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
-			return []object.Object{evaluated}
-		}
-
-		results = append(results, evaluated)
-	}
-
-	return results
+	return e.Builtin(node.Value)
 }
 
 func evalArrayIndexExpression(left, index object.Object) object.Object {
 	array := left.(*object.Array)
-	idx := index.(*object.Integer).Value
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return invalidIndexType(index)
+	}
+	idx := integer.Value
 	max := int64(len(array.Elements) - 1)
 
 	if idx > max || idx < 0 {
@@ -402,54 +847,103 @@ func evalArrayIndexExpression(left, index object.Object) object.Object {
 	return array.Elements[idx]
 }
 
-func evalHashIndexExpression(left, index object.Object) object.Object {
+func evalBytesIndexExpression(left, index object.Object) object.Object {
+	b := left.(*object.Bytes)
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return invalidIndexType(index)
+	}
+
+	if integer.Value < 0 || integer.Value >= int64(len(b.Value)) {
+		return NULL
+	}
+
+	return object.NewInteger(int64(b.Value[integer.Value]))
+}
+
+func (e *Evaluator) evalHashIndexExpression(left, index object.Object) object.Object {
 	hash := left.(*object.Hash)
 	idx, ok := index.(object.Hashable)
 	if !ok {
-		return invalidIndexType(index)
+		return unusableHashKey(index)
 	}
 
 	if value, ok := hash.Pairs[idx.HashKey()]; ok {
 		return value.Value
 	}
+	if e.config.StrictKeys {
+		return newError("hash has no key %s", index.Inspect())
+	}
 
 	return NULL
 }
 
-func evalIndexExpression(left, index object.Object) object.Object {
-	switch left.(type) {
-	case *object.Array:
-		// todo we differ from the book on how to evaluate the object indices
-		return evalArrayIndexExpression(left, index)
-	case *object.Hash:
-		return evalHashIndexExpression(left, index)
-	default:
-		return newError("index operator not supported: %s", left.Type())
+// evalFieldExpression evaluates h.name, which is h["name"] for a hash h
+func (e *Evaluator) evalFieldExpression(left object.Object, name string) object.Object {
+	hash, ok := left.(*object.Hash)
+	if !ok {
+		return newError("field access not supported: %s.%s", left.Type(), name)
+	}
+
+	key := &object.String{Value: name}
+	if pair, ok := hash.Pairs[key.HashKey()]; ok {
+		return pair.Value
+	}
+	if e.config.StrictFields {
+		return newError("hash has no field %s", name)
 	}
+
+	return NULL
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	switch fn := fn.(type) {
-	case *object.Function:
+// setIndex evaluates left[index] = val, which sets the key of a hash left
+func (e *Evaluator) setIndex(left, index, val object.Object) object.Object {
+	hash, ok := left.(*object.Hash)
+	if !ok {
+		return newError("index assignment not supported: %s", left.Type())
+	}
 
-		extendEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendEnv)
-		return unwrapReturnValue(evaluated)
-	case *object.Builtin:
-		return fn.Fn(args...)
-	default:
-		return newError("not a function: %s", fn.Type())
+	return e.setKey(hash, index, val)
+}
+
+// setField evaluates left.name = val, which is left["name"] = val for a hash left
+func (e *Evaluator) setField(left object.Object, name string, val object.Object) object.Object {
+	hash, ok := left.(*object.Hash)
+	if !ok {
+		return newError("field assignment not supported: %s.%s", left.Type(), name)
 	}
 
+	return e.setKey(hash, &object.String{Value: name}, val)
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
-	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+// setKey sets the key of the hash to val, and returns val
+func (e *Evaluator) setKey(hash *object.Hash, key, val object.Object) object.Object {
+	hashableKey, ok := key.(object.Hashable)
+	if !ok {
+		return unusableHashKey(key)
+	}
+	if _, ok := hash.Pairs[hashableKey.HashKey()]; !ok {
+		if err := e.checkHashSize(len(hash.Pairs) + 1); err != nil {
+			return err
+		}
 	}
+	hash.Set(hashableKey, val)
+
+	return val
+}
 
-	return env
+func (e *Evaluator) evalIndexExpression(left, index object.Object) object.Object {
+	switch left.(type) {
+	case *object.Array:
+		// todo we differ from the book on how to evaluate the object indices
+		return evalArrayIndexExpression(left, index)
+	case *object.Hash:
+		return e.evalHashIndexExpression(left, index)
+	case *object.Bytes:
+		return evalBytesIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -1,11 +1,25 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"monkey/internal/lexer"
+	"monkey/internal/module"
 	"monkey/internal/object"
 	"monkey/internal/parser"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -144,6 +158,7 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) { }", nil},
 	}
 
 	for _, tt := range tests {
@@ -350,6 +365,8 @@ func TestEvalStringExpression(t *testing.T) {
 		{`"" + "a"`, "a"},
 		{`"a" * 2`, "aa"},
 		{`"ab" * 2`, "abab"},
+		{`"a\tb\n"`, "a\tb\n"},
+		{`"say \"hi\"" + "\\"`, `say "hi"\`},
 	}
 
 	for _, tt := range tests {
@@ -382,7 +399,24 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` is not supported. got INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len("one", "two")`, "wrong number of arguments to `len`. got=2, want=1"},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY. got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last([1], [2])`, "wrong number of arguments to `last`. got=2, want=1"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([1])`, []int{}},
+		{`rest([])`, nil},
+		{`push([1], 2)`, []int{1, 2}},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY. got INTEGER"},
+		{`push([1])`, "wrong number of arguments to `push`. got=1, want=2"},
+		{`pop([1, 2])`, []int{1}},
+		{`pop([])`, nil},
+		{`pop("ab")`, "argument to `pop` must be ARRAY. got STRING"},
+		{`let a = [1, 2]; let b = push(a, 3); let c = pop(a); let d = rest(a); len(a)`, 2},
 	}
 
 	for _, tt := range tests {
@@ -399,6 +433,21 @@ func TestBuiltinFunctions(t *testing.T) {
 			if errObj.Message != tt.expected {
 				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
 			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong number of elements. expected=%d, got=%d", len(expected), len(array.Elements))
+				continue
+			}
+			for i, element := range expected {
+				testIntegerObject(t, array.Elements[i], int64(element))
+			}
+		case nil:
+			testNullObject(t, evaluated)
 		}
 	}
 }
@@ -454,6 +503,9 @@ func TestArrayIndexExpressions(t *testing.T) {
 		{`let myArray = [1, "b", fn() { "1312" }]; myArray[0]`, 1},
 		{`let myArray = [1, "b", fn() { "1312" }]; myArray[1]`, "b"},
 		{`let myArray = [1, "b", (fn() { "1312" })]; myArray[2]()`, "1312"},
+		{`{true: 1, false: 2}[true]`, 1},
+		{`{true: 1, false: 2}[1 > 2]`, 2},
+		{`{true: "t", "true": "s"}["true"]`, "s"},
 	}
 
 	for _, tt := range tests {
@@ -481,6 +533,10 @@ func TestHashIndexExpressions(t *testing.T) {
 		{`let myArray = [1, "b", fn() { "1312" }]; myArray[0]`, 1},
 		{`let myArray = [1, "b", fn() { "1312" }]; myArray[1]`, "b"},
 		{`let myArray = [1, "b", (fn() { "1312" })]; myArray[2]()`, "1312"},
+		{`{true: 1, false: 2}[true]`, 1},
+		{`{true: 1, false: 2}[1 > 2]`, 2},
+		{`{true: "t", "true": "s"}["true"]`, "s"},
+		{`let k = "a"; {k + "b": 3}["ab"]`, 3},
 	}
 
 	for _, tt := range tests {
@@ -492,4 +548,1530 @@ func TestHashIndexExpressions(t *testing.T) {
 			testStringObject(t, evaluated, tt.expected.(string))
 		}
 	}
+
+	missing := []struct {
+		input    string
+		expected string
+		strict   string // the result with StrictKeys
+	}{
+		{`{"a": 1}["b"]`, "null", "ERROR: line 1, column 9: hash has no key b"},
+		{`{1: 1}[2]`, "null", "ERROR: line 1, column 7: hash has no key 2"},
+		{`{"a": if (false) { 1 }}["a"]`, "null", "null"},
+		{`[1][5]`, "null", "null"},
+	}
+
+	for _, tt := range missing {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if got := New(Config{StrictKeys: true}).Eval(program, object.NewEnv()).Inspect(); got != tt.strict {
+			t.Errorf("wrong result for %q with StrictKeys. expected=%q, got=%q", tt.input, tt.strict, got)
+		}
+	}
+}
+
+func TestDeepRecursion(t *testing.T) {
+	// with a Go stack this small, evaluating recursively would crash long before the Monkey recursion ends
+	defer debug.SetMaxStack(debug.SetMaxStack(256 << 10))
+
+	input := `
+let count = fn(n) { if (n == 0) { return 0; } 1 + count(n - 1) };
+let nested = fn(n) { if (n == 0) { [] } else { [nested(n - 1)] } };
+len(nested(1000)) + count(20000)`
+	testIntegerObject(t, testEval(input), 20001)
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	input := `let down = fn(n) { if (n > 0) { down(n - 1) } else { up(n) } };
+let up = fn(n) { up(n + 1) };
+down(3)`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	evaluated := New(Config{MaxCallDepth: 10}).Eval(program, object.NewEnv())
+
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := `ERROR: line 2, column 20: stack overflow: more than 10 calls in progress
+	up called at line 2, column 20 (repeated 5 times)
+	up called at line 1, column 56
+	down called at line 1, column 37 (repeated 3 times)
+	down called at line 3, column 5`
+	if err.Inspect() != expected {
+		t.Errorf("wrong error.\nexpected=%s\ngot=%s", expected, err.Inspect())
+	}
+
+	// the same evaluator keeps working after a stack overflow
+	testIntegerObject(t, testEval("let f = fn(n) { if (n > 0) { f(n - 1) } else { 7 } }; f(9)"), 7)
+
+	// the calls of builtins count too, and their nesting is limited as they run on the Go stack
+	tests := []struct {
+		input    string
+		config   Config
+		expected string
+	}{
+		{"let f = fn(n) { if (n > 0) { map([n - 1], f) } }; f(20)", Config{MaxCallDepth: 10}, "stack overflow: more than 10 calls in progress"},
+		{"let f = fn(x) { map([x], f) }; f(1)", Config{}, "stack overflow: more than 1000 calls of builtins calling functions in progress"},
+	}
+	for _, tt := range tests {
+		evaluated := New(tt.config).Eval(parser.New(lexer.New(tt.input)).ParseProgram(), object.NewEnv())
+		if err, ok := evaluated.(*object.Error); !ok || err.Message != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+	testIntegerObject(t, testEval("let f = fn(n) { if (n > 0) { reduce(map([n - 1], f), fn(a, b) { a + b }, 1) } else { 1 } }; f(100)"), 101)
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 +\n  foobar", "ERROR: line 2, column 3: identifier not found: foobar"},
+		{"[1][true - 1]", "ERROR: line 1, column 10: type mismatch: BOOLEAN - INTEGER"},
+		{"let f = fn(x) { len(x) };\nlet g = fn() { f(1) };\n\ng()",
+			"ERROR: line 1, column 20: argument to `len` is not supported. got INTEGER\n" +
+				"\tf called at line 2, column 17\n" +
+				"\tg called at line 4, column 2"},
+		{"let h = {}; h[fn() {}]", "ERROR: line 1, column 14: unusable as hash key: FUNCTION"},
+		{"let a = [1]; {a: 2}", "ERROR: line 1, column 15: unusable as hash key: ARRAY"},
+		{`[1]["a"]`, "ERROR: line 1, column 4: invalid index type. got=STRING"},
+		{"5(1)", "ERROR: line 1, column 2: not a function: INTEGER"},
+		{"let n = 0;\n10 / n", "ERROR: line 2, column 4: division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if evaluated == nil {
+			t.Errorf("no error for %q", tt.input)
+		} else if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong error for %q.\nexpected=%s\ngot=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBuiltinIO(t *testing.T) {
+	var out, errOut bytes.Buffer
+	e := New(Config{Stdout: &out, Stderr: &errOut, Stdin: strings.NewReader("Ada\nrest")})
+
+	input := `let name = input("name? ");
+println("hello", name);
+eprintln("warning:", [name]);
+printf("%s, %s!", input(), input());
+print(" a", 1, [2]);
+puts("", "b", 3);
+puts()`
+	evaluated := e.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnv())
+
+	testNullObject(t, evaluated)
+	if expected := "name? hello Ada\nrest, null! a 1 [2]\nb\n3\n"; out.String() != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, out.String())
+	}
+	if expected := "warning: [\"Ada\"]\n"; errOut.String() != expected {
+		t.Errorf("wrong error output. expected=%q, got=%q", expected, errOut.String())
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	tests := []struct {
+		sandbox  *Sandbox
+		input    string
+		expected string
+	}{
+		{nil, `input("? ")`, "? "},
+		{&Sandbox{}, `println(len("abc"))`, "3\n"},
+		{&Sandbox{}, `input("? ")`, "ERROR: line 1, column 1: input is not available in the sandbox"},
+		{&Sandbox{Allow: []string{"input"}}, `input("? ")`, "? "},
+		{&Sandbox{Allow: []string{"input"}}, `len("")`, "ERROR: line 1, column 1: len is not available in the sandbox"},
+		{&Sandbox{Deny: []string{"println"}}, `println(1)`, "ERROR: line 1, column 1: println is not available in the sandbox"},
+		{&Sandbox{Deny: []string{"println"}}, `let println = fn(x) { x }; println(1)`, ""},
+		{&Sandbox{}, `import("./lib")`, "ERROR: line 1, column 1: import is not available in the sandbox"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := New(Config{Stdout: &out, Stdin: strings.NewReader(""), Sandbox: tt.sandbox})
+		evaluated := e.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), object.NewEnv())
+
+		if err, ok := evaluated.(*object.Error); ok {
+			out.WriteString(err.Inspect())
+		}
+		if out.String() != tt.expected {
+			t.Errorf("wrong result for %q in %+v. expected=%q, got=%q", tt.input, tt.sandbox, tt.expected, out.String())
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	lib := fstest.MapFS{
+		"math.mk":   {Data: []byte(`puts("loading math"); let square = fn(x) { x * x }; let _twice = fn(x) { x * 2 };`)},
+		"geo.mk":    {Data: []byte(`let m = import("./math"); let area = fn(side) { m.square(side) };`)},
+		"a.mk":      {Data: []byte(`let b = import("./b");`)},
+		"b.mk":      {Data: []byte(`let a = import("./a");`)},
+		"broken.mk": {Data: []byte(`let x = 1 + true;`)},
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = import("lib/math"); m.square(3)`, "9"},
+		{`import("lib/geo").area(4) + import("lib/math").square(2)`, "20"},
+		{`import("lib/math")._twice`, "null"},
+		{`import("lib/a")`, "ERROR: line 1, column 7: lib:a.mk: line 1, column 15: lib:b.mk: line 1, column 15: import cycle: lib:a.mk imports lib:b.mk imports lib:a.mk"},
+		{`import("lib/broken")`, "ERROR: line 1, column 7: lib:broken.mk: line 1, column 11: type mismatch: INTEGER + BOOLEAN"},
+		{`import("lib/none")`, `ERROR: line 1, column 7: module "lib/none" not found, searched: lib:none.mk`},
+		{`import(1)`, "ERROR: line 1, column 7: argument to `import` must be STRING. got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := New(Config{Stdout: &out, Modules: &module.Resolver{Libraries: map[string]fs.FS{"lib": lib}}})
+		evaluated := e.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), object.NewEnv())
+
+		got := evaluated.Inspect()
+		if err, ok := evaluated.(*object.Error); ok {
+			got = "ERROR: " + fmt.Sprintf("line %d, column %d: ", err.Token.Line, err.Token.Column) + err.Message
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if strings.Count(out.String(), "loading math") > 1 {
+			t.Errorf("math loaded more than once for %q", tt.input)
+		}
+	}
+
+	// relative paths are found from the file of the program
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "util.mk"), []byte("let answer = 42;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := InFile(context.Background(), module.File{Name: filepath.Join(dir, "main.mk")})
+	program := parser.New(lexer.New(`import("./util").answer`)).ParseProgram()
+	testIntegerObject(t, New(Config{}).EvalContext(ctx, program, object.NewEnv()), 42)
+}
+
+func TestHashOrder(t *testing.T) {
+	// the order of the source, with a key set again keeping its place
+	input := `{"b": 1, "a": 2, 3: 4, true: 5, "b": 6}`
+	for i := 0; i < 10; i++ {
+		if got := testEval(input).Inspect(); got != `{"b": 6, "a": 2, 3: 4, true: 5}` {
+			t.Fatalf("wrong order. got=%s", got)
+		}
+	}
+}
+
+func TestIntegersAreShared(t *testing.T) {
+	// small integers are shared, so operations must never change their operands
+	testIntegerObject(t, testEval("let a = 5; let b = -a; a + 5"), 10)
+	testIntegerObject(t, testEval("let f = fn() { 7 }; -f(); f()"), 7)
+
+	if testEval("3 + 4") != testEval("7") {
+		t.Errorf("expected small integers to be the same object")
+	}
+
+	// every evaluation of a literal gives the same value
+	pair := testEval(`let f = fn() { [1000000, "s"] }; [f(), f()]`).(*object.Array).Elements
+	first, second := pair[0].(*object.Array).Elements, pair[1].(*object.Array).Elements
+	if first[0] != second[0] || first[1] != second[1] {
+		t.Errorf("expected literals to be evaluated to the same objects")
+	}
+}
+
+func TestClosureCaptures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// a binding set after the closure is created is seen by it
+		{"let f = fn() { let g = fn() { x }; let x = 2; g() }; f()", 2},
+		{"let x = 1; let f = fn() { let g = fn() { x }; let y = g(); let x = 2; y * 10 + g() }; f()", 12},
+		{"let f = fn() { let even = fn(n) { if (n == 0) { 1 } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { 0 } else { even(n - 1) } }; even(10) }; f()", 1},
+		{"let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3)", 6},
+		{"let f = fn() { let n = 1; let g = fn() { let n = n + 1; n }; g() + n }; f()", 3},
+		{"let g = 5; let f = fn() { fn() { g } }; let h = f(); let g = 6; h()", 6},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// the closure doesn't keep the bindings of the function it was created in that it doesn't use
+	fn, ok := testEval("let g = 1; let f = fn(a) { let big = [1, 2, 3]; fn() { a + g } }; f(1)").(*object.Function)
+	if !ok {
+		t.Fatalf("expected a function")
+	}
+	if _, ok := fn.Env.Get("big"); ok {
+		t.Errorf("expected big not to be captured")
+	}
+	for _, name := range []string{"a", "g"} {
+		if _, ok := fn.Env.Get(name); !ok {
+			t.Errorf("expected %s to be in scope", name)
+		}
+	}
+}
+
+func TestSizeLimits(t *testing.T) {
+	config := Config{MaxStringLength: 10, MaxArrayLength: 3, MaxHashSize: 2}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a" * 999999999`, "resource limit exceeded: strings can't be longer than 10 bytes"},
+		{`"ab" * 5`, "ababababab"},
+		{`"ab" * 6`, "resource limit exceeded: strings can't be longer than 10 bytes"},
+		{`"abcdef" + "ghijk"`, "resource limit exceeded: strings can't be longer than 10 bytes"},
+		{`"a" * -1`, "negative repeat count: -1"},
+		{`[1, 2, 3]`, "[1, 2, 3]"},
+		{`[1, 2, 3, 4]`, "resource limit exceeded: arrays can't have more than 3 elements"},
+		{`{1: 1, 2: 2, 1: 3}`, "{1: 3, 2: 2}"},
+		{`{1: 1, 2: 2, 3: 3}`, "resource limit exceeded: hashes can't have more than 2 pairs"},
+		{`join(["abcde", "fghij"], "")`, "abcdefghij"},
+		{`join(["abcde", "fghij"], "-")`, "resource limit exceeded: strings can't be longer than 10 bytes"},
+		{`let s = "ab"; s = join([s, s], ""); s = join([s, s], ""); join([s, s], "")`, "resource limit exceeded: strings can't be longer than 10 bytes"},
+		{`replace("aaaaa", "a", "bb")`, "bbbbbbbbbb"},
+		{`replace("aaaaaa", "a", "bb")`, "resource limit exceeded: strings can't be longer than 10 bytes"},
+		{`replace("ab", "", "xxxx")`, "resource limit exceeded: strings can't be longer than 10 bytes"},
+		{`split("a,b,c", ",")`, `["a", "b", "c"]`},
+		{`split("a,b,c,d", ",")`, "resource limit exceeded: arrays can't have more than 3 elements"},
+		{`split("abcd", "")`, "resource limit exceeded: arrays can't have more than 3 elements"},
+		{`push([1, 2], 3)`, "[1, 2, 3]"},
+		{`let xs = []; for (let i = 0; i < 10; i = i + 1) { xs = push(xs, i) }; xs`, "resource limit exceeded: arrays can't have more than 3 elements"},
+		{`str([1, 2, 3])`, "[1, 2, 3]"},
+		{`str([100, 200, 300])`, "resource limit exceeded: strings can't be longer than 10 bytes"},
+		{`toHex(bytes("abcde"))`, "6162636465"},
+		{`toHex(bytes("abcdef"))`, "resource limit exceeded: strings can't be longer than 10 bytes"},
+		{`toBase64(bytes("abcdefgh"))`, "resource limit exceeded: strings can't be longer than 10 bytes"},
+		{`type(chan(3))`, "CHANNEL"},
+		{`chan(4)`, "resource limit exceeded: channels can't hold more than 3 values"},
+		{`pool(9223372036854775807, [1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		result := New(config).Eval(program, object.NewEnv())
+
+		var got string
+		if err, ok := result.(*object.Error); ok {
+			got = err.Message
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestCheckedIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2"},
+		{"let min = -9223372036854775807 - 1; -min", "integer overflow: -(-9223372036854775808)"},
+		{"let min = -9223372036854775807 - 1; min / -1", "integer overflow: -9223372036854775808 / -1"},
+		{"let min = -9223372036854775807 - 1; min * -1", "integer overflow: -9223372036854775808 * -1"},
+		{"4611686018427387903 * 2 + 1", "9223372036854775807"},
+		{"-3037000499 * 3037000499", "-9223372030926249001"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		result := New(Config{CheckedIntegers: true}).Eval(program, object.NewEnv())
+
+		var got string
+		if err, ok := result.(*object.Error); ok {
+			got = err.Message
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// integers wrap around by default
+	testIntegerObject(t, testEval("9223372036854775807 + 1"), math.MinInt64)
+}
+
+func TestHashKeys(t *testing.T) {
+	// keys of different types never collide, whatever their values
+	hash := testEval(`{"INTEGER_5": 1, 5: 2, "1": 3, 1: 4, true: 5}`).(*object.Hash)
+	if len(hash.Pairs) != 5 {
+		t.Errorf("hash has wrong number of pairs. got=%d", len(hash.Pairs))
+	}
+
+	one, alsoOne := &object.String{Value: "one"}, &object.String{Value: "one"}
+	if one.HashKey() != alsoOne.HashKey() {
+		t.Errorf("equal strings have different hash keys")
+	}
+	if one.HashKey() == (&object.String{Value: "two"}).HashKey() {
+		t.Errorf("different strings have the same hash key")
+	}
+}
+
+func BenchmarkHashes(b *testing.B) {
+	input := `
+let h = {"alpha": 1, "beta": 2, "gamma": 3, 1: 4, 2: 5, true: 6};
+let loop = fn(n, acc) {
+	if (n == 0) {
+		acc
+	} else {
+		loop(n - 1, acc + h["alpha"] + h["beta"] + h["gamma"] + h[1] + h[2] + h[true])
+	}
+};
+loop(1000, 0)`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnv())
+	}
+}
+
+func BenchmarkHashKey(b *testing.B) {
+	key := &object.String{Value: "a key of a typical length"}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		key.HashKey()
+	}
+}
+
+func TestDeepEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`[1, "a", [true]] == [1, "a", [true]]`, true},
+		{`[1, 2] == [1, 2, 3]`, false},
+		{`[1, 2] != [2, 1]`, true},
+		{`[1, "1"] == [1, 1]`, false},
+		{`{"a": [1], 2: {}} == {2: {}, "a": [1]}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`let f = fn() { 1 }; f == f`, true},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`[len] == [len]`, true},
+		{`if (false) { 1 } == if (false) { 2 }`, true},
+	}
+
+	for _, tt := range tests {
+		if !testBooleanObject(t, testEval(tt.input), tt.expected) {
+			t.Errorf("wrong result for %q", tt.input)
+		}
+	}
+
+	// values containing themselves
+	a, b := &object.Array{}, &object.Array{}
+	a.Elements = []object.Object{object.NewInteger(1), a}
+	b.Elements = []object.Object{object.NewInteger(1), b}
+	if !equal(a, b) {
+		t.Errorf("expected arrays containing themselves to be equal")
+	}
+	c := &object.Array{}
+	c.Elements = []object.Object{object.NewInteger(2), c}
+	if equal(a, c) {
+		t.Errorf("expected arrays containing themselves with different elements to differ")
+	}
+}
+
+func TestFieldExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		strict   string // the result with StrictFields, if it differs
+	}{
+		{`let point = {"x": 1, "y": 2}; point.x + point.y`, "3", ""},
+		{`let user = {"name": "ann", "address": {"city": "oslo"}}; user.address.city`, "oslo", ""},
+		{`let name = "x"; {"name": 1}.name`, "1", ""},
+		{`let h = {"f": fn(a) { a * 2 }}; h.f(4)`, "8", ""},
+		{`{}.missing`, "null", "ERROR: line 1, column 3: hash has no field missing"},
+		{`let a = [1]; a.len`, "ERROR: line 1, column 15: field access not supported: ARRAY.len", ""},
+		{`let h = {"x": 1}; h.x = h.x + 1; h.y = 5; [h.x, h.y]`, "[2, 5]", ""},
+		{`let h = {}; let v = h.a = h["b"] = 3; [v, h["a"], h.b]`, "[3, 3, 3]", ""},
+		{`let p = {"at": {}}; p.at.x = 1; p.at[true] = 2; p`, `{"at": {"x": 1, true: 2}}`, ""},
+		{`let a = [1]; a.len = 2`, "ERROR: line 1, column 15: field assignment not supported: ARRAY.len", ""},
+		{`let a = [1]; a[0] = 2`, "ERROR: line 1, column 15: index assignment not supported: ARRAY", ""},
+		{`let h = {}; h[[1]] = 2`, "ERROR: line 1, column 14: unusable as hash key: ARRAY", ""},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		for _, strict := range []bool{false, true} {
+			expected := tt.expected
+			if strict && tt.strict != "" {
+				expected = tt.strict
+			}
+
+			got := New(Config{StrictFields: strict}).Eval(program, object.NewEnv()).Inspect()
+			if got != expected {
+				t.Errorf("wrong result for %q with StrictFields %t. expected=%q, got=%q", tt.input, strict, expected, got)
+			}
+		}
+	}
+}
+
+func TestMemo(t *testing.T) {
+	// without memo, this would take 2^90 calls
+	input := `
+let fib = memo(fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } });
+fib(90)`
+	testIntegerObject(t, testEval(input), 2880067194370816120)
+
+	var out bytes.Buffer
+	input = `
+let f = memo(fn(a, b) { println(a, b); [a, b] });
+f(1, "x"); f(1, "x"); f("1", "x"); f(1, "x")[1]`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	testStringObject(t, New(Config{Stdout: &out}).Eval(program, object.NewEnv()), "x")
+	if out.String() != "1 x\n1 x\n" {
+		t.Errorf("expected each distinct call to be made once. got=%q", out.String())
+	}
+
+	// arguments that can't be hash keys skip the memo, errors aren't remembered
+	testIntegerObject(t, testEval("let f = memo(fn(a) { len(a) }); f([1, 2]) + f([1])"), 3)
+	errorMessage := testEval(`let f = memo(fn(a) { a / 0 }); f(1); f(1)`).(*object.Error).Message
+	if errorMessage != "division by zero" {
+		t.Errorf("wrong error. got=%q", errorMessage)
+	}
+	if got := testEval("memo(1)").(*object.Error).Message; got != "argument to `memo` must be a function. got INTEGER" {
+		t.Errorf("wrong error. got=%q", got)
+	}
+}
+
+func TestConcurrentEvaluation(t *testing.T) {
+	// run with -race: evaluations in their own environments share nothing they change, even when they share the
+	// evaluator and the program
+	input := `
+let fib = memo(fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } });
+let adder = fn(a) { fn(b) { a + b } };
+let h = {"a": 1, true: 2, 3: [4]};
+println("fib", fib(30));
+adder(fib(20))(h.a + h[true] + h[3][0] - 7) + len("abc" * 2)`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	shared := New(Config{Stdout: io.Discard})
+
+	var wg sync.WaitGroup
+	results := make([]object.Object, 16)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				results[i] = shared.Eval(program, object.NewEnv())
+			} else {
+				results[i] = New(Config{Stdout: io.Discard}).Eval(program, object.NewEnv())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		testIntegerObject(t, result, 6771)
+	}
+}
+
+func TestFloats(t *testing.T) {
+	f := func(v float64) object.Object { return &object.Float{Value: v} }
+	i := func(v int64) object.Object { return object.NewInteger(v) }
+
+	tests := []struct {
+		left     object.Object
+		operator string
+		right    object.Object
+		expected string
+	}{
+		{f(1.5), "+", f(2.25), "3.75"},
+		{f(1.5), "*", i(2), "3.0"},
+		{i(7), "/", f(2), "3.5"},
+		{i(1), "-", f(0.5), "0.5"},
+		{f(1e21), "*", i(10), "1e+22"},
+		{f(1), "/", i(0), "division by zero"},
+		{f(2), "==", i(2), "true"},
+		{i(2), "<", f(2.5), "true"},
+		{f(2.5), ">", f(2.5), "false"},
+		{f(2.5), "!=", i(2), "true"},
+		{f(1), "+", &object.String{Value: "a"}, "type mismatch: FLOAT + STRING"},
+	}
+
+	e := New(Config{})
+	for _, tt := range tests {
+		result := e.evalInfixExpression(tt.operator, tt.left, tt.right)
+
+		var got string
+		if err, ok := result.(*object.Error); ok {
+			got = err.Message
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %s %s %s. expected=%q, got=%q", tt.left.Inspect(), tt.operator, tt.right.Inspect(), tt.expected, got)
+		}
+	}
+
+	if got := e.evalPrefixExpression("-", f(0.5)).Inspect(); got != "-0.5" {
+		t.Errorf("wrong negation. got=%s", got)
+	}
+
+	if !equal(&object.Array{Elements: []object.Object{f(1)}}, &object.Array{Elements: []object.Object{i(1)}}) {
+		t.Errorf("expected [1.0] to equal [1]")
+	}
+
+	sources := []struct {
+		input    string
+		expected string
+	}{
+		{"3.14", "3.14"},
+		{"1.5 * 2", "3.0"},
+		{"2.5e-1 + 1", "1.25"},
+		{"-1e3", "-1000.0"},
+		{"7 / 2.0 > 3", "true"},
+		{`{1.5: "a", 2: "b"}[1.5]`, "a"},
+		{`{1.5: "a", 2: "b"}[2.0]`, "b"},
+	}
+	for _, tt := range sources {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// floats with an integer value are the same key as the integer
+	if f(3).(object.Hashable).HashKey() != i(3).(object.Hashable).HashKey() {
+		t.Errorf("expected 3.0 and 3 to be the same hash key")
+	}
+	if f(3.5).(object.Hashable).HashKey() == f(3.25).(object.Hashable).HashKey() {
+		t.Errorf("expected 3.5 and 3.25 to be different hash keys")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`bytes("hi")`, `b"hi"`},
+		{`bytes([0, 104, 255])`, `b"\x00h\xff"`},
+		{`bytes([256])`, "argument to `bytes` must only hold integers from 0 to 255. got 256"},
+		{`let b = bytes([1, 2, 3]); b[0] + b[2] + len(b)`, "7"},
+		{`bytes("a")[1]`, "null"},
+		{`text(bytes("héllo"))`, "héllo"},
+		{`toHex(bytes([0, 171, 255]))`, "00abff"},
+		{`fromHex("00abff") == bytes([0, 171, 255])`, "true"},
+		{`fromHex("0g")`, "invalid hex: encoding/hex: invalid byte: U+0067 'g'"},
+		{`toBase64(bytes("any carnal pleas"))`, "YW55IGNhcm5hbCBwbGVhcw=="},
+		{`text(fromBase64("YW55IGNhcm5hbCBwbGVhcw=="))`, "any carnal pleas"},
+		{`slice(bytes("abcdef"), 1, 3)`, `b"bc"`},
+		{`slice("abcdef", 2, 6)`, "cdef"},
+		{`slice([1, 2, 3], 0, 2)`, "[1, 2]"},
+		{"slice([\"a\", \"b\nc\"], 1, 2)", `["b\nc"]`},
+		{`slice(bytes("ab"), 1, 3)`, "slice bounds out of range [1:3] with length 2"},
+		{`text("a")`, "argument to `text` must be BYTES. got STRING"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+
+		var got string
+		if err, ok := result.(*object.Error); ok {
+			got = err.Message
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEnvironmentSnapshots(t *testing.T) {
+	env := object.NewEnv()
+	eval := func(input string) object.Object {
+		return Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+
+	eval("let a = 1; let get = fn() { a }; let f = fn() { let x = 5; fn() { x } }; let g = f();")
+	snapshot := env.Snapshot()
+
+	eval("let a = 2; let b = 3;")
+	testIntegerObject(t, eval("get()"), 2)
+
+	env.Restore(snapshot)
+	testIntegerObject(t, eval("get()"), 1)
+	if _, ok := env.Get("b"); ok {
+		t.Errorf("expected b to be gone")
+	}
+
+	env.Delete("g")
+	if _, ok := env.Get("g"); ok {
+		t.Errorf("expected g to be deleted")
+	}
+	env.Restore(snapshot)
+	testIntegerObject(t, eval("g()"), 5)
+}
+
+func TestConstants(t *testing.T) {
+	env := object.NewEnv()
+	env.SetConst("pi", object.NewInteger(3))
+	eval := func(input string) object.Object {
+		return Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+
+	if got := eval("let pi = 4;").Inspect(); got != "ERROR: line 1, column 5: cannot assign to pi, it is a constant" {
+		t.Errorf("wrong result for rebinding a constant. got=%s", got)
+	}
+	testIntegerObject(t, eval("pi"), 3)
+
+	// functions have their own names
+	testIntegerObject(t, eval("let f = fn() { let pi = 4; pi }; f() + pi"), 7)
+
+	if _, ok := env.SetConst("pi", object.NewInteger(5)).(*object.Error); !ok {
+		t.Errorf("expected an error setting a constant again")
+	}
+
+	snapshot := env.Snapshot()
+	env.Delete("pi")
+	env.Restore(snapshot)
+	if _, ok := env.Set("pi", object.NewInteger(5)).(*object.Error); !ok {
+		t.Errorf("expected pi to still be a constant once restored")
+	}
+}
+
+func TestSyncEnvironment(t *testing.T) {
+	// run with -race: programs running at once share the globals
+	globals := object.NewSyncEnv()
+	Eval(parser.New(lexer.New(`let base = 10; let add = fn(a) { a + base };`)).ParseProgram(), globals)
+
+	read := parser.New(lexer.New(`let mine = add(1); let base = 10; mine`)).ParseProgram()
+	write := parser.New(lexer.New(`let shared = add(2);`)).ParseProgram()
+
+	var wg sync.WaitGroup
+	results := make([]object.Object, 8)
+	for i := range results {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = Eval(read, object.NewEnclosedEnvironment(globals))
+		}(i)
+		go func() {
+			defer wg.Done()
+			Eval(write, globals)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		testIntegerObject(t, result, 11)
+	}
+	shared, _ := globals.Get("shared")
+	testIntegerObject(t, shared, 12)
+}
+
+func TestSerialization(t *testing.T) {
+	value := testEval(`{"a": [1, 9223372036854775807, "s", true, false, if (false) { 1 }], 2: {}, false: bytes("\x00")}`)
+	data, err := object.Marshal(value)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	restored, err := object.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+	if !equal(value, restored) || restored.Inspect() != value.Inspect() {
+		t.Errorf("wrong value restored. expected=%s, got=%s", value.Inspect(), restored.Inspect())
+	}
+
+	if _, err := object.Marshal(testEval("[fn() { 1 }]")); err == nil || err.Error() != "cannot marshal FUNCTION" {
+		t.Errorf("expected functions not to be marshaled. got=%v", err)
+	}
+
+	// environments are saved without the functions
+	env := object.NewEnv()
+	Eval(parser.New(lexer.New(`let a = [1, 2]; let f = fn() { a };`)).ParseProgram(), env)
+	env.SetConst("c", object.FALSE)
+	var saved bytes.Buffer
+	if err := env.Save(&saved); err != nil {
+		t.Fatalf("save failed: %s", err)
+	}
+
+	loaded := object.NewEnv()
+	if err := loaded.Load(&saved); err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+	if got := Eval(parser.New(lexer.New(`if (c) { 0 } else { a[1] }`)).ParseProgram(), loaded); got.Inspect() != "2" {
+		t.Errorf("wrong value after loading. got=%s", got.Inspect())
+	}
+	if _, ok := loaded.Get("f"); ok {
+		t.Errorf("expected f not to be saved")
+	}
+	if _, ok := loaded.Set("c", object.TRUE).(*object.Error); !ok {
+		t.Errorf("expected c to still be a constant")
+	}
+}
+
+func TestNative(t *testing.T) {
+	type handle struct{ id int }
+	h := &object.Native{Value: &handle{id: 7}}
+
+	env := object.NewEnv()
+	env.Set("h", h)
+	result := Eval(parser.New(lexer.New(`let pass = fn(x) { x }; [pass(h), h == h, h]`)).ParseProgram(), env)
+
+	elements := result.(*object.Array).Elements
+	if elements[0] != h {
+		t.Errorf("expected the native value to be passed through")
+	}
+	testBooleanObject(t, elements[1], true)
+	if got := h.Inspect(); got != "&{7}" {
+		t.Errorf("wrong inspect. got=%s", got)
+	}
+	if got := Eval(parser.New(lexer.New(`h + 1`)).ParseProgram(), env).(*object.Error).Message; got != "type mismatch: NATIVE + INTEGER" {
+		t.Errorf("wrong error. got=%s", got)
+	}
+}
+
+func TestGoConversions(t *testing.T) {
+	type point struct {
+		X, Y   int
+		hidden bool
+	}
+
+	obj, err := object.FromGo(map[string]interface{}{
+		"ints":   []int{1, 2},
+		"point":  &point{X: 3, Y: 4},
+		"nested": map[int][]string{1: {"a"}},
+		"data":   []byte("b"),
+		"none":   nil,
+		"flag":   true,
+		"ratio":  0.5,
+	})
+	if err != nil {
+		t.Fatalf("conversion failed: %s", err)
+	}
+	expected := `{"data": b"b", "flag": true, "ints": [1, 2], "nested": {1: ["a"]}, "none": null, "point": {"X": 3, "Y": 4}, "ratio": 0.5}`
+	if obj.Inspect() != expected {
+		t.Errorf("wrong object. expected=%s, got=%s", expected, obj.Inspect())
+	}
+
+	env := object.NewEnv()
+	env.Set("v", obj)
+	testIntegerObject(t, Eval(parser.New(lexer.New(`v.point.X + v.ints[1] + len(v.nested[1])`)).ParseProgram(), env), 6)
+
+	if _, err := object.FromGo(func() {}); err == nil {
+		t.Errorf("expected functions not to be converted")
+	}
+	if _, err := object.FromGo(uint64(math.MaxUint64)); err == nil {
+		t.Errorf("expected an overflow error")
+	}
+
+	value := object.ToGo(testEval(`{"a": [1, "s", true, 1 > 2], "b": {2: if (false) { 1 }}}`))
+	expectedValue := map[string]interface{}{
+		"a": []interface{}{int64(1), "s", true, false},
+		"b": map[interface{}]interface{}{int64(2): nil},
+	}
+	if !reflect.DeepEqual(value, expectedValue) {
+		t.Errorf("wrong Go value. expected=%#v, got=%#v", expectedValue, value)
+	}
+}
+
+func TestIterators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`[1, "a", [2]]`, []string{"1", "a", "[2]"}},
+		{`{"b": 1, 2: 3, true: 4}`, []string{"b", "2", "true"}},
+		{`"héllo"`, []string{"h", "é", "l", "l", "o"}},
+		{`range(3)`, []string{"0", "1", "2"}},
+		{`range(1, 8, 3)`, []string{"1", "4", "7"}},
+		{`range(5, 0, -2)`, []string{"5", "3", "1"}},
+		{`range(3, 1)`, nil},
+		{`[]`, nil},
+	}
+
+	for _, tt := range tests {
+		iterable, ok := testEval(tt.input).(object.Iterable)
+		if !ok {
+			t.Errorf("%q isn't iterable", tt.input)
+			continue
+		}
+
+		var got []string
+		for it := iterable.Iterate(); ; {
+			obj, ok := it.Next()
+			if !ok {
+				break
+			}
+			got = append(got, obj.Inspect())
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("wrong iteration of %q. expected=%v, got=%v", tt.input, tt.expected, got)
+		}
+	}
+
+	testIntegerObject(t, testEval("len(range(0, 10, 3))"), 4)
+	if got := testEval("range(1, 2, 0)").(*object.Error).Message; got != "step of `range` can't be 0" {
+		t.Errorf("wrong error. got=%s", got)
+	}
+}
+
+func TestComparisons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"apple" < "banana"`, "true"},
+		{`"b" > "banana"`, "false"},
+		{`false < true`, "true"},
+		{`true > true`, "false"},
+		{`-1 < 0`, "true"},
+		{`"a" < 1`, "type mismatch: STRING < INTEGER"},
+		{`[1] < [2]`, "type mismatch: ARRAY < ARRAY"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+
+		var got string
+		if err, ok := result.(*object.Error); ok {
+			got = err.Message
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	order, err := object.NewInteger(2).Compare(&object.Float{Value: 2.5})
+	if err != nil || order != -1 {
+		t.Errorf("wrong order of 2 and 2.5. got=%d, %v", order, err)
+	}
+	if _, err := (&object.Float{Value: math.NaN()}).Compare(object.NewInteger(1)); err == nil {
+		t.Errorf("expected NaN not to be comparable")
+	}
+}
+
+func TestHelp(t *testing.T) {
+	input := `
+/// add returns the sum of a and b.
+/// It works on integers.
+let add = fn(a, b) { a + b };
+let anonymous = [fn(x) { x }];
+help(add); help(anonymous[0]); help(len); help(memo(add));
+add(1)`
+
+	var out bytes.Buffer
+	program := parser.New(lexer.New(input)).ParseProgram()
+	result := New(Config{Stdout: &out}).Eval(program, object.NewEnv())
+
+	expected := "fn add(a, b)\n\tadd returns the sum of a and b.\n\tIt works on integers.\n" +
+		"fn(x)\n" +
+		"builtin len(x)\n\tlen returns the length of a string, an array, bytes or a range.\n" +
+		"memo(fn add(a, b))\n\tadd returns the sum of a and b.\n\tIt works on integers.\n"
+	if out.String() != expected {
+		t.Errorf("wrong help.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+
+	if got := result.Inspect(); got != "ERROR: line 7, column 4: wrong number of arguments to `add`. got=1, want=2" {
+		t.Errorf("wrong error. got=%s", got)
+	}
+	if got := testEval("fn(x) { x }(1, 2)").(*object.Error).Message; got != "wrong number of arguments to `fn`. got=2, want=1" {
+		t.Errorf("wrong error. got=%s", got)
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the error message, empty for null
+	}{
+		{`assert(1 < 2)`, ""},
+		{`assert(1 > 2)`, "assertion failed"},
+		{`assert(false, "must hold")`, "assertion failed: must hold"},
+		{`assert_eq([1, {"a": 2}], [1, {"a": 2}])`, ""},
+		{`assert_eq(1 + 2, 4)`, "assertion failed. got=3, want=4"},
+		{`assert_eq("a", "b", "strings")`, `assertion failed: strings. got=a, want=b`},
+		{`assert()`, "wrong number of arguments to `assert`. got=0, want=1 or 2"},
+		{`assert_eq(1)`, "wrong number of arguments to `assert_eq`. got=1, want=2 or 3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if tt.expected == "" {
+			testNullObject(t, evaluated)
+			continue
+		}
+
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, err.Message)
+		}
+	}
+}
+
+func TestDeclaredTests(t *testing.T) {
+	input := `
+let check = fn(x) { assert_eq(x, 2) };
+test("passes", fn() { check(1 + 1) });
+test("fails", fn() { check(1) });
+bench("checks", fn() { check(2) });
+`
+	var names, benchmarks []string
+	var fns []object.Object
+	e := New(Config{
+		Test: func(name string, fn object.Object) {
+			names = append(names, name)
+			fns = append(fns, fn)
+		},
+		Bench: func(name string, fn object.Object) { benchmarks = append(benchmarks, name) },
+	})
+	testNullObject(t, e.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnv()))
+
+	if len(names) != 2 || names[0] != "passes" || names[1] != "fails" {
+		t.Fatalf("wrong tests declared. got=%v", names)
+	}
+	if len(benchmarks) != 1 || benchmarks[0] != "checks" {
+		t.Errorf("wrong benchmarks declared. got=%v", benchmarks)
+	}
+	testNullObject(t, e.Call(fns[0]))
+	if got := e.Call(fns[1]).Inspect(); got != "ERROR: line 2, column 30: assertion failed. got=1, want=2\n\tcheck called at line 4, column 27\n\tfn" {
+		t.Errorf("wrong error. got=%q", got)
+	}
+
+	// without a runner, tests and benchmarks are only checked
+	testNullObject(t, testEval(`test("ignored", fn() { assert(false) })`))
+	testNullObject(t, testEval(`bench("ignored", fn() { 1 })`))
+	if got := testEval(`bench(1, fn() { 1 })`).(*object.Error).Message; got != "name of `bench` must be STRING. got INTEGER" {
+		t.Errorf("wrong error. got=%q", got)
+	}
+	if got := testEval(`test("x", 1)`).(*object.Error).Message; got != "argument to `test` must be a function. got INTEGER" {
+		t.Errorf("wrong error. got=%q", got)
+	}
+}
+
+func TestCall(t *testing.T) {
+	env := object.NewEnv()
+	e := New(Config{})
+	e.Eval(parser.New(lexer.New(`let add = fn(a, b) { a + b }`)).ParseProgram(), env)
+	add, _ := env.Get("add")
+
+	testIntegerObject(t, e.Call(add, object.NewInteger(2), object.NewInteger(3)), 5)
+	testIntegerObject(t, e.Call(e.Builtin("len"), &object.String{Value: "four"}), 4)
+	if got := e.Call(add).(*object.Error).Message; got != "wrong number of arguments to `add`. got=0, want=2" {
+		t.Errorf("wrong error. got=%q", got)
+	}
+	if got := e.Call(object.NewInteger(1)).(*object.Error).Message; got != "not a function: INTEGER" {
+		t.Errorf("wrong error. got=%q", got)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var out bytes.Buffer
+	e := New(Config{Stdout: &out, Sandbox: &Sandbox{Deny: []string{"lookup"}}})
+	e.Register("lookup", &object.Builtin{Params: []string{"key"}, Fn: func(args ...object.Object) object.Object {
+		return &object.String{Value: "value of " + args[0].Inspect()}
+	}})
+	e.Register("len", &object.Builtin{Fn: func(args ...object.Object) object.Object { return object.NewInteger(-1) }})
+
+	e.Eval(parser.New(lexer.New(`println(lookup("a"), len("abc")); help(lookup)`)).ParseProgram(), object.NewEnv())
+	if out.String() != "value of a -1\nbuiltin lookup(key)\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	e.Remove("lookup")
+	e.Remove("missing")
+	result := e.Eval(parser.New(lexer.New(`lookup("a")`)).ParseProgram(), object.NewEnv())
+	if err, ok := result.(*object.Error); !ok || err.Message != "lookup is disabled by the configuration of the engine" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
+
+func TestMeter(t *testing.T) {
+	input := `let f = fn(n) { if (n > 0) { [n, f(n - 1)] } else { [] } }; let g = fn() { {"a": "b" + "c"} }; g(); f(3)`
+	tests := []struct {
+		meter    *Meter
+		expected string
+	}{
+		{&Meter{}, ""},
+		{&Meter{MaxSteps: 5}, "ERROR: line 1, column 17: resource limit exceeded: programs can't run more than 5 steps\n\tf called at line 1, column 102"},
+		{&Meter{MaxObjects: 6}, "ERROR: line 1, column 42: resource limit exceeded: programs can't create more than 6 objects\n\tf called at line 1, column 35\n\tf called at line 1, column 102"},
+	}
+
+	for _, tt := range tests {
+		e := New(Config{Meter: tt.meter})
+		result := e.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnv())
+		if tt.expected != "" {
+			if result.Inspect() != tt.expected {
+				t.Errorf("wrong result. expected=%q, got=%q", tt.expected, result.Inspect())
+			}
+			continue
+		}
+
+		if result.Inspect() != "[3, [2, [1, []]]]" {
+			t.Errorf("wrong result. got=%s", result.Inspect())
+		}
+		if tt.meter.Steps() != 13 || tt.meter.Objects() != 8 || tt.meter.Depth() != 4 {
+			t.Errorf("wrong usage. got steps=%d, objects=%d, depth=%d", tt.meter.Steps(), tt.meter.Objects(), tt.meter.Depth())
+		}
+		tt.meter.Reset()
+		if tt.meter.Steps() != 0 || tt.meter.Objects() != 0 || tt.meter.Depth() != 0 {
+			t.Errorf("meter not reset")
+		}
+	}
+
+	e := New(Config{Meter: &Meter{}})
+	meter := &Meter{}
+	e.WithMeter(meter).Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnv())
+	if meter.Steps() != 13 || e.Config().Meter.Steps() != 0 {
+		t.Errorf("wrong meter. got steps=%d and %d", meter.Steps(), e.Config().Meter.Steps())
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	// run with -race: the globals the tasks use are set while they run
+	input := `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let tasks = [spawn(fib, 20), spawn(fib, 21), spawn(fn(a, b) { fib(a) + b }, 10, 1)];
+let other = 1;
+wait(tasks[0]) + wait(tasks[1]) + wait(tasks[2]) + other`
+	testIntegerObject(t, testEval(input), 6765+10946+55+1+1)
+
+	// a memo shared by tasks and the program calling it at once
+	input = `
+let fib = memo(fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } });
+let tasks = [spawn(fib, 60), spawn(fib, 61), spawn(fib, 62)];
+fib(59) + wait(tasks[0]) + wait(tasks[1]) + wait(tasks[2])`
+	testIntegerObject(t, testEval(input), 956722026041+1548008755920+2504730781961+4052739537881)
+
+	// a task and the function spawning it setting a local the task captured at once
+	input = `
+let count = fn(n) {
+  let x = 0;
+  let task = spawn(fn() { for (let i = 0; i < n; i = i + 1) { x = x + 1 } });
+  for (let i = 0; i < n; i = i + 1) { x = x + 1 };
+  wait(task);
+  x > 0
+};
+count(1000)`
+	testBooleanObject(t, testEval(input), true)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"wait(spawn(fn(a) { a / 0 }, 1))", "division by zero"},
+		{"spawn(1)", "argument to `spawn` must be a function. got INTEGER"},
+		{"wait([])", "argument to `wait` must be a task. got ARRAY"},
+	}
+	for _, tt := range tests {
+		if got := testEval(tt.input).(*object.Error).Message; got != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	// tasks are stopped along with the program spawning them
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	program := parser.New(lexer.New("let f = fn() { f() + 1 }; wait(spawn(f))")).ParseProgram()
+	result := New(Config{MaxCallDepth: 1 << 30}).EvalContext(ctx, program, object.NewEnv())
+	if err, ok := result.(*object.Error); !ok || !strings.HasPrefix(err.Message, "interrupted") {
+		t.Errorf("expected the task to be interrupted. got=%s", result.Inspect())
+	}
+}
+
+func TestChannels(t *testing.T) {
+	input := `
+let jobs = chan();
+let results = chan(3);
+let worker = fn() { let job = recv(jobs); if (job) { send(results, job * job); worker() } };
+let tasks = [spawn(worker), spawn(worker)];
+send(jobs, 1); send(jobs, 2); send(jobs, 3); close(jobs);
+wait(tasks[0]); wait(tasks[1]); close(results);
+recv(results) + recv(results) + recv(results) + len([recv(results)])`
+	testIntegerObject(t, testEval(input), 15)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let c = chan(1); send(c, 1); [select([chan(), c]), select([c], 1)]", "[[1, 1], null]"},
+		{"let c = chan(); close(c); select([chan(), c], 10)", "[1, null]"},
+		{"chan(2)", "chan(2)"},
+	}
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"let c = chan(1); close(c); send(c, 1)", "send on a closed channel"},
+		{"let c = chan(1); close(c); close(c)", "close of a closed channel"},
+		{"recv([])", "argument to `recv` must be a channel. got ARRAY"},
+		{"chan(-1)", "argument to `chan` must be an integer of at least 0. got -1"},
+		{"select([chan()], -1)", "second argument to `select` must be an integer of at least 0. got -1"},
+	}
+	for _, tt := range errors {
+		if got := testEval(tt.input).(*object.Error).Message; got != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	// waiting on a channel nobody sends on is stopped with the program
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	program := parser.New(lexer.New("recv(chan())")).ParseProgram()
+	result := New(Config{}).EvalContext(ctx, program, object.NewEnv())
+	if err, ok := result.(*object.Error); !ok || !strings.HasPrefix(err.Message, "interrupted") {
+		t.Errorf("expected the receive to be interrupted. got=%s", result.Inspect())
+	}
+}
+
+func TestFutures(t *testing.T) {
+	input := `
+let fetch = fn(n) { future(fn() { n * 10 }) };
+let all = await([fetch(1), fetch(2), fetch(3)]);
+await(fetch(4)) + all[0] + all[1] + all[2]`
+	testIntegerObject(t, testEval(input), 100)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"await([future(fn() { 1 }), future(fn() { [] + 1 })])", "type mismatch: ARRAY + INTEGER"},
+		{"await(future(fn() { recv(chan()) }), 5)", "await timed out after 5 milliseconds"},
+		{"future(fn(a) { a })", ""},
+		{"future(len(1))", "argument to `len` is not supported. got INTEGER"},
+		{"future(1)", "argument to `future` must be a function. got INTEGER"},
+		{"await([1])", "first argument to `await` must be a future or an array of futures. got an array holding INTEGER"},
+		{"await(future(fn() { 1 }), true)", "second argument to `await` must be an integer of at least 0. got true"},
+	}
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if tt.expected == "" {
+			if result.Type() != object.TASK_OBJ {
+				t.Errorf("expected a future. got=%s", result.Inspect())
+			}
+			continue
+		}
+		if got := result.(*object.Error).Message; got != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestTypeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"type(1)", "INTEGER"},
+		{"type(1.5)", "FLOAT"},
+		{`type("a")`, "STRING"},
+		{"type(true)", "BOOLEAN"},
+		{"type(if (false) { 1 })", "NULL"},
+		{"type([])", "ARRAY"},
+		{"type({})", "HASH"},
+		{"type(fn() {})", "FUNCTION"},
+		{"type(len)", "BUILTIN"},
+		{"type(range(3))", "RANGE"},
+		{"[INTEGER, STRING, type(type(1))]", `["INTEGER", "STRING", "STRING"]`},
+		{`let describe = fn(x) { if (type(x) == INTEGER) { "number" } else { if (type(x) == ARRAY) { "list" } else { "other" } } }; [describe(1), describe([]), describe("")]`, `["number", "list", "other"]`},
+		{"let INTEGER = 1; INTEGER", "1"},
+		{"type()", "ERROR: line 1, column 5: wrong number of arguments to `type`. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`int("42") + 1`, "43"},
+		{`int("-7")`, "-7"},
+		{"int(3)", "3"},
+		{"int(3.9)", "3"},
+		{"int(-3.9)", "-3"},
+		{`int(trim(" 12\n"))`, "12"},
+		{`str(12) + "!"`, "12!"},
+		{`[str("a"), str(true), str([1, "b"]), str(if (false) { 1 })]`, `["a", "true", "[1, \"b\"]", "null"]`},
+		{`str(int("5") * 2) == "10"`, "true"},
+		{`[bool(0), bool(""), bool([]), bool(true), bool(false), bool(if (false) { 1 })]`, "[true, true, true, true, false, false]"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`int("12a")`, `could not parse "12a" as an integer`},
+		{`int("")`, `could not parse "" as an integer`},
+		{`int("99999999999999999999")`, `could not parse "99999999999999999999" as an integer`},
+		{"int(1e19)", "1e+19 is out of the range of integers"},
+		{"int([])", "argument to `int` is not supported. got ARRAY"},
+		{"str()", "wrong number of arguments to `str`. got=0, want=1"},
+		{"bool(1, 2)", "wrong number of arguments to `bool`. got=2, want=1"},
+	}
+	for _, tt := range errors {
+		if got := testEval(tt.input).(*object.Error).Message; got != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, `["a", "b", "", "c"]`},
+		{`split("abc", "")`, `["a", "b", "c"]`},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`join([], "-")`, ""},
+		{`join(split("a b c", " "), "+")`, "a+b+c"},
+		{`trim("  a b \n\t")`, "a b"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`[contains("hello", "ell"), contains("hello", "x"), contains([1, "a", [2]], [2]), contains([], 1)]`, "[true, false, true, false]"},
+		{`[indexOf("hello", "l"), indexOf("hello", "x"), indexOf([1, 2, 3], 3), indexOf([1], "1")]`, "[2, -1, 2, -1]"},
+		{`[startsWith("hello", "he"), startsWith("hello", "lo"), endsWith("hello", "lo"), endsWith("", "a")]`, "[true, false, true, false]"},
+		{`upper("Hello, World")`, "HELLO, WORLD"},
+		{`lower("Hello, World")`, "hello, world"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a")`, "wrong number of arguments to `split`. got=1, want=2"},
+		{`split("a", 1)`, "arguments to `split` must be STRING. got INTEGER"},
+		{`join("a", "")`, "argument to `join` must be ARRAY. got STRING"},
+		{`join(["a", 1], "")`, "elements of the array given to `join` must be STRING. got INTEGER"},
+		{`join(["a"], 1)`, "argument to `join` must be STRING. got INTEGER"},
+		{`trim(1)`, "argument to `trim` must be STRING. got INTEGER"},
+		{`replace("a", "b")`, "wrong number of arguments to `replace`. got=2, want=3"},
+		{`contains("a", 1)`, "value to look for in a string with `contains` must be STRING. got INTEGER"},
+		{`indexOf(1, 1)`, "argument to `indexOf` is not supported. got INTEGER"},
+		{`upper()`, "wrong number of arguments to `upper`. got=0, want=1"},
+	}
+	for _, tt := range errors {
+		if got := testEval(tt.input).(*object.Error).Message; got != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"map([1, 2, 3], fn(x) { x * 2 })", "[2, 4, 6]"},
+		{"let k = 10; map([1, 2], fn(x) { x + k })", "[11, 12]"},
+		{`map([[1], "ab", []], len)`, "[1, 2, 0]"},
+		{"map([], fn(x) { x })", "[]"},
+		{"filter([1, 2, 3, 4], fn(x) { x > 2 })", "[3, 4]"},
+		{"filter([1, 2], fn(x) { false })", "[]"},
+		{"reduce([1, 2, 3, 4], fn(acc, x) { acc + x })", "10"},
+		{"reduce([1, 2, 3], fn(acc, x) { push(acc, x * x) }, [])", "[1, 4, 9]"},
+		{"reduce([], fn(acc, x) { acc + x })", "null"},
+		{"reduce([], fn(acc, x) { acc + x }, 0)", "0"},
+		{"let sum = fn(arr) { reduce(map(filter(arr, fn(x) { x > 2 }), fn(x) { x * x }), fn(a, b) { a + b }, 0) }; sum([1, 2, 3, 4])", "25"},
+		{"let f = fn() { map([1], fn(x) { return x + 1; 0 }) }; f()", "[2]"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"map([1, 0, 2], fn(x) { 1 / x })", "division by zero"},
+		{"filter([1], 1)", "argument to `filter` must be a function. got INTEGER"},
+		{"reduce(1, len)", "argument to `reduce` must be an array. got INTEGER"},
+		{"map([1])", "wrong number of arguments to `map`. got=1, want=2"},
+	}
+	for _, tt := range errors {
+		if got := testEval(tt.input).(*object.Error).Message; got != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestParallelMaps(t *testing.T) {
+	input := `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let a = pmap([10, 15, 20], fib);
+let b = pool(2, [1, 2, 3, 4, 5], fn(x) { fib(x) * 2 });
+[a, b, pmap([], fib)]`
+	if got := testEval(input).Inspect(); got != "[[55, 610, 6765], [2, 2, 4, 6, 10], []]" {
+		t.Errorf("wrong result. got=%s", got)
+	}
+
+	// the workers share the results of the memo
+	input = `
+let xs = []; for (let i = 0; i < 200; i = i + 1) { xs = push(xs, i / 10) };
+let square = memo(fn(n) { n * n });
+reduce(pool(16, xs, square), fn(a, b) { a + b }, 0) + reduce(pmap(xs, square), fn(a, b) { a + b }, 0)`
+	testIntegerObject(t, testEval(input), 2*24700)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"pmap([1, 0, 2], fn(x) { 1 / x })", "division by zero"},
+		{"pool(3, [0, 1, 0, []], fn(x) { 1 / x })", "3 calls of `pool` failed: element 0: division by zero; element 2: division by zero; element 3: type mismatch: INTEGER / ARRAY"},
+		{"pmap([1], 1)", "argument to `pmap` must be a function. got INTEGER"},
+		{"pmap(1, len)", "argument to `pmap` must be an array. got INTEGER"},
+		{"pool(0, [1], len)", "first argument to `pool` must be an integer of at least 1. got 0"},
+	}
+	for _, tt := range tests {
+		if got := testEval(tt.input).(*object.Error).Message; got != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"true && false", "false"},
+		{"true && true", "true"},
+		{"false || true", "true"},
+		{"false || false", "false"},
+		{"1 && \"a\"", "true"},
+		{"if (false) { 1 } || 0", "true"},
+		{"false && 1 / 0", "false"},
+		{"true || 1 / 0", "true"},
+		{"true && 1 / 0", "ERROR: line 1, column 11: division by zero"},
+		{"let n = 0; let inc = fn() { n = n + 1; true }; false && inc(); true || inc(); true && inc(); n", "1"},
+		{"1 < 2 && 2 < 3 || false", "true"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { throw "boom" } catch (e) { e + "!" }`, "boom!"},
+		{"try { throw [1, 2] } catch (e) { len(e) }", "2"},
+		{"try { 1 } catch (e) { 2 }", "1"},
+		{"try { 1 + true } catch (e) { e }", "type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn(n) { if (n == 0) { throw n }; f(n - 1) }; try { f(3) } catch (e) { e - 1 }", "-1"},
+		{"let log = []; try { log = push(log, 1) } finally { log = push(log, 2) }; log", "[1, 2]"},
+		{"let log = []; try { throw 0 } catch (e) { log = push(log, 1) } finally { log = push(log, 2) }; log", "[1, 2]"},
+		{"try { 1 } finally { 2 }", "1"},
+		{"let f = fn() { try { return 1 } finally { 2 } }; f()", "1"},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", "2"},
+		{"let n = 0; for (;;) { try { n = n + 1; if (n == 3) { break } } catch (e) { } }; n", "3"},
+		{"try { throw 1 } catch (e) { let x = e }; x", "ERROR: line 1, column 42: identifier not found: x"},
+		{"try { throw 1 } catch (e) { throw e + 1 }", "ERROR: line 1, column 29: 2"},
+		{"try { throw 1 } finally { 2 }", "ERROR: line 1, column 7: 1"},
+		{"try { 1 } finally { 1 + true }", "ERROR: line 1, column 23: type mismatch: INTEGER + BOOLEAN"},
+		{`throw "boom"`, "ERROR: line 1, column 1: boom"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	program := parser.New(lexer.New("try { for (;;) {} } catch (e) { 1 }")).ParseProgram()
+	result := New(Config{}).EvalContext(ctx, program, object.NewEnv())
+	if !strings.HasPrefix(result.Inspect(), "ERROR: line 1, column 7: interrupted") {
+		t.Errorf("expected an interrupted evaluation not to be caught. got=%s", result.Inspect())
+	}
+}
+
+func TestForExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let sum = 0; for (let i = 0; i < 5; i = i + 1) { sum = sum + i }; sum", "10"},
+		{"for (let i = 0; i < 5; i = i + 1) { i }", "null"},
+		{"let i = 10; for (let i = 0; i < 3; i = i + 1) { }; i", "10"},
+		{"let n = 0; for (; n < 3;) { n = n + 1 }; n", "3"},
+		{"let f = fn() { for (let i = 0; ; i = i + 1) { if (i == 4) { return i } } }; f()", "4"},
+		{"let f = 0; for (let i = 0; i < 2; i = i + 1) { let j = i * 10; f = fn() { j + i } }; f()", "12"},
+		{"let count = fn() { let n = 0; let inc = fn() { n = n + 1 }; for (let i = 0; i < 3; i = i + 1) { inc() }; n }; count()", "3"},
+		{"let a = 1; let b = a = 2; [a, b]", "[2, 2]"},
+		{"let n = 0; for (;;) { if (n == 3) { break }; n = n + 1 }; n", "3"},
+		{"let sum = 0; for (let i = 0; i < 5; i = i + 1) { if (i == 2) { continue; }; sum = sum + i }; sum", "8"},
+		{"let n = 0; for (let i = 0; i < 3; i = i + 1) { for (;;) { n = n + 1; break; n = 100 } }; n", "3"},
+		{"for (;;) { break }", "null"},
+		{"let f = fn() { for (;;) { let g = fn() { return 1 }; if (g() == 1) { return 2 } } }; f()", "2"},
+		{"for (let i = 0; i < 3; i = i + 1) { }; i", "ERROR: line 1, column 40: identifier not found: i"},
+		{"x = 1", "ERROR: line 1, column 1: identifier not found: x"},
+		{"for (let i = 0; i < 3; i = i + 1) { i + true }", "ERROR: line 1, column 39: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	env := object.NewEnv()
+	env.SetConst("pi", object.NewInteger(3))
+	result := Eval(parser.New(lexer.New("pi = 4")).ParseProgram(), env)
+	if result.Inspect() != "ERROR: line 1, column 1: cannot assign to pi, it is a constant" {
+		t.Errorf("wrong result assigning a constant. got=%s", result.Inspect())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	result = New(Config{}).EvalContext(ctx, parser.New(lexer.New("for (;;) {}")).ParseProgram(), object.NewEnv())
+	if !strings.HasPrefix(result.Inspect(), "ERROR: line 1, column 1: interrupted") {
+		t.Errorf("expected an endless loop to be interrupted. got=%s", result.Inspect())
+	}
 }
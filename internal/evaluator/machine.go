@@ -0,0 +1,342 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/internal/ast"
+	"monkey/internal/object"
+	"strconv"
+	"strings"
+)
+
+type (
+	// machine evaluates trees without recursing on the Go stack, however deeply nested the tree or the calls of
+	// the program are. What's left to do is kept on a stack of tasks, and the value of every evaluated node is
+	// pushed on a stack of values for the task that needs it.
+	machine struct {
+		evaluator *Evaluator
+		ctx       context.Context // stops the evaluation when done, nil for evaluations that can't be stopped
+		tasks     []task
+		values    []object.Object
+		frames    []object.Frame // the calls in progress, innermost last
+
+		// depth is how many calls are in progress in the machines calling this one through builtins, and callbacks
+		// how many of those machines there are, see caller
+		depth, callbacks int
+
+		// literals holds the value of every literal evaluated so far, to evaluate it again without allocating
+		literals map[ast.Expression]object.Object
+
+		// scopes holds what the body of every function called or created so far declares and uses
+		scopes map[*ast.BlockStatement]*scope
+	}
+
+	// task evaluates the node in env, pushing its value, or calls then, which continues the evaluation of a node
+	// with the values of its children
+	task struct {
+		node ast.Node
+		env  *object.Environment
+		then func()
+	}
+)
+
+// run evaluates the node and returns its value. Runs can be nested, like for a builtin calling a function: a
+// run only works on the tasks and values it pushed itself.
+func (m *machine) run(node ast.Node, env *object.Environment) object.Object {
+	tasks, values := len(m.tasks), len(m.values)
+
+	m.eval(node, env)
+	return m.finish(tasks, values)
+}
+
+// call calls the function with the arguments and returns what it returns, like a call of the program without a
+// call expression. Calls nest like runs.
+func (m *machine) call(fn object.Object, args []object.Object) object.Object {
+	tasks, values := len(m.tasks), len(m.values)
+
+	m.apply(nil, fn, args)
+	return m.finish(tasks, values)
+}
+
+// finish works on the tasks until only the first ones are left, and returns the value they pushed on top of the
+// first values
+func (m *machine) finish(tasks, values int) object.Object {
+	for len(m.tasks) > tasks {
+		t := m.tasks[len(m.tasks)-1]
+		m.tasks = m.tasks[:len(m.tasks)-1]
+
+		if t.then != nil {
+			t.then()
+		} else {
+			m.step(t.node, t.env)
+		}
+	}
+
+	result := m.values[len(m.values)-1]
+	m.values = m.values[:values]
+	return result
+}
+
+// literal returns the value of the literal, created by create the first time it is evaluated. The values of
+// literals are never changed, so every evaluation of a literal can share the same value.
+func (m *machine) literal(node ast.Expression, create func() object.Object) object.Object {
+	if obj, ok := m.literals[node]; ok {
+		return obj
+	}
+
+	if m.literals == nil {
+		m.literals = map[ast.Expression]object.Object{}
+	}
+	obj := create()
+	m.literals[node] = obj
+	return obj
+}
+
+func (m *machine) push(obj object.Object) {
+	m.values = append(m.values, obj)
+}
+
+func (m *machine) peek() object.Object {
+	return m.values[len(m.values)-1]
+}
+
+func (m *machine) pop() object.Object {
+	obj := m.values[len(m.values)-1]
+	m.values = m.values[:len(m.values)-1]
+	return obj
+}
+
+// eval schedules the evaluation of the node
+func (m *machine) eval(node ast.Node, env *object.Environment) {
+	m.tasks = append(m.tasks, task{node: node, env: env})
+}
+
+// then schedules f to run next, before whatever is scheduled after it
+func (m *machine) then(f func()) {
+	m.tasks = append(m.tasks, task{then: f})
+}
+
+// evalThen evaluates the node and calls f with its value. An error is the value of the node being evaluated
+// instead, f isn't called then.
+func (m *machine) evalThen(node ast.Node, env *object.Environment, f func(object.Object)) {
+	m.then(func() {
+		obj := m.pop()
+		if isError(obj) {
+			m.push(obj)
+			return
+		}
+
+		f(obj)
+	})
+	m.eval(node, env)
+}
+
+// evalList evaluates the expressions in order and calls f with their values, stopping at the first error, which
+// is the value of the node being evaluated instead.
+func (m *machine) evalList(exps []ast.Expression, env *object.Environment, f func([]object.Object)) {
+	results := make([]object.Object, 0, len(exps))
+
+	var next func(i int)
+	next = func(i int) {
+		if i == len(exps) {
+			f(results)
+			return
+		}
+
+		m.evalThen(exps[i], env, func(obj object.Object) {
+			results = append(results, obj)
+			next(i + 1)
+		})
+	}
+
+	next(0)
+}
+
+// evalStatements evaluates the statements in order and calls f with the value of the last one. Return values,
+// breaks, continues and errors stop the evaluation, f is called with them as they are.
+func (m *machine) evalStatements(stmts []ast.Statement, env *object.Environment, f func(object.Object)) {
+	var next func(i int, result object.Object)
+	next = func(i int, result object.Object) {
+		if i == len(stmts) || isError(result) || isReturnValue(result) || isLoopControl(result) {
+			f(result)
+			return
+		}
+
+		if m.ctx != nil && m.ctx.Err() != nil {
+			f(m.located(stmts[i], newKindError(object.InterruptedError, "interrupted: %s", m.ctx.Err())))
+			return
+		}
+		if err := m.evaluator.config.Meter.Step(); err != nil {
+			f(m.located(stmts[i], err))
+			return
+		}
+		if hook := m.evaluator.config.Hooks.Statement; hook != nil {
+			hook(stmts[i])
+		}
+		m.then(func() { next(i+1, m.pop()) })
+		m.eval(stmts[i], env)
+	}
+
+	next(0, nil)
+}
+
+// apply calls the function, pushing what it returns. The call is nil for functions called from Go.
+func (m *machine) apply(call *ast.CallExpression, fn object.Object, args []object.Object) {
+	var at ast.Node // what errors of the call point at, none for calls from Go
+	if call != nil {
+		at = call
+	}
+
+	switch fn := fn.(type) {
+	case *object.Function:
+		if len(args) != fn.Arity() {
+			name := fn.Name
+			if name == "" {
+				name = "fn"
+			}
+			m.push(m.located(at, newError("wrong number of arguments to `%s`. got=%d, want=%d", name, len(args), fn.Arity())))
+			return
+		}
+		if m.depth+len(m.frames) >= m.evaluator.config.MaxCallDepth {
+			m.push(m.located(at, newKindError(object.StackOverflowError, "stack overflow: more than %d calls in progress", m.evaluator.config.MaxCallDepth)))
+			return
+		}
+
+		frame := object.Frame{Function: fn.Name}
+		if call != nil {
+			frame = object.Frame{Function: calleeName(call.Function), Call: call.Token}
+		} else if frame.Function == "" {
+			frame.Function = "fn"
+		}
+
+		hooks := m.evaluator.config.Hooks
+		if hooks.Call != nil {
+			hooks.Call(frame)
+		}
+		m.frames = append(m.frames, frame)
+		m.evaluator.config.Meter.Call(m.depth + len(m.frames))
+		m.then(func() {
+			m.frames = m.frames[:len(m.frames)-1]
+			if hooks.Return != nil {
+				hooks.Return()
+			}
+			m.push(unwrapReturnValue(m.pop()))
+		})
+		m.eval(fn.Body, m.callEnv(fn, args))
+	case *object.Memo:
+		key, ok := memoKey(args)
+		if !ok {
+			m.apply(call, fn.Function, args)
+			return
+		}
+		if result, ok := fn.Result(key); ok {
+			m.push(result)
+			return
+		}
+
+		m.then(func() {
+			result := m.peek()
+			if !isError(result) {
+				fn.Remember(key, result)
+			}
+		})
+		m.apply(call, fn.Function, args)
+	case *object.Builtin:
+		hooks := m.evaluator.config.Hooks
+		if hooks.Call != nil {
+			frame := object.Frame{Function: fn.Name}
+			if call != nil {
+				frame.Call = call.Token
+			}
+			hooks.Call(frame)
+		}
+		var result object.Object
+		if fn.Run != nil {
+			ctx := m.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			result = fn.Run(ctx, m.caller(), args...)
+		} else {
+			result = fn.Fn(args...)
+		}
+		if hooks.Return != nil {
+			hooks.Return()
+		}
+		m.push(m.located(at, result))
+	default:
+		m.push(m.located(at, newError("not a function: %s", fn.Type())))
+	}
+}
+
+// caller returns how builtins like spawn call functions: on a machine of their own every time, which the context
+// of this one stops too. Its calls count towards the depth of this one.
+func (m *machine) caller() object.Caller {
+	depth, callbacks := m.depth+len(m.frames), m.callbacks+1
+	return func(fn object.Object, args ...object.Object) object.Object {
+		if callbacks > MaxCallbackDepth {
+			return newKindError(object.StackOverflowError, "stack overflow: more than %d calls of builtins calling functions in progress", MaxCallbackDepth)
+		}
+
+		return (&machine{evaluator: m.evaluator, ctx: m.ctx, depth: depth, callbacks: callbacks}).call(fn, args)
+	}
+}
+
+// memoKey returns the key of the arguments in the results of a memo, false if they can't all be hash keys
+func memoKey(args []object.Object) (string, bool) {
+	var key strings.Builder
+	for _, arg := range args {
+		hashable, ok := arg.(object.Hashable)
+		if !ok {
+			return "", false
+		}
+
+		hashKey := hashable.HashKey()
+		key.WriteString(string(hashKey.Type))
+		key.WriteString(":")
+		key.WriteString(strconv.FormatUint(hashKey.Value, 16))
+		key.WriteString(",")
+	}
+
+	return key.String(), true
+}
+
+func isReturnValue(obj object.Object) bool {
+	_, ok := obj.(*object.ReturnValue)
+	return ok
+}
+
+// isLoopControl reports whether the object is what a break or continue statement evaluates to
+func isLoopControl(obj object.Object) bool {
+	return obj == BREAK || obj == CONTINUE
+}
+
+// located returns the object, with an error that doesn't say where it happened yet pointed at the node and
+// given the stack of calls in progress. Errors that went through other nodes already point at where they happened.
+func (m *machine) located(node ast.Node, obj object.Object) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Token == nil {
+		err.Token = ast.TokenOf(node)
+		err.Stack = m.stack()
+	}
+
+	return obj
+}
+
+// stack returns the calls in progress, innermost first
+func (m *machine) stack() []object.Frame {
+	stack := make([]object.Frame, 0, len(m.frames))
+	for i := len(m.frames) - 1; i >= 0; i-- {
+		stack = append(stack, m.frames[i])
+	}
+
+	return stack
+}
+
+// calleeName returns what a function is called by in a stack: the expression it was called with, or fn for
+// function literals called on the spot
+func calleeName(function ast.Expression) string {
+	if _, ok := function.(*ast.FunctionLiteral); ok {
+		return "fn"
+	}
+
+	return function.String()
+}
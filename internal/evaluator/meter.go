@@ -0,0 +1,79 @@
+package evaluator
+
+import (
+	"monkey/internal/object"
+	"sync/atomic"
+)
+
+// Meter measures what evaluations use: the steps they run, the objects they create and how deep their calls go,
+// and stops them with an error once they go over its limits, see Config.Meter. A step is a statement for the
+// evaluator and an instruction for the virtual machine, and the objects counted are the strings, arrays, hashes and
+// functions that literals and operators create. A Meter is safe for concurrent use: the evaluations sharing one
+// share its limits.
+type Meter struct {
+	MaxSteps   int64 // how many steps can run, unlimited if 0
+	MaxObjects int64 // how many objects can be created, unlimited if 0
+
+	steps, objects, depth int64
+}
+
+// Step counts a step, returning the error stopping the evaluation if it goes over MaxSteps. It does nothing on a
+// nil Meter, like the other methods.
+func (m *Meter) Step() *object.Error {
+	if m == nil {
+		return nil
+	}
+
+	if steps := atomic.AddInt64(&m.steps, 1); m.MaxSteps > 0 && steps > m.MaxSteps {
+		return newKindError(object.ResourceLimitError, "resource limit exceeded: programs can't run more than %d steps", m.MaxSteps)
+	}
+	return nil
+}
+
+// Object counts an object created, returning the error stopping the evaluation if it goes over MaxObjects.
+func (m *Meter) Object() *object.Error {
+	if m == nil {
+		return nil
+	}
+
+	if objects := atomic.AddInt64(&m.objects, 1); m.MaxObjects > 0 && objects > m.MaxObjects {
+		return newKindError(object.ResourceLimitError, "resource limit exceeded: programs can't create more than %d objects", m.MaxObjects)
+	}
+	return nil
+}
+
+// Call records that depth calls are in progress, the deepest being kept.
+func (m *Meter) Call(depth int) {
+	if m == nil {
+		return
+	}
+
+	for {
+		deepest := atomic.LoadInt64(&m.depth)
+		if int64(depth) <= deepest || atomic.CompareAndSwapInt64(&m.depth, deepest, int64(depth)) {
+			return
+		}
+	}
+}
+
+// Steps returns how many steps ran since the meter was created or reset.
+func (m *Meter) Steps() int64 {
+	return atomic.LoadInt64(&m.steps)
+}
+
+// Objects returns how many objects were created since the meter was created or reset.
+func (m *Meter) Objects() int64 {
+	return atomic.LoadInt64(&m.objects)
+}
+
+// Depth returns how many calls were in progress at most since the meter was created or reset.
+func (m *Meter) Depth() int {
+	return int(atomic.LoadInt64(&m.depth))
+}
+
+// Reset forgets what was used, to measure the next evaluations on their own.
+func (m *Meter) Reset() {
+	atomic.StoreInt64(&m.steps, 0)
+	atomic.StoreInt64(&m.objects, 0)
+	atomic.StoreInt64(&m.depth, 0)
+}
@@ -0,0 +1,61 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"monkey/internal/lexer"
+	"monkey/internal/module"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"strings"
+)
+
+// chainKey is the key of the files being loaded in the context of an evaluation, the one evaluated last
+type chainKey struct{}
+
+// InFile returns a context evaluating a program as the one of the file, for the modules it imports to be found
+// from it, like the ones of relative paths. A program evaluated without it imports like one that isn't in a file,
+// from the current directory.
+func InFile(ctx context.Context, file module.File) context.Context {
+	return context.WithValue(ctx, chainKey{}, []module.File{file})
+}
+
+// importModule returns the exports of the module imported with the path by the program evaluated with the context
+func (e *Evaluator) importModule(ctx context.Context, path string) object.Object {
+	chain, _ := ctx.Value(chainKey{}).([]module.File)
+	exports, err := e.modules.Load(path, chain)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	return exports
+}
+
+// evalModule evaluates the source of the module in the file in an environment of its own, and returns a hash of
+// the names it declares, the ones starting with _ left out. A module is evaluated on its own: the evaluation
+// importing it first doesn't stop it.
+func (e *Evaluator) evalModule(file module.File, source string, chain []module.File) (object.Object, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Diagnostics(); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %s", file, errs[0])
+	}
+
+	env := object.NewEnv()
+	result := e.EvalContext(context.WithValue(context.Background(), chainKey{}, chain), program, env)
+	if err, ok := result.(*object.Error); ok {
+		if err.Token == nil {
+			return nil, fmt.Errorf("%s: %s", file, err.Message)
+		}
+		return nil, fmt.Errorf("%s: line %d, column %d: %s", file, err.Token.Line, err.Token.Column, err.Message)
+	}
+
+	exports := object.NewHash()
+	for _, name := range env.Names() {
+		if value, ok := env.Get(name); ok && !strings.HasPrefix(name, "_") {
+			exports.Set(&object.String{Value: name}, value)
+		}
+	}
+
+	return exports, nil
+}
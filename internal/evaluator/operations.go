@@ -0,0 +1,134 @@
+package evaluator
+
+import "monkey/internal/object"
+
+// The operations on objects the evaluator evaluates expressions with, for the virtual machine to share them: a
+// program means the same whichever of the two runs it, with the settings of the same Config. Like when
+// evaluating, an operation that can't be done returns an error, which doesn't say where it happened yet.
+
+// Prefix returns the result of the prefix operator on the object.
+func (e *Evaluator) Prefix(operator string, right object.Object) object.Object {
+	return e.evalPrefixExpression(operator, right)
+}
+
+// Infix returns the result of the infix operator on the objects.
+func (e *Evaluator) Infix(operator string, left, right object.Object) object.Object {
+	return e.evalInfixExpression(operator, left, right)
+}
+
+// Index returns the element of left at index, null if there's none unless the config makes a missing hash key
+// an error.
+func (e *Evaluator) Index(left, index object.Object) object.Object {
+	return e.evalIndexExpression(left, index)
+}
+
+// Field returns the field of left with the name, like left.name does.
+func (e *Evaluator) Field(left object.Object, name string) object.Object {
+	return e.evalFieldExpression(left, name)
+}
+
+// Array returns the array of the elements, or an error if the config doesn't allow one that long.
+func (e *Evaluator) Array(elements []object.Object) object.Object {
+	if err := e.checkArrayLength(len(elements)); err != nil {
+		return err
+	}
+	if err := e.config.Meter.Object(); err != nil {
+		return err
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+// Hash returns the hash of the keys and values, alternating in pairs, or an error if a key can't be a hash key
+// or if the config doesn't allow a hash that big. Like in a literal, a key found again keeps its place and gets
+// the last value.
+func (e *Evaluator) Hash(pairs []object.Object) object.Object {
+	if err := e.config.Meter.Object(); err != nil {
+		return err
+	}
+	hash := object.NewHash()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		key, ok := pairs[i].(object.Hashable)
+		if !ok {
+			return unusableHashKey(pairs[i])
+		}
+
+		if _, ok := hash.Pairs[key.HashKey()]; !ok {
+			if err := e.checkHashSize(len(hash.Pairs) + 1); err != nil {
+				return err
+			}
+		}
+		hash.Set(key, pairs[i+1])
+	}
+
+	return hash
+}
+
+// Builtin returns the builtin with the name, or the name of a type for a name like INTEGER, or an error if there's
+// none or if the sandbox took it away.
+func (e *Evaluator) Builtin(name string) object.Object {
+	if builtin, ok := e.builtins[name]; ok {
+		return builtin
+	}
+	if typeName, ok := typeNames[name]; ok {
+		return typeName
+	}
+
+	if e.removed[name] {
+		return newError("%s is disabled by the configuration of the engine", name)
+	}
+	if e.disabled[name] {
+		return newError("%s is not available in the sandbox", name)
+	}
+
+	return newError("identifier not found: %s", name)
+}
+
+// Register adds the builtin under the name, replacing the builtin of the same name if any, for hosts to give
+// programs functions of their own. A sandbox doesn't take registered builtins away. Builtins are registered before
+// the evaluator evaluates anything, Register isn't safe to call while it does.
+func (e *Evaluator) Register(name string, builtin *object.Builtin) {
+	registered := *builtin
+	registered.Name = name
+	e.builtins[name] = &registered
+	delete(e.disabled, name)
+	delete(e.removed, name)
+}
+
+// Remove takes the builtin of the name away, for hosts to keep programs from using it, sandboxed or not. Like
+// Register, Remove isn't safe to call while the evaluator evaluates.
+func (e *Evaluator) Remove(name string) {
+	if _, ok := e.builtins[name]; !ok {
+		return
+	}
+
+	delete(e.builtins, name)
+	if e.removed == nil {
+		e.removed = map[string]bool{}
+	}
+	e.removed[name] = true
+}
+
+// MemoKey returns the key of the arguments in the results of a memo, false if they can't all be hash keys and
+// the call can't be kept.
+func MemoKey(args []object.Object) (string, bool) {
+	return memoKey(args)
+}
+
+// Config returns the config of the evaluator, with the defaults of what it didn't set.
+func (e *Evaluator) Config() Config {
+	return e.config
+}
+
+// WithMeter returns an evaluator like this one, its builtins included, measured by the meter instead, for
+// evaluations sharing the settings of an evaluator to be measured on their own.
+func (e *Evaluator) WithMeter(meter *Meter) *Evaluator {
+	measured := *e
+	measured.config.Meter = meter
+	return &measured
+}
+
+// IsTruthy reports whether the object counts as true in a condition: anything but false and null does.
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
@@ -0,0 +1,362 @@
+// Package gogen translates Monkey programs to Go programs, to build the scripts that run hot into native binaries
+// with go build. The values of the translated program are the objects of package object and its operations the
+// ones of the evaluator, so that it computes what the program computes, but without walking a tree or decoding
+// bytecode: lets become Go variables, functions Go closures and ifs Go ifs.
+//
+// The translated program imports the internal packages of this module, so it has to be built inside of it, like
+// in a directory under cmd. It prints the value of the program, or the error that stopped it, like the interpreter.
+package gogen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"monkey/internal/ast"
+	"monkey/internal/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Generate returns the source of the Go program doing what the program does, in the canonical Go style. The name
+// is the one of the file the program comes from, for the comment saying the source is generated.
+func Generate(program *ast.Program, name string) ([]byte, error) {
+	g := &generator{}
+	g.line("// Code generated by monkey transpile from %s. DO NOT EDIT.", name)
+	g.line("")
+	g.line("package main")
+	g.line("")
+	g.line(`import (`)
+	g.line(`"context"`)
+	g.line(`"fmt"`)
+	g.line(`"os"`)
+	g.line("")
+	g.line(`"monkey/internal/evaluator"`)
+	g.line(`"monkey/internal/object"`)
+	g.line(`)`)
+	g.line("")
+	g.line("func run() object.Object {")
+	g.body(nil, program.Statements, "nil")
+	g.line("}")
+	g.out.WriteString(runtime)
+
+	if g.err != nil {
+		return nil, g.err
+	}
+	return format.Source(g.out.Bytes())
+}
+
+// runtime holds what the translated programs share: how they report errors and call functions
+const runtime = `
+var e = evaluator.New(evaluator.Config{})
+
+func main() {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(*object.Error)
+			if !ok {
+				panic(r)
+			}
+			fmt.Println(err.Inspect())
+			os.Exit(1)
+		}
+	}()
+
+	if result := run(); result != nil {
+		fmt.Println(result.Inspect())
+	}
+}
+
+// check returns the object, or stops the program with it if it is an error
+func check(obj object.Object) object.Object {
+	if err, ok := obj.(*object.Error); ok {
+		panic(err)
+	}
+	return obj
+}
+
+// get returns the value of a variable, the builtin of the name if the variable isn't set yet
+func get(v object.Object, name string) object.Object {
+	if v == nil {
+		return check(e.Builtin(name))
+	}
+	return v
+}
+
+// function returns the function of the program with the body and arity
+func function(name string, arity int, body func(args []object.Object) object.Object) object.Object {
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		if len(args) != arity {
+			return &object.Error{Message: fmt.Sprintf("wrong number of arguments to ` + "`%s`" + `. got=%d, want=%d", name, len(args), arity)}
+		}
+		return body(args)
+	}}
+}
+
+// call calls the function with the arguments
+func call(fn object.Object, args ...object.Object) object.Object {
+	builtin, ok := fn.(*object.Builtin)
+	if !ok {
+		return &object.Error{Message: fmt.Sprintf("not a function: %s", fn.Type())}
+	}
+	if builtin.Run != nil {
+		return builtin.Run(context.Background(), call, args...)
+	}
+	return builtin.Fn(args...)
+}
+`
+
+// generator writes the Go source of a program, one line at a time
+type generator struct {
+	out   bytes.Buffer
+	temps int   // how many temporaries were declared so far
+	err   error // the first node that can't be translated
+
+	// scopes holds the names the function being translated and the ones around it declare, innermost last: true
+	// for the lets, which aren't set until they run, false for the parameters
+	scopes []map[string]bool
+}
+
+func (g *generator) line(format string, args ...interface{}) {
+	fmt.Fprintf(&g.out, format, args...)
+	g.out.WriteString("\n")
+}
+
+// temp declares a temporary holding the value of the Go expression and returns its name. Every value goes through
+// one, which keeps the order the program evaluates things in.
+func (g *generator) temp(format string, args ...interface{}) string {
+	g.temps++
+	name := "t" + strconv.Itoa(g.temps)
+	g.line(name+" := "+format, args...)
+	return name
+}
+
+// variable returns the Go variable of a Monkey name, out of the way of the names of Go and of the runtime
+func variable(name string) string {
+	return "v_" + name
+}
+
+// body writes the body of a function, or of the program, with the parameters set from args: its variables, its
+// statements and the return of its value, or of empty if it has no statements
+func (g *generator) body(params []*ast.Identifier, stmts []ast.Statement, empty string) {
+	scope := map[string]bool{}
+	for i, param := range params {
+		scope[param.Value] = false
+		g.line("%s := args[%d]", variable(param.Value), i)
+		g.line("_ = %s", variable(param.Value))
+	}
+
+	var lets []string
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			if let, ok := node.(*ast.LetStatement); ok {
+				name := let.Name.(*ast.Identifier).Value
+				if _, declared := scope[name]; !declared {
+					scope[name] = true
+					lets = append(lets, variable(name))
+				}
+			}
+			_, isFunction := node.(*ast.FunctionLiteral)
+			return !isFunction
+		})
+	}
+	sort.Strings(lets)
+	if len(lets) > 0 {
+		g.line("var %s object.Object", strings.Join(lets, ", "))
+		g.line("%s = %s", strings.Repeat("_, ", len(lets)-1)+"_", strings.Join(lets, ", "))
+	}
+
+	g.scopes = append(g.scopes, scope)
+	if value, returned := g.statements(stmts, empty); !returned {
+		g.line("return %s", value)
+	}
+	g.scopes = g.scopes[:len(g.scopes)-1]
+}
+
+// statements writes the statements and returns the value of the last one, empty if there are none, and whether
+// they end with a return
+func (g *generator) statements(stmts []ast.Statement, empty string) (string, bool) {
+	value := empty
+	for i, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			name := variable(stmt.Name.(*ast.Identifier).Value)
+			g.line("%s = %s", name, g.expression(stmt.Value, stmt.Name.(*ast.Identifier).Value))
+			value = name
+		case *ast.ReturnStatement:
+			g.line("return %s", g.expression(stmt.ReturnValue, ""))
+			return "", true
+		case *ast.ExpressionStatement:
+			value = g.expression(stmt.Expression, "")
+			if i < len(stmts)-1 {
+				g.line("_ = %s", value)
+			}
+		case *ast.BreakStatement:
+			g.fail(stmt, "break statements can't be translated to Go yet")
+		case *ast.ContinueStatement:
+			g.fail(stmt, "continue statements can't be translated to Go yet")
+		case *ast.ThrowStatement:
+			g.fail(stmt, "throw statements can't be translated to Go yet")
+		default:
+			g.fail(stmt, "")
+		}
+	}
+
+	return value, false
+}
+
+// expression writes what computing the expression takes and returns the Go expression of its value. The name is
+// the one a function literal is declared with, if any.
+func (g *generator) expression(expr ast.Expression, name string) string {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return fmt.Sprintf("object.NewInteger(%d)", expr.Value)
+	case *ast.FloatLiteral:
+		return fmt.Sprintf("&object.Float{Value: %s}", strconv.FormatFloat(expr.Value, 'g', -1, 64))
+	case *ast.StringLiteral:
+		return fmt.Sprintf("&object.String{Value: %s}", strconv.Quote(expr.Value))
+	case *ast.Boolean:
+		if expr.Value {
+			return "object.TRUE"
+		}
+		return "object.FALSE"
+	case *ast.Identifier:
+		return g.identifier(expr.Value)
+	case *ast.PrefixExpression:
+		right := g.expression(expr.Right, "")
+		return g.temp("check(e.Prefix(%q, %s))", expr.Operator, right)
+	case *ast.InfixExpression:
+		if expr.Operator == "&&" || expr.Operator == "||" {
+			return g.logical(expr)
+		}
+		left := g.expression(expr.Left, "")
+		right := g.expression(expr.Right, "")
+		return g.temp("check(e.Infix(%q, %s, %s))", expr.Operator, left, right)
+	case *ast.IndexExpression:
+		left := g.expression(expr.Left, "")
+		if expr.Token != nil && expr.Token.Type == token.PERIOD {
+			return g.temp("check(e.Field(%s, %q))", left, expr.Index.(*ast.Identifier).Value)
+		}
+		index := g.expression(expr.Index, "")
+		return g.temp("check(e.Index(%s, %s))", left, index)
+	case *ast.ArrayLiteral:
+		elements := g.expressions(expr.Elements)
+		return g.temp("check(e.Array([]object.Object{%s}))", strings.Join(elements, ", "))
+	case *ast.HashLiteral:
+		var pairs []string
+		for _, key := range expr.Keys() {
+			pairs = append(pairs, g.expression(key, ""), g.expression(expr.Hash[key], ""))
+		}
+		return g.temp("check(e.Hash([]object.Object{%s}))", strings.Join(pairs, ", "))
+	case *ast.CallExpression:
+		fn := g.expression(expr.Function, "")
+		args := append([]string{fn}, g.expressions(expr.Arguments)...)
+		return g.temp("check(call(%s))", strings.Join(args, ", "))
+	case *ast.FunctionLiteral:
+		if name == "" {
+			name = "fn"
+		}
+		g.temps++
+		temp := "t" + strconv.Itoa(g.temps)
+		g.line("%s := function(%q, %d, func(args []object.Object) object.Object {", temp, name, len(expr.Parameters))
+		g.body(expr.Parameters, expr.Body.Statements, "object.NULL")
+		g.line("})")
+		return temp
+	case *ast.IfExpression:
+		g.temps++
+		temp := "t" + strconv.Itoa(g.temps)
+		condition := g.expression(expr.Condition, "")
+		g.line("var %s object.Object", temp)
+		g.line("if evaluator.IsTruthy(%s) {", condition)
+		g.branch(temp, expr.Consequence)
+		g.line("} else {")
+		g.branch(temp, expr.Alternative)
+		g.line("}")
+		return temp
+	case *ast.ForExpression:
+		g.fail(expr, "for loops can't be translated to Go yet")
+		return "object.NULL"
+	case *ast.AssignExpression:
+		g.fail(expr, "assignments can't be translated to Go yet")
+		return "object.NULL"
+	case *ast.TryExpression:
+		g.fail(expr, "try expressions can't be translated to Go yet")
+		return "object.NULL"
+	default:
+		g.fail(expr, "")
+		return "object.NULL"
+	}
+}
+
+// logical writes && and || computing the right side only when the left one doesn't decide the result already
+func (g *generator) logical(expr *ast.InfixExpression) string {
+	g.temps++
+	temp := "t" + strconv.Itoa(g.temps)
+	left := g.expression(expr.Left, "")
+
+	// the result is the one the left side decides, unless the right side has a say
+	decided, other, not := "object.FALSE", "object.TRUE", ""
+	if expr.Operator == "||" {
+		decided, other, not = "object.TRUE", "object.FALSE", "!"
+	}
+	g.line("%s := %s", temp, decided)
+	g.line("if %sevaluator.IsTruthy(%s) {", not, left)
+	right := g.expression(expr.Right, "")
+	g.line("if %sevaluator.IsTruthy(%s) {", not, right)
+	g.line("%s = %s", temp, other)
+	g.line("}")
+	g.line("}")
+
+	return temp
+}
+
+// expressions writes what computing the expressions takes, in order, and returns the Go expressions of their values
+func (g *generator) expressions(exprs []ast.Expression) []string {
+	values := make([]string, len(exprs))
+	for i, expr := range exprs {
+		values[i] = g.expression(expr, "")
+	}
+
+	return values
+}
+
+// branch writes the block of an if, setting temp to its value, null for a missing or empty block
+func (g *generator) branch(temp string, block *ast.BlockStatement) {
+	if block == nil {
+		g.line("%s = object.NULL", temp)
+		return
+	}
+
+	if value, returned := g.statements(block.Statements, "object.NULL"); !returned {
+		g.line("%s = %s", temp, value)
+	}
+}
+
+// identifier returns the Go expression of the value of the name: a variable, or the builtin of the name
+func (g *generator) identifier(name string) string {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if isLet, ok := g.scopes[i][name]; ok {
+			if !isLet {
+				return variable(name)
+			}
+			return g.temp("get(%s, %q)", variable(name), name)
+		}
+	}
+
+	return g.temp("check(e.Builtin(%q))", name)
+}
+
+// fail records why the node can't be translated, if it is the first one
+func (g *generator) fail(node ast.Node, reason string) {
+	if g.err != nil {
+		return
+	}
+
+	if reason == "" {
+		reason = fmt.Sprintf("%T can't be translated to Go", node)
+	}
+	if tok := ast.TokenOf(node); tok != nil {
+		reason = fmt.Sprintf("line %d, column %d: %s", tok.Line, tok.Column, reason)
+	}
+	g.err = fmt.Errorf("%s", reason)
+}
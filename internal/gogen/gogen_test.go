@@ -0,0 +1,103 @@
+package gogen
+
+import (
+	"bytes"
+	"monkey/internal/ast"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const program = `
+let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+let add = fn(a) { fn(b) { a + b } };
+let h = {"a": [1, 2], 3: true};
+println(fib(15), add(2)(3), h["a"][1], h.a, len("abc"), -h.a[0], !true);
+let f = fn() { later() };
+let later = fn() { "late" };
+println(f(), if (false) { 1 }, [1, "two", [3]] == [1, "two", [3]]);
+println(true || 1 / 0, false && 1 / 0, if (false) { 1 } || h.a, fib(3) == 2 && "x");
+let x = if (1 < 2) { let y = "yes"; y } else { "no" };
+x + "!"
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	assert.Empty(t, p.Errors())
+	return program
+}
+
+func TestGenerate(t *testing.T) {
+	source, err := Generate(parse(t, "let a = 1; let f = fn(x) { x + a }; f(2)"), "a.mk")
+	assert.NoError(t, err)
+
+	for _, line := range []string{
+		"// Code generated by monkey transpile from a.mk. DO NOT EDIT.",
+		"\tvar v_a, v_f object.Object\n",
+		"\tv_a = object.NewInteger(1)\n",
+		"\tt1 := function(\"f\", 1, func(args []object.Object) object.Object {\n\t\tv_x := args[0]\n",
+		"\t\tt2 := get(v_a, \"a\")\n\t\tt3 := check(e.Infix(\"+\", v_x, t2))\n\t\treturn t3\n",
+		"\tt5 := check(call(t4, object.NewInteger(2)))\n\treturn t5\n",
+	} {
+		assert.Contains(t, string(source), line)
+	}
+
+	for input, reason := range map[string]string{
+		"let n = 0; for (;;) { n }": "line 1, column 12: for loops can't be translated to Go yet",
+		"let n = 0;\nn = n + 1":     "line 2, column 3: assignments can't be translated to Go yet",
+		"try { 1 } catch (e) { e }": "line 1, column 1: try expressions can't be translated to Go yet",
+		"throw 1":                   "line 1, column 1: throw statements can't be translated to Go yet",
+	} {
+		_, err := Generate(parse(t, input), "a.mk")
+		if assert.Error(t, err, input) {
+			assert.Equal(t, reason, err.Error(), input)
+		}
+	}
+
+	loop := parse(t, "for (;;) { break; continue; }").Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ForExpression)
+	_, err = Generate(&ast.Program{Statements: loop.Body.Statements[:1]}, "a.mk")
+	assert.EqualError(t, err, "line 1, column 12: break statements can't be translated to Go yet")
+	_, err = Generate(&ast.Program{Statements: loop.Body.Statements[1:]}, "a.mk")
+	assert.EqualError(t, err, "line 1, column 19: continue statements can't be translated to Go yet")
+}
+
+// TestRun builds the translated program and checks that it prints what the evaluator does
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a Go program")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+
+	var expected bytes.Buffer
+	result := evaluator.New(evaluator.Config{Stdout: &expected}).Eval(parse(t, program), object.NewEnv())
+	expected.WriteString(result.Inspect() + "\n")
+
+	source, err := Generate(parse(t, program), "program.mk")
+	assert.NoError(t, err)
+
+	// the program imports internal packages, so it is built in the module, in a directory the go command ignores
+	root, err := filepath.Abs("../..")
+	assert.NoError(t, err)
+	dir, err := os.MkdirTemp(root, "_gogen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), source, 0o644))
+
+	cmd := exec.Command("go", "run", "./"+filepath.Base(dir))
+	cmd.Dir = root
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(output))
+	assert.Equal(t, expected.String(), string(output))
+	assert.True(t, strings.HasSuffix(string(output), "yes!\n"))
+}
@@ -0,0 +1,392 @@
+// Package jsgen translates Monkey programs to readable JavaScript, to run them on the web without WebAssembly.
+// Lets become JavaScript variables, functions arrow functions and ifs ifs, or conditional expressions where they
+// are values. A small runtime, $, gives the operators and the builtins the meaning they have in Monkey: integers
+// are BigInts wrapping around at 64 bits, hashes are $.Hash, and errors are thrown as $.MonkeyError.
+//
+// Only the builtins of the runtime are available: len, println, slice, assert and assert_eq. The value of the
+// program isn't printed, a program runs for what it does.
+package jsgen
+
+import (
+	_ "embed"
+	"fmt"
+	"monkey/internal/ast"
+	"monkey/internal/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed runtime.js
+var runtime string
+
+// builtins are the builtins of the runtime
+var builtins = map[string]bool{
+	"len": true, "println": true, "slice": true, "assert": true, "assert_eq": true,
+}
+
+// operators are the functions of the runtime applying the operators
+var operators = map[string]string{
+	"+": "$.add", "-": "$.sub", "*": "$.mul", "/": "$.div",
+	"==": "$.eq", "!=": "$.ne", "<": "$.lt", ">": "$.gt",
+}
+
+// reserved are the names JavaScript has for itself, which the variables of the same names get a _ after
+var reserved = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`arguments await break case catch class const continue debugger default
+		delete do else enum eval export extends false finally for function if implements import in instanceof
+		interface let new null package private protected public return static super switch this throw true try
+		typeof undefined var void while with yield Infinity NaN`) {
+		reserved[name] = true
+	}
+}
+
+// Generate returns the JavaScript doing what the program does, the runtime first. The name is the one of the file
+// the program comes from, for the comment saying the source is generated.
+func Generate(program *ast.Program, name string) ([]byte, error) {
+	g := &generator{}
+	g.line("// Code generated by monkey transpile from %s. DO NOT EDIT.", name)
+	g.line(`"use strict";`)
+	g.line("")
+	g.out.WriteString(runtime)
+	g.line("")
+	g.function(nil, program.Statements, false)
+
+	if g.err != nil {
+		return nil, g.err
+	}
+	return []byte(g.out.String()), nil
+}
+
+type (
+	// generator writes the JavaScript of a program, one indented line at a time
+	generator struct {
+		out    strings.Builder
+		indent int
+		err    error    // the first node that can't be translated
+		scopes []*scope // the functions being translated, innermost last
+	}
+
+	// scope holds the names a function declares
+	scope struct {
+		names    map[string]bool // the parameters and the lets
+		declared map[string]bool // the names declared in JavaScript so far
+	}
+)
+
+func (g *generator) line(format string, args ...interface{}) {
+	if format != "" {
+		g.out.WriteString(strings.Repeat("\t", g.indent))
+	}
+	fmt.Fprintf(&g.out, format, args...)
+	g.out.WriteString("\n")
+}
+
+// nested returns what f writes, indented one level deeper, to put it in the middle of an expression
+func (g *generator) nested(f func()) string {
+	out := g.out
+	g.out = strings.Builder{}
+	g.indent++
+
+	f()
+	text := g.out.String()
+
+	g.indent--
+	g.out = out
+	return text
+}
+
+// variable returns the JavaScript variable of a Monkey name
+func variable(name string) string {
+	if reserved[name] {
+		return name + "_"
+	}
+
+	return name
+}
+
+// function writes the body of a function, or the program when params is nil and tail is false: the declarations
+// of the variables set in nested blocks, then the statements, returning the value of the last one when tail
+func (g *generator) function(params []*ast.Identifier, stmts []ast.Statement, tail bool) {
+	s := &scope{names: map[string]bool{}, declared: map[string]bool{}}
+	for _, param := range params {
+		s.names[param.Value] = true
+		s.declared[param.Value] = true
+	}
+
+	// lets in blocks are declared upfront, Monkey blocks not being scopes like JavaScript ones are
+	var nested []string
+	for _, stmt := range stmts {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			s.names[let.Name.(*ast.Identifier).Value] = true
+		}
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.FunctionLiteral:
+				return false
+			case *ast.BlockStatement:
+				for _, stmt := range node.Statements {
+					if let, ok := stmt.(*ast.LetStatement); ok {
+						name := let.Name.(*ast.Identifier).Value
+						if !s.declared[name] {
+							s.names[name], s.declared[name] = true, true
+							nested = append(nested, variable(name))
+						}
+					}
+				}
+			}
+			return node != nil
+		})
+	}
+	if len(nested) > 0 {
+		sort.Strings(nested)
+		g.line("let %s;", strings.Join(nested, ", "))
+	}
+
+	g.scopes = append(g.scopes, s)
+	g.statements(stmts, tail)
+	g.scopes = g.scopes[:len(g.scopes)-1]
+}
+
+// statements writes the statements, returning the value of the last one when tail
+func (g *generator) statements(stmts []ast.Statement, tail bool) {
+	if tail && len(stmts) == 0 {
+		g.line("return null;")
+	}
+
+	for i, stmt := range stmts {
+		last := tail && i == len(stmts)-1
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			name := stmt.Name.(*ast.Identifier).Value
+			value := g.expression(stmt.Value, name)
+			s := g.scopes[len(g.scopes)-1]
+			if s.declared[name] {
+				g.line("%s = %s;", variable(name), value)
+			} else {
+				s.declared[name] = true
+				g.line("let %s = %s;", variable(name), value)
+			}
+			if last {
+				g.line("return %s;", variable(name))
+			}
+		case *ast.ReturnStatement:
+			if len(g.scopes) == 1 {
+				g.fail(stmt, "a return outside of a function can't be translated to JavaScript")
+			}
+			g.line("return %s;", g.expression(stmt.ReturnValue, ""))
+			return
+		case *ast.ExpressionStatement:
+			if ifExpr, ok := stmt.Expression.(*ast.IfExpression); ok {
+				g.ifStatement(ifExpr, last)
+			} else if last {
+				g.line("return %s;", g.expression(stmt.Expression, ""))
+			} else {
+				g.line("%s;", g.expression(stmt.Expression, ""))
+			}
+		case *ast.BreakStatement:
+			g.fail(stmt, "break statements can't be translated to JavaScript yet")
+		case *ast.ContinueStatement:
+			g.fail(stmt, "continue statements can't be translated to JavaScript yet")
+		case *ast.ThrowStatement:
+			g.fail(stmt, "throw statements can't be translated to JavaScript yet")
+		default:
+			g.fail(stmt, "")
+		}
+	}
+}
+
+// ifStatement writes the if as a statement, returning the value of its branches when tail
+func (g *generator) ifStatement(expr *ast.IfExpression, tail bool) {
+	g.line("if (%s) {", g.condition(expr.Condition))
+	g.indent++
+	g.statements(expr.Consequence.Statements, tail)
+	g.indent--
+
+	if expr.Alternative != nil {
+		g.line("} else {")
+		g.indent++
+		g.statements(expr.Alternative.Statements, tail)
+		g.indent--
+	}
+	g.line("}")
+
+	if expr.Alternative == nil && tail {
+		g.line("return null;")
+	}
+}
+
+// condition returns the JavaScript of a condition, asking the runtime whether its value is truthy unless it is a
+// boolean already
+func (g *generator) condition(expr ast.Expression) string {
+	switch expr := expr.(type) {
+	case *ast.Boolean:
+		return g.expression(expr, "")
+	case *ast.PrefixExpression:
+		if expr.Operator == "!" {
+			return g.expression(expr, "")
+		}
+	case *ast.InfixExpression:
+		switch expr.Operator {
+		case "==", "!=", "<", ">", "&&", "||":
+			return g.expression(expr, "")
+		}
+	}
+
+	return fmt.Sprintf("$.truthy(%s)", g.expression(expr, ""))
+}
+
+// expression returns the JavaScript of the expression. The name is the one a function literal is declared with,
+// if any.
+func (g *generator) expression(expr ast.Expression, name string) string {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return strconv.FormatInt(expr.Value, 10) + "n"
+	case *ast.StringLiteral:
+		return strings.ReplaceAll(strconv.Quote(expr.Value), `\a`, `\x07`)
+	case *ast.Boolean:
+		return strconv.FormatBool(expr.Value)
+	case *ast.Identifier:
+		return g.identifier(expr)
+	case *ast.PrefixExpression:
+		right := g.expression(expr.Right, "")
+		switch expr.Operator {
+		case "-":
+			return fmt.Sprintf("$.neg(%s)", right)
+		case "!":
+			return fmt.Sprintf("$.not(%s)", right)
+		}
+	case *ast.InfixExpression:
+		if expr.Operator == "&&" || expr.Operator == "||" {
+			return fmt.Sprintf("(%s %s %s)", g.condition(expr.Left), expr.Operator, g.condition(expr.Right))
+		}
+		if operator, ok := operators[expr.Operator]; ok {
+			return fmt.Sprintf("%s(%s, %s)", operator, g.expression(expr.Left, ""), g.expression(expr.Right, ""))
+		}
+	case *ast.IndexExpression:
+		left := g.expression(expr.Left, "")
+		if expr.Token != nil && expr.Token.Type == token.PERIOD {
+			return fmt.Sprintf("$.field(%s, %s)", left, strconv.Quote(expr.Index.(*ast.Identifier).Value))
+		}
+		return fmt.Sprintf("$.index(%s, %s)", left, g.expression(expr.Index, ""))
+	case *ast.ArrayLiteral:
+		return "[" + strings.Join(g.expressions(expr.Elements), ", ") + "]"
+	case *ast.HashLiteral:
+		var pairs []string
+		for _, key := range expr.Keys() {
+			pairs = append(pairs, "["+g.expression(key, "")+", "+g.expression(expr.Hash[key], "")+"]")
+		}
+		return "$.hash([" + strings.Join(pairs, ", ") + "])"
+	case *ast.CallExpression:
+		fn := g.expression(expr.Function, "")
+		if _, ok := expr.Function.(*ast.FunctionLiteral); ok {
+			fn = "(" + fn + ")"
+		}
+		return fn + "(" + strings.Join(g.expressions(expr.Arguments), ", ") + ")"
+	case *ast.FunctionLiteral:
+		if name == "" {
+			name = "fn"
+		}
+		params := make([]string, len(expr.Parameters))
+		for i, param := range expr.Parameters {
+			params[i] = variable(param.Value)
+		}
+		body := g.nested(func() { g.function(expr.Parameters, expr.Body.Statements, true) })
+		return fmt.Sprintf("$.fn(%s, (%s) => {\n%s%s})", strconv.Quote(name), strings.Join(params, ", "), body, strings.Repeat("\t", g.indent))
+	case *ast.IfExpression:
+		return g.ifExpression(expr)
+	case *ast.ForExpression:
+		g.fail(expr, "for loops can't be translated to JavaScript yet")
+		return "null"
+	case *ast.AssignExpression:
+		g.fail(expr, "assignments can't be translated to JavaScript yet")
+		return "null"
+	case *ast.TryExpression:
+		g.fail(expr, "try expressions can't be translated to JavaScript yet")
+		return "null"
+	}
+
+	g.fail(expr, "")
+	return "null"
+}
+
+// expressions returns the JavaScript of the expressions
+func (g *generator) expressions(exprs []ast.Expression) []string {
+	values := make([]string, len(exprs))
+	for i, expr := range exprs {
+		values[i] = g.expression(expr, "")
+	}
+
+	return values
+}
+
+// ifExpression returns the JavaScript of an if used as a value: a conditional expression when its branches are
+// expressions, a function called on the spot otherwise
+func (g *generator) ifExpression(expr *ast.IfExpression) string {
+	if value, ok := g.branchValue(expr.Consequence); ok {
+		if alternative, ok := g.branchValue(expr.Alternative); ok {
+			return fmt.Sprintf("(%s ? %s : %s)", g.condition(expr.Condition), value, alternative)
+		}
+	}
+
+	ast.Inspect(expr, func(node ast.Node) bool {
+		if _, ok := node.(*ast.ReturnStatement); ok {
+			g.fail(node, "a return in an if used as a value can't be translated to JavaScript")
+		}
+		_, isFunction := node.(*ast.FunctionLiteral)
+		return !isFunction
+	})
+
+	body := g.nested(func() { g.ifStatement(expr, true) })
+	return fmt.Sprintf("(() => {\n%s%s})()", body, strings.Repeat("\t", g.indent))
+}
+
+// branchValue returns the JavaScript of the value of a branch that is a single expression, null for a missing or
+// empty branch, false for the other branches
+func (g *generator) branchValue(block *ast.BlockStatement) (string, bool) {
+	if block == nil || len(block.Statements) == 0 {
+		return "null", true
+	}
+	if len(block.Statements) != 1 {
+		return "", false
+	}
+
+	stmt, ok := block.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return "", false
+	}
+	return g.expression(stmt.Expression, ""), true
+}
+
+// identifier returns the JavaScript of a name: a variable, or a builtin of the runtime
+func (g *generator) identifier(ident *ast.Identifier) string {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if g.scopes[i].names[ident.Value] {
+			return variable(ident.Value)
+		}
+	}
+
+	if builtins[ident.Value] {
+		return "$." + ident.Value
+	}
+
+	g.fail(ident, fmt.Sprintf("%s isn't declared, or is a builtin JavaScript doesn't have", ident.Value))
+	return "null"
+}
+
+// fail records why the node can't be translated, if it is the first one
+func (g *generator) fail(node ast.Node, reason string) {
+	if g.err != nil {
+		return
+	}
+
+	if reason == "" {
+		reason = fmt.Sprintf("%T can't be translated to JavaScript", node)
+	}
+	if tok := ast.TokenOf(node); tok != nil {
+		reason = fmt.Sprintf("line %d, column %d: %s", tok.Line, tok.Column, reason)
+	}
+	g.err = fmt.Errorf("%s", reason)
+}
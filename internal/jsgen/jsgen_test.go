@@ -0,0 +1,97 @@
+package jsgen
+
+import (
+	"bytes"
+	"monkey/internal/ast"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const program = `
+let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+let add = fn(a) { fn(b) { a + b } };
+let h = {"a": [1, 2], 3: true};
+println(fib(15), add(2)(3), h["a"][1], h.a, h.b, len("héllo"), -h.a[0], !true);
+let f = fn() { later() };
+let later = fn() { "late" };
+println(f(), if (false) { 1 }, [1, "two", [3]] == [1, "two", [3]], {1: 2} == {1: 2});
+let x = if (1 < 2) { let y = "yes"; y } else { "no" };
+let g = fn(n) { if (n > 0) { let z = n * 2; z } };
+println(g(2), g(0), "ab" * 2, 7 / 2, 9223372036854775807 + 1, slice([1, 2, 3], 1, 2), h);
+println(true || 1 / 0, false && 1 / 0, if (false) { 1 } || h.a, fib(3) == 2 && "x");
+println(x + "!");
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	assert.Empty(t, p.Errors())
+	return program
+}
+
+func TestGenerate(t *testing.T) {
+	source, err := Generate(parse(t, "let a = 1; let f = fn(x) { if (x) { let new = x; } a + new }; f(2)"), "a.mk")
+	assert.NoError(t, err)
+
+	for _, line := range []string{
+		"// Code generated by monkey transpile from a.mk. DO NOT EDIT.\n\"use strict\";\n",
+		"\nlet a = 1n;\n",
+		"let f = $.fn(\"f\", (x) => {\n\tlet new_;\n\tif ($.truthy(x)) {\n\t\tnew_ = x;\n\t}\n\treturn $.add(a, new_);\n});\n",
+		"\nf(2n);\n",
+	} {
+		assert.Contains(t, string(source), line)
+	}
+
+	for input, reason := range map[string]string{
+		"return 1;": "line 1, column 1: a return outside of a function can't be translated to JavaScript",
+		"puts(1)":   "line 1, column 1: puts isn't declared, or is a builtin JavaScript doesn't have",
+		"fn() { let a = if (true) { return 1; }; a }": "line 1, column 28: a return in an if used as a value can't be translated to JavaScript",
+		"let n = 0; for (;;) { n }":                   "line 1, column 12: for loops can't be translated to JavaScript yet",
+		"let n = 0;\nn = n + 1":                       "line 2, column 3: assignments can't be translated to JavaScript yet",
+		"try { 1 } catch (e) { e }":                   "line 1, column 1: try expressions can't be translated to JavaScript yet",
+		"throw 1":                                     "line 1, column 1: throw statements can't be translated to JavaScript yet",
+	} {
+		_, err := Generate(parse(t, input), "a.mk")
+		if assert.Error(t, err, input) {
+			assert.Equal(t, reason, err.Error(), input)
+		}
+	}
+
+	loop := parse(t, "for (;;) { break; continue; }").Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ForExpression)
+	_, err = Generate(&ast.Program{Statements: loop.Body.Statements[:1]}, "a.mk")
+	assert.EqualError(t, err, "line 1, column 12: break statements can't be translated to JavaScript yet")
+	_, err = Generate(&ast.Program{Statements: loop.Body.Statements[1:]}, "a.mk")
+	assert.EqualError(t, err, "line 1, column 19: continue statements can't be translated to JavaScript yet")
+}
+
+// TestRun runs the translated program with node and checks that it prints what the evaluator does
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs a JavaScript program")
+	}
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("no node command")
+	}
+
+	var expected bytes.Buffer
+	result := evaluator.New(evaluator.Config{Stdout: &expected}).Eval(parse(t, program), object.NewEnv())
+	assert.NotEqual(t, object.ERROR_OBJ, result.Type(), result.Inspect())
+
+	source, err := Generate(parse(t, program), "program.mk")
+	assert.NoError(t, err)
+
+	filename := filepath.Join(t.TempDir(), "program.js")
+	assert.NoError(t, os.WriteFile(filename, source, 0o644))
+
+	output, err := exec.Command("node", filename).CombinedOutput()
+	assert.NoError(t, err, string(output))
+	assert.Equal(t, expected.String(), string(output))
+}
@@ -0,0 +1,206 @@
+// The runtime of Monkey programs translated to JavaScript: the operators and builtins whose meaning differs from
+// JavaScript's. Integers are BigInts wrapping around at 64 bits, floats are numbers and hashes are $.Hash.
+const $ = (() => {
+	class MonkeyError extends Error {}
+	const fail = (message) => {
+		throw new MonkeyError(message);
+	};
+
+	class Hash {
+		constructor(pairs) {
+			this.pairs = new Map();
+			for (const [key, value] of pairs) {
+				this.set(key, value);
+			}
+		}
+
+		static key(key) {
+			switch (type(key)) {
+			case "INTEGER":
+				return "i" + key;
+			case "FLOAT":
+				return (Number.isInteger(key) ? "i" : "f") + key;
+			case "STRING":
+				return "s" + key;
+			case "BOOLEAN":
+				return "b" + key;
+			default:
+				return fail("unusable as hash key: " + type(key));
+			}
+		}
+
+		get(key) {
+			const pair = this.pairs.get(Hash.key(key));
+			return pair === undefined ? null : pair[1];
+		}
+
+		set(key, value) {
+			const k = Hash.key(key);
+			const pair = this.pairs.get(k);
+			if (pair !== undefined) {
+				pair[1] = value;
+			} else {
+				this.pairs.set(k, [key, value]);
+			}
+		}
+	}
+
+	const type = (v) => {
+		if (v === null) return "NULL";
+		if (Array.isArray(v)) return "ARRAY";
+		if (v instanceof Hash) return "HASH";
+		switch (typeof v) {
+		case "bigint": return "INTEGER";
+		case "number": return "FLOAT";
+		case "string": return "STRING";
+		case "boolean": return "BOOLEAN";
+		case "function": return v.builtin ? "BUILTIN" : "FUNCTION";
+		default: return "UNKNOWN";
+		}
+	};
+
+	const int64 = (n) => BigInt.asIntN(64, n);
+	const isNumber = (v) => typeof v === "bigint" || typeof v === "number";
+	const bothIntegers = (a, b) => typeof a === "bigint" && typeof b === "bigint";
+	const mismatch = (op, a, b) => fail(type(a) === type(b)
+		? `unknown operator: ${type(a)} ${op} ${type(b)}`
+		: `type mismatch: ${type(a)} ${op} ${type(b)}`);
+
+	const inspect = (v, nested) => {
+		switch (type(v)) {
+		case "STRING":
+			return nested ? JSON.stringify(v) : v;
+		case "FLOAT": {
+			const s = String(v);
+			return /[.eIN]/.test(s) ? s : s + ".0";
+		}
+		case "ARRAY":
+			return "[" + v.map((e) => inspect(e, true)).join(", ") + "]";
+		case "HASH":
+			return "{" + [...v.pairs.values()].map(([k, e]) => inspect(k, true) + ": " + inspect(e, true)).join(", ") + "}";
+		case "FUNCTION":
+			return "fn";
+		case "BUILTIN":
+			return "builtin function";
+		default:
+			return String(v);
+		}
+	};
+
+	const equal = (a, b) => {
+		if (isNumber(a) && isNumber(b)) return a == b;
+		if (type(a) !== type(b)) return false;
+		if (Array.isArray(a)) return a.length === b.length && a.every((e, i) => equal(e, b[i]));
+		if (a instanceof Hash) {
+			return a.pairs.size === b.pairs.size &&
+				[...a.pairs].every(([k, [, v]]) => b.pairs.has(k) && equal(v, b.pairs.get(k)[1]));
+		}
+		return a === b;
+	};
+
+	const truthy = (v) => v !== null && v !== false;
+
+	const compare = (op, a, b) => {
+		if (isNumber(a) && isNumber(b) || type(a) === type(b) && (typeof a === "string" || typeof a === "boolean")) {
+			return op === "<" ? a < b : a > b;
+		}
+		return mismatch(op, a, b);
+	};
+
+	const builtin = (name, arity, f) => {
+		const g = (...args) => {
+			if (arity >= 0 && args.length !== arity) {
+				fail(`wrong number of arguments to \`${name}\`. got=${args.length}, want=${arity}`);
+			}
+			return f(...args);
+		};
+		g.builtin = true;
+		return g;
+	};
+
+	const utf8 = new TextEncoder();
+
+	return {
+		Hash,
+		MonkeyError,
+		truthy,
+		inspect,
+		hash: (pairs) => new Hash(pairs),
+
+		fn: (name, f) => (...args) => {
+			if (args.length !== f.length) {
+				fail(`wrong number of arguments to \`${name}\`. got=${args.length}, want=${f.length}`);
+			}
+			return f(...args);
+		},
+
+		add: (a, b) => {
+			if (bothIntegers(a, b)) return int64(a + b);
+			if (isNumber(a) && isNumber(b)) return Number(a) + Number(b);
+			if (typeof a === "string" && typeof b === "string") return a + b;
+			return mismatch("+", a, b);
+		},
+		sub: (a, b) => {
+			if (bothIntegers(a, b)) return int64(a - b);
+			if (isNumber(a) && isNumber(b)) return Number(a) - Number(b);
+			return mismatch("-", a, b);
+		},
+		mul: (a, b) => {
+			if (bothIntegers(a, b)) return int64(a * b);
+			if (isNumber(a) && isNumber(b)) return Number(a) * Number(b);
+			if (typeof a === "string" && typeof b === "bigint") {
+				return b < 0n ? fail(`negative repeat count: ${b}`) : a.repeat(Number(b));
+			}
+			return mismatch("*", a, b);
+		},
+		div: (a, b) => {
+			if (isNumber(a) && isNumber(b) && b == 0) return fail("division by zero");
+			if (bothIntegers(a, b)) return int64(a / b);
+			if (isNumber(a) && isNumber(b)) return Number(a) / Number(b);
+			return mismatch("/", a, b);
+		},
+		eq: (a, b) => isNumber(a) && isNumber(b) || type(a) === type(b) ? equal(a, b) : mismatch("==", a, b),
+		ne: (a, b) => isNumber(a) && isNumber(b) || type(a) === type(b) ? !equal(a, b) : mismatch("!=", a, b),
+		lt: (a, b) => compare("<", a, b),
+		gt: (a, b) => compare(">", a, b),
+		neg: (v) => {
+			if (typeof v === "bigint") return int64(-v);
+			if (typeof v === "number") return -v;
+			return fail(`unknown operator: -${type(v)}`);
+		},
+		not: (v) => !truthy(v),
+
+		index: (a, i) => {
+			if (Array.isArray(a)) {
+				if (typeof i !== "bigint") return fail("invalid index type. got=" + type(i));
+				return i < 0n || i >= BigInt(a.length) ? null : a[Number(i)];
+			}
+			if (a instanceof Hash) return a.get(i);
+			return fail("index operator not supported: " + type(a));
+		},
+		field: (h, name) => h instanceof Hash ? h.get(name) : fail(`field access not supported: ${type(h)}.${name}`),
+
+		len: builtin("len", 1, (x) => {
+			if (typeof x === "string") return BigInt(utf8.encode(x).length);
+			if (Array.isArray(x)) return BigInt(x.length);
+			return fail("argument to `len` is not supported. got " + type(x));
+		}),
+		println: builtin("println", -1, (...args) => {
+			if (args.length === 0) fail("wrong number of arguments to `println`. got=0");
+			console.log(args.map((a) => inspect(a, false)).join(" "));
+			return null;
+		}),
+		slice: builtin("slice", 3, (x, start, end) => {
+			const length = typeof x === "string" || Array.isArray(x) ? x.length : fail("argument to `slice` is not supported. got " + type(x));
+			if (start < 0n || start > end || end > BigInt(length)) {
+				fail(`slice bounds out of range [${start}:${end}] with length ${length}`);
+			}
+			return x.slice(Number(start), Number(end));
+		}),
+		assert: builtin("assert", -1, (cond, message) => truthy(cond) ? null
+			: fail("assertion failed" + (message === undefined ? "" : ": " + inspect(message, false)))),
+		assert_eq: builtin("assert_eq", -1, (actual, expected, message) => equal(actual, expected) ? null
+			: fail("assertion failed" + (message === undefined ? "" : ": " + inspect(message, false)) +
+				`. got=${inspect(actual, false)}, want=${inspect(expected, false)}`)),
+	};
+})();
@@ -1,6 +1,9 @@
 package lexer
 
-import "monkey/internal/token"
+import (
+	"monkey/internal/token"
+	"strings"
+)
 
 type (
 	Lexer struct {
@@ -8,6 +11,8 @@ type (
 		position     int  // current position in input (points to current char)
 		readPosition int  // current reading position in input (after current char)
 		ch           byte // current char under examination
+		line         int  // line of the current char, starting at 1
+		column       int  // column of the current char, starting at 1
 	}
 )
 
@@ -20,21 +25,50 @@ func isDigit(ch byte) bool {
 	return ch >= '0' && ch <= '9'
 }
 
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
+	l.readChar()
+	return l
+}
+
+// NewAt creates a lexer that starts reading the input at offset, which is on the given line and column. It is
+// used to lex part of a file again without starting from the top.
+func NewAt(input string, offset, line, column int) *Lexer {
+	l := &Lexer{input: input, readPosition: offset, line: line, column: column - 1}
 	l.readChar()
 	return l
 }
 
+// Input returns the whole input of the lexer.
+func (l *Lexer) Input() string {
+	return l.input
+}
+
+// Offset returns how far into the input the lexer has read.
+func (l *Lexer) Offset() int {
+	return l.position
+}
+
 func (l *Lexer) NextToken() *token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	line, column, offset := l.line, l.column, l.position
 
 	switch l.ch {
 	case '"':
-		tok = token.Token{Type: token.STRING}
-		tok.Literal = l.readString()
+		literal, invalid := l.readString()
+		tok = token.Token{Type: token.STRING, Literal: literal}
+		if l.ch == 0 {
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.input[offset:]} // a string the input ends in
+		} else if invalid != nil {
+			l.readChar()
+			return invalid
+		}
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -67,9 +101,35 @@ func (l *Lexer) NextToken() *token.Token {
 		} else {
 			tok = *newToken(token.BANG, l.ch)
 		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tok = *newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tok = *newToken(token.ILLEGAL, l.ch)
+		}
 	case '*':
 		tok = *newToken(token.ASTERISK, l.ch)
 	case '/':
+		if l.peekChar() == '/' {
+			tok = token.Token{Type: token.COMMENT, Literal: l.readComment(), Line: line, Column: column, Offset: offset}
+			return &tok
+		}
+		if l.peekChar() == '*' {
+			literal, terminated := l.readBlockComment()
+			tok = token.Token{Type: token.COMMENT, Literal: literal, Line: line, Column: column, Offset: offset}
+			if !terminated {
+				tok.Type = token.ILLEGAL // a comment the input ends in
+			}
+			return &tok
+		}
 		tok = *newToken(token.SLASH, l.ch)
 	case '<':
 		tok = *newToken(token.LT, l.ch)
@@ -92,10 +152,11 @@ func (l *Lexer) NextToken() *token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line, tok.Column, tok.Offset = line, column, offset
 			return &tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Line, tok.Column, tok.Offset = line, column, offset
 			return &tok
 		} else {
 			tok = *newToken(token.ILLEGAL, l.ch)
@@ -103,6 +164,7 @@ func (l *Lexer) NextToken() *token.Token {
 	}
 
 	l.readChar()
+	tok.Line, tok.Column, tok.Offset = line, column, offset
 
 	return &tok
 }
@@ -114,38 +176,179 @@ func (l *Lexer) skipWhitespace() {
 }
 
 // reads in a full word
+// readIdentifier reads a letter followed by letters and digits, like toBase64
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || l.position > position && isDigit(l.ch) {
 		l.readChar()
 	}
 
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer, or a float if the digits are followed by a fraction or an exponent like 3.14 or
+// 1e-9. A dot not followed by a digit isn't part of the number, so that 1.x stays a field access.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	var tokenType token.TokenType = token.INT
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if (next == '+' || next == '-') && l.readPosition+1 < len(l.input) && isDigit(l.input[l.readPosition+1]) {
+			tokenType = token.FLOAT
+			l.readChar()
+			l.readChar()
+			l.readDigits()
+		} else if isDigit(next) {
+			tokenType = token.FLOAT
+			l.readChar()
+			l.readDigits()
+		}
+	}
+
+	return l.input[position:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
+// readString reads a string up to its closing quote and returns its value, with the escape sequences in it
+// decoded: \n, \t, \r, \", \\ and \x followed by two hex digits for any byte. The first escape sequence it doesn't know is returned as an ILLEGAL token, the rest of the string is
+// still read so that it isn't taken for code.
+func (l *Lexer) readString() (string, *token.Token) {
+	var out strings.Builder
+	var invalid *token.Token
 	for {
 		l.readChar()
 
 		if l.ch == '"' || l.ch == 0 {
 			break
 		}
+		if l.ch != '\\' {
+			out.WriteByte(l.ch)
+			continue
+		}
+
+		line, column, offset := l.line, l.column, l.position
+		l.readChar()
+		if l.ch == 0 {
+			break
+		}
+		if ch, ok := escapes[l.ch]; ok {
+			out.WriteByte(ch)
+		} else if l.ch == 'x' && isHexDigit(l.peekChar()) && l.readPosition+1 < len(l.input) && isHexDigit(l.input[l.readPosition+1]) {
+			l.readChar()
+			high := hexValue(l.ch)
+			l.readChar()
+			out.WriteByte(high<<4 | hexValue(l.ch))
+		} else if invalid == nil {
+			invalid = &token.Token{Type: token.ILLEGAL, Literal: l.input[offset:l.readPosition], Line: line, Column: column, Offset: offset}
+		}
+	}
+
+	return out.String(), invalid
+}
+
+// escapes maps the character following a backslash in a string to the one the escape sequence stands for
+var escapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'"':  '"',
+	'\\': '\\',
+}
+
+func hexValue(ch byte) byte {
+	switch {
+	case isDigit(ch):
+		return ch - '0'
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
+}
+
+// Quote returns the string as a string literal, quoted and with the characters that need it escaped, that reads
+// back as the same string.
+func Quote(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		default:
+			if s[i] < ' ' || s[i] == 0x7f {
+				const digits = "0123456789abcdef"
+				out.WriteString(`\x`)
+				out.WriteByte(digits[s[i]>>4])
+				out.WriteByte(digits[s[i]&0xf])
+				continue
+			}
+			out.WriteByte(s[i])
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
+
+// readComment reads a `//` comment up to, but not including, the end of the line
+func (l *Lexer) readComment() string {
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
 	}
 
 	return l.input[position:l.position]
 }
 
+// readBlockComment reads a `/* */` comment up to and including its end, or up to the end of the input if it
+// isn't terminated, reporting whether it was
+func (l *Lexer) readBlockComment() (string, bool) {
+	position := l.position
+	l.readChar() // the * after the /
+	l.readChar()
+	for l.ch != 0 && !(l.ch == '*' && l.peekChar() == '/') {
+		l.readChar()
+	}
+
+	if l.ch == 0 {
+		return l.input[position:l.position], false
+	}
+
+	l.readChar()
+	l.readChar()
+	return l.input[position:l.position], true
+}
+
 // reads a char
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -40,6 +40,37 @@ var (
 				{token.EOF, ""},
 			},
 		},
+		"identifiers with digits": {
+			input: `let x2y = 3d;`,
+			tests: []TestCase{
+				{token.LET, "let"},
+				{token.IDENT, "x2y"},
+				{token.ASSIGN, "="},
+				{token.INT, "3"},
+				{token.IDENT, "d"},
+				{token.SEMICOLON, ";"},
+				{token.EOF, ""},
+			},
+		},
+		"comments": {
+			input: `// leading
+let a = 1; // trailing
+a / 2 //`,
+			tests: []TestCase{
+				{token.COMMENT, "// leading"},
+				{token.LET, "let"},
+				{token.IDENT, "a"},
+				{token.ASSIGN, "="},
+				{token.INT, "1"},
+				{token.SEMICOLON, ";"},
+				{token.COMMENT, "// trailing"},
+				{token.IDENT, "a"},
+				{token.SLASH, "/"},
+				{token.INT, "2"},
+				{token.COMMENT, "//"},
+				{token.EOF, ""},
+			},
+		},
 		"monkey code": {
 			input: `let five = 5;
 let ten = 10;
@@ -49,7 +80,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 if (5 < 10) {
 	return true;
@@ -165,6 +196,105 @@ if (5 < 10) {
 				{token.EOF, ""},
 			},
 		},
+		"block comments": {
+			input: "a /* one */ b /* two\n * lines */ c /**/ / * d",
+			tests: []TestCase{
+				{token.IDENT, "a"},
+				{token.COMMENT, "/* one */"},
+				{token.IDENT, "b"},
+				{token.COMMENT, "/* two\n * lines */"},
+				{token.IDENT, "c"},
+				{token.COMMENT, "/**/"},
+				{token.SLASH, "/"},
+				{token.ASTERISK, "*"},
+				{token.IDENT, "d"},
+				{token.EOF, ""},
+			},
+		},
+		"logical operators": {
+			input: `a && b || !c & d | e`,
+			tests: []TestCase{
+				{token.IDENT, "a"},
+				{token.AND, "&&"},
+				{token.IDENT, "b"},
+				{token.OR, "||"},
+				{token.BANG, "!"},
+				{token.IDENT, "c"},
+				{token.ILLEGAL, "&"},
+				{token.IDENT, "d"},
+				{token.ILLEGAL, "|"},
+				{token.IDENT, "e"},
+				{token.EOF, ""},
+			},
+		},
+		"strings": {
+			input: `"a\nb" "\t\"q\"\\" "\x00\x7F" "a\qb\z" "\x4" c`,
+			tests: []TestCase{
+				{token.STRING, "a\nb"},
+				{token.STRING, "\t\"q\"\\"},
+				{token.STRING, "\x00\x7f"},
+				{token.ILLEGAL, `\q`},
+				{token.ILLEGAL, `\x`},
+				{token.IDENT, "c"},
+				{token.EOF, ""},
+			},
+		},
+		"loops": {
+			input: `for (;;) { break; continue }`,
+			tests: []TestCase{
+				{token.FOR, "for"},
+				{token.LPAREN, "("},
+				{token.SEMICOLON, ";"},
+				{token.SEMICOLON, ";"},
+				{token.RPAREN, ")"},
+				{token.LBRACE, "{"},
+				{token.BREAK, "break"},
+				{token.SEMICOLON, ";"},
+				{token.CONTINUE, "continue"},
+				{token.RBRACE, "}"},
+				{token.EOF, ""},
+			},
+		},
+		"exceptions": {
+			input: `try { throw e } catch (e) {} finally {}`,
+			tests: []TestCase{
+				{token.TRY, "try"},
+				{token.LBRACE, "{"},
+				{token.THROW, "throw"},
+				{token.IDENT, "e"},
+				{token.RBRACE, "}"},
+				{token.CATCH, "catch"},
+				{token.LPAREN, "("},
+				{token.IDENT, "e"},
+				{token.RPAREN, ")"},
+				{token.LBRACE, "{"},
+				{token.RBRACE, "}"},
+				{token.FINALLY, "finally"},
+				{token.LBRACE, "{"},
+				{token.RBRACE, "}"},
+				{token.EOF, ""},
+			},
+		},
+		"numbers": {
+			input: `3.14 1e-9 2.5E+3 7e2 1.x 1e x 2e- 10`,
+			tests: []TestCase{
+				{token.FLOAT, "3.14"},
+				{token.FLOAT, "1e-9"},
+				{token.FLOAT, "2.5E+3"},
+				{token.FLOAT, "7e2"},
+				{token.INT, "1"},
+				{token.PERIOD, "."},
+				{token.IDENT, "x"},
+				{token.INT, "1"},
+				{token.IDENT, "e"},
+				{token.IDENT, "x"},
+				{token.INT, "2"},
+				{token.IDENT, "e"},
+				{token.MINUS, "-"},
+				{token.INT, "10"},
+				{token.EOF, ""},
+			},
+		},
 	}
 )
 
@@ -199,3 +329,55 @@ func TestNextToken(t *testing.T) {
 		index++
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "ab"; /* a
+b */ y "\n" "a\zb" z
+"c`
+
+	expected := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"ab", 2, 7},
+		{";", 2, 11},
+		{"/* a\nb */", 2, 13},
+		{"y", 3, 6},
+		{"\n", 3, 8},
+		{`\z`, 3, 15}, // ILLEGAL, unknown escape sequence
+		{"z", 3, 20},
+		{`"c`, 4, 1}, // ILLEGAL, not terminated
+	}
+
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.literal, tok.Literal)
+		}
+
+		if tok.Line != tt.line || tok.Column != tt.column {
+			t.Errorf("tests[%d] - position of %q wrong. expected=%d:%d, got=%d:%d",
+				i, tt.literal, tt.line, tt.column, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, s := range []string{"", "ab", "a\nb\tc\r", `say "hi"`, `C:\dir\`, "\x00\x1b[0m\x7f\xff"} {
+		quoted := Quote(s)
+		tok := New(quoted).NextToken()
+		if tok.Type != token.STRING || tok.Literal != s {
+			t.Errorf("%q doesn't read back as %q. got=%s %q", quoted, s, tok.Type, tok.Literal)
+		}
+	}
+}
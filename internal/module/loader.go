@@ -0,0 +1,89 @@
+package module
+
+import (
+	"monkey/internal/object"
+	"strings"
+	"sync"
+)
+
+type (
+	// Loader loads modules once: importing a module again returns what it exported the first time, or the error
+	// that kept it from loading. It can be used by several goroutines at once, which load a module once too.
+	Loader struct {
+		Resolver *Resolver
+
+		// Eval evaluates the source of the module in the file and returns what it exports. Its imports are loaded
+		// with the chain, the files being loaded by the one importing them, the file last.
+		Eval func(file File, source string, chain []File) (object.Object, error)
+
+		mu      sync.Mutex
+		modules map[File]*loaded
+	}
+
+	// CycleError is the error of a module importing itself, through the modules it imports.
+	CycleError struct {
+		Chain []File // the module imported again first and last, with the ones importing it in between
+	}
+
+	// loaded is a module, loaded once done is closed
+	loaded struct {
+		done    chan struct{}
+		exports object.Object
+		err     error
+	}
+)
+
+func (e *CycleError) Error() string {
+	files := make([]string, len(e.Chain))
+	for i, file := range e.Chain {
+		files[i] = file.String()
+	}
+
+	return "import cycle: " + strings.Join(files, " imports ")
+}
+
+// NewLoader returns a loader finding modules with the resolver and evaluating them with eval, see Loader.Eval.
+func NewLoader(r *Resolver, eval func(file File, source string, chain []File) (object.Object, error)) *Loader {
+	return &Loader{Resolver: r, Eval: eval, modules: map[File]*loaded{}}
+}
+
+// Load returns what the module imported with the path exports, loading it if it wasn't. The chain holds the files
+// being loaded by the one importing the module, the one importing last, and is empty for a program that isn't in
+// a file. Importing a module of the chain returns a *CycleError.
+func (l *Loader) Load(importPath string, chain []File) (object.Object, error) {
+	importing := File{}
+	if len(chain) > 0 {
+		importing = chain[len(chain)-1]
+	}
+	file, err := l.Resolver.Resolve(importPath, importing)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, f := range chain {
+		if f == file {
+			return nil, &CycleError{Chain: append(append([]File(nil), chain[i:]...), file)}
+		}
+	}
+
+	l.mu.Lock()
+	m, ok := l.modules[file]
+	if !ok {
+		m = &loaded{done: make(chan struct{})}
+		l.modules[file] = m
+	}
+	l.mu.Unlock()
+	if ok {
+		<-m.done
+		return m.exports, m.err
+	}
+
+	defer close(m.done)
+	source, err := l.Resolver.Read(file)
+	if err != nil {
+		m.err = err
+		return nil, err
+	}
+	m.exports, m.err = l.Eval(file, string(source), append(chain[:len(chain):len(chain)], file))
+	return m.exports, m.err
+}
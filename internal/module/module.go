@@ -0,0 +1,228 @@
+// Package module finds the files of the modules programs import, and loads them. The path of an import is either
+// relative to the file importing it, starting with ./ or ../, or searched for: first in the libraries of the
+// resolver when it starts with the name of one, like std/json for the json module of the library std, then in the
+// root of the project, the directory holding the monkey.mod manifest found from the directory of the importing
+// file upwards, then in the directories of MONKEY_PATH. A path names a file, the .mk extension being optional.
+//
+// Libraries are file systems like the one of go:embed, for binaries to ship modules like a standard library
+// along with the interpreter.
+//
+// The manifest can name the project with a module line, like:
+//
+//	// the vectors of the game
+//	module game
+//
+// An import path starting with the name, like game/vec, is then always the file of the project, like vec.mk, rather
+// than one of MONKEY_PATH.
+package module
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	Ext      = ".mk"         // the extension of the files of modules, optional in import paths
+	Manifest = "monkey.mod"  // the manifest marking the root of a project
+	PathEnv  = "MONKEY_PATH" // the environment variable holding the directories searched, like PATH
+)
+
+type (
+	// Resolver finds the files of modules, see the package documentation.
+	Resolver struct {
+		Paths     []string         // the directories searched after the root of the project
+		Libraries map[string]fs.FS // the libraries by name, searched for the import paths starting with it
+	}
+
+	// File is the file of a module, on the host or in a library of the resolver.
+	File struct {
+		Library string // the name of the library, empty for a file of the host
+		Name    string // the path of the file, slash-separated in a library
+	}
+
+	// NotFoundError is the error of an import of a module that isn't in any of the places searched.
+	NotFoundError struct {
+		Path     string
+		Searched []string // the files looked for, in order
+	}
+
+	// project is the root of a project and what its manifest says
+	project struct {
+		root string
+		name string // empty if the manifest doesn't have a module line
+	}
+)
+
+// String returns the name of the file, prefixed with the library it is in, like std:json.mk.
+func (f File) String() string {
+	if f.Library == "" {
+		return f.Name
+	}
+
+	return f.Library + ":" + f.Name
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("module %q not found, searched: %s", e.Path, strings.Join(e.Searched, ", "))
+}
+
+// NewResolver returns a resolver searching the directories of MONKEY_PATH.
+func NewResolver() *Resolver {
+	return &Resolver{Paths: filepath.SplitList(os.Getenv(PathEnv))}
+}
+
+// Resolve returns the file of the module imported with the path from the file importing, which is the zero File
+// for a program that isn't in a file, like the lines of the repl: the current directory stands for its directory.
+// It returns a *NotFoundError if the module isn't found, and the error of the manifest of the project if it is
+// wrong.
+func (r *Resolver) Resolve(importPath string, importing File) (File, error) {
+	if importPath == "" {
+		return File{}, fmt.Errorf("empty module path")
+	}
+
+	if filepath.IsAbs(importPath) {
+		return r.find(importPath, "", importPath, []string{""})
+	}
+	if strings.HasPrefix(importPath, "./") || strings.HasPrefix(importPath, "../") {
+		if importing.Library != "" {
+			return r.find(importPath, importing.Library, importPath, []string{path.Dir(importing.Name)})
+		}
+		return r.find(importPath, "", importPath, []string{hostDir(importing)})
+	}
+
+	library, name, _ := strings.Cut(importPath, "/")
+	if _, ok := r.Libraries[library]; ok && name != "" {
+		return r.find(importPath, library, name, []string{"."})
+	}
+
+	var dirs []string
+	if importing.Library == "" {
+		p, err := findProject(hostDir(importing))
+		if err != nil {
+			return File{}, err
+		}
+		if p != nil {
+			if p.name != "" && strings.HasPrefix(importPath, p.name+"/") {
+				return r.find(importPath, "", strings.TrimPrefix(importPath, p.name+"/"), []string{p.root})
+			}
+			dirs = append(dirs, p.root)
+		}
+	}
+	dirs = append(dirs, r.Paths...)
+
+	return r.find(importPath, "", importPath, dirs)
+}
+
+// Read returns the content of the file.
+func (r *Resolver) Read(file File) ([]byte, error) {
+	if file.Library == "" {
+		return os.ReadFile(file.Name)
+	}
+
+	library, ok := r.Libraries[file.Library]
+	if !ok {
+		return nil, fmt.Errorf("no library %q", file.Library)
+	}
+	return fs.ReadFile(library, file.Name)
+}
+
+// hostDir returns the directory of the file of the host, the current one for the zero File
+func hostDir(file File) string {
+	if file.Name == "" {
+		return "."
+	}
+
+	return filepath.Dir(file.Name)
+}
+
+// find returns the first file named name in the directories of the library, with the extension or not, for the
+// module with the path. It returns a *NotFoundError if the file is in none of them.
+func (r *Resolver) find(importPath, library, name string, dirs []string) (File, error) {
+	var searched []string
+	for _, dir := range dirs {
+		file := File{Library: library, Name: filepath.Join(dir, filepath.FromSlash(name))}
+		if library != "" {
+			file.Name = path.Join(dir, name)
+		}
+
+		candidates := []File{file}
+		if path.Ext(name) != Ext {
+			candidates = []File{{Library: library, Name: file.Name + Ext}, file}
+		}
+		for _, candidate := range candidates {
+			if r.isFile(candidate) {
+				return candidate, nil
+			}
+		}
+		searched = append(searched, candidates[0].String())
+	}
+
+	return File{}, &NotFoundError{Path: importPath, Searched: searched}
+}
+
+// isFile returns whether the file exists, and isn't a directory
+func (r *Resolver) isFile(file File) bool {
+	var info fs.FileInfo
+	var err error
+	if file.Library == "" {
+		info, err = os.Stat(file.Name)
+	} else {
+		info, err = fs.Stat(r.Libraries[file.Library], file.Name)
+	}
+
+	return err == nil && !info.IsDir()
+}
+
+// findProject returns the project the directory is in, nil if no directory up from it holds a manifest
+func findProject(dir string) (*project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		file, err := os.Open(filepath.Join(dir, Manifest))
+		if err == nil {
+			defer file.Close()
+			return readManifest(file, dir)
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// readManifest reads the manifest of the project rooted in the directory
+func readManifest(file *os.File, root string) (*project, error) {
+	p := &project{root: root}
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(text, "//"); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+
+		fields := strings.Fields(text)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "module" && len(fields) == 2 && p.name == "":
+			p.name = fields[1]
+		default:
+			return nil, fmt.Errorf("%s:%d: unexpected %q", file.Name(), line, text)
+		}
+	}
+
+	return p, scanner.Err()
+}
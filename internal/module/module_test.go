@@ -0,0 +1,136 @@
+package module
+
+import (
+	"io/fs"
+	"monkey/internal/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// write creates the files under the directory, with their directories
+func write(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755)) || !assert.NoError(t, os.WriteFile(file, []byte(content), 0o644)) {
+			t.FailNow()
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, map[string]string{
+		"game/monkey.mod":      "// the game\nmodule game\n",
+		"game/main.mk":         "",
+		"game/vec.mk":          "",
+		"game/util/strings.mk": "",
+		"game/util/data.txt":   "",
+		"lib/vec.mk":           "",
+		"lib/json.mk":          "",
+		"other/main.mk":        "",
+	})
+	importing := File{Name: filepath.Join(dir, "game", "util", "strings.mk")}
+	main := File{Name: filepath.Join(dir, "game", "main.mk")}
+	std := fstest.MapFS{
+		"json.mk":          {Data: []byte("")},
+		"encoding/json.mk": {Data: []byte("")},
+	}
+	r := &Resolver{Paths: []string{filepath.Join(dir, "lib")}, Libraries: map[string]fs.FS{"std": std}}
+
+	tests := []struct {
+		path      string
+		importing File
+		expected  File
+	}{
+		{"./vec", main, File{Name: "game/vec.mk"}},
+		{"../vec.mk", importing, File{Name: "game/vec.mk"}},
+		{"./data.txt", importing, File{Name: "game/util/data.txt"}},
+		{"vec", importing, File{Name: "game/vec.mk"}},
+		{"util/strings", main, File{Name: "game/util/strings.mk"}},
+		{"game/vec", importing, File{Name: "game/vec.mk"}},
+		{"json", importing, File{Name: "lib/json.mk"}},
+		{"vec", File{Name: filepath.Join(dir, "other", "main.mk")}, File{Name: "lib/vec.mk"}},
+		{filepath.Join(dir, "lib", "json"), File{}, File{Name: "lib/json.mk"}},
+		{"std/json", importing, File{Library: "std", Name: "json.mk"}},
+		{"../json", File{Library: "std", Name: "encoding/json.mk"}, File{Library: "std", Name: "json.mk"}},
+		{"vec", File{Library: "std", Name: "json.mk"}, File{Name: "lib/vec.mk"}},
+	}
+	for _, tt := range tests {
+		file, err := r.Resolve(tt.path, tt.importing)
+		if tt.expected.Library == "" {
+			tt.expected.Name = filepath.Join(dir, filepath.FromSlash(tt.expected.Name))
+		}
+		if assert.NoError(t, err, "path: %q", tt.path) {
+			assert.Equal(t, tt.expected, file, "path: %q", tt.path)
+		}
+	}
+
+	_, err := r.Resolve("game/json", importing)
+	assert.EqualError(t, err, `module "game/json" not found, searched: `+filepath.Join(dir, "game", "json.mk"))
+	_, err = r.Resolve("missing", importing)
+	assert.EqualError(t, err, `module "missing" not found, searched: `+filepath.Join(dir, "game", "missing.mk")+", "+filepath.Join(dir, "lib", "missing.mk"))
+	assert.IsType(t, &NotFoundError{}, err)
+	_, err = r.Resolve("std/xml", importing)
+	assert.EqualError(t, err, `module "std/xml" not found, searched: std:xml.mk`)
+	_, err = r.Resolve("../../json", File{Library: "std", Name: "encoding/json.mk"})
+	assert.EqualError(t, err, `module "../../json" not found, searched: std:../json.mk`)
+
+	write(t, dir, map[string]string{"bad/monkey.mod": "module a\nrequire b\n"})
+	_, err = r.Resolve("vec", File{Name: filepath.Join(dir, "bad", "main.mk")})
+	assert.EqualError(t, err, filepath.Join(dir, "bad", "monkey.mod")+`:2: unexpected "require b"`)
+
+	t.Setenv(PathEnv, filepath.Join(dir, "lib")+string(filepath.ListSeparator)+filepath.Join(dir, "other"))
+	assert.Equal(t, []string{filepath.Join(dir, "lib"), filepath.Join(dir, "other")}, NewResolver().Paths)
+}
+
+func TestLoader(t *testing.T) {
+	std := fstest.MapFS{
+		"a.mk":    {Data: []byte("import b")},
+		"b.mk":    {Data: []byte("import c")},
+		"c.mk":    {Data: []byte("import ./a")},
+		"x.mk":    {Data: []byte("import y; import y")},
+		"y.mk":    {Data: []byte("42")},
+		"self.mk": {Data: []byte("import self")},
+	}
+
+	loads := map[File]int{}
+	var l *Loader
+	l = NewLoader(&Resolver{Libraries: map[string]fs.FS{"std": std}}, func(file File, source string, chain []File) (object.Object, error) {
+		loads[file]++
+		if !strings.HasPrefix(source, "import ") {
+			return &object.String{Value: source}, nil
+		}
+
+		var exports object.Object
+		for _, stmt := range strings.Split(source, "; ") {
+			var err error
+			if exports, err = l.Load("std/"+strings.TrimPrefix(strings.TrimPrefix(stmt, "import "), "./"), chain); err != nil {
+				return nil, err
+			}
+		}
+		return exports, nil
+	})
+
+	exports, err := l.Load("std/x", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "42", exports.Inspect())
+	}
+	_, err = l.Load("std/y", []File{{Name: "main.mk"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[File]int{{"std", "x.mk"}: 1, {"std", "y.mk"}: 1}, loads)
+
+	_, err = l.Load("std/a", []File{{Name: "main.mk"}})
+	assert.EqualError(t, err, "import cycle: std:a.mk imports std:b.mk imports std:c.mk imports std:a.mk")
+	_, err = l.Load("std/b", nil)
+	assert.EqualError(t, err, "import cycle: std:a.mk imports std:b.mk imports std:c.mk imports std:a.mk", "errors are kept too")
+	_, err = l.Load("std/self", nil)
+	assert.EqualError(t, err, "import cycle: std:self.mk imports std:self.mk")
+	assert.Equal(t, 1, loads[File{"std", "b.mk"}])
+}
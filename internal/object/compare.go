@@ -0,0 +1,91 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Comparable is an object with an order, which relational operators and sorting go by. Compare returns a negative
+// number, 0 or a positive number when the object is less than, equal to or greater than the other one, or an
+// error when the objects have no order between them.
+type Comparable interface {
+	Object
+	Compare(other Object) (int, error)
+}
+
+func (i *Integer) Compare(other Object) (int, error) {
+	switch other := other.(type) {
+	case *Integer:
+		return compareInts(i.Value, other.Value), nil
+	case *Float:
+		return compareFloats(float64(i.Value), other.Value)
+	default:
+		return 0, incomparable(i, other)
+	}
+}
+
+func (f *Float) Compare(other Object) (int, error) {
+	switch other := other.(type) {
+	case *Float:
+		return compareFloats(f.Value, other.Value)
+	case *Integer:
+		return compareFloats(f.Value, float64(other.Value))
+	default:
+		return 0, incomparable(f, other)
+	}
+}
+
+func (s *String) Compare(other Object) (int, error) {
+	if other, ok := other.(*String); ok {
+		return strings.Compare(s.Value, other.Value), nil
+	}
+
+	return 0, incomparable(s, other)
+}
+
+// Compare orders false before true.
+func (b *Boolean) Compare(other Object) (int, error) {
+	if other, ok := other.(*Boolean); ok {
+		switch {
+		case b.Value == other.Value:
+			return 0, nil
+		case other.Value:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+
+	return 0, incomparable(b, other)
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareFloats(a, b float64) (int, error) {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return 0, fmt.Errorf("NaN can't be compared")
+	}
+
+	switch {
+	case a < b:
+		return -1, nil
+	case a > b:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+func incomparable(a, b Object) error {
+	return fmt.Errorf("%s can't be compared to %s", a.Type(), b.Type())
+}
@@ -0,0 +1,170 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// FromGo returns the object of a Go value: nil is NULL, booleans, integers, floats and strings are the objects of
+// the same kind, a []byte is Bytes, slices and arrays are arrays, and maps and structs are hashes, with the
+// exported fields of structs keyed by their names. Pointers are followed, and objects are returned as they are.
+// Values of other kinds, like functions and channels, can't be converted, but can be passed as Native objects.
+func FromGo(value interface{}) (Object, error) {
+	if value == nil {
+		return NULL, nil
+	}
+	if obj, ok := value.(Object); ok {
+		return obj, nil
+	}
+
+	return fromGo(reflect.ValueOf(value))
+}
+
+func fromGo(v reflect.Value) (Object, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewInteger(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows INTEGER", v.Uint())
+		}
+		return NewInteger(int64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		if obj, ok := v.Interface().(Object); ok {
+			return obj, nil
+		}
+		return fromGo(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return &Bytes{Value: append([]byte(nil), v.Bytes()...)}, nil
+		}
+		array := &Array{Elements: make([]Object, v.Len())}
+		for i := range array.Elements {
+			element, err := fromGo(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			array.Elements[i] = element
+		}
+		return array, nil
+	case reflect.Map:
+		return fromGoMap(v)
+	case reflect.Struct:
+		hash := NewHash()
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue // unexported
+			}
+			value, err := fromGo(v.Field(i))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field.Name, err)
+			}
+			hash.Set(&String{Value: field.Name}, value)
+		}
+		return hash, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to an object", v.Type())
+	}
+}
+
+// fromGoMap returns the hash of a map, with the pairs in the order of their keys, since maps have none
+func fromGoMap(v reflect.Value) (Object, error) {
+	type pair struct {
+		key   Hashable
+		value Object
+	}
+
+	pairs := make([]pair, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := fromGo(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		hashable, ok := key.(Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		value, err := fromGo(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair{key: hashable, value: value})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].key.Inspect() < pairs[j].key.Inspect() })
+	hash := NewHash()
+	for _, p := range pairs {
+		hash.Set(p.key, p.value)
+	}
+
+	return hash, nil
+}
+
+// ToGo returns the Go value of an object, the other way around from FromGo: NULL is nil, integers are int64,
+// floats float64, arrays []interface{} and hashes map[string]interface{} if all their keys are strings, or
+// map[interface{}]interface{} otherwise. Native objects are their value, and the objects without a Go value, like
+// functions, are returned as they are.
+func ToGo(obj Object) interface{} {
+	switch obj := obj.(type) {
+	case nil, *Null:
+		return nil
+	case *Integer:
+		return obj.Value
+	case *Float:
+		return obj.Value
+	case *String:
+		return obj.Value
+	case *Boolean:
+		return obj.Value
+	case *Bytes:
+		return append([]byte(nil), obj.Value...)
+	case *Native:
+		return obj.Value
+	case *Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, element := range obj.Elements {
+			values[i] = ToGo(element)
+		}
+		return values
+	case *Hash:
+		stringKeys := true
+		for _, pair := range obj.Pairs {
+			if _, ok := pair.Key.(*String); !ok {
+				stringKeys = false
+				break
+			}
+		}
+
+		if stringKeys {
+			values := make(map[string]interface{}, len(obj.Pairs))
+			for _, pair := range obj.Pairs {
+				values[pair.Key.(*String).Value] = ToGo(pair.Value)
+			}
+			return values
+		}
+
+		values := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			values[ToGo(pair.Key)] = ToGo(pair.Value)
+		}
+		return values
+	default:
+		return obj
+	}
+}
@@ -0,0 +1,245 @@
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// encoded is the JSON form of an object: its type along with its value
+type encoded struct {
+	Type  ObjectType      `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// encodedPair is the JSON form of a pair of a hash
+type encodedPair struct {
+	Key   *encoded `json:"key"`
+	Value *encoded `json:"value"`
+}
+
+// Marshal returns the JSON form of the object, which Unmarshal reads back. Only data can be marshaled: integers,
+// floats, strings, booleans, bytes, null, and arrays and hashes of them. Functions and builtins can't, since they
+// hold environments and Go code, and neither can errors, return values or values containing themselves.
+func Marshal(obj Object) ([]byte, error) {
+	e, err := encode(obj, map[Object]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(e)
+}
+
+// Unmarshal returns the object of the JSON form Marshal returned.
+func Unmarshal(data []byte) (Object, error) {
+	var e encoded
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	return decode(&e)
+}
+
+// encode returns the JSON form of the object, containing holds the arrays and hashes being encoded
+func encode(obj Object, containing map[Object]bool) (*encoded, error) {
+	var value interface{}
+	switch obj := obj.(type) {
+	case *Integer:
+		value = strconv.FormatInt(obj.Value, 10) // as a string, not to lose precision to readers using floats
+	case *Float:
+		value = obj.Value
+	case *String:
+		value = obj.Value
+	case *Boolean:
+		value = obj.Value
+	case *Bytes:
+		value = obj.Value
+	case *Null:
+		return &encoded{Type: NULL_OBJ}, nil
+	case *Array:
+		if containing[obj] {
+			return nil, fmt.Errorf("cannot marshal an array containing itself")
+		}
+		containing[obj] = true
+		defer delete(containing, obj)
+
+		elements := make([]*encoded, len(obj.Elements))
+		for i, element := range obj.Elements {
+			e, err := encode(element, containing)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = e
+		}
+		value = elements
+	case *Hash:
+		if containing[obj] {
+			return nil, fmt.Errorf("cannot marshal a hash containing itself")
+		}
+		containing[obj] = true
+		defer delete(containing, obj)
+
+		pairs := make([]encodedPair, 0, len(obj.Pairs))
+		for _, pair := range obj.OrderedPairs() {
+			key, err := encode(pair.Key, containing)
+			if err != nil {
+				return nil, err
+			}
+			value, err := encode(pair.Value, containing)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, encodedPair{Key: key, Value: value})
+		}
+		value = pairs
+	default:
+		return nil, fmt.Errorf("cannot marshal %s", obj.Type())
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encoded{Type: obj.Type(), Value: data}, nil
+}
+
+func decode(e *encoded) (Object, error) {
+	if e == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	switch e.Type {
+	case INTEGER_OBJ:
+		var s string
+		if err := json.Unmarshal(e.Value, &s); err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return NewInteger(value), nil
+	case FLOAT_OBJ:
+		var value float64
+		err := json.Unmarshal(e.Value, &value)
+		return &Float{Value: value}, err
+	case STRING_OBJ:
+		var value string
+		err := json.Unmarshal(e.Value, &value)
+		return &String{Value: value}, err
+	case BOOLEAN_OBJ:
+		var value bool
+		err := json.Unmarshal(e.Value, &value)
+		if value {
+			return TRUE, err
+		}
+		return FALSE, err
+	case BYTES_OBJ:
+		var value []byte
+		err := json.Unmarshal(e.Value, &value)
+		return &Bytes{Value: value}, err
+	case NULL_OBJ:
+		return NULL, nil
+	case ARRAY_OBJ:
+		var elements []*encoded
+		if err := json.Unmarshal(e.Value, &elements); err != nil {
+			return nil, err
+		}
+		array := &Array{Elements: make([]Object, len(elements))}
+		for i, element := range elements {
+			obj, err := decode(element)
+			if err != nil {
+				return nil, err
+			}
+			array.Elements[i] = obj
+		}
+		return array, nil
+	case HASH_OBJ:
+		var pairs []encodedPair
+		if err := json.Unmarshal(e.Value, &pairs); err != nil {
+			return nil, err
+		}
+		hash := NewHash()
+		for _, pair := range pairs {
+			key, err := decode(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := decode(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(hashable, value)
+		}
+		return hash, nil
+	default:
+		return nil, fmt.Errorf("cannot unmarshal %s", e.Type)
+	}
+}
+
+// savedBinding is the JSON form of a binding of an environment
+type savedBinding struct {
+	Value *encoded `json:"value"`
+	Const bool     `json:"const,omitempty"`
+}
+
+// Save writes the names of the environment and what they are bound to as JSON, which Load reads back. Outer
+// environments aren't saved, and neither are the names bound to what Marshal can't marshal, like functions.
+func (e *Environment) Save(w io.Writer) error {
+	e.rlock()
+	saved := make(map[string]savedBinding, len(e.store))
+	for name, binding := range e.store {
+		binding.lock()
+		value, isConst := binding.Value, binding.Const
+		binding.unlock()
+		if value == nil {
+			continue
+		}
+
+		encoded, err := encode(value, map[Object]bool{})
+		if err != nil {
+			continue
+		}
+		saved[name] = savedBinding{Value: encoded, Const: isConst}
+	}
+	e.runlock()
+
+	return json.NewEncoder(w).Encode(saved)
+}
+
+// Load binds the names of what Save wrote, replacing what they are bound to in the environment.
+func (e *Environment) Load(r io.Reader) error {
+	var saved map[string]savedBinding
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+
+	values := make(map[string]Object, len(saved))
+	for name, binding := range saved {
+		value, err := decode(binding.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		values[name] = value
+	}
+
+	e.lock()
+	defer e.unlock()
+	for name, value := range values {
+		if binding, ok := e.store[name]; ok {
+			binding.lock()
+			binding.Value, binding.Const = value, saved[name].Const
+			binding.unlock()
+		} else {
+			e.store[name] = &Binding{Value: value, Const: saved[name].Const}
+		}
+	}
+
+	return nil
+}
@@ -1,14 +1,121 @@
 package object
 
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
 type Environment struct {
 	outer *Environment
-	store map[string]Object
+	store map[string]*Binding
+
+	// function is set for the environments of calls and closures, see Capture
+	function bool
+
+	// mu guards store for the environments of NewSyncEnv, it is nil for the others
+	mu *sync.RWMutex
+}
+
+// Binding holds the value of a name. Closures share the bindings they use with the environment they were created
+// in, so a value set later on is seen by both. The value is nil for a name that is declared but not set yet.
+type Binding struct {
+	Value Object
+	Const bool // set with SetConst, the value can't be changed
+
+	// mu guards the binding once a closure that captured it is shared with another goroutine, see Share. It is
+	// nil for the others.
+	mu *sync.Mutex
+}
+
+// Load returns the value of the binding, under its lock if it is shared.
+func (b *Binding) Load() Object {
+	b.lock()
+	defer b.unlock()
+
+	return b.Value
+}
+
+// Store sets the value of the binding, under its lock if it is shared.
+func (b *Binding) Store(value Object) {
+	b.lock()
+	defer b.unlock()
+
+	b.Value = value
+}
+
+// share guards the binding with a lock of its own, which the environments of the calls it was declared in don't
+// take
+func (b *Binding) share() {
+	if b.mu == nil {
+		b.mu = &sync.Mutex{}
+	}
+}
+
+func (b *Binding) lock() {
+	if b.mu != nil {
+		b.mu.Lock()
+	}
+}
+
+func (b *Binding) unlock() {
+	if b.mu != nil {
+		b.mu.Unlock()
+	}
 }
 
 func NewEnv() *Environment {
 	return &Environment{
 		outer: nil,
-		store: map[string]Object{},
+		store: map[string]*Binding{},
+	}
+}
+
+// NewSyncEnv returns an environment that goroutines can use at once, like the globals of programs running
+// concurrently. Environments enclosing it don't need to be, if only their goroutine uses them. Only the
+// environment is safe for concurrent use, the objects its names are bound to are as safe as they are.
+func NewSyncEnv() *Environment {
+	e := NewEnv()
+	e.mu = &sync.RWMutex{}
+	return e
+}
+
+// Share makes the environment and its outer ones safe for goroutines to use at once like the ones of NewSyncEnv,
+// for a function created in it to run on another goroutine. The bindings of calls and closures get locks of their
+// own too, as the environments of the calls closures captured them from use them without the one of e. It has to
+// be called before other goroutines use them.
+func (e *Environment) Share() {
+	for env := e; env != nil && env.mu == nil; env = env.outer {
+		env.mu = &sync.RWMutex{}
+		if env.function {
+			for _, binding := range env.store {
+				binding.share()
+			}
+		}
+	}
+}
+
+func (e *Environment) lock() {
+	if e.mu != nil {
+		e.mu.Lock()
+	}
+}
+
+func (e *Environment) unlock() {
+	if e.mu != nil {
+		e.mu.Unlock()
+	}
+}
+
+func (e *Environment) rlock() {
+	if e.mu != nil {
+		e.mu.RLock()
+	}
+}
+
+func (e *Environment) runlock() {
+	if e.mu != nil {
+		e.mu.RUnlock()
 	}
 }
 
@@ -18,16 +125,191 @@ func NewEnclosedEnvironment(env *Environment) *Environment {
 	return e
 }
 
+// NewCallEnvironment returns the environment of a call of a function with the env of the function as the outer
+// one. The locals are the names the function declares with let, which closures created before they are set can
+// then capture.
+func NewCallEnvironment(env *Environment, locals []string) *Environment {
+	e := NewEnclosedEnvironment(env)
+	e.function = true
+	for _, name := range locals {
+		e.store[name] = &Binding{}
+	}
+
+	return e
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	e.rlock()
+	var value Object
+	if binding, ok := e.store[name]; ok {
+		value = binding.Load()
+	}
+	e.runlock()
+
+	if value != nil {
+		return value, true
+	}
+
+	if e.outer != nil {
+		return e.outer.Get(name)
 	}
 
-	return obj, ok
+	return nil, false
 }
 
+// Set binds the name to the object and returns it, or returns an error if the name is a constant of the
+// environment.
 func (e *Environment) Set(name string, obj Object) Object {
-	e.store[name] = obj
+	e.lock()
+	defer e.unlock()
+
+	return e.set(name, obj)
+}
+
+func (e *Environment) set(name string, obj Object) Object {
+	if binding, ok := e.store[name]; ok {
+		binding.lock()
+		defer binding.unlock()
+		if binding.Const {
+			return &Error{Message: fmt.Sprintf("cannot assign to %s, it is a constant", name)}
+		}
+
+		binding.Value = obj
+		return obj
+	}
+
+	e.store[name] = &Binding{Value: obj}
+	return obj
+}
+
+// Assign gives a new value to the name where it is bound, in the environment or the innermost outer one that has
+// it, and returns the value. It returns an error if the name is a constant there, and nil if the name isn't bound
+// anywhere, as assigning doesn't declare names.
+func (e *Environment) Assign(name string, obj Object) Object {
+	e.lock()
+	binding, ok := e.store[name]
+	if ok && binding.Load() != nil {
+		defer e.unlock()
+		return e.set(name, obj)
+	}
+	e.unlock()
+
+	if e.outer != nil {
+		return e.outer.Assign(name, obj)
+	}
+
+	return nil
+}
+
+// SetConst binds the name to the object for good, Set returns an error for it from then on. Like Set, it returns
+// an error if the name already is a constant.
+func (e *Environment) SetConst(name string, obj Object) Object {
+	e.lock()
+	defer e.unlock()
+
+	if result := e.set(name, obj); result != obj {
+		return result
+	}
+
+	binding := e.store[name]
+	binding.lock()
+	binding.Const = true
+	binding.unlock()
 	return obj
 }
+
+// Capture returns the environment of a closure created in e that uses the free names. Instead of the whole chain
+// of environments of the calls it was created in, the closure only keeps the bindings of the names it uses, along
+// with the environment the outermost function was created in, which holds the globals.
+func (e *Environment) Capture(free []string) *Environment {
+	global := e
+	for global.function {
+		global = global.outer
+	}
+
+	if global == e {
+		return e
+	}
+
+	closure := &Environment{outer: global, store: make(map[string]*Binding, len(free)), function: true}
+	for _, name := range free {
+		for env := e; env != global; env = env.outer {
+			if binding, ok := env.store[name]; ok {
+				closure.store[name] = binding
+				break
+			}
+		}
+	}
+
+	return closure
+}
+
+// Delete removes the name from the environment, outer environments aren't changed. Closures that captured the
+// binding of the name keep it.
+func (e *Environment) Delete(name string) {
+	e.lock()
+	defer e.unlock()
+
+	delete(e.store, name)
+}
+
+// Names returns the names bound in the environment itself, sorted. The names of outer environments aren't part of
+// them.
+func (e *Environment) Names() []string {
+	e.rlock()
+	defer e.runlock()
+
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Snapshot is the state of the names of an environment at some point, see Environment.Snapshot.
+type Snapshot struct {
+	bindings map[string]Binding
+}
+
+// Snapshot returns the state of the names of the environment, which Restore brings back. Only the names of the
+// environment itself are part of it, not the ones of outer environments, and the objects they are bound to are
+// not copied.
+func (e *Environment) Snapshot() *Snapshot {
+	e.rlock()
+	defer e.runlock()
+
+	bindings := make(map[string]Binding, len(e.store))
+	for name, binding := range e.store {
+		binding.lock()
+		bindings[name] = Binding{Value: binding.Value, Const: binding.Const}
+		binding.unlock()
+	}
+
+	return &Snapshot{bindings: bindings}
+}
+
+// Restore brings the names of the environment back to the snapshot: the names set since are removed and the ones
+// set again are bound to what they were, which closures that captured them see too.
+func (e *Environment) Restore(snapshot *Snapshot) {
+	e.lock()
+	defer e.unlock()
+
+	for name, binding := range e.store {
+		if saved, ok := snapshot.bindings[name]; ok {
+			binding.lock()
+			binding.Value, binding.Const = saved.Value, saved.Const
+			binding.unlock()
+		} else {
+			delete(e.store, name)
+		}
+	}
+
+	for name, saved := range snapshot.bindings {
+		if _, ok := e.store[name]; !ok {
+			saved := saved
+			e.store[name] = &saved
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package object
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+type (
+	// Iterable is an object holding a sequence of objects, which for loops and builtins like map go through.
+	Iterable interface {
+		Object
+		Iterate() Iterator
+	}
+
+	// Iterator goes through the objects of an Iterable, Next returns the next one, or false once they are all
+	// gone.
+	Iterator interface {
+		Next() (Object, bool)
+	}
+
+	// IteratorFunc is an Iterator calling the function for the next object.
+	IteratorFunc func() (Object, bool)
+)
+
+func (f IteratorFunc) Next() (Object, bool) { return f() }
+
+// Iterate goes through the elements of the array.
+func (a *Array) Iterate() Iterator {
+	i := 0
+	return IteratorFunc(func() (Object, bool) {
+		if i >= len(a.Elements) {
+			return nil, false
+		}
+		i++
+		return a.Elements[i-1], true
+	})
+}
+
+// Iterate goes through the keys of the hash, in the order of OrderedPairs.
+func (h *Hash) Iterate() Iterator {
+	pairs := h.OrderedPairs()
+	i := 0
+	return IteratorFunc(func() (Object, bool) {
+		if i >= len(pairs) {
+			return nil, false
+		}
+		i++
+		return pairs[i-1].Key, true
+	})
+}
+
+// Iterate goes through the characters of the string, each as a string of its own.
+func (s *String) Iterate() Iterator {
+	i := 0
+	return IteratorFunc(func() (Object, bool) {
+		if i >= len(s.Value) {
+			return nil, false
+		}
+		_, size := utf8.DecodeRuneInString(s.Value[i:])
+		i += size
+		return &String{Value: s.Value[i-size : i]}, true
+	})
+}
+
+// Range is the integers from Start up to End, End excluded, going by Step, which is never 0. A negative Step goes
+// down from Start to End.
+type Range struct {
+	Start, End, Step int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+
+// Len returns how many integers the range goes through.
+func (r *Range) Len() int64 {
+	if r.Step > 0 && r.Start < r.End {
+		return (r.End - r.Start + r.Step - 1) / r.Step
+	}
+	if r.Step < 0 && r.Start > r.End {
+		return (r.Start - r.End - r.Step - 1) / -r.Step
+	}
+
+	return 0
+}
+
+// Iterate goes through the integers of the range.
+func (r *Range) Iterate() Iterator {
+	var i int64
+	n := r.Len()
+	return IteratorFunc(func() (Object, bool) {
+		if i >= n {
+			return nil, false
+		}
+		i++
+		return NewInteger(r.Start + (i-1)*r.Step), true
+	})
+}
@@ -2,24 +2,40 @@ package object
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"hash/fnv"
+	"math"
 	"monkey/internal/ast"
+	"monkey/internal/code"
+	"monkey/internal/token"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	STRING_OBJ       = "STRING"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	BYTES_OBJ        = "BYTES"
+	NATIVE_OBJ       = "NATIVE"
+	RANGE_OBJ        = "RANGE"
+	TASK_OBJ         = "TASK"
+	CHANNEL_OBJ      = "CHANNEL"
 )
 
 type (
@@ -37,6 +53,10 @@ type (
 		Value int64
 	}
 
+	Float struct {
+		Value float64
+	}
+
 	String struct {
 		Value string
 	}
@@ -46,6 +66,38 @@ type (
 	}
 )
 
+// TRUE, FALSE and NULL are the only booleans and null there are, so they can be compared by pointer.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+// the range of the integers NewInteger doesn't allocate
+const (
+	minSmallInteger = -128
+	maxSmallInteger = 1024
+)
+
+var smallIntegers = func() []Integer {
+	integers := make([]Integer, maxSmallInteger-minSmallInteger+1)
+	for i := range integers {
+		integers[i].Value = int64(i + minSmallInteger)
+	}
+
+	return integers
+}()
+
+// NewInteger returns an Integer of the value. Small integers are allocated once and shared, which is why an
+// Integer must never be changed.
+func NewInteger(value int64) *Integer {
+	if value >= minSmallInteger && value <= maxSmallInteger {
+		return &smallIntegers[value-minSmallInteger]
+	}
+
+	return &Integer{Value: value}
+}
+
 func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
@@ -55,7 +107,31 @@ func (i *Integer) Type() ObjectType {
 }
 
 func (i *Integer) HashKey() HashKey {
-	return HashKey(fmt.Sprintf("%s_%d", i.Type(), i.Value))
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// Inspect formats the float in the shortest way that reads back the same, always with a decimal point or an
+// exponent so that it doesn't look like an integer.
+func (f *Float) Inspect() string {
+	out := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(out, ".eIN") {
+		out += ".0"
+	}
+
+	return out
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// HashKey of a float with an integer value is the HashKey of the integer, since they are equal.
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return (&Integer{Value: int64(f.Value)}).HashKey()
+	}
+
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
 }
 
 func (s *String) Inspect() string {
@@ -67,7 +143,17 @@ func (s *String) Type() ObjectType {
 }
 
 func (s *String) HashKey() HashKey {
-	return HashKey(fmt.Sprintf("%s_%s", s.Type(), s.Value))
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	if b.Value {
+		return HashKey{Type: b.Type(), Value: 1}
+	}
+
+	return HashKey{Type: b.Type(), Value: 0}
 }
 
 func (b *Boolean) Inspect() string {
@@ -102,21 +188,137 @@ func (r *ReturnValue) Inspect() string {
 	return r.Value.Inspect()
 }
 
+type (
+	// Break is what a break statement evaluates to. Like a ReturnValue does for the statements of a function, it
+	// stops the statements of the loop body it is in, and the loop then ends.
+	Break struct{}
+
+	// Continue is what a continue statement evaluates to. It stops the statements of the loop body it is in, and
+	// the loop then goes on with its next iteration.
+	Continue struct{}
+)
+
+func (*Break) Type() ObjectType    { return BREAK_OBJ }
+func (*Break) Inspect() string     { return "break" }
+func (*Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (*Continue) Inspect() string  { return "continue" }
+
 type Error struct {
 	Message string
+	Kind    ErrorKind    // what stopped the program, if not the program itself
+	Token   *token.Token // the token of the node the error happened at, nil if not known
+	Stack   []Frame      // the calls in progress when the error happened, innermost first
+	Thrown  Object       // the value given to a throw statement, nil for the errors of the evaluation itself
+}
+
+// ErrorKind tells the errors the interpreter stops a program with apart from the ones of the program, which can't
+// raise them with throw or a builtin of the host.
+type ErrorKind int
+
+const (
+	ProgramError       ErrorKind = iota // the program failed or threw
+	InterruptedError                    // the context of the evaluation is done
+	ResourceLimitError                  // the program went over a limit of the config
+	StackOverflowError                  // the program has too many calls in progress
+)
+
+// Frame is a call of a function in progress.
+type Frame struct {
+	Function string       // what the function was called by, like "fib" or "handlers[0]"
+	Call     *token.Token // the ( of the call
 }
 
 func (e *Error) Type() ObjectType {
 	return ERROR_OBJ
 }
+
+// Error returns the message, so that errors can be handled as Go errors by the hosts of programs too.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Inspect returns the message, with the position of the error and its stack when known, like:
+//
+//	ERROR: line 1, column 16: identifier not found: foobar
+//		f called at line 2, column 2
 func (e *Error) Inspect() string {
-	return "ERROR: " + e.Message
+	var out bytes.Buffer
+	out.WriteString("ERROR: ")
+	if e.Token != nil {
+		out.WriteString(fmt.Sprintf("line %d, column %d: ", e.Token.Line, e.Token.Column))
+	}
+	out.WriteString(e.Message)
+
+	for _, line := range e.StackLines() {
+		out.WriteString("\n\t" + line)
+	}
+
+	return out.String()
+}
+
+// maxStackLines is how many lines StackLines returns at most, half of them from each end of the stack
+const maxStackLines = 20
+
+// StackLines returns the stack one frame per line. Runs of the same call, like the ones of a recursion, are
+// only shown once, and the middle of long stacks is left out.
+func (e *Error) StackLines() []string {
+	var lines []string
+	for i := 0; i < len(e.Stack); {
+		frame, repeated := e.Stack[i], 1
+		for i+repeated < len(e.Stack) && e.Stack[i+repeated] == frame {
+			repeated++
+		}
+
+		if repeated > 1 {
+			lines = append(lines, fmt.Sprintf("%s (repeated %d times)", frame, repeated))
+		} else {
+			lines = append(lines, frame.String())
+		}
+		i += repeated
+	}
+
+	if len(lines) > maxStackLines {
+		head, tail := lines[:maxStackLines/2], lines[len(lines)-maxStackLines/2:]
+		skipped := fmt.Sprintf("... %d more", len(lines)-maxStackLines)
+		lines = append(append(append([]string{}, head...), skipped), tail...)
+	}
+
+	return lines
+}
+
+func (f Frame) String() string {
+	if f.Call == nil {
+		return f.Function
+	}
+
+	return fmt.Sprintf("%s called at line %d, column %d", f.Function, f.Call.Line, f.Call.Column)
 }
 
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+
+	Name string // the name of the let declaring the function, empty for anonymous functions
+	Doc  string // the text of the comments before the let declaring the function
+}
+
+// Arity returns how many arguments the function takes.
+func (f *Function) Arity() int {
+	return len(f.Parameters)
+}
+
+// Signature returns the name and parameters of the function, like fn add(a, b).
+func (f *Function) Signature() string {
+	params := make([]string, len(f.Parameters))
+	for i, p := range f.Parameters {
+		params[i] = p.Value
+	}
+
+	if f.Name == "" {
+		return "fn(" + strings.Join(params, ", ") + ")"
+	}
+	return "fn " + f.Name + "(" + strings.Join(params, ", ") + ")"
 }
 
 func (f *Function) Type() ObjectType {
@@ -141,9 +343,185 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// CompiledFunction is a function the compiler compiled to bytecode, for the virtual machine to call.
+type CompiledFunction struct {
+	Instructions code.Instructions
+	Parameters   []string
+	Locals       []string // the names of the slots of the locals of a call, starting with the parameters
+	Free         []FreeVariable
+	Body         string // the source of the body, for Inspect
+
+	Name string // the name of the let declaring the function, empty for anonymous functions
+	Doc  string // the text of the comments before the let declaring the function
+}
+
+// Arity returns how many arguments the function takes.
+func (f *CompiledFunction) Arity() int {
+	return len(f.Parameters)
+}
+
+// Signature returns the name and parameters of the function, like fn add(a, b).
+func (f *CompiledFunction) Signature() string {
+	if f.Name == "" {
+		return "fn(" + strings.Join(f.Parameters, ", ") + ")"
+	}
+	return "fn " + f.Name + "(" + strings.Join(f.Parameters, ", ") + ")"
+}
+
+func (f *CompiledFunction) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+// Inspect returns the source of the function, like the Inspect of a Function does.
+func (f *CompiledFunction) Inspect() string {
+	return "fn(" + strings.Join(f.Parameters, ", ") + ") {\n" + f.Body + "\n}"
+}
+
+// FreeVariable tells where a closure of a compiled function captures a free variable from when it is created:
+// the local at Index of the call creating it if Local is set, or else the free variable at Index of the closure
+// of that call.
+type FreeVariable struct {
+	Name  string
+	Local bool
+	Index int
+}
+
+// Closure is a compiled function with the bindings of the free variables it captured. Like the environments of the
+// evaluator, the bindings are shared with the call that created the closure, which sees what the closure sets
+// and the other way around.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Binding
+}
+
+// Share makes the bindings the closure captured safe for goroutines to use at once, for it to run on another
+// goroutine, see Environment.Share.
+func (c *Closure) Share() {
+	for _, binding := range c.Free {
+		binding.share()
+	}
+}
+
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+func (c *Closure) Inspect() string {
+	return c.Fn.Inspect()
+}
+
+// Memo is a function remembering what it returned for the arguments it was called with, see the memo builtin.
+// Calling it again with the same arguments returns the same value without calling the function, so the function
+// must not have side effects. Goroutines can call a memo at once, like the ones of pmap.
+type Memo struct {
+	Function Object // a Function, or a Closure on the virtual machine
+
+	mu      sync.Mutex
+	results map[string]Object // by the hash keys of the arguments
+}
+
+// NewMemo returns a memo of the function that doesn't remember anything yet.
+func NewMemo(fn Object) *Memo {
+	return &Memo{Function: fn, results: map[string]Object{}}
+}
+
+// Result returns what the function returned for the arguments of the key, false if it wasn't called with them.
+func (m *Memo) Result(key string) (Object, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result, ok := m.results[key]
+	return result, ok
+}
+
+// Remember keeps what the function returned for the arguments of the key.
+func (m *Memo) Remember(key string, result Object) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.results[key] = result
+}
+
+func (m *Memo) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+func (m *Memo) Inspect() string {
+	return "memo(" + m.Function.Inspect() + ")"
+}
+
+// Task is a function running on a goroutine of its own, see the spawn and future builtins. Done is closed once the function
+// returned, Result is what it returned from then on.
+type Task struct {
+	Function Object
+	Done     chan struct{}
+	Result   Object
+}
+
+func (t *Task) Type() ObjectType {
+	return TASK_OBJ
+}
+
+func (t *Task) Inspect() string {
+	return "task(" + t.Function.Inspect() + ")"
+}
+
+// Channel passes objects from a task to another, see the chan builtin. Values holds the ones sent but not
+// received yet, up to its capacity. Closing a channel closes Closed instead of Values, so that a send racing with
+// it doesn't panic, and receivers get what's left in Values first.
+type Channel struct {
+	Values chan Object
+	Closed chan struct{}
+
+	closing sync.Once
+}
+
+// NewChannel returns an open channel holding up to size values not received yet.
+func NewChannel(size int) *Channel {
+	return &Channel{Values: make(chan Object, size), Closed: make(chan struct{})}
+}
+
+// Close closes the channel, false if it was closed already.
+func (c *Channel) Close() bool {
+	closed := false
+	c.closing.Do(func() {
+		close(c.Closed)
+		closed = true
+	})
+
+	return closed
+}
+
+func (c *Channel) Type() ObjectType {
+	return CHANNEL_OBJ
+}
+
+func (c *Channel) Inspect() string {
+	return fmt.Sprintf("chan(%d)", cap(c.Values))
+}
+
 type BuiltinFunction func(arg ...Object) Object
+
+// Caller calls a function of the program, like the program calling it would, see Builtin.Run.
+type Caller func(fn Object, args ...Object) Object
+
 type Builtin struct {
 	Fn BuiltinFunction
+
+	// Run is the function of the builtins calling functions of the program, like spawn, or waiting for other
+	// goroutines, like recv, which is nil otherwise: Fn is nil for them. The engine running the program gives it
+	// the context stopping the program, never nil, and how to call functions, which can be used from any
+	// goroutine, every call running on its own.
+	Run func(ctx context.Context, call Caller, args ...Object) Object
+
+	Name   string
+	Params []string // the names of the arguments, with a ? after the optional ones and ... after variadic ones
+	Doc    string
+}
+
+// Signature returns the name and parameters of the builtin, like builtin len(x).
+func (b *Builtin) Signature() string {
+	return "builtin " + b.Name + "(" + strings.Join(b.Params, ", ") + ")"
 }
 
 func (b *Builtin) Type() ObjectType {
@@ -164,7 +542,7 @@ func (a *Array) Inspect() string {
 
 	elts := make([]string, 0, len(a.Elements))
 	for _, obj := range a.Elements {
-		elts = append(elts, obj.Inspect())
+		elts = append(elts, inspectElement(obj))
 	}
 
 	out.WriteString("[")
@@ -174,7 +552,44 @@ func (a *Array) Inspect() string {
 	return out.String()
 }
 
-type HashKey string
+// inspectElement inspects an element of an array or a hash, where strings are quoted not to be taken for other
+// values, unlike strings printed on their own
+func inspectElement(obj Object) string {
+	if s, ok := obj.(*String); ok {
+		return strconv.Quote(s.Value)
+	}
+
+	return obj.Inspect()
+}
+
+// Bytes is binary data, which strings can't hold without it being taken for text. Like strings, bytes are never
+// changed once created.
+type Bytes struct {
+	Value []byte
+}
+
+func (b *Bytes) Type() ObjectType { return BYTES_OBJ }
+
+// Inspect quotes the bytes like a string, with the bytes that aren't printable escaped, prefixed by a b.
+func (b *Bytes) Inspect() string {
+	return "b" + strconv.Quote(string(b.Value))
+}
+
+// Native holds a Go value, like a file or a database connection, that builtins return and take back. Monkey code
+// can pass it around but can't look into it.
+type Native struct {
+	Value interface{}
+}
+
+func (n *Native) Type() ObjectType { return NATIVE_OBJ }
+func (n *Native) Inspect() string  { return fmt.Sprintf("%v", n.Value) }
+
+// HashKey identifies the key of a pair in a hash: keys of different types never collide, and keys of the same
+// type have the same HashKey when they are equal. Strings are hashed with FNV-1a.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
 
 type HashPair struct {
 	Key   Object
@@ -183,6 +598,56 @@ type HashPair struct {
 
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	Order []HashKey // the keys of Pairs in the order they were first set, see Set
+}
+
+// NewHash returns an empty hash.
+func NewHash() *Hash {
+	return &Hash{Pairs: map[HashKey]HashPair{}}
+}
+
+// Set sets the value of the key, keeping the position of a key that is already set.
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.Order = append(h.Order, hashKey)
+	}
+
+	h.Pairs[hashKey] = HashPair{Key: key, Value: value}
+}
+
+// OrderedPairs returns the pairs in the order their keys were first set. Pairs that were put into Pairs without
+// Set come last, ordered by their keys.
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	seen := make(map[HashKey]bool, len(h.Pairs))
+	for _, key := range h.Order {
+		if pair, ok := h.Pairs[key]; ok && !seen[key] {
+			pairs = append(pairs, pair)
+			seen[key] = true
+		}
+	}
+
+	if len(pairs) < len(h.Pairs) {
+		var rest []HashKey
+		for key := range h.Pairs {
+			if !seen[key] {
+				rest = append(rest, key)
+			}
+		}
+		sort.Slice(rest, func(i, j int) bool {
+			if rest[i].Type != rest[j].Type {
+				return rest[i].Type < rest[j].Type
+			}
+			return rest[i].Value < rest[j].Value
+		})
+
+		for _, key := range rest {
+			pairs = append(pairs, h.Pairs[key])
+		}
+	}
+
+	return pairs
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -190,8 +655,8 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	elts := make([]string, 0, len(h.Pairs))
-	for _, v := range h.Pairs {
-		elts = append(elts, fmt.Sprintf("%s: %s", v.Key.Inspect(), v.Value.Inspect()))
+	for _, pair := range h.OrderedPairs() {
+		elts = append(elts, fmt.Sprintf("%s: %s", inspectElement(pair.Key), inspectElement(pair.Value)))
 	}
 
 	out.WriteString("{")
@@ -1,17 +1,22 @@
 package parser
 
 import (
-	"fmt"
 	"monkey/internal/ast"
+	"monkey/internal/diagnostics"
 	"monkey/internal/lexer"
 	"monkey/internal/token"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 const (
 	// this is list of precedences
 	_ int = iota
 	LOWEST
+	ASSIGN      // x = 1
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
@@ -22,23 +27,52 @@ const (
 	COLON       // property access
 )
 
+// Mode changes how strictly the parser reads its input. Modes can be combined with |.
+type Mode uint
+
+const (
+	// StrictSemicolons requires every statement to be terminated, see endStatement for the rules.
+	StrictSemicolons Mode = 1 << iota
+)
+
+// maxNesting bounds how deeply expressions may nest so hostile input can't exhaust the Go stack.
+const maxNesting = 10000
+
 type (
-	prefixParseFn func() ast.Expression
-	infixParseFn  func(expression ast.Expression) ast.Expression
+	// PrefixParseFn parses an expression that starts at the current token, like a literal or "-x".
+	PrefixParseFn func() ast.Expression
+	// InfixParseFn parses an expression that continues an already parsed left hand side, like "+ x" or "(args)".
+	// It is called with the operator as the current token.
+	InfixParseFn func(left ast.Expression) ast.Expression
 
 	Parser struct {
 		l              *lexer.Lexer
-		errors         []string
+		mode           Mode
+		errors         []diagnostics.Diagnostic
+		warnings       []diagnostics.Diagnostic // warnings found inside of statements
+		programWarns   []diagnostics.Diagnostic // warnings about the top level statements themselves
 		curToken       *token.Token
 		peekToken      *token.Token
-		prefixParseFns map[token.TokenType]prefixParseFn
-		infixParseFns  map[token.TokenType]infixParseFn
+		prefixParseFns map[token.TokenType]PrefixParseFn
+		infixParseFns  map[token.TokenType]InfixParseFn
+		precedences    map[token.TokenType]int
+		nesting        int // how many parseExpression calls are currently active
+		loops          int // how many loops the current token is in, inside of the current function
+
+		comments      []*ast.Comment      // comments read but not yet attached to a statement
+		commentGroups []*ast.CommentGroup // every comment group created so far, in source order
+
+		program *ast.Program    // the program returned by the last ParseProgram or Reparse
+		spans   []statementSpan // where each top level statement of program was read from
 	}
 )
 
 var (
-	// assign the different operator precedence amounts
+	// assign the different operator precedence amounts. every parser starts with its own copy of this table.
 	precedences = map[token.TokenType]int{
+		token.ASSIGN:   ASSIGN,
+		token.OR:       OR,
+		token.AND:      AND,
 		token.EQ:       EQUALS,
 		token.NOT_EQ:   EQUALS,
 		token.LT:       LESSGREATER,
@@ -49,27 +83,174 @@ var (
 		token.ASTERISK: PRODUCT,
 		token.LPAREN:   CALL,
 		token.LBRACKET: INDEX,
+		token.PERIOD:   INDEX,
 		token.COLON:    COLON,
 	}
 )
 
 // We plan on implementing a pratt parser. This requires associating 2 functions to every type of operator
 
-// helper for registering a prefix parser function
-func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
+// RegisterPrefix registers the function used to parse expressions starting with the token type, replacing any
+// existing one. Embedders can use it to add literal forms or prefix operators.
+func (p *Parser) RegisterPrefix(tokenType token.TokenType, fn PrefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
 
-// helper for registering an infix parser function
-func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
+// RegisterInfix registers the function used to parse expressions continued by the token type, replacing any
+// existing one. The token type also needs a precedence above LOWEST, see SetPrecedence.
+func (p *Parser) RegisterInfix(tokenType token.TokenType, fn InfixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+// SetPrecedence sets how tightly an infix token type binds, using the precedence constants of this package.
+func (p *Parser) SetPrecedence(tokenType token.TokenType, precedence int) {
+	p.precedences[tokenType] = precedence
+}
+
+// Precedence returns the precedence of the token type, LOWEST if it has none.
+func (p *Parser) Precedence(tokenType token.TokenType) int {
+	if p, ok := p.precedences[tokenType]; ok {
+		return p
+	}
+
+	return LOWEST
+}
+
+// DefaultPrecedence returns the precedence a new parser gives the token type, LOWEST if it has none.
+func DefaultPrecedence(tokenType token.TokenType) int {
+	if p, ok := precedences[tokenType]; ok {
+		return p
+	}
+
+	return LOWEST
+}
+
+// Helpers for parse functions registered from outside the package.
+
+// CurToken returns the token under examination.
+func (p *Parser) CurToken() *token.Token { return p.curToken }
+
+// PeekToken returns the token after the current one.
+func (p *Parser) PeekToken() *token.Token { return p.peekToken }
+
+// NextToken advances to the next token.
+func (p *Parser) NextToken() { p.nextToken() }
+
+// ExpectPeek advances if the next token is of the given type and records an error if it isn't.
+func (p *Parser) ExpectPeek(t token.TokenType) bool { return p.expectPeek(t) }
+
+// ParseExpression parses an expression starting at the current token, binding tighter than precedence.
+// It returns nil after recording an error.
+func (p *Parser) ParseExpression(precedence int) ast.Expression { return p.parseExpression(precedence) }
+
+// ParseExpressionList parses comma separated expressions up to the end token, starting on the opening token.
+// It returns nil on errors and an empty slice for an empty list.
+func (p *Parser) ParseExpressionList(end token.TokenType) []ast.Expression {
+	return p.parseExpressionList(end)
+}
+
+// ParseBlockStatement parses a { ... } block, starting on the opening brace.
+func (p *Parser) ParseBlockStatement() *ast.BlockStatement { return p.parseBlockStatement() }
+
+// Errorf records a parse error at the current token.
+func (p *Parser) Errorf(format string, a ...interface{}) {
+	p.errorAt(p.curToken, format, a...)
+}
+
+// Warnf records a warning at the current token. Warnings don't make the parse fail.
+func (p *Parser) Warnf(format string, a ...interface{}) {
+	p.warnings = append(p.warnings, diagnostics.WarningAt(p.curToken, format, a...))
+}
+
+// errorAt records a parse error pointing at the token
+func (p *Parser) errorAt(tok *token.Token, format string, a ...interface{}) {
+	p.errors = append(p.errors, diagnostics.At(tok, format, a...))
+}
+
 // nextToken moves the value inside of peekToken into curToken
-// then reads the next token into peekToken
+// then reads the next token into peekToken. Comments are never handed to the parse functions, they are
+// set aside until they can be attached to a statement.
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, &ast.Comment{Token: p.peekToken, Text: p.peekToken.Literal})
+		p.peekToken = p.l.NextToken()
+	}
+}
+
+// before reports whether token a starts before token b in the source
+func before(a, b *token.Token) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// takeComments removes the pending comments accepted by keep, stopping at the first one that is not,
+// and groups them. It returns nil if there was nothing to take.
+func (p *Parser) takeComments(keep func(c *ast.Comment) bool) *ast.CommentGroup {
+	n := 0
+	for n < len(p.comments) && keep(p.comments[n]) {
+		n++
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	group := &ast.CommentGroup{List: p.comments[:n:n]}
+	p.comments = p.comments[n:]
+	p.commentGroups = append(p.commentGroups, group)
+
+	return group
+}
+
+// leadingComments takes the comments that come before the current token
+func (p *Parser) leadingComments() *ast.CommentGroup {
+	return p.takeComments(func(c *ast.Comment) bool { return before(c.Token, p.curToken) })
+}
+
+// trailingComments takes the comments that follow the current token on the same line. Comments left inside
+// the statement that just ended are kept in the program but not attached.
+func (p *Parser) trailingComments() *ast.CommentGroup {
+	p.leadingComments()
+
+	return p.takeComments(func(c *ast.Comment) bool { return c.Token.Line == p.curToken.Line })
+}
+
+// attachComments attaches the leading comments and whatever trailing comments follow the statement
+func (p *Parser) attachComments(stmt ast.Statement, leading *ast.CommentGroup) {
+	commented, ok := stmt.(ast.Commented)
+	if !ok {
+		return
+	}
+
+	commented.Comments().Leading = leading
+	commented.Comments().Trailing = p.trailingComments()
+	commented.Comments().Doc = docComments(leading, stmt)
+}
+
+// docComments returns the `///` comments ending the leading comments of the statement, nil if there are none or
+// if a blank line separates them from the statement
+func docComments(leading *ast.CommentGroup, stmt ast.Statement) *ast.CommentGroup {
+	if leading == nil {
+		return nil
+	}
+
+	line := ast.TokenOf(stmt).Line
+	start := len(leading.List)
+	for start > 0 {
+		c := leading.List[start-1]
+		if !strings.HasPrefix(c.Text, "///") || c.Token.Line != line-1 {
+			break
+		}
+		start--
+		line--
+	}
+	if start == len(leading.List) {
+		return nil
+	}
+
+	return &ast.CommentGroup{List: leading.List[start:]}
 }
 
 // curTokenIs returns true if the curToken type is of that token.TokenType passed
@@ -94,55 +275,165 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Literal]; ok {
-		return p
-	}
-
-	return LOWEST
+	return p.Precedence(p.peekToken.Type)
 }
 
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Literal]; ok {
-		return p
-	}
-
-	return LOWEST
+	return p.Precedence(p.curToken.Type)
 }
 
 // peekError appends an error ot the parsers error object.
 func (p *Parser) peekError(t token.TokenType) {
 	if p.peekToken.Type != t {
-		p.errors = append(p.errors, fmt.Sprintf("expected next token to be %s, got %s instead",
-			t, p.peekToken.Type))
+		p.errorAt(p.peekToken, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
 	}
 }
 
 // Errors a helper for extracting all the errors accumulated by the parser during parsing.
 func (p *Parser) Errors() []string {
+	msgs := make([]string, 0, len(p.errors))
+	for _, err := range p.errors {
+		msgs = append(msgs, err.Message)
+	}
+
+	return msgs
+}
+
+// Diagnostics returns the errors accumulated by the parser along with the position they point at.
+func (p *Parser) Diagnostics() []diagnostics.Diagnostic {
 	return p.errors
 }
 
+// Warnings returns the non fatal problems found while parsing, like statements that have no effect, in the
+// order they appear in the source.
+func (p *Parser) Warnings() []diagnostics.Diagnostic {
+	if len(p.warnings)+len(p.programWarns) == 0 {
+		return nil
+	}
+
+	warnings := append(append([]diagnostics.Diagnostic{}, p.warnings...), p.programWarns...)
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Line < warnings[j].Line ||
+			warnings[i].Line == warnings[j].Line && warnings[i].Column < warnings[j].Column
+	})
+
+	return warnings
+}
+
+// noEffectWarnings warns about every expression statement that computes a value nobody can see. The last
+// statement of a block is left alone since its value is the value of the block.
+func noEffectWarnings(stmts []ast.Statement) []diagnostics.Diagnostic {
+	var warnings []diagnostics.Diagnostic
+	for i, stmt := range stmts {
+		exp, ok := stmt.(*ast.ExpressionStatement)
+		if !ok || i == len(stmts)-1 || !isPure(exp.Expression) {
+			continue
+		}
+
+		warnings = append(warnings, diagnostics.WarningAt(exp.Token, "expression statement has no effect"))
+	}
+
+	return warnings
+}
+
+// isPure reports whether evaluating the expression can't do anything but produce a value
+func isPure(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean, *ast.FunctionLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return isPure(exp.Right)
+	case *ast.InfixExpression:
+		return isPure(exp.Left) && isPure(exp.Right)
+	case *ast.IndexExpression:
+		return isPure(exp.Left) && isPure(exp.Index)
+	case *ast.ArrayLiteral:
+		for _, elt := range exp.Elements {
+			if !isPure(elt) {
+				return false
+			}
+		}
+		return true
+	case *ast.HashLiteral:
+		for key, value := range exp.Hash {
+			if !isPure(key) || !isPure(value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
 // ParseProgram iterate through the lexer to produce an AST representation of the code
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{
 		Statements: make([]ast.Statement, 0),
 	}
 
+	p.spans = nil
+	p.parseStatements(program, nil)
+	p.finishProgram(program)
+
+	return program
+}
+
+// parseStatements parses top level statements into the program until the end of the input, or until stop
+// returns true for the offset the next statement starts at. It returns whether it was stopped.
+func (p *Parser) parseStatements(program *ast.Program, stop func(offset int) bool) bool {
 	for !p.curTokenIs(token.EOF) {
+		span := statementSpan{start: p.curToken}
+		if len(p.comments) > 0 && before(p.comments[0].Token, p.curToken) {
+			span.start = p.comments[0].Token
+		}
+
+		if stop != nil && stop(span.start.Offset) {
+			return true
+		}
+
+		leading := p.leadingComments()
 		statement := p.parseStatement()
 		if statement != nil {
+			p.attachComments(statement, leading)
 			program.Statements = append(program.Statements, statement)
+
+			span.end = p.l.Offset()
+			span.next = p.peekToken
+			p.spans = append(p.spans, span)
 		}
 
 		p.nextToken()
 	}
 
-	return program
+	return false
+}
+
+// finishProgram runs the checks that need every top level statement and hands out the comments
+func (p *Parser) finishProgram(program *ast.Program) {
+	p.programWarns = noEffectWarnings(program.Statements)
+
+	// whatever is left did not belong to any statement
+	p.takeComments(func(*ast.Comment) bool { return true })
+	program.Comments = p.commentGroups
+	p.program = program
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	p.errors = append(p.errors,
-		fmt.Sprintf("no prefix parser function for %s found", t))
+	if t == token.ILLEGAL {
+		if strings.HasPrefix(p.curToken.Literal, `"`) {
+			p.errorAt(p.curToken, "string not terminated")
+		} else if strings.HasPrefix(p.curToken.Literal, "/*") {
+			p.errorAt(p.curToken, "comment not terminated")
+		} else if strings.HasPrefix(p.curToken.Literal, `\`) {
+			p.errorAt(p.curToken, "unknown escape sequence %s in string", p.curToken.Literal)
+		} else {
+			p.errorAt(p.curToken, "illegal character %q", p.curToken.Literal)
+		}
+		return
+	}
+
+	p.errorAt(p.curToken, "no prefix parser function for %s found", t)
 }
 
 // Statement Parsers
@@ -163,9 +454,8 @@ func (p *Parser) parseLetStatement() ast.Statement {
 
 	p.nextToken() // move from = to expression
 	stmt.Value = p.parseExpression(LOWEST)
-
-	for p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
+	if stmt.Value == nil || !p.endStatement() {
+		return nil
 	}
 
 	return stmt
@@ -177,14 +467,43 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 
 	p.nextToken() // move from = to expression
 	stmt.ReturnValue = p.parseExpression(LOWEST)
+	if stmt.ReturnValue == nil || !p.endStatement() {
+		return nil
+	}
 
-	for p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
+	return stmt
+}
+
+// parseThrowStatement parses a statement like "throw x;"
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil || !p.endStatement() {
+		return nil
 	}
 
 	return stmt
 }
 
+// parseBranchStatement parses a break or continue statement, which has to be in a loop of the function it is in
+func (p *Parser) parseBranchStatement() ast.Statement {
+	tok := p.curToken
+	if !p.endStatement() {
+		return nil
+	}
+	if p.loops == 0 {
+		p.errorAt(tok, "%s outside of a loop", tok.Literal)
+		return nil
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 // Expression Statement is a something like "5 + 1;", "1 + 1"
 // It's an expression that is placed on its own without a let or return statement (in the case of monkey)
 // but in the general case without a statement.
@@ -192,12 +511,58 @@ func (p *Parser) parseExpressionStatements() ast.Statement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
 	stmt.Expression = p.parseExpression(LOWEST)
+	if stmt.Expression == nil || !p.endStatement() {
+		return nil
+	}
+
+	return stmt
+}
+
+// endStatement consumes the terminator of the statement ending on the current token. The rules are:
+//
+//   - by default a semicolon after a statement is optional, and any number of them may follow it.
+//   - with StrictSemicolons exactly one semicolon has to follow, unless the statement ends with a } (like an if or
+//     a function literal) or is the last one of a block, where its value is the value of the block.
+//
+// It returns false after recording an error.
+func (p *Parser) endStatement() bool {
+	if p.mode&StrictSemicolons == 0 {
+		for p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+
+		return true
+	}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.errorAt(p.peekToken, "unexpected ; after the end of a statement")
+			for p.peekTokenIs(token.SEMICOLON) {
+				p.nextToken()
+			}
+			return false
+		}
+
+		return true
 	}
 
-	return stmt
+	if p.curTokenIs(token.RBRACE) || p.peekTokenIs(token.RBRACE) {
+		return true
+	}
+
+	p.errorAt(p.endOfCurToken(), "expected ; after statement, got %s instead", p.peekToken.Type)
+	return false
+}
+
+// endOfCurToken returns a token positioned right after the current one, where a missing token would have been
+func (p *Parser) endOfCurToken() *token.Token {
+	width := len(p.curToken.Literal)
+	if p.curTokenIs(token.STRING) {
+		width = len(lexer.Quote(p.curToken.Literal)) // the literal is the decoded value, without the quotes
+	}
+
+	return &token.Token{Line: p.curToken.Line, Column: p.curToken.Column + width}
 }
 
 // parseStatement decides which statement parser function to call based on the token type.
@@ -207,6 +572,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseBranchStatement()
 	default:
 		return p.parseExpressionStatements()
 	}
@@ -224,7 +593,18 @@ func (p *Parser) parseIdentifier() ast.Expression {
 }
 
 // parseExpression handles the parsing of any expression. Expression is a statement that produces a value.
+//
+// Like every parse function it returns nil after recording an error, and callers give up on the node they
+// were building when a part of it comes back nil, so the finished tree never has holes in it.
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	p.nesting++
+	defer func() { p.nesting-- }()
+
+	if p.nesting > maxNesting {
+		p.errorAt(p.curToken, "expression nested deeper than %d levels", maxNesting)
+		return nil
+	}
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
@@ -233,7 +613,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 	leftExp := prefix()
 
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for leftExp != nil && !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -256,6 +636,9 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	precedence := p.curPrecedence()
 	p.nextToken()
 	inf.Right = p.parseExpression(precedence)
+	if inf.Right == nil {
+		return nil
+	}
 
 	return inf
 }
@@ -266,7 +649,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	intValue, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
 	if err != nil {
-		p.errors = append(p.errors, fmt.Sprintf("could not parse %q as integer", p.curToken.Literal))
+		p.errorAt(p.curToken, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 
@@ -274,6 +657,20 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return literal
 }
 
+// parseFloatLiteral parses a float literal like "3.14" or "1e-9"
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.errorAt(p.curToken, "could not parse %q as float", p.curToken.Literal)
+		return nil
+	}
+
+	literal.Value = value
+	return literal
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -294,6 +691,10 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	p.nextToken()
 
 	exp.Right = p.parseExpression(PREFIX)
+	if exp.Right == nil {
+		return nil
+	}
+
 	return exp
 }
 
@@ -303,6 +704,9 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 
 	// parse anything
 	exp := p.parseExpression(LOWEST)
+	if exp == nil {
+		return nil
+	}
 	// we expect the last token after parsing everything between the prans to be a right pran. if not then we error
 	if !p.expectPeek(token.RPAREN) {
 		return nil
@@ -320,6 +724,13 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 	p.nextToken()
 	exp.Condition = p.parseExpression(LOWEST)
+	if exp.Condition == nil {
+		return nil
+	}
+
+	if assign, ok := exp.Condition.(*ast.AssignExpression); ok {
+		p.warnings = append(p.warnings, diagnostics.WarningAt(assign.Token, "= in a condition, did you mean ==?"))
+	}
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
@@ -330,6 +741,9 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	}
 
 	exp.Consequence = p.parseBlockStatement()
+	if exp.Consequence == nil {
+		return nil
+	}
 
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
@@ -338,11 +752,160 @@ func (p *Parser) parseIfExpression() ast.Expression {
 		}
 
 		exp.Alternative = p.parseBlockStatement()
+		if exp.Alternative == nil {
+			return nil
+		}
+	}
+
+	return exp
+}
+
+// parseAssignExpression parses the value given to a variable or to a key of a hash, like "x = x + 1" or
+// "h.name = x". Assignments group to the right, so "a = b = 1" gives both the value 1.
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	exp := &ast.AssignExpression{Token: p.curToken, Target: left}
+
+	switch left.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.errorAt(p.curToken, "cannot assign to %s", left.String())
+		return nil
+	}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+	if exp.Value == nil {
+		return nil
+	}
+
+	return exp
+}
+
+// parseTryExpression parses "try { ... } catch (e) { ... } finally { ... }", where either the catch or the
+// finally block can be left out
+func (p *Parser) parseTryExpression() ast.Expression {
+	exp := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	exp.Body = p.parseBlockStatement()
+	if exp.Body == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		exp.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		exp.Catch = p.parseBlockStatement()
+		if exp.Catch == nil {
+			return nil
+		}
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		exp.Finally = p.parseBlockStatement()
+		if exp.Finally == nil {
+			return nil
+		}
+	}
+
+	if exp.Catch == nil && exp.Finally == nil {
+		p.errorAt(exp.Token, "expected catch or finally after try")
+		return nil
 	}
 
 	return exp
 }
 
+// parseForExpression parses a loop like "for (let i = 0; i < 10; i = i + 1) { ... }". Its clauses are read here
+// rather than as statements, as endStatement would take the semicolons of the clauses left out for its own.
+func (p *Parser) parseForExpression() ast.Expression {
+	exp := &ast.ForExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	if !p.curTokenIs(token.SEMICOLON) {
+		exp.Init = p.parseForInit()
+		if exp.Init == nil || !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	if !p.curTokenIs(token.SEMICOLON) {
+		exp.Condition = p.parseExpression(LOWEST)
+		if exp.Condition == nil || !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	if !p.curTokenIs(token.RPAREN) {
+		exp.Post = p.parseExpression(LOWEST)
+		if exp.Post == nil || !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.loops++
+	exp.Body = p.parseBlockStatement()
+	p.loops--
+	if exp.Body == nil {
+		return nil
+	}
+
+	return exp
+}
+
+// parseForInit parses the first clause of a for loop, a let or an expression without its semicolon
+func (p *Parser) parseForInit() ast.Statement {
+	if !p.curTokenIs(token.LET) {
+		stmt := &ast.ExpressionStatement{Token: p.curToken, Expression: p.parseExpression(LOWEST)}
+		if stmt.Expression == nil {
+			return nil
+		}
+
+		return stmt
+	}
+
+	stmt := &ast.LetStatement{Token: p.curToken}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = p.parseIdentifier()
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	program := &ast.BlockStatement{
 		Token:      p.curToken,
@@ -352,34 +915,58 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		leading := p.leadingComments()
 		statement := p.parseStatement()
 		if statement != nil {
+			p.attachComments(statement, leading)
 			program.Statements = append(program.Statements, statement)
 		}
 
 		p.nextToken()
 	}
 
+	if p.curTokenIs(token.EOF) {
+		p.errorAt(p.curToken, "expected } before the end of the input")
+		return nil
+	}
+
+	program.Rbrace = p.curToken
+	p.warnings = append(p.warnings, noEffectWarnings(program.Statements)...)
+
+	// comments right before the closing brace stay in the program without an owner
+	p.leadingComments()
+
 	return program
 
 }
 
+// parseFunctionParameters parses the parameter names up to the closing paren. It returns nil on errors and an
+// empty slice if there are no parameters.
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	var identifiers []*ast.Identifier
+	identifiers := []*ast.Identifier{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
 		return identifiers
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
+		if p.peekTokenIs(token.RPAREN) {
+			// trailing comma
+			break
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		identifiers = append(identifiers, ident)
 	}
@@ -404,13 +991,22 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 
 	// parse what's between ( ..here.. )
 	exp.Parameters = p.parseFunctionParameters()
+	if exp.Parameters == nil {
+		return nil
+	}
 
 	// check that the next token is {
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
-	// parse the body of the function
+	// parse the body of the function, where the loops around the function can't be broken out of
+	loops := p.loops
+	p.loops = 0
 	exp.Body = p.parseBlockStatement()
+	p.loops = loops
+	if exp.Body == nil {
+		return nil
+	}
 
 	// return expression note: the curToken cursor is on }
 	return exp
@@ -423,18 +1019,29 @@ func (p *Parser) parseCallExpression(left ast.Expression) ast.Expression {
 	}
 
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if exp.Arguments == nil {
+		return nil
+	}
+
 	return exp
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
-	return &ast.ArrayLiteral{
+	array := &ast.ArrayLiteral{
 		Token:    p.curToken,
 		Elements: p.parseExpressionList(token.RBRACKET),
 	}
+	if array.Elements == nil {
+		return nil
+	}
+
+	return array
 }
 
+// parseExpressionList parses comma separated expressions up to the end token. It returns nil on errors and an
+// empty slice if the list is empty.
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
-	var exps []ast.Expression
+	exps := []ast.Expression{}
 
 	if p.peekTokenIs(end) {
 		p.nextToken()
@@ -442,12 +1049,25 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	}
 
 	p.nextToken()
-	exps = append(exps, p.parseExpression(LOWEST))
+	exp := p.parseExpression(LOWEST)
+	if exp == nil {
+		return nil
+	}
+	exps = append(exps, exp)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
+		if p.peekTokenIs(end) {
+			// trailing comma
+			break
+		}
+
 		p.nextToken()
-		exps = append(exps, p.parseExpression(LOWEST))
+		exp := p.parseExpression(LOWEST)
+		if exp == nil {
+			return nil
+		}
+		exps = append(exps, exp)
 	}
 
 	if !p.expectPeek(end) {
@@ -461,17 +1081,19 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	index := &ast.IndexExpression{Token: p.curToken, Left: left}
 
 	if p.curTokenIs(token.PERIOD) {
-		if !p.peekTokenIs(token.IDENT) {
+		if !p.expectPeek(token.IDENT) {
 			return nil
 		}
 
-		p.nextToken()
 		index.Index = p.parseIdentifier()
 		return index
 	}
 
 	p.nextToken()
 	index.Index = p.parseExpression(LOWEST)
+	if index.Index == nil {
+		return nil
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
@@ -490,17 +1112,20 @@ func (p *Parser) parseHashExpression() ast.Expression {
 		p.nextToken()
 
 		key := p.parseExpression(LOWEST)
-		if !p.expectPeek(token.COLON) {
+		if key == nil || !p.expectPeek(token.COLON) {
 			return nil
 		}
 		// move over the colon
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
 		hash.Hash[key] = value
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			// if we are not about the end with a } or if there isn't an upcoming element
-			// then there is an error
+			// then there is an error. a comma right before the } is fine, the loop ends on it
 			return nil
 		}
 	}
@@ -513,38 +1138,56 @@ func (p *Parser) parseHashExpression() ast.Expression {
 	return hash
 }
 
+// New creates a parser reading from the lexer in the default, permissive, mode.
 func New(l *lexer.Lexer) *Parser {
+	return NewWithMode(l, 0)
+}
+
+// NewWithMode creates a parser reading from the lexer in the given mode.
+func NewWithMode(l *lexer.Lexer, mode Mode) *Parser {
 	p := &Parser{
 		l:              l,
-		errors:         []string{},
-		prefixParseFns: map[token.TokenType]prefixParseFn{},
-		infixParseFns:  map[token.TokenType]infixParseFn{},
-	}
-
-	p.registerPrefix(token.IDENT, p.parseIdentifier)
-	p.registerPrefix(token.INT, p.parseIntegerLiteral)
-	p.registerPrefix(token.BANG, p.parsePrefixExpression)
-	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
-	p.registerPrefix(token.TRUE, p.parseBoolean)
-	p.registerPrefix(token.FALSE, p.parseBoolean)
-	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
-	p.registerPrefix(token.IF, p.parseIfExpression)
-	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
-	p.registerPrefix(token.STRING, p.parseStringLiteral)
-	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
-	p.registerPrefix(token.LBRACE, p.parseHashExpression)
-
-	p.registerInfix(token.PLUS, p.parseInfixExpression)
-	p.registerInfix(token.MINUS, p.parseInfixExpression)
-	p.registerInfix(token.SLASH, p.parseInfixExpression)
-	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
-	p.registerInfix(token.EQ, p.parseInfixExpression)
-	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
-	p.registerInfix(token.LT, p.parseInfixExpression)
-	p.registerInfix(token.GT, p.parseInfixExpression)
-	p.registerInfix(token.LPAREN, p.parseCallExpression)
-	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
-	p.registerInfix(token.PERIOD, p.parseIndexExpression)
+		mode:           mode,
+		errors:         []diagnostics.Diagnostic{},
+		prefixParseFns: map[token.TokenType]PrefixParseFn{},
+		infixParseFns:  map[token.TokenType]InfixParseFn{},
+		precedences:    map[token.TokenType]int{},
+	}
+
+	for tokenType, precedence := range precedences {
+		p.precedences[tokenType] = precedence
+	}
+
+	p.RegisterPrefix(token.IDENT, p.parseIdentifier)
+	p.RegisterPrefix(token.INT, p.parseIntegerLiteral)
+	p.RegisterPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.RegisterPrefix(token.BANG, p.parsePrefixExpression)
+	p.RegisterPrefix(token.MINUS, p.parsePrefixExpression)
+	p.RegisterPrefix(token.TRUE, p.parseBoolean)
+	p.RegisterPrefix(token.FALSE, p.parseBoolean)
+	p.RegisterPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.RegisterPrefix(token.IF, p.parseIfExpression)
+	p.RegisterPrefix(token.FOR, p.parseForExpression)
+	p.RegisterPrefix(token.TRY, p.parseTryExpression)
+	p.RegisterPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.RegisterPrefix(token.STRING, p.parseStringLiteral)
+	p.RegisterPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.RegisterPrefix(token.LBRACE, p.parseHashExpression)
+
+	p.RegisterInfix(token.ASSIGN, p.parseAssignExpression)
+	p.RegisterInfix(token.PLUS, p.parseInfixExpression)
+	p.RegisterInfix(token.MINUS, p.parseInfixExpression)
+	p.RegisterInfix(token.SLASH, p.parseInfixExpression)
+	p.RegisterInfix(token.ASTERISK, p.parseInfixExpression)
+	p.RegisterInfix(token.AND, p.parseInfixExpression)
+	p.RegisterInfix(token.OR, p.parseInfixExpression)
+	p.RegisterInfix(token.EQ, p.parseInfixExpression)
+	p.RegisterInfix(token.NOT_EQ, p.parseInfixExpression)
+	p.RegisterInfix(token.LT, p.parseInfixExpression)
+	p.RegisterInfix(token.GT, p.parseInfixExpression)
+	p.RegisterInfix(token.LPAREN, p.parseCallExpression)
+	p.RegisterInfix(token.LBRACKET, p.parseIndexExpression)
+	p.RegisterInfix(token.PERIOD, p.parseIndexExpression)
 
 	p.nextToken()
 	p.nextToken()
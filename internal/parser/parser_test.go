@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"monkey/internal/ast"
+	"monkey/internal/diagnostics"
 	"monkey/internal/lexer"
+	"monkey/internal/token"
+	"strings"
 	"testing"
 )
 
@@ -452,6 +455,15 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"-a.b.c * f(x).y[0]", "((-((a.b).c)) * ((f(x).y)[0]))"},
+		{"a = b = 1 + 2", "(a = (b = (1 + 2)))"},
+		{"h.x.y = h[k] = 1", "(((h.x).y) = ((h[k]) = 1))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c", "((a && b) || c)"},
+		{"a == 1 && !b || c < 2", "(((a == 1) && (!b)) || (c < 2))"},
+		{"x = a || b", "(x = (a || b))"},
+		{"a = b == c", "(a = (b == c))"},
+		{"f(a = 1)", "f((a = 1))"},
 	}
 
 	for _, tt := range tests {
@@ -511,6 +523,81 @@ func TestIfExpression(t *testing.T) {
 		t.Errorf("exp.Alternative.Statements was not nil. got=%+v", exp.Alternative)
 	}
 }
+func TestForExpression(t *testing.T) {
+	tests := []struct {
+		input     string
+		init      string
+		condition string
+		post      string
+	}{
+		{"for (let i = 0; i < 10; i = i + 1) { puts(i) }", "let i = 0;", "(i < 10)", "(i = (i + 1))"},
+		{"for (i = 0; i < 10;) { puts(i) }", "(i = 0)", "(i < 10)", ""},
+		{"for (;;) { puts(i) }", "", "", ""},
+		{"for (;;) { if (i) { break; }; puts(i) }", "", "", ""},
+		{"for (;;) { if (i) { continue }; puts(i) }", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if !assert.Len(t, program.Statements, 1, tt.input) {
+			continue
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !assert.True(t, ok, tt.input) {
+			continue
+		}
+		exp, ok := stmt.Expression.(*ast.ForExpression)
+		if !assert.True(t, ok, "%s: got %T", tt.input, stmt.Expression) {
+			continue
+		}
+
+		str := func(node ast.Node) string {
+			if node == nil {
+				return ""
+			}
+			return node.String()
+		}
+		assert.Equal(t, tt.init, str(exp.Init), tt.input)
+		assert.Equal(t, tt.condition, str(exp.Condition), tt.input)
+		assert.Equal(t, tt.post, str(exp.Post), tt.input)
+		assert.Equal(t, "puts(i)", exp.Body.Statements[len(exp.Body.Statements)-1].String(), tt.input)
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() } catch (e) { puts(e) }", "try f() catch (e) puts(e)"},
+		{"try { f() } finally { g() }", "try f() finally g()"},
+		{"try { throw 1 + 2; } catch (e) { e } finally { g() }", "try throw (1 + 2); catch (e) e finally g()"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if !assert.Len(t, program.Statements, 1, tt.input) {
+			continue
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !assert.True(t, ok, tt.input) {
+			continue
+		}
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !assert.True(t, ok, "%s: got %T", tt.input, stmt.Expression) {
+			continue
+		}
+		assert.Equal(t, tt.expected, exp.String())
+		assert.Equal(t, exp.Catch == nil, exp.Param == nil, tt.input)
+	}
+}
+
 func TestIfElseExpression(t *testing.T) {
 	input := `if (x < y) { x } else { y }`
 
@@ -748,6 +835,35 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestFloatLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E+3", 2500},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !assert.True(t, ok, "%s: got %T", tt.input, stmt.Expression) {
+			continue
+		}
+		assert.Equal(t, tt.expected, literal.Value, tt.input)
+		assert.Equal(t, tt.input, literal.String())
+	}
+
+	p := New(lexer.New("1e999"))
+	p.ParseProgram()
+	assert.Equal(t, []string{`could not parse "1e999" as float`}, p.Errors())
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"hello world!"`
 
@@ -814,7 +930,7 @@ func TestParsingIndexExpression(t *testing.T) {
 		t.Errorf("expected expression to be of type *ast.IndexExpression. got=%T", stmt.Expression)
 	}
 
-	if !testIdentifier(t, indexExp, "myArray") {
+	if !testIdentifier(t, indexExp.Left, "myArray") {
 		return
 	}
 
@@ -851,3 +967,424 @@ func TestParsingHashExpression(t *testing.T) {
 
 	// todo circle back to these test.
 }
+
+func TestCommentAttachment(t *testing.T) {
+	input := `// the answer
+// to everything
+let answer = 42; // not 41
+
+let f = fn() {
+	// inside
+	return answer; // done
+	// dangling
+};
+answer
+// eof`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected program.Statements length 3. got=%d", len(program.Statements))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	if let.Leading.Text() != "the answer\nto everything" {
+		t.Errorf("wrong leading comments. got=%q", let.Leading.Text())
+	}
+	if let.Trailing.Text() != "not 41" {
+		t.Errorf("wrong trailing comments. got=%q", let.Trailing.Text())
+	}
+
+	fn := program.Statements[1].(*ast.LetStatement)
+	if fn.Leading != nil || fn.Trailing != nil {
+		t.Errorf("expected no comments on second let. got=%+v", fn.CommentAttachment)
+	}
+
+	body := fn.Value.(*ast.FunctionLiteral).Body
+	ret := body.Statements[0].(*ast.ReturnStatement)
+	if ret.Leading.Text() != "inside" || ret.Trailing.Text() != "done" {
+		t.Errorf("wrong comments on return. got=%q and %q", ret.Leading.Text(), ret.Trailing.Text())
+	}
+
+	last := program.Statements[2].(*ast.ExpressionStatement)
+	if last.Leading != nil || last.Trailing != nil {
+		t.Errorf("expected no comments on last statement. got=%+v", last.CommentAttachment)
+	}
+
+	var all []string
+	for _, group := range program.Comments {
+		all = append(all, group.Text())
+	}
+	expected := []string{"the answer\nto everything", "not 41", "inside", "done", "dangling", "eof"}
+	assert.Equal(t, expected, all)
+}
+
+func TestDocComments(t *testing.T) {
+	input := `// not documentation
+/// add returns the sum
+/// of a and b.
+let add = fn(a, b) { a + b };
+
+/// separated from the let by a blank line
+
+let one = 1;
+/// one line
+let two = 2;`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tests := []struct {
+		doc     string
+		leading string
+	}{
+		{"add returns the sum\nof a and b.", "not documentation\nadd returns the sum\nof a and b."},
+		{"", "separated from the let by a blank line"},
+		{"one line", "one line"},
+	}
+	for i, tt := range tests {
+		let := program.Statements[i].(*ast.LetStatement)
+		if let.Doc.Text() != tt.doc {
+			t.Errorf("wrong doc of statement %d. expected=%q, got=%q", i, tt.doc, let.Doc.Text())
+		}
+		if let.Leading.Text() != tt.leading {
+			t.Errorf("wrong leading comments of statement %d. expected=%q, got=%q", i, tt.leading, let.Leading.Text())
+		}
+	}
+}
+func TestTrailingCommas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3,]", "[1, 2, 3]"},
+		{"[1,]", "[1]"},
+		{"f(a, b,)", "f(a, b)"},
+		{`{"a": 1,}`, `{a: 1}`},
+		{"fn(a, b,) { a }", "fn(a, b)a"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	for _, input := range []string{"[,]", "f(,)", "[1,,]", `{,}`} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestCustomParselets(t *testing.T) {
+	p := New(lexer.New(`*x + 1; 2 / double / triple`))
+
+	// `*x` becomes `deref(x)`
+	p.RegisterPrefix(token.ASTERISK, func() ast.Expression {
+		call := &ast.CallExpression{
+			Token:    p.CurToken(),
+			Function: &ast.Identifier{Token: p.CurToken(), Value: "deref"},
+		}
+		p.NextToken()
+		call.Arguments = []ast.Expression{p.ParseExpression(PREFIX)}
+		return call
+	})
+
+	// `a / f` pipes a into f and binds looser than a sum
+	p.SetPrecedence(token.SLASH, LESSGREATER)
+	p.RegisterInfix(token.SLASH, func(left ast.Expression) ast.Expression {
+		call := &ast.CallExpression{Token: p.CurToken(), Arguments: []ast.Expression{left}}
+		precedence := p.Precedence(p.CurToken().Type)
+		p.NextToken()
+		call.Function = p.ParseExpression(precedence)
+		return call
+	})
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := "(deref(x) + 1)triple(double(2))"
+	if program.String() != expected {
+		t.Errorf("wrong program. expected=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestMalformedInputDoesNotPanic(t *testing.T) {
+	inputs := []string{
+		"a.",
+		"a.1",
+		"a[",
+		"a[]",
+		"{1: }",
+		"{: 1}",
+		"fn(1) {}",
+		"fn(a, ) {",
+		"if (x) { 1",
+		"if (x",
+		"let x = ;",
+		"return",
+		"-",
+		"f(1, ",
+		strings.Repeat("(", maxNesting+10),
+	}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+
+		// a tree with holes in it would panic here
+		_ = program.String()
+	}
+}
+
+func FuzzParseProgram(f *testing.F) {
+	seeds := []string{
+		"let x = 5; x * 2;",
+		"let add = fn(a, b) { return a + b; }; add(1, 2)",
+		`{"a": [1, 2, 3,], true: fn() {}}["a"][0]`,
+		"if (1 < 2) { 10 } else { 20 } // done",
+		"h.key; h[1 + 1]",
+		"!-a / (b * c) == d != e",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if program == nil {
+			t.Fatalf("ParseProgram() returned nil for %q", input)
+		}
+
+		_ = program.String()
+	})
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []diagnostics.Diagnostic
+	}{
+		{"let x = (1 + 2;", []diagnostics.Diagnostic{
+			{Line: 1, Column: 15, Message: "expected next token to be ), got ; instead"},
+			{Line: 1, Column: 15, Message: "no prefix parser function for ; found"},
+		}},
+		{"let a = 1;\nlet = 2;", []diagnostics.Diagnostic{
+			{Line: 2, Column: 5, Message: "expected next token to be IDENT, got = instead"},
+			{Line: 2, Column: 5, Message: "no prefix parser function for = found"},
+		}},
+		{"if (x) {\n  1", []diagnostics.Diagnostic{
+			{Line: 2, Column: 4, Message: "expected } before the end of the input"},
+		}},
+		{"let a = 1;\n  let b = a @ 2;", []diagnostics.Diagnostic{
+			{Line: 2, Column: 13, Message: `illegal character "@"`},
+		}},
+		{"let a = 1;\nlet s = \"ab\n", []diagnostics.Diagnostic{
+			{Line: 2, Column: 9, Message: "string not terminated"},
+		}},
+		{`let s = "a\qb"`, []diagnostics.Diagnostic{
+			{Line: 1, Column: 11, Message: `unknown escape sequence \q in string`},
+		}},
+		{"let a = 1; /* a\n", []diagnostics.Diagnostic{
+			{Line: 1, Column: 12, Message: "comment not terminated"},
+		}},
+		{"f() = 2", []diagnostics.Diagnostic{
+			{Line: 1, Column: 5, Message: "cannot assign to f()"},
+		}},
+		{"a + 1 = 2", []diagnostics.Diagnostic{
+			{Line: 1, Column: 7, Message: "cannot assign to (a + 1)"},
+		}},
+		{"for (let i = 0, i < 3) {}", []diagnostics.Diagnostic{
+			{Line: 1, Column: 15, Message: "expected next token to be ;, got , instead"},
+			{Line: 1, Column: 15, Message: "no prefix parser function for , found"},
+			{Line: 1, Column: 22, Message: "no prefix parser function for ) found"},
+		}},
+		{"for (;;) 1", []diagnostics.Diagnostic{
+			{Line: 1, Column: 10, Message: "expected next token to be {, got INT instead"},
+		}},
+		{"let a = 1;\nbreak;", []diagnostics.Diagnostic{
+			{Line: 2, Column: 1, Message: "break outside of a loop"},
+		}},
+		{"for (;;) { let f = fn() { continue }; break }", []diagnostics.Diagnostic{
+			{Line: 1, Column: 27, Message: "continue outside of a loop"},
+		}},
+		{"try { 1 }", []diagnostics.Diagnostic{
+			{Line: 1, Column: 1, Message: "expected catch or finally after try"},
+		}},
+		{"try { 1 } catch (e)", []diagnostics.Diagnostic{
+			{Line: 1, Column: 20, Message: "expected next token to be {, got EOF instead"},
+		}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		assert.Equal(t, tt.expected, p.Diagnostics(), tt.input)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []diagnostics.Diagnostic
+	}{
+		{"let a = 1; a + 1; a", []diagnostics.Diagnostic{
+			{Line: 1, Column: 12, Message: "expression statement has no effect", Severity: diagnostics.Warning},
+		}},
+		{"f(1); [1, g()]; 5", nil},
+		{"fn() {\n  1;\n  2\n}", []diagnostics.Diagnostic{
+			{Line: 2, Column: 3, Message: "expression statement has no effect", Severity: diagnostics.Warning},
+		}},
+		{"if (a = 1) { 2 }", []diagnostics.Diagnostic{
+			{Line: 1, Column: 7, Message: "= in a condition, did you mean ==?", Severity: diagnostics.Warning},
+		}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		assert.Equal(t, tt.expected, p.Warnings(), tt.input)
+	}
+
+	p := New(lexer.New("1; 2"))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+func TestSemicolonModes(t *testing.T) {
+	inputs := []string{
+		"let a = 1; let b = 2;",
+		"let a = 1;;; a;",
+		"if (a) { 1 } else { 2 }\nlet f = fn() { return 1; }\nf();",
+		"let f = fn(x) { let y = x; y }; f(1);",
+		`puts("a");`,
+	}
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		checkParserErrors(t, p)
+	}
+
+	tests := []struct {
+		input    string
+		expected []diagnostics.Diagnostic
+	}{
+		{"let a = 1; let b = 2;", []diagnostics.Diagnostic{}},
+		{"let f = fn(x) { let y = x; y }; if (f(1)) { 1 }", []diagnostics.Diagnostic{}},
+		{"let a = 1\nlet b = 2;", []diagnostics.Diagnostic{
+			{Line: 1, Column: 10, Message: "expected ; after statement, got LET instead"},
+		}},
+		{`puts("a")`, []diagnostics.Diagnostic{
+			{Line: 1, Column: 10, Message: "expected ; after statement, got EOF instead"},
+		}},
+		{"return 1;;", []diagnostics.Diagnostic{
+			{Line: 1, Column: 10, Message: "unexpected ; after the end of a statement"},
+		}},
+	}
+
+	for _, tt := range tests {
+		p := NewWithMode(lexer.New(tt.input), StrictSemicolons)
+		p.ParseProgram()
+		assert.Equal(t, tt.expected, p.Diagnostics(), tt.input)
+	}
+}
+
+func TestReparse(t *testing.T) {
+	source := `let a = 1;
+let b = a + 1; // b
+
+// doubles x
+let c = fn(x) {
+  x * 2
+};
+c(b);
+`
+	tests := []struct {
+		name     string
+		edit     Edit
+		reused   []int // statements of the old program that have to be in the new one
+		expected []int // where they end up
+	}{
+		{"change a literal", Edit{Offset: strings.Index(source, "+ 1") + 2, Length: 1, Text: "10"}, []int{0, 2, 3}, []int{0, 2, 3}},
+		{"insert a statement", Edit{Offset: strings.Index(source, "\n// doubles"), Text: "let z = 3;\n"}, []int{0, 2, 3}, []int{0, 3, 4}},
+		{"delete a statement", Edit{Offset: strings.Index(source, "let b"), Length: len("let b = a + 1; // b\n")}, []int{2, 3}, []int{1, 2}},
+		{"edit the first line", Edit{Offset: 4, Length: 1, Text: "aa"}, []int{1, 2, 3}, []int{1, 2, 3}},
+		{"append at the end", Edit{Offset: len(source), Text: "c(a)"}, []int{0, 1, 2}, []int{0, 1, 2}},
+		{"edit inside a function", Edit{Offset: strings.Index(source, "* 2"), Length: 1, Text: "+"}, []int{0, 1, 3}, []int{0, 1, 3}},
+		{"break the next statement", Edit{Offset: strings.Index(source, ";\nlet b"), Length: 2, Text: " +"}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(source))
+			old := p.ParseProgram()
+			checkParserErrors(t, p)
+			oldStatements := append([]ast.Statement{}, old.Statements...)
+
+			newSource := source[:tt.edit.Offset] + tt.edit.Text + source[tt.edit.Offset+tt.edit.Length:]
+			program := p.Reparse(old, tt.edit)
+
+			full := New(lexer.New(newSource))
+			expected := full.ParseProgram()
+
+			assert.Equal(t, full.Errors(), p.Errors())
+			assert.Equal(t, full.Warnings(), p.Warnings())
+			assert.Equal(t, expected.String(), program.String())
+			assert.Equal(t, len(expected.Statements), len(program.Statements))
+			for i, stmt := range expected.Statements {
+				tokens := map[*token.Token]bool{}
+				tokensOf(stmt, tokens)
+				reparsed := map[*token.Token]bool{}
+				tokensOf(program.Statements[i], reparsed)
+
+				var want, got []token.Token
+				for tok := range tokens {
+					want = append(want, *tok)
+				}
+				for tok := range reparsed {
+					got = append(got, *tok)
+				}
+				assert.ElementsMatch(t, want, got, "tokens of statement %d", i)
+			}
+
+			var comments, expectedComments []token.Token
+			for _, group := range program.Comments {
+				for _, c := range group.List {
+					comments = append(comments, *c.Token)
+				}
+			}
+			for _, group := range expected.Comments {
+				for _, c := range group.List {
+					expectedComments = append(expectedComments, *c.Token)
+				}
+			}
+			assert.Equal(t, expectedComments, comments)
+
+			for i, idx := range tt.reused {
+				if program.Statements[tt.expected[i]] != oldStatements[idx] {
+					t.Errorf("statement %d was not reused", idx)
+				}
+			}
+
+			// reparsing the result again keeps working off the new source
+			again := p.Reparse(program, Edit{Offset: 0, Text: "// top\n"})
+			assert.Equal(t, New(lexer.New("// top\n"+newSource)).ParseProgram().String(), again.String())
+		})
+	}
+}
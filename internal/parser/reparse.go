@@ -0,0 +1,194 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/internal/ast"
+	"monkey/internal/diagnostics"
+	"monkey/internal/lexer"
+	"monkey/internal/token"
+	"strings"
+)
+
+type (
+	// Edit describes a change to the source of a program: the Length bytes at Offset were replaced by Text.
+	Edit struct {
+		Offset int
+		Length int
+		Text   string
+	}
+
+	// statementSpan records where a top level statement was read from
+	statementSpan struct {
+		start *token.Token // first token of the statement, or of the comments leading it
+		end   int          // offset right after the last character read while parsing the statement
+		next  *token.Token // the token following the statement
+	}
+)
+
+// Reparse returns the program for the source p last parsed with the edit applied. old has to be the program
+// returned by the last ParseProgram or Reparse call on p.
+//
+// Only part of the source is parsed again: statements the parser was done with before reaching the edit are
+// reused as they are, and statements after the edit that still start where they used to are reused with their
+// positions moved. The tokens of those are updated in place, so old must not be used afterwards. If the last
+// parse had errors, or old isn't the last program, the whole source is parsed again.
+func (p *Parser) Reparse(old *ast.Program, edit Edit) *ast.Program {
+	oldSource := p.l.Input()
+	if edit.Offset < 0 || edit.Length < 0 || edit.Offset+edit.Length > len(oldSource) {
+		panic(fmt.Sprintf("parser: edit [%d, %d) out of range of the %d byte source",
+			edit.Offset, edit.Offset+edit.Length, len(oldSource)))
+	}
+
+	source := oldSource[:edit.Offset] + edit.Text + oldSource[edit.Offset+edit.Length:]
+	if old == nil || old != p.program || len(p.errors) > 0 {
+		p.reset(lexer.New(source))
+		return p.ParseProgram()
+	}
+
+	editEnd := edit.Offset + edit.Length
+	delta := len(edit.Text) - edit.Length
+	lineDelta := strings.Count(edit.Text, "\n") - strings.Count(oldSource[edit.Offset:editEnd], "\n")
+	editEndLine := 1 + strings.Count(oldSource[:editEnd], "\n")
+
+	// statements the parser was done with before reaching the edit are kept as they are
+	keep := 0
+	for keep < len(p.spans) && p.spans[keep].end < edit.Offset {
+		keep++
+	}
+
+	// the rest is parsed again starting where the first statement that isn't kept starts
+	resume := &token.Token{Line: 1, Column: 1}
+	if keep > 0 && keep < len(p.spans) {
+		resume = p.spans[keep].start
+	} else if keep > 0 {
+		resume = p.spans[keep-1].next
+	}
+	if resume.Offset > edit.Offset {
+		keep, resume = 0, &token.Token{Line: 1, Column: 1}
+	}
+
+	// statements starting on a line after the edit can be picked up again once the parser gets back to them
+	suffix := map[int]int{}
+	for j := keep; j < len(p.spans); j++ {
+		if start := p.spans[j].start; start.Offset > editEnd && start.Line > editEndLine {
+			suffix[start.Offset+delta] = j
+		}
+	}
+
+	oldSpans, oldWarnings, oldGroups := p.spans, p.warnings, old.Comments
+	program := &ast.Program{Statements: append([]ast.Statement{}, old.Statements[:keep]...)}
+
+	p.reset(lexer.NewAt(source, resume.Offset, resume.Line, resume.Column))
+	p.spans = append([]statementSpan{}, oldSpans[:keep]...)
+	p.warnings = filterDiagnostics(oldWarnings, func(d diagnostics.Diagnostic) bool { return beforeToken(d, resume) })
+	for _, group := range oldGroups {
+		if group.List[0].Token.Offset < resume.Offset {
+			p.commentGroups = append(p.commentGroups, group)
+		}
+	}
+
+	stopAt := 0
+	stopped := p.parseStatements(program, func(offset int) bool {
+		stopAt = offset
+		_, ok := suffix[offset]
+		return ok
+	})
+
+	if stopped {
+		j := suffix[stopAt]
+		from := oldSpans[j].start
+
+		moved := map[*token.Token]bool{}
+		for _, stmt := range old.Statements[j:] {
+			tokensOf(stmt, moved)
+		}
+		for _, span := range oldSpans[j:] {
+			moved[span.start] = true
+			moved[span.next] = true
+		}
+
+		var groups []*ast.CommentGroup
+		for _, group := range oldGroups {
+			if group.List[0].Token.Offset >= from.Offset {
+				groups = append(groups, group)
+				for _, c := range group.List {
+					moved[c.Token] = true
+				}
+			}
+		}
+
+		warnings := filterDiagnostics(oldWarnings, func(d diagnostics.Diagnostic) bool { return !beforeToken(d, from) })
+		for i := range warnings {
+			warnings[i].Line += lineDelta
+		}
+
+		for tok := range moved {
+			tok.Offset += delta
+			tok.Line += lineDelta
+		}
+
+		for _, span := range oldSpans[j:] {
+			span.end += delta
+			p.spans = append(p.spans, span)
+		}
+
+		// the comments read ahead of the stop belong to the statements picked up again
+		p.comments = nil
+		program.Statements = append(program.Statements, old.Statements[j:]...)
+		p.commentGroups = append(p.commentGroups, groups...)
+		p.warnings = append(p.warnings, warnings...)
+	}
+
+	p.finishProgram(program)
+
+	return program
+}
+
+// reset makes the parser read from the lexer as if it was just created, keeping its mode and parse functions
+func (p *Parser) reset(l *lexer.Lexer) {
+	p.l = l
+	p.errors = []diagnostics.Diagnostic{}
+	p.warnings = nil
+	p.programWarns = nil
+	p.comments = nil
+	p.commentGroups = nil
+	p.spans = nil
+	p.nesting = 0
+	p.curToken = nil
+	p.peekToken = nil
+
+	p.nextToken()
+	p.nextToken()
+}
+
+// beforeToken reports whether the diagnostic points before the token
+func beforeToken(d diagnostics.Diagnostic, tok *token.Token) bool {
+	return d.Line < tok.Line || d.Line == tok.Line && d.Column < tok.Column
+}
+
+// filterDiagnostics returns a new slice with the diagnostics accepted by keep
+func filterDiagnostics(ds []diagnostics.Diagnostic, keep func(diagnostics.Diagnostic) bool) []diagnostics.Diagnostic {
+	var kept []diagnostics.Diagnostic
+	for _, d := range ds {
+		if keep(d) {
+			kept = append(kept, d)
+		}
+	}
+
+	return kept
+}
+
+// tokensOf adds every token the node and its children point to to the set, the closing braces of blocks included.
+// Nodes often share a token with their first child, which is why this collects into a set.
+func tokensOf(node ast.Node, set map[*token.Token]bool) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		if tok := ast.TokenOf(n); tok != nil {
+			set[tok] = true
+		}
+		if block, ok := n.(*ast.BlockStatement); ok && block.Rbrace != nil {
+			set[block.Rbrace] = true
+		}
+
+		return true
+	})
+}
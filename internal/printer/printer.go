@@ -0,0 +1,469 @@
+// Package printer prints syntax trees back out as Monkey source in a single canonical style: one statement per
+// line, blocks indented with tabs, operators surrounded by spaces and only the parentheses the parser needs.
+package printer
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"monkey/internal/ast"
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"monkey/internal/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// atom is the precedence of expressions that never need parentheses, like literals and identifiers
+const atom = parser.INDEX + 1
+
+type printer struct {
+	out         bytes.Buffer
+	indent      int
+	atLineStart bool
+	dangling    []*ast.CommentGroup // comments not attached to a statement that are still to be printed
+}
+
+// Fprint writes the node as Monkey source to w. Comments are printed along with the statements they are attached
+// to, and for a Program, the comments that aren't attached to anything are printed where they were found.
+func Fprint(w io.Writer, node ast.Node) error {
+	p := &printer{atLineStart: true}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		p.dangling = danglingComments(node)
+		p.statements(node.Statements, false, nil)
+	case ast.Statement:
+		p.statement(node)
+	case ast.Expression:
+		p.expression(node, parser.LOWEST)
+	}
+
+	_, err := w.Write(p.out.Bytes())
+	return err
+}
+
+// Sprint returns the node as Monkey source, see Fprint.
+func Sprint(node ast.Node) string {
+	var out strings.Builder
+	Fprint(&out, node)
+	return out.String()
+}
+
+// danglingComments returns the comment groups of the program that aren't attached to a statement
+func danglingComments(program *ast.Program) []*ast.CommentGroup {
+	attached := map[*ast.CommentGroup]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if commented, ok := node.(ast.Commented); ok {
+			attached[commented.Comments().Leading] = true
+			attached[commented.Comments().Trailing] = true
+		}
+		return true
+	})
+
+	var dangling []*ast.CommentGroup
+	for _, group := range program.Comments {
+		if !attached[group] && len(group.List) > 0 {
+			dangling = append(dangling, group)
+		}
+	}
+
+	sort.SliceStable(dangling, func(i, j int) bool {
+		return dangling[i].List[0].Token.Offset < dangling[j].List[0].Token.Offset
+	})
+
+	return dangling
+}
+
+func (p *printer) write(s string) {
+	if p.atLineStart && s != "" {
+		p.out.WriteString(strings.Repeat("\t", p.indent))
+		p.atLineStart = false
+	}
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.out.WriteString("\n")
+	p.atLineStart = true
+}
+
+// statements prints the statements one per line, keeping single blank lines that separated them in the source.
+// In a block the last expression statement is the value of the block, which is printed without a semicolon.
+func (p *printer) statements(stmts []ast.Statement, block bool, rbrace *token.Token) {
+	lastLine := 0
+	for i, stmt := range stmts {
+		lastLine = p.danglingBefore(startOffset(stmt), lastLine)
+
+		if lastLine > 0 && startLine(stmt)-lastLine > 1 {
+			p.newline()
+		}
+
+		var next ast.Statement
+		if i+1 < len(stmts) {
+			next = stmts[i+1]
+		}
+
+		p.leadingComments(stmt)
+		p.statement(stmt)
+		if needsSemicolon(stmt, next, block) {
+			p.write(";")
+		}
+		p.trailingComments(stmt)
+		p.newline()
+
+		lastLine = endLine(stmt)
+	}
+
+	if rbrace != nil {
+		p.danglingBefore(rbrace.Offset, lastLine)
+	} else if !block {
+		p.danglingBefore(-1, lastLine)
+	}
+}
+
+// danglingBefore prints the unattached comments found before offset, all of them if offset is negative. It
+// returns the line the last thing printed ended on.
+func (p *printer) danglingBefore(offset, lastLine int) int {
+	for len(p.dangling) > 0 {
+		group := p.dangling[0]
+		first, last := group.List[0].Token, group.List[len(group.List)-1]
+		if offset >= 0 && first.Offset >= offset {
+			break
+		}
+
+		if lastLine > 0 && first.Line-lastLine > 1 {
+			p.newline()
+		}
+		p.commentLines(group)
+
+		p.dangling = p.dangling[1:]
+		lastLine = commentEnd(last)
+	}
+
+	return lastLine
+}
+
+// commentLines prints the comments one per line, keeping single blank lines that separated them in the source
+func (p *printer) commentLines(group *ast.CommentGroup) {
+	for i, c := range group.List {
+		if i > 0 && c.Token.Line-commentEnd(group.List[i-1]) > 1 {
+			p.newline()
+		}
+		p.write(c.Text)
+		p.newline()
+	}
+}
+
+// commentEnd returns the line the comment ends on, further down than the one it starts on for a block comment
+// spanning lines
+func commentEnd(c *ast.Comment) int {
+	return c.Token.Line + strings.Count(c.Text, "\n")
+}
+
+func (p *printer) leadingComments(stmt ast.Statement) {
+	commented, ok := stmt.(ast.Commented)
+	if !ok || commented.Comments().Leading == nil {
+		return
+	}
+
+	leading := commented.Comments().Leading
+	p.commentLines(leading)
+	if tok := ast.TokenOf(stmt); tok != nil && tok.Line-commentEnd(leading.List[len(leading.List)-1]) > 1 {
+		p.newline()
+	}
+}
+
+func (p *printer) trailingComments(stmt ast.Statement) {
+	commented, ok := stmt.(ast.Commented)
+	if !ok || commented.Comments().Trailing == nil {
+		return
+	}
+
+	for _, c := range commented.Comments().Trailing.List {
+		p.write(" " + c.Text)
+	}
+}
+
+// needsSemicolon decides on the terminator of a statement. Statements ending with a block, like an if, and the
+// value of a block go without one, unless the next statement would otherwise be read as continuing the
+// expression, like "(a)" after an if would turn into a call.
+func needsSemicolon(stmt, next ast.Statement, block bool) bool {
+	exp, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return true
+	}
+
+	if next == nil {
+		return !block && !endsWithBlock(exp.Expression)
+	}
+
+	if !endsWithBlock(exp.Expression) {
+		return true
+	}
+
+	// the next statement must not look like the rest of this one
+	first := Sprint(next)
+	return first != "" && parser.DefaultPrecedence(token.TokenType(first[:1])) > parser.LOWEST
+}
+
+func endsWithBlock(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IfExpression, *ast.ForExpression, *ast.TryExpression:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let ")
+		p.expression(stmt.Name, parser.LOWEST)
+		p.write(" = ")
+		p.expression(stmt.Value, parser.LOWEST)
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(stmt.ReturnValue, parser.LOWEST)
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(stmt.Value, parser.LOWEST)
+	case *ast.BreakStatement:
+		p.write("break")
+	case *ast.ContinueStatement:
+		p.write("continue")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, parser.LOWEST)
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 && !hasDanglingBefore(p.dangling, block.Rbrace) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	p.newline()
+	p.indent++
+	p.statements(block.Statements, true, block.Rbrace)
+	p.indent--
+	p.write("}")
+}
+
+func hasDanglingBefore(dangling []*ast.CommentGroup, rbrace *token.Token) bool {
+	return rbrace != nil && len(dangling) > 0 && dangling[0].List[0].Token.Offset < rbrace.Offset
+}
+
+// precedence returns how tightly the expression binds as printed. Calls and index expressions chain with each
+// other, so both take anything binding at least as tightly as a call on their left.
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.InfixExpression:
+		return parser.DefaultPrecedence(token.TokenType(exp.Operator))
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression:
+		return parser.INDEX
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.IntegerLiteral:
+		if exp.Value < 0 {
+			return parser.PREFIX // prints as "-5", which reads back as a prefix expression
+		}
+		return atom
+	case *ast.FloatLiteral:
+		if math.Signbit(exp.Value) {
+			return parser.PREFIX // like a negative integer, -0.0 included
+		}
+		return atom
+	default:
+		return atom
+	}
+}
+
+// expression prints the expression, in parentheses if it binds looser than the surrounding expression requires
+func (p *printer) expression(exp ast.Expression, min int) {
+	if precedence(exp) < min {
+		p.write("(")
+		defer p.write(")")
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+	case *ast.IntegerLiteral:
+		p.write(strconv.FormatInt(exp.Value, 10))
+	case *ast.FloatLiteral:
+		p.write(formatFloat(exp.Value))
+	case *ast.StringLiteral:
+		p.write(lexer.Quote(exp.Value))
+	case *ast.Boolean:
+		p.write(strconv.FormatBool(exp.Value))
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		p.expression(exp.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		// operators are left associative, so the right hand side needs parentheses at the same precedence
+		prec := precedence(exp)
+		p.expression(exp.Left, prec)
+		p.write(" " + exp.Operator + " ")
+		p.expression(exp.Right, prec+1)
+	case *ast.CallExpression:
+		p.expression(exp.Function, parser.CALL)
+		p.write("(")
+		p.expressionList(exp.Arguments)
+		p.write(")")
+	case *ast.IndexExpression:
+		p.expression(exp.Left, parser.CALL)
+		if ident, ok := exp.Index.(*ast.Identifier); ok && exp.Token != nil && exp.Token.Type == token.PERIOD {
+			p.write("." + ident.Value)
+			return
+		}
+		p.write("[")
+		p.expression(exp.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.expressionList(exp.Elements)
+		p.write("]")
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, key := range exp.Keys() {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(key, parser.LOWEST)
+			p.write(": ")
+			p.expression(exp.Hash[key], parser.LOWEST)
+		}
+		p.write("}")
+	case *ast.FunctionLiteral:
+		p.write("fn(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(param.Value)
+		}
+		p.write(") ")
+		p.block(exp.Body)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.AssignExpression:
+		// assignments are right associative, so the value doesn't need parentheses at the same precedence
+		p.expression(exp.Target, parser.INDEX)
+		p.write(" = ")
+		p.expression(exp.Value, parser.ASSIGN)
+	case *ast.ForExpression:
+		p.write("for (")
+		if exp.Init != nil {
+			p.statement(exp.Init)
+		}
+		p.write(";")
+		if exp.Condition != nil {
+			p.write(" ")
+			p.expression(exp.Condition, parser.LOWEST)
+		}
+		p.write(";")
+		if exp.Post != nil {
+			p.write(" ")
+			p.expression(exp.Post, parser.LOWEST)
+		}
+		p.write(") ")
+		p.block(exp.Body)
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(exp.Body)
+		if exp.Catch != nil {
+			p.write(" catch (" + exp.Param.Value + ") ")
+			p.block(exp.Catch)
+		}
+		if exp.Finally != nil {
+			p.write(" finally ")
+			p.block(exp.Finally)
+		}
+	}
+}
+
+// formatFloat formats the float in the shortest way that reads back the same, with a decimal point or an exponent
+// for it to read back as a float rather than an integer
+func formatFloat(value float64) string {
+	out := strconv.FormatFloat(value, 'g', -1, 64)
+	if !strings.ContainsAny(out, ".e") {
+		out += ".0"
+	}
+
+	return out
+}
+
+func (p *printer) expressionList(exps []ast.Expression) {
+	for i, exp := range exps {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(exp, parser.LOWEST)
+	}
+}
+
+// startOffset returns where the statement starts in the source, including its leading comments
+func startOffset(stmt ast.Statement) int {
+	if commented, ok := stmt.(ast.Commented); ok && commented.Comments().Leading != nil {
+		return commented.Comments().Leading.List[0].Token.Offset
+	}
+
+	if tok := ast.TokenOf(stmt); tok != nil {
+		return tok.Offset
+	}
+
+	return 0
+}
+
+// startLine returns the line the statement starts on in the source, including its leading comments
+func startLine(stmt ast.Statement) int {
+	if commented, ok := stmt.(ast.Commented); ok && commented.Comments().Leading != nil {
+		return commented.Comments().Leading.List[0].Token.Line
+	}
+
+	if tok := ast.TokenOf(stmt); tok != nil {
+		return tok.Line
+	}
+
+	return 0
+}
+
+// endLine returns the last line the statement was found on in the source, 0 if it has no positions
+func endLine(stmt ast.Statement) int {
+	line := 0
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		if tok := ast.TokenOf(node); tok != nil && tok.Line > line {
+			line = tok.Line
+		}
+		if block, ok := node.(*ast.BlockStatement); ok && block.Rbrace != nil && block.Rbrace.Line > line {
+			line = block.Rbrace.Line
+		}
+		return true
+	})
+
+	if commented, ok := stmt.(ast.Commented); ok && commented.Comments().Trailing != nil {
+		trailing := commented.Comments().Trailing.List
+		if l := commentEnd(trailing[len(trailing)-1]); l > line {
+			line = l
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,149 @@
+package printer
+
+import (
+	"monkey/internal/ast"
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"monkey/internal/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if !assert.Empty(t, p.Errors(), "input: %q", input) {
+		t.FailNow()
+	}
+
+	return program
+}
+
+func TestSprint(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1", "let x = 1;\n"},
+		{"return   x ;;", "return x;\n"},
+		{"1+2*3", "1 + 2 * 3;\n"},
+		{"(1+2)*3", "(1 + 2) * 3;\n"},
+		{"1-(2-3)", "1 - (2 - 3);\n"},
+		{"(1-2)-3", "1 - 2 - 3;\n"},
+		{"-(1+2)", "-(1 + 2);\n"},
+		{"!(true==false)", "!(true == false);\n"},
+		{"(fn(x){x})(1)", "fn(x) {\n\tx\n}(1);\n"},
+		{"add(1,2,)[0]", "add(1, 2)[0];\n"},
+		{"(a+b)[0]", "(a + b)[0];\n"},
+		{"(a . b).c(1)", "a.b.c(1);\n"},
+		{`{"b":2,"a":1,}`, "{\"b\": 2, \"a\": 1};\n"},
+		{`"a\"b\\"`, `"a\"b\\";` + "\n"},
+		{"fn(){}", "fn() {};\n"},
+		{"if(x){1}else{let y=2;y}", "if (x) {\n\t1\n} else {\n\tlet y = 2;\n\ty\n}\n"},
+		{"if (x) { 1 }; [1][0]", "if (x) {\n\t1\n};\n[1][0];\n"},
+		{"if (x) { 1 }; -a", "if (x) {\n\t1\n};\n-a;\n"},
+		{"if (x) { 1 }; (a)", "if (x) {\n\t1\n}\na;\n"},
+		{"if (x) { 1 } a", "if (x) {\n\t1\n}\na;\n"},
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		{"for(let i=0;i<3;i=i+1){puts(i)}", "for (let i = 0; i < 3; i = i + 1) {\n\tputs(i)\n}\n"},
+		{"for(;;){}", "for (;;) {}\n"},
+		{"for(;;){if(a){break;}continue}", "for (;;) {\n\tif (a) {\n\t\tbreak;\n\t}\n\tcontinue;\n}\n"},
+		{"try{throw 1}catch(e){e}finally{f()}", "try {\n\tthrow 1;\n} catch (e) {\n\te\n} finally {\n\tf()\n}\n"},
+		{"1.50+2e3*1e-9", "1.5 + 2000.0 * 1e-09;\n"},
+		{"a=b=(c=1)+2", "a = b = (c = 1) + 2;\n"},
+		{"(a||b)&&c||d==1", "(a || b) && c || d == 1;\n"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, Sprint(parse(t, tt.input)), "input: %q", tt.input)
+	}
+}
+
+func TestSprintComments(t *testing.T) {
+	input := `// the answer
+let x = 42; // not 41
+
+// dangling
+
+let f = fn(a) {
+	// leading
+	a + x // trailing
+	// at the end
+};
+// the last word`
+
+	expected := `// the answer
+let x = 42; // not 41
+
+// dangling
+
+let f = fn(a) {
+	// leading
+	a + x // trailing
+	// at the end
+};
+// the last word
+`
+
+	assert.Equal(t, expected, Sprint(parse(t, input)))
+}
+
+func TestSprintRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10)",
+		"let m = {1: [1, 2], true: -(-3), \"s\": fn() { !!false }}; m[1][0] * (2 + m[true])",
+		"if (a) { b } else { if (c) { d } }; [1][0]; -a * b; a * -b; (a * b)(c)",
+		"let p = {\"x\": {\"y\": 1}}; p.x.y + f(p).x[0]",
+		"let p = {}; p.x = p[\"y\"] = 1; f(p).z = 2",
+		"puts(\"a\\tb\\n\", \"say \\\"hi\\\"\", \"\\\\\")",
+		"let n = 0; for (let i = 0; i < 3; i = i + 1) { n = n + i }; for (; n > 0;) { n = (n - 1) }; n",
+		"// c\nlet a = 1; // t\n\n// d\nputs(a, \"x\");\n",
+		"/* header\n   spanning lines */\nlet a = 1; /* t */\n\n/* d */\nputs(a, /* inside */ \"x\");\n",
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+		printed := Sprint(program)
+
+		reparsed := parse(t, printed)
+		assert.True(t, ast.Equal(program, reparsed), "printed: %q", printed)
+		assert.Equal(t, printed, Sprint(reparsed), "not idempotent for input: %q", input)
+	}
+}
+
+func TestSprintReparsed(t *testing.T) {
+	source := "let a = 1;\n\nlet f = fn(x) {\n  x\n\n  // last\n};\n\n// after\nf(a)\n"
+	edits := []parser.Edit{
+		{Offset: 0, Text: "let z = 2;\n\n\n"},
+		{Offset: 0, Length: len("let a = 1;\n")},
+		{Offset: len("let a = 1;"), Text: " // one\n// two\n"},
+	}
+
+	for _, edit := range edits {
+		p := parser.New(lexer.New(source))
+		program := p.Reparse(p.ParseProgram(), edit)
+
+		newSource := source[:edit.Offset] + edit.Text + source[edit.Offset+edit.Length:]
+		assert.Equal(t, Sprint(parse(t, newSource)), Sprint(program), "source: %q", newSource)
+	}
+}
+
+func TestSprintBuiltTrees(t *testing.T) {
+	tok := func(literal string) *token.Token { return &token.Token{Literal: literal} }
+
+	// trees that weren't parsed have no positions, and can have values the parser never produces
+	exp := &ast.PrefixExpression{
+		Token:    tok("-"),
+		Operator: "-",
+		Right: &ast.IndexExpression{
+			Token: tok("["),
+			Left:  &ast.IntegerLiteral{Token: tok("-5"), Value: -5},
+			Index: &ast.IntegerLiteral{Token: tok("0"), Value: 0},
+		},
+	}
+
+	assert.Equal(t, "-(-5)[0]", Sprint(exp))
+}
@@ -0,0 +1,137 @@
+// Package profile times the calls of programs, as told by the Call and Return hooks of an evaluator, to show where
+// they spend their time: as folded stacks, the input of flame graph tools like flamegraph.pl or speedscope, or as
+// a report of the functions taking the most time.
+package profile
+
+import (
+	"fmt"
+	"io"
+	"monkey/internal/evaluator"
+	"monkey/internal/object"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// Profiler times the calls of one evaluation at a time.
+	Profiler struct {
+		now       func() time.Time
+		calls     []call                   // the calls in progress, innermost last
+		stacks    map[string]time.Duration // the time spent in the innermost call of every stack, by folded stack
+		functions map[string]*Function
+	}
+
+	// Function is the time spent in the calls of a function.
+	Function struct {
+		Name  string
+		Calls int
+		Self  time.Duration // the time spent in the function itself, not in the functions it called
+		Total time.Duration // the time spent in the calls, the ones of recursions counted once
+	}
+
+	// call is a call in progress
+	call struct {
+		name     string
+		start    time.Time
+		children time.Duration // the time spent in the calls it made
+	}
+)
+
+// New returns a profiler that timed nothing yet.
+func New() *Profiler {
+	return &Profiler{now: time.Now, stacks: map[string]time.Duration{}, functions: map[string]*Function{}}
+}
+
+// Hooks returns the hooks for an evaluator to tell the profiler about the calls it makes.
+func (p *Profiler) Hooks() evaluator.Hooks {
+	return evaluator.Hooks{Call: p.call, Return: p.ret}
+}
+
+func (p *Profiler) call(frame object.Frame) {
+	p.calls = append(p.calls, call{name: frame.Function, start: p.now()})
+}
+
+func (p *Profiler) ret() {
+	c := p.calls[len(p.calls)-1]
+	elapsed := p.now().Sub(c.start)
+
+	names := make([]string, len(p.calls))
+	for i, c := range p.calls {
+		names[i] = c.name
+	}
+	p.stacks[strings.Join(names, ";")] += elapsed - c.children
+	p.calls = p.calls[:len(p.calls)-1]
+
+	f, ok := p.functions[c.name]
+	if !ok {
+		f = &Function{Name: c.name}
+		p.functions[c.name] = f
+	}
+	f.Calls++
+	f.Self += elapsed - c.children
+	if !p.inProgress(c.name) {
+		f.Total += elapsed
+	}
+	if len(p.calls) > 0 {
+		p.calls[len(p.calls)-1].children += elapsed
+	}
+}
+
+// inProgress reports whether a call of the function is still in progress
+func (p *Profiler) inProgress(name string) bool {
+	for _, c := range p.calls {
+		if c.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WriteFolded writes the folded stacks, one line per stack: the functions called separated by semicolons,
+// outermost first, and the microseconds spent in the innermost one, like "main;fib;fib 120".
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	stacks := make([]string, 0, len(p.stacks))
+	for stack := range p.stacks {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	var out strings.Builder
+	for _, stack := range stacks {
+		fmt.Fprintf(&out, "%s %d\n", stack, p.stacks[stack].Microseconds())
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// Top returns the n functions that took the most time of their own, all of them if n <= 0.
+func (p *Profiler) Top(n int) []Function {
+	functions := make([]Function, 0, len(p.functions))
+	for _, f := range p.functions {
+		functions = append(functions, *f)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		a, b := functions[i], functions[j]
+		return a.Self > b.Self || a.Self == b.Self && a.Name < b.Name
+	})
+
+	if n > 0 && n < len(functions) {
+		functions = functions[:n]
+	}
+	return functions
+}
+
+// WriteTop writes a table of the n functions that took the most time of their own, see Top.
+func (p *Profiler) WriteTop(w io.Writer, n int) error {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%-30s %10s %14s %14s\n", "function", "calls", "self", "total")
+	for _, f := range p.Top(n) {
+		fmt.Fprintf(&out, "%-30s %10d %14s %14s\n", f.Name, f.Calls, f.Self, f.Total)
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
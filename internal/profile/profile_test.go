@@ -0,0 +1,48 @@
+package profile
+
+import (
+	"bytes"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfiler(t *testing.T) {
+	input := `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let run = fn() { len(str); fib(3) };
+let str = "abc";
+run()`
+
+	// every call of the clock moves it a millisecond forward
+	clock := time.Unix(0, 0)
+	p := New()
+	p.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+
+	e := evaluator.New(evaluator.Config{Hooks: p.Hooks()})
+	e.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnv())
+
+	var folded bytes.Buffer
+	assert.NoError(t, p.WriteFolded(&folded))
+	assert.Equal(t, "run 3000\nrun;fib 3000\nrun;fib;fib 4000\nrun;fib;fib;fib 2000\nrun;len 1000\n", folded.String())
+
+	assert.Equal(t, []Function{
+		{Name: "fib", Calls: 5, Self: 9 * time.Millisecond, Total: 9 * time.Millisecond},
+		{Name: "run", Calls: 1, Self: 3 * time.Millisecond, Total: 13 * time.Millisecond},
+		{Name: "len", Calls: 1, Self: time.Millisecond, Total: time.Millisecond},
+	}, p.Top(0))
+	assert.Len(t, p.Top(1), 1)
+
+	var top bytes.Buffer
+	assert.NoError(t, p.WriteTop(&top, 1))
+	assert.Equal(t, "function                            calls           self          total\n"+
+		"fib                                     5            9ms            9ms\n", top.String())
+}
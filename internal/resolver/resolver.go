@@ -0,0 +1,366 @@
+// Package resolver works out what every identifier of a program refers to. It builds the tree of scopes the
+// program runs in, links each identifier to the symbol it declares or uses, and reports the uses that can't work,
+// like a variable used before it is declared, along with bindings that are never used.
+//
+// Monkey scopes follow its environments: the program has the global scope and every function call gets a scope of
+// its own, holding the parameters and the lets of the function body. A for loop has a scope of its own too, for the
+// lets of its init and body not to be seen after it. Blocks of if expressions don't have a scope of their own, a
+// let inside of them declares into the enclosing loop, function or program.
+package resolver
+
+import (
+	"monkey/internal/ast"
+	"monkey/internal/diagnostics"
+	"monkey/internal/token"
+	"sort"
+)
+
+// Kind tells where a symbol is declared.
+type Kind int
+
+const (
+	Predeclared Kind = iota // provided by the host, like the builtins
+	Global                  // declared by a let at the top level of the program
+	Local                   // declared by a let in a function or loop
+	Parameter               // a parameter of a function, or the name a catch block gets the thrown value as
+)
+
+type (
+	// Symbol is a name declared in a scope.
+	Symbol struct {
+		Name  string
+		Kind  Kind
+		Scope *Scope
+		Decl  *ast.Identifier   // the first declaration, nil for predeclared symbols
+		Uses  []*ast.Identifier // every identifier referring to the symbol, other than its declarations
+	}
+
+	// Scope holds the symbols declared in a program, function, loop or catch block.
+	Scope struct {
+		Parent   *Scope
+		Children []*Scope
+		Node     ast.Node // the Program, FunctionLiteral, ForExpression or TryExpression, nil for the predeclared symbols
+		Symbols  map[string]*Symbol
+
+		// Free holds the symbols of enclosing functions used in this scope or the ones nested in it, in the
+		// order they were first used. Globals and predeclared symbols are never free.
+		Free []*Symbol
+	}
+
+	// Info is the result of resolving a program.
+	Info struct {
+		Universe    *Scope                          // holds the predeclared symbols, the parent of Global
+		Global      *Scope                          // the scope of the program
+		Scopes      map[*ast.FunctionLiteral]*Scope // the scope of every function
+		Symbols     map[*ast.Identifier]*Symbol     // what every declaration and use resolved to
+		Diagnostics []diagnostics.Diagnostic        // errors and warnings ordered by position
+	}
+)
+
+// Lookup returns the symbol the name refers to in the scope, looking through the enclosing scopes.
+func (s *Scope) Lookup(name string) *Symbol {
+	for ; s != nil; s = s.Parent {
+		if sym, ok := s.Symbols[name]; ok {
+			return sym
+		}
+	}
+
+	return nil
+}
+
+// function returns the closest scope that belongs to a function, nil if s isn't inside of one
+func (s *Scope) function() *Scope {
+	for ; s != nil; s = s.Parent {
+		if s.isFunction() {
+			return s
+		}
+	}
+
+	return nil
+}
+
+func (s *Scope) isFunction() bool {
+	_, ok := s.Node.(*ast.FunctionLiteral)
+	return ok
+}
+
+func newScope(parent *Scope, node ast.Node) *Scope {
+	s := &Scope{Parent: parent, Node: node, Symbols: map[string]*Symbol{}}
+	if parent != nil {
+		parent.Children = append(parent.Children, s)
+	}
+
+	return s
+}
+
+type resolver struct {
+	info    *Info
+	scope   *Scope
+	pending map[string]*ast.Identifier // the lets of the current scope that weren't reached yet
+	bodies  []*ast.FunctionLiteral     // functions of the current scope still to be resolved
+}
+
+// Resolve resolves the identifiers of the program. The predeclared names are the ones the program can use without
+// declaring them, usually the names of the builtins and whatever the host defines.
+//
+// The bodies of functions are resolved after the scope they are declared in, since they can only run once they
+// are called: a function can use itself and the lets following it, like a global function declared later on.
+func Resolve(program *ast.Program, predeclared ...string) *Info {
+	universe := newScope(nil, nil)
+	for _, name := range predeclared {
+		universe.Symbols[name] = &Symbol{Name: name, Kind: Predeclared, Scope: universe}
+	}
+
+	info := &Info{
+		Universe: universe,
+		Global:   newScope(universe, program),
+		Scopes:   map[*ast.FunctionLiteral]*Scope{},
+		Symbols:  map[*ast.Identifier]*Symbol{},
+	}
+
+	r := &resolver{info: info}
+	r.resolveScope(info.Global, program.Statements)
+	r.reportUnused(info.Global)
+
+	sort.SliceStable(info.Diagnostics, func(i, j int) bool {
+		a, b := info.Diagnostics[i], info.Diagnostics[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+
+	return info
+}
+
+// Errors returns the error diagnostics, the uses that fail when the program runs.
+func (info *Info) Errors() []diagnostics.Diagnostic {
+	return info.filter(diagnostics.Error)
+}
+
+// Warnings returns the warning diagnostics, like unused bindings.
+func (info *Info) Warnings() []diagnostics.Diagnostic {
+	return info.filter(diagnostics.Warning)
+}
+
+func (info *Info) filter(severity diagnostics.Severity) []diagnostics.Diagnostic {
+	var ds []diagnostics.Diagnostic
+	for _, d := range info.Diagnostics {
+		if d.Severity == severity {
+			ds = append(ds, d)
+		}
+	}
+
+	return ds
+}
+
+// resolveScope resolves the statements in the scope, followed by the bodies of the functions declared in them
+func (r *resolver) resolveScope(scope *Scope, stmts []ast.Statement) {
+	outer, outerPending, outerBodies := r.scope, r.pending, r.bodies
+	r.scope, r.pending, r.bodies = scope, declaredIn(stmts), nil
+
+	for _, stmt := range stmts {
+		r.resolve(stmt)
+	}
+
+	// a body can add functions of its own to resolve, those come after it
+	for len(r.bodies) > 0 {
+		fn := r.bodies[0]
+		r.bodies = r.bodies[1:]
+		r.resolveFunction(fn)
+	}
+
+	r.scope, r.pending, r.bodies = outer, outerPending, outerBodies
+}
+
+func (r *resolver) resolveFunction(fn *ast.FunctionLiteral) {
+	scope := newScope(r.scope, fn)
+	r.info.Scopes[fn] = scope
+
+	for _, param := range fn.Parameters {
+		r.declare(scope, param, Parameter)
+	}
+
+	var stmts []ast.Statement
+	if fn.Body != nil {
+		stmts = fn.Body.Statements
+	}
+	r.resolveScope(scope, stmts)
+}
+
+// resolve resolves the identifiers of the node in the order they are evaluated
+func (r *resolver) resolve(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.LetStatement:
+			if n.Value != nil {
+				r.resolve(n.Value)
+			}
+			if name, ok := n.Name.(*ast.Identifier); ok {
+				kind := Global
+				if r.scope != r.info.Global {
+					kind = Local
+				}
+				r.declare(r.scope, name, kind)
+			}
+			return false
+		case *ast.FunctionLiteral:
+			r.bodies = append(r.bodies, n)
+			return false
+		case *ast.ForExpression:
+			r.resolveLoop(n)
+			return false
+		case *ast.TryExpression:
+			r.resolveTry(n)
+			return false
+		case *ast.IndexExpression:
+			if n.Token != nil && n.Token.Type == token.PERIOD {
+				r.resolve(n.Left) // the name after the dot is a key, not a variable
+				return false
+			}
+		case *ast.Identifier:
+			r.use(n)
+		}
+
+		return true
+	})
+}
+
+// resolveLoop resolves the clauses and body of the loop in a scope of its own, in the order they are evaluated
+func (r *resolver) resolveLoop(loop *ast.ForExpression) {
+	var stmts []ast.Statement
+	if loop.Init != nil {
+		stmts = append(stmts, loop.Init)
+	}
+	if loop.Condition != nil {
+		stmts = append(stmts, &ast.ExpressionStatement{Token: ast.TokenOf(loop.Condition), Expression: loop.Condition})
+	}
+	if loop.Body != nil {
+		stmts = append(stmts, loop.Body.Statements...)
+	}
+	if loop.Post != nil {
+		stmts = append(stmts, &ast.ExpressionStatement{Token: ast.TokenOf(loop.Post), Expression: loop.Post})
+	}
+
+	r.resolveScope(newScope(r.scope, loop), stmts)
+}
+
+// resolveTry resolves the body and the finally block in the current scope, and the catch block in a scope of its
+// own holding the thrown value
+func (r *resolver) resolveTry(try *ast.TryExpression) {
+	if try.Body != nil {
+		r.resolve(try.Body)
+	}
+	if try.Catch != nil {
+		scope := newScope(r.scope, try)
+		r.declare(scope, try.Param, Parameter)
+		r.resolveScope(scope, try.Catch.Statements)
+	}
+	if try.Finally != nil {
+		r.resolve(try.Finally)
+	}
+}
+
+func (r *resolver) declare(scope *Scope, name *ast.Identifier, kind Kind) {
+	if scope == r.scope {
+		delete(r.pending, name.Value)
+	}
+
+	sym, ok := scope.Symbols[name.Value]
+	if !ok {
+		sym = &Symbol{Name: name.Value, Kind: kind, Scope: scope, Decl: name}
+		scope.Symbols[name.Value] = sym
+	}
+
+	r.info.Symbols[name] = sym
+}
+
+func (r *resolver) use(ident *ast.Identifier) {
+	sym := r.scope.Lookup(ident.Value)
+	if sym == nil {
+		if decl, ok := r.pending[ident.Value]; ok {
+			r.errorf(ident, "%s used before it is declared on line %d", ident.Value, decl.Token.Line)
+		} else {
+			r.errorf(ident, "identifier not found: %s", ident.Value)
+		}
+		return
+	}
+
+	r.info.Symbols[ident] = sym
+	sym.Uses = append(sym.Uses, ident)
+
+	if sym.Kind != Local && sym.Kind != Parameter {
+		return
+	}
+
+	// every function between the use and the declaration captures the symbol
+	for s := r.scope; s != sym.Scope; s = s.Parent {
+		if s.isFunction() && !contains(s.Free, sym) {
+			s.Free = append(s.Free, sym)
+		}
+	}
+}
+
+// reportUnused warns about the lets in functions that are never used. Parameters are left alone, as a function
+// often has to take arguments it doesn't need, and so are globals, which the host or other programs can use.
+func (r *resolver) reportUnused(scope *Scope) {
+	var unused []*Symbol
+	for _, sym := range scope.Symbols {
+		if sym.Kind == Local && len(sym.Uses) == 0 && sym.Name != "_" {
+			unused = append(unused, sym)
+		}
+	}
+
+	sort.Slice(unused, func(i, j int) bool { return unused[i].Decl.Token.Offset < unused[j].Decl.Token.Offset })
+	for _, sym := range unused {
+		d := diagnostics.WarningAt(sym.Decl.Token, "%s declared and not used", sym.Name)
+		r.info.Diagnostics = append(r.info.Diagnostics, d)
+	}
+
+	for _, child := range scope.Children {
+		r.reportUnused(child)
+	}
+}
+
+func (r *resolver) errorf(ident *ast.Identifier, format string, a ...interface{}) {
+	r.info.Diagnostics = append(r.info.Diagnostics, diagnostics.At(ident.Token, format, a...))
+}
+
+// declaredIn returns the names the statements declare with let, not looking into the functions, loops and catch
+// blocks in them
+func declaredIn(stmts []ast.Statement) map[string]*ast.Identifier {
+	declared := map[string]*ast.Identifier{}
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FunctionLiteral, *ast.ForExpression:
+			return false
+		case *ast.TryExpression:
+			ast.Inspect(n.Body, visit)
+			if n.Finally != nil {
+				ast.Inspect(n.Finally, visit)
+			}
+			return false
+		case *ast.LetStatement:
+			if name, ok := n.Name.(*ast.Identifier); ok {
+				if _, seen := declared[name.Value]; !seen {
+					declared[name.Value] = name
+				}
+			}
+		}
+
+		return true
+	}
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, visit)
+	}
+
+	return declared
+}
+
+func contains(symbols []*Symbol, sym *Symbol) bool {
+	for _, s := range symbols {
+		if s == sym {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,118 @@
+package resolver
+
+import (
+	"monkey/internal/ast"
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resolve(t *testing.T, input string, predeclared ...string) (*ast.Program, *Info) {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if !assert.Empty(t, p.Errors(), "input: %q", input) {
+		t.FailNow()
+	}
+
+	return program, Resolve(program, predeclared...)
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; x", nil},
+		{"x; let x = 1;", []string{"line 1, column 1: x used before it is declared on line 1"}},
+		{"let f = fn() { y }; let y = 1; f()", nil},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(3)", nil},
+		{"puts(y)", []string{"line 1, column 1: identifier not found: puts", "line 1, column 6: identifier not found: y"}},
+		{"let f = fn(a) { let b = 1; let c = a; c };", []string{"line 1, column 21: warning: b declared and not used"}},
+		{"let f = fn() { if (true) { let v = 1; } v };", nil},
+		{"let f = fn() { let _ = 1; };", nil},
+		{"let x = 1; let f = fn() { let y = x; let x = 2; y + x };", nil},
+		{"let f = fn() { z; let z = 1; z };", []string{"line 1, column 16: z used before it is declared on line 1"}},
+		{"let h = {k: 1};", []string{"line 1, column 10: identifier not found: k"}},
+		{"let n = 0; for (let i = 0; i < 3; i = i + 1) { n = n + i }; n", nil},
+		{"for (let i = 0; i < 3; i = i + 1) { let v = i; }; i", []string{
+			"line 1, column 41: warning: v declared and not used",
+			"line 1, column 51: identifier not found: i",
+		}},
+		{"y = 1", []string{"line 1, column 1: identifier not found: y"}},
+		{"let f = fn() { try { let a = 1; a } catch (e) { let b = 2; a } finally { a } };", []string{
+			"line 1, column 53: warning: b declared and not used",
+		}},
+		{"try { 1 } catch (e) { 2 }; e", []string{"line 1, column 28: identifier not found: e"}},
+	}
+
+	for _, tt := range tests {
+		_, info := resolve(t, tt.input)
+
+		var got []string
+		for _, d := range info.Diagnostics {
+			got = append(got, d.String())
+		}
+		assert.Equal(t, tt.expected, got, "input: %q", tt.input)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	input := `
+let g = 1;
+let adder = fn(a) {
+	let unused = 0;
+	fn(b) { fn() { a + b + g + len([]) } }
+};`
+
+	program, info := resolve(t, input, "len")
+	assert.Empty(t, info.Errors())
+	assert.Len(t, info.Warnings(), 1)
+
+	// every identifier resolves to a symbol
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			assert.NotNil(t, info.Symbols[ident], "identifier %s at line %d", ident.Value, ident.Token.Line)
+		}
+		return true
+	})
+
+	g := info.Global.Symbols["g"]
+	assert.Equal(t, Global, g.Kind)
+	assert.Len(t, g.Uses, 1)
+	assert.Equal(t, Predeclared, info.Global.Lookup("len").Kind)
+
+	assert.Len(t, info.Global.Children, 1)
+	adder := info.Global.Children[0]
+	assert.Equal(t, Parameter, adder.Symbols["a"].Kind)
+	assert.Equal(t, Local, adder.Symbols["unused"].Kind)
+	assert.Empty(t, adder.Free)
+
+	assert.Len(t, adder.Children, 1)
+	middle := adder.Children[0]
+	assert.Equal(t, []*Symbol{adder.Symbols["a"]}, middle.Free)
+
+	inner := middle.Children[0]
+	assert.Same(t, inner, info.Scopes[inner.Node.(*ast.FunctionLiteral)])
+	assert.Equal(t, []*Symbol{adder.Symbols["a"], middle.Symbols["b"]}, inner.Free)
+}
+
+func TestLoopScopes(t *testing.T) {
+	_, info := resolve(t, "let f = fn(n) { for (let i = 0; i < n; i = i + 1) { let g = fn() { i }; g() } };")
+	assert.Empty(t, info.Diagnostics)
+
+	f := info.Global.Children[0]
+	assert.Len(t, f.Children, 1)
+	loop := f.Children[0]
+	assert.IsType(t, &ast.ForExpression{}, loop.Node)
+	assert.Equal(t, Local, loop.Symbols["i"].Kind)
+	assert.Equal(t, Local, loop.Symbols["g"].Kind)
+	assert.NotContains(t, f.Symbols, "i")
+	assert.Empty(t, loop.Free, "loops don't capture")
+
+	g := loop.Children[0]
+	assert.Equal(t, []*Symbol{loop.Symbols["i"]}, g.Free)
+}
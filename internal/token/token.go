@@ -18,6 +18,9 @@ type (
 	Token     struct {
 		Type    TokenType
 		Literal string
+		Line    int // line the token starts on, starting at 1
+		Column  int // column the token starts on, starting at 1
+		Offset  int // byte offset of the token in the input
 	}
 )
 
@@ -28,8 +31,12 @@ const (
 	// Identifiers
 	IDENT  = "IDENT" // token type for all the user defined identifiers
 	INT    = "INT"   // integer data type
+	FLOAT  = "FLOAT" // floating point data type, like 3.14 or 1e-9
 	STRING = "STRING"
 
+	// COMMENT holds a `//` comment up to the end of its line
+	COMMENT = "COMMENT"
+
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -44,6 +51,9 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
 	// Delimiters
 	PERIOD    = "."
 	COMMA     = ","
@@ -65,17 +75,31 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	FOR      = "FOR"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 )
 
 var (
 	keywords = map[string]TokenType{
-		"let":    LET,
-		"fn":     FUNCTION,
-		"true":   TRUE,
-		"false":  FALSE,
-		"if":     IF,
-		"else":   ELSE,
-		"return": RETURN,
+		"let":      LET,
+		"fn":       FUNCTION,
+		"true":     TRUE,
+		"false":    FALSE,
+		"if":       IF,
+		"else":     ELSE,
+		"return":   RETURN,
+		"for":      FOR,
+		"break":    BREAK,
+		"continue": CONTINUE,
+		"try":      TRY,
+		"catch":    CATCH,
+		"finally":  FINALLY,
+		"throw":    THROW,
 	}
 )
 
@@ -0,0 +1,170 @@
+// Package vet reports the suspicious constructs of programs, the ones that run but probably don't do what was
+// intended: bindings that are never used or that shadow others, code that never runs, conditions known ahead and
+// expressions whose value is thrown away. Along with them come the errors of the resolver, the uses of names that
+// fail when the program runs.
+package vet
+
+import (
+	"monkey/internal/ast"
+	"monkey/internal/diagnostics"
+	"monkey/internal/resolver"
+	"sort"
+)
+
+// Check returns the diagnostics about the program, ordered by position, with the names in predeclared declared by
+// the host, like the builtins.
+func Check(program *ast.Program, predeclared ...string) []diagnostics.Diagnostic {
+	info := resolver.Resolve(program, predeclared...)
+
+	ds := append([]diagnostics.Diagnostic(nil), info.Diagnostics...) // the errors, and the unused lets
+	ds = append(ds, shadowing(info.Global)...)
+	ds = append(ds, unreachable(program)...)
+	ds = append(ds, constantConditions(program)...)
+	ds = append(ds, unusedValues(program)...)
+
+	sort.SliceStable(ds, func(i, j int) bool {
+		a, b := ds[i], ds[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+
+	return ds
+}
+
+// shadowing warns about the names declared in the scope, and in the ones nested in it, that hide the same name of
+// an enclosing scope
+func shadowing(scope *resolver.Scope) []diagnostics.Diagnostic {
+	var shadows []*resolver.Symbol
+	for _, sym := range scope.Symbols {
+		if sym.Decl != nil && scope.Parent.Lookup(sym.Name) != nil && sym.Name != "_" {
+			shadows = append(shadows, sym)
+		}
+	}
+	sort.Slice(shadows, func(i, j int) bool { return shadows[i].Decl.Token.Offset < shadows[j].Decl.Token.Offset })
+
+	var ds []diagnostics.Diagnostic
+	for _, sym := range shadows {
+		outer := scope.Parent.Lookup(sym.Name)
+		if outer.Decl == nil {
+			ds = append(ds, diagnostics.WarningAt(sym.Decl.Token, "%s shadows the predeclared %s", sym.Name, sym.Name))
+		} else {
+			ds = append(ds, diagnostics.WarningAt(sym.Decl.Token, "%s shadows the %s declared on line %d", sym.Name, sym.Name, outer.Decl.Token.Line))
+		}
+	}
+
+	for _, child := range scope.Children {
+		ds = append(ds, shadowing(child)...)
+	}
+
+	return ds
+}
+
+// unreachable warns about the first statement following a return, break or continue in every program and block
+func unreachable(program *ast.Program) []diagnostics.Diagnostic {
+	var ds []diagnostics.Diagnostic
+	forEachStatements(program, func(stmts []ast.Statement) {
+		for i, stmt := range stmts[:max(len(stmts)-1, 0)] {
+			if jumps(stmt) {
+				if tok := ast.TokenOf(stmts[i+1]); tok != nil {
+					ds = append(ds, diagnostics.WarningAt(tok, "unreachable code"))
+				}
+				return
+			}
+		}
+	})
+
+	return ds
+}
+
+// jumps reports whether the statement leaves the statements it is in, so none of the ones following it run
+func jumps(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		return true
+	default:
+		return false
+	}
+}
+
+// constantConditions warns about the conditions of ifs that are always true or always false, the ones made of
+// literals only
+func constantConditions(program *ast.Program) []diagnostics.Diagnostic {
+	var ds []diagnostics.Diagnostic
+	ast.Inspect(ast.Fold(program), func(node ast.Node) bool {
+		n, ok := node.(*ast.IfExpression)
+		if !ok || n.Token == nil {
+			return true
+		}
+
+		switch condition := n.Condition.(type) {
+		case *ast.Boolean:
+			ds = append(ds, diagnostics.WarningAt(n.Token, "condition is always %t", condition.Value))
+		case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral:
+			ds = append(ds, diagnostics.WarningAt(n.Token, "condition is always true"))
+		}
+		return true
+	})
+
+	return ds
+}
+
+// unusedValues warns about the expression statements whose value is thrown away, all but the last of a program or
+// block, when they can't have an effect either: they call nothing
+func unusedValues(program *ast.Program) []diagnostics.Diagnostic {
+	var ds []diagnostics.Diagnostic
+	forEachStatements(program, func(stmts []ast.Statement) {
+		for _, stmt := range stmts[:max(len(stmts)-1, 0)] {
+			if jumps(stmt) {
+				return // what follows is unreachable instead
+			}
+
+			s, ok := stmt.(*ast.ExpressionStatement)
+			if !ok || s.Token == nil || s.Expression == nil || calls(s.Expression) {
+				continue
+			}
+
+			switch exp := s.Expression.(type) {
+			case *ast.IfExpression, *ast.ForExpression, *ast.TryExpression:
+				// used as a statement, for what its branches or body do
+			case *ast.AssignExpression:
+				// used as a statement, for the value it assigns
+			case *ast.FunctionLiteral:
+				ds = append(ds, diagnostics.WarningAt(s.Token, "function is never called"))
+			case *ast.InfixExpression:
+				ds = append(ds, diagnostics.WarningAt(s.Token, "result of %s isn't used", exp.Operator))
+			case *ast.PrefixExpression:
+				ds = append(ds, diagnostics.WarningAt(s.Token, "result of %s isn't used", exp.Operator))
+			default:
+				ds = append(ds, diagnostics.WarningAt(s.Token, "value of %s isn't used", exp))
+			}
+		}
+	})
+
+	return ds
+}
+
+// calls reports whether evaluating the expression calls a function, not counting the functions it declares
+func calls(exp ast.Expression) bool {
+	found := false
+	ast.Inspect(exp, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.CallExpression:
+			found = true
+		case *ast.FunctionLiteral:
+			return false
+		}
+		return !found
+	})
+
+	return found
+}
+
+// forEachStatements calls f with the statements of the program, and with the ones of every block in it
+func forEachStatements(program *ast.Program, f func([]ast.Statement)) {
+	f(program.Statements)
+	ast.Inspect(program, func(node ast.Node) bool {
+		if block, ok := node.(*ast.BlockStatement); ok {
+			f(block.Statements)
+		}
+		return true
+	})
+}
@@ -0,0 +1,60 @@
+package vet
+
+import (
+	"monkey/internal/lexer"
+	"monkey/internal/parser"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let a = 1; let f = fn(x) { x + a }; f(a)", nil},
+		{"let f = fn() { let a = 1; 2 }; f()", []string{"line 1, column 20: warning: a declared and not used"}},
+		{"x", []string{"line 1, column 1: identifier not found: x"}},
+
+		// shadowing
+		{"let a = 1; let f = fn(a) { a }; f(2)", []string{"line 1, column 23: warning: a shadows the a declared on line 1"}},
+		{"let f = fn() { let f = 1; f }; f()", []string{"line 1, column 20: warning: f shadows the f declared on line 1"}},
+		{"let len = fn(x) { 0 }; len(1)", []string{"line 1, column 5: warning: len shadows the predeclared len"}},
+		{"let a = 1; let a = a + 1; a", nil},
+		{"let f = fn(_) { fn(_) { 1 } }; f(1)", nil},
+
+		// unreachable code
+		{"let f = fn() { return 1; 2 }; f()", []string{"line 1, column 26: warning: unreachable code"}},
+		{"return 1;\nlet a = 2;\na", []string{"line 2, column 1: warning: unreachable code"}},
+		{"let n = 0; for (;;) { break; n = 1 }", []string{"line 1, column 30: warning: unreachable code"}},
+		{"let f = fn(x) { if (x) { return 1; } 2 }; f(true)", nil},
+		{"let f = fn() { throw 1; 2 }; f()", []string{"line 1, column 25: warning: unreachable code"}},
+
+		// constant conditions
+		{"if (1 < 2) { 3 }", []string{"line 1, column 1: warning: condition is always true"}},
+		{`if (!"a") { 3 }`, []string{"line 1, column 1: warning: condition is always false"}},
+		{"let f = fn(x) { if (x == 1) { 3 } }; f(1)", nil},
+
+		// values thrown away
+		{"let a = 1; a == 2; a", []string{"line 1, column 12: warning: result of == isn't used"}},
+		{"let a = 1; a; -a; a", []string{"line 1, column 12: warning: value of a isn't used", "line 1, column 15: warning: result of - isn't used"}},
+		{"fn(x) { x }; 1", []string{"line 1, column 1: warning: function is never called"}},
+		{"let f = fn() { 1 }; f(); [f()][0]; if (true) { 1 } else { 2 }; 1", []string{"line 1, column 36: warning: condition is always true"}},
+		{"let f = fn(x) { x == 1 }; f(1)", nil},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if !assert.Empty(t, p.Errors(), "input: %q", tt.input) {
+			continue
+		}
+
+		var actual []string
+		for _, d := range Check(program, "len") {
+			actual = append(actual, d.String())
+		}
+		assert.Equal(t, tt.expected, actual, "input: %q", tt.input)
+	}
+}
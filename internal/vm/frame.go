@@ -0,0 +1,41 @@
+package vm
+
+import (
+	"monkey/internal/code"
+	"monkey/internal/object"
+)
+
+// Frame is a call in progress: the closure called, where it is at in its instructions and where its locals
+// start on the stack.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+
+	// cells hold the locals the closures nested in the function capture, which they share with the call
+	cells []*object.Binding
+
+	// memo and memoKey are the memo called, and the key of the arguments, to keep the result of the call in
+	memo    *object.Memo
+	memoKey string
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// cell returns the binding of the local at the index, which closures capture
+func (f *Frame) cell(index int) *object.Binding {
+	if f.cells == nil {
+		f.cells = make([]*object.Binding, len(f.cl.Fn.Locals))
+	}
+	if f.cells[index] == nil {
+		f.cells[index] = &object.Binding{}
+	}
+
+	return f.cells[index]
+}
@@ -0,0 +1,436 @@
+// Package vm runs the bytecode of package compiler. It is a stack machine: instructions pop their operands off
+// of a stack of values and push their result. The operations on objects are the ones of the evaluator, so that a
+// program evaluates to the same value, or the same error, whichever of the two runs it.
+package vm
+
+import (
+	"context"
+	"fmt"
+	"monkey/internal/code"
+	"monkey/internal/compiler"
+	"monkey/internal/evaluator"
+	"monkey/internal/object"
+)
+
+var (
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
+)
+
+// operators are the infix operators of the opcodes, to apply them with the evaluator
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpLessThan:    "<",
+	code.OpGreaterThan: ">",
+}
+
+type VM struct {
+	evaluator    *evaluator.Evaluator
+	maxCallDepth int
+	meter        *evaluator.Meter
+	ctx          context.Context // stops the run when done, nil for runs that can't be stopped
+	constants    []object.Object
+
+	stack      []object.Object
+	lastPopped object.Object
+
+	globals     []object.Object // nil for the globals that aren't set yet
+	globalNames []string
+	builtins    []string
+
+	frames []*Frame // the calls in progress, innermost last, after the frame of the program
+
+	// depth is how many calls are in progress in the virtual machines calling this one through builtins, and
+	// callbacks how many of those there are, see caller
+	depth, callbacks int
+}
+
+// New returns a virtual machine running the bytecode with the operations of the evaluator, and its settings.
+func New(bytecode *compiler.Bytecode, e *evaluator.Evaluator) *VM {
+	return NewWithGlobals(bytecode, e, make([]object.Object, compiler.GlobalsSize))
+}
+
+// NewWithGlobals returns a virtual machine going on with the globals of another one, like the repl does for every
+// line, along with the state of the compiler.
+func NewWithGlobals(bytecode *compiler.Bytecode, e *evaluator.Evaluator, globals []object.Object) *VM {
+	main := &object.Closure{Fn: &object.CompiledFunction{Instructions: bytecode.Instructions}}
+
+	return &VM{
+		evaluator:    e,
+		maxCallDepth: e.Config().MaxCallDepth,
+		meter:        e.Config().Meter,
+		constants:    bytecode.Constants,
+		globals:      globals,
+		globalNames:  bytecode.Globals,
+		builtins:     bytecode.Builtins,
+		frames:       []*Frame{NewFrame(main, 0)},
+	}
+}
+
+// Globals returns the globals of the virtual machine, see NewWithGlobals.
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
+// Run runs the bytecode and returns the value of the program: the value of its last statement or the value it
+// returned, or the error that stopped it. It returns nil for a program without statements.
+func (vm *VM) Run() object.Object {
+	return vm.run()
+}
+
+// RunContext runs the bytecode like Run, stopping with an error once the context is done. The context is checked
+// before every call and jump.
+func (vm *VM) RunContext(ctx context.Context) object.Object {
+	vm.ctx = ctx
+	return vm.run()
+}
+
+// Call calls the function, a closure of the bytecode or a builtin, with the arguments on a virtual machine that
+// has no instructions of its own and returns what it returns, like Evaluator.Call does for functions evaluated by
+// the evaluator.
+func (vm *VM) Call(fn object.Object, args ...object.Object) object.Object {
+	return vm.callFunction(fn, args)
+}
+
+// CallContext calls the function like Call, stopping with an error once the context is done, see RunContext.
+func (vm *VM) CallContext(ctx context.Context, fn object.Object, args ...object.Object) object.Object {
+	vm.ctx = ctx
+	return vm.callFunction(fn, args)
+}
+
+func (vm *VM) callFunction(fn object.Object, args []object.Object) object.Object {
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	if err := vm.call(len(args)); err != nil {
+		return err
+	}
+
+	if err, ok := vm.run().(*object.Error); ok {
+		return err
+	}
+	return vm.pop()
+}
+
+func (vm *VM) run() object.Object {
+	for {
+		frame := vm.frames[len(vm.frames)-1]
+		ins := frame.Instructions()
+		frame.ip++
+		if frame.ip >= len(ins) {
+			return vm.lastPopped // only the program runs out of instructions, functions return
+		}
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+		if vm.meter != nil {
+			if err := vm.meter.Step(); err != nil {
+				return err
+			}
+		}
+
+		var result object.Object
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			result = vm.constants[constIndex]
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+			continue
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan:
+			right := vm.pop()
+			left := vm.pop()
+			result = vm.evaluator.Infix(operators[op], left, right)
+		case code.OpMinus:
+			result = vm.evaluator.Prefix("-", vm.pop())
+		case code.OpBang:
+			result = vm.evaluator.Prefix("!", vm.pop())
+		case code.OpTrue:
+			result = True
+		case code.OpFalse:
+			result = False
+		case code.OpNull:
+			result = Null
+		case code.OpJump:
+			if err := vm.interrupted(); err != nil {
+				return err
+			}
+			frame.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+			continue
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+			continue
+		case code.OpJumpTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if evaluator.IsTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+			continue
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.globals[globalIndex] = vm.stack[len(vm.stack)-1]
+			continue
+		case code.OpPopGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.lastPopped = vm.pop()
+			vm.globals[globalIndex] = vm.lastPopped
+			continue
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			result = vm.globals[globalIndex]
+			if result == nil {
+				// a global used by a function before it is set is looked up like the evaluator does then
+				result = vm.evaluator.Builtin(vm.globalNames[globalIndex])
+			}
+		case code.OpSetLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			vm.stack[frame.basePointer+localIndex] = vm.stack[len(vm.stack)-1]
+			continue
+		case code.OpPopLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			vm.lastPopped = vm.pop()
+			vm.stack[frame.basePointer+localIndex] = vm.lastPopped
+			continue
+		case code.OpGetLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			result = vm.stack[frame.basePointer+localIndex]
+			if result == nil {
+				result = vm.evaluator.Builtin(frame.cl.Fn.Locals[localIndex])
+			}
+		case code.OpSetCell:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			frame.cell(localIndex).Store(vm.stack[len(vm.stack)-1])
+			continue
+		case code.OpPopCell:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			vm.lastPopped = vm.pop()
+			frame.cell(localIndex).Store(vm.lastPopped)
+			continue
+		case code.OpGetCell:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			result = frame.cell(localIndex).Load()
+			if result == nil {
+				result = vm.evaluator.Builtin(frame.cl.Fn.Locals[localIndex])
+			}
+		case code.OpGetFree:
+			freeIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			result = frame.cl.Free[freeIndex].Load()
+			if result == nil {
+				result = vm.evaluator.Builtin(frame.cl.Fn.Free[freeIndex].Name)
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			result = vm.evaluator.Builtin(vm.builtins[builtinIndex])
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			if err := vm.meter.Object(); err != nil {
+				return err
+			}
+			result = vm.closure(frame, vm.constants[constIndex].(*object.CompiledFunction))
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[len(vm.stack)-numElements:])
+			vm.stack = vm.stack[:len(vm.stack)-numElements]
+			result = vm.evaluator.Array(elements)
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			result = vm.evaluator.Hash(vm.stack[len(vm.stack)-numElements:])
+			vm.stack = vm.stack[:len(vm.stack)-numElements]
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			result = vm.evaluator.Index(left, index)
+		case code.OpField:
+			name := vm.constants[code.ReadUint16(ins[ip+1:])].(*object.String)
+			frame.ip += 2
+			result = vm.evaluator.Field(vm.pop(), name.Value)
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			if err := vm.interrupted(); err != nil {
+				return err
+			}
+			if err := vm.call(numArgs); err != nil {
+				return err
+			}
+			continue
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if len(vm.frames) == 1 {
+				return returnValue
+			}
+
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.stack = vm.stack[:frame.basePointer-1] // the function called goes too
+			if _, ok := returnValue.(*object.Error); !ok && frame.memo != nil {
+				frame.memo.Remember(frame.memoKey, returnValue)
+			}
+			result = returnValue
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return &object.Error{Message: err.Error()}
+			}
+			return &object.Error{Message: fmt.Sprintf("%s can't be run yet", def.Name)}
+		}
+
+		if err, ok := result.(*object.Error); ok {
+			return err
+		}
+		vm.push(result)
+	}
+}
+
+// interrupted returns the error stopping the run if its context is done, nil otherwise
+func (vm *VM) interrupted() *object.Error {
+	if vm.ctx == nil || vm.ctx.Err() == nil {
+		return nil
+	}
+
+	return &object.Error{Message: fmt.Sprintf("interrupted: %s", vm.ctx.Err()), Kind: object.InterruptedError}
+}
+
+// call calls the function under the arguments on top of the stack, returning an error if it can't be called or,
+// for a builtin, the error it returned
+func (vm *VM) call(numArgs int) *object.Error {
+	callee := vm.stack[len(vm.stack)-1-numArgs]
+	switch fn := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(fn, numArgs)
+	case *object.Memo:
+		key, ok := evaluator.MemoKey(vm.stack[len(vm.stack)-numArgs:])
+		if result, found := fn.Result(key); ok && found {
+			vm.stack = vm.stack[:len(vm.stack)-1-numArgs]
+			vm.push(result)
+			return nil
+		}
+
+		cl, isClosure := fn.Function.(*object.Closure)
+		if !isClosure {
+			return &object.Error{Message: fmt.Sprintf("not a function: %s", fn.Function.Type())}
+		}
+		if err := vm.callClosure(cl, numArgs); err != nil {
+			return err
+		}
+		if ok {
+			frame := vm.frames[len(vm.frames)-1]
+			frame.memo, frame.memoKey = fn, key
+		}
+		return nil
+	case *object.Builtin:
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[len(vm.stack)-numArgs:])
+		vm.stack = vm.stack[:len(vm.stack)-1-numArgs]
+
+		var result object.Object
+		if fn.Run != nil {
+			ctx := vm.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			result = fn.Run(ctx, vm.caller(), args...)
+		} else {
+			result = fn.Fn(args...)
+		}
+		if err, ok := result.(*object.Error); ok {
+			return err
+		}
+		vm.push(result)
+		return nil
+	default:
+		return &object.Error{Message: fmt.Sprintf("not a function: %s", callee.Type())}
+	}
+}
+
+// caller returns how builtins like spawn call functions: on a virtual machine of their own every time, sharing
+// the globals and the context of this one. Its calls count towards the depth of this one.
+func (vm *VM) caller() object.Caller {
+	bytecode := &compiler.Bytecode{Constants: vm.constants, Globals: vm.globalNames, Builtins: vm.builtins}
+	depth, callbacks := vm.depth+len(vm.frames)-1, vm.callbacks+1
+	return func(fn object.Object, args ...object.Object) object.Object {
+		if callbacks > evaluator.MaxCallbackDepth {
+			return &object.Error{
+				Message: fmt.Sprintf("stack overflow: more than %d calls of builtins calling functions in progress", evaluator.MaxCallbackDepth),
+				Kind:    object.StackOverflowError,
+			}
+		}
+
+		called := NewWithGlobals(bytecode, vm.evaluator, vm.globals)
+		called.ctx, called.depth, called.callbacks = vm.ctx, depth, callbacks
+		return called.callFunction(fn, args)
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	fn := cl.Fn
+	if numArgs != fn.Arity() {
+		name := fn.Name
+		if name == "" {
+			name = "fn"
+		}
+		return &object.Error{Message: fmt.Sprintf("wrong number of arguments to `%s`. got=%d, want=%d", name, numArgs, fn.Arity())}
+	}
+	if vm.depth+len(vm.frames)-1 >= vm.maxCallDepth {
+		return &object.Error{Message: fmt.Sprintf("stack overflow: more than %d calls in progress", vm.maxCallDepth), Kind: object.StackOverflowError}
+	}
+
+	vm.frames = append(vm.frames, NewFrame(cl, len(vm.stack)-numArgs))
+	vm.meter.Call(vm.depth + len(vm.frames) - 1)
+	for i := numArgs; i < len(fn.Locals); i++ {
+		vm.push(nil) // the locals that aren't set yet
+	}
+
+	return nil
+}
+
+// closure returns the closure of the function, capturing its free variables from the call in progress
+func (vm *VM) closure(frame *Frame, fn *object.CompiledFunction) *object.Closure {
+	free := make([]*object.Binding, len(fn.Free))
+	for i, v := range fn.Free {
+		if v.Local {
+			free[i] = frame.cell(v.Index)
+		} else {
+			free[i] = frame.cl.Free[v.Index]
+		}
+	}
+
+	return &object.Closure{Fn: fn, Free: free}
+}
+
+func (vm *VM) push(obj object.Object) {
+	vm.stack = append(vm.stack, obj)
+}
+
+func (vm *VM) pop() object.Object {
+	obj := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return obj
+}
@@ -0,0 +1,345 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"monkey/internal/compiler"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// corpus holds programs of the evaluator tests, which must evaluate to the same on the virtual machine
+var corpus = []string{
+	// integers and booleans
+	"5", "-10", "5 + 5 * 2 / 2", "(5 + (5 * 2)) / 2", "5 / 0",
+	"true", "!5", "!!false", "1 < 2", "1 > 2", "1 == 1", "1 != 2", "(1 != 1) == !false",
+	"true == false", "true < false", "true > false",
+	"true && false", "1 || 1 / 0", "false || 2", "false && 1 / 0", "1 && 0 / 0", "!true || !false && 1 > 2",
+	"let n = 0; let f = fn() { let n = n + 1; n }; [true && f(), false && f(), false || f()]",
+	"3.14", "1.5 * 2", "7 / 2.0", "-2.5e3 + 1", "1.0 / 0", "0.1 + 0.2 == 0.3", "{1.5: 1, 2.0: 2}[2]",
+
+	// conditionals
+	"if (true) { 10 }", "if (false) { 10 }", "if (1) { 10 }", "if (1 > 2) { 10 } else { 20 }",
+	"if (1 < 2) { 10 } else { 20 }", "if (true) { }", "if (true) { let x = 3 }",
+
+	// returns
+	"return 10;", "return 10; 9;", "9; return 2 * 5; 9;",
+	"if (1 == 1) { if (2 == 2) { return 10; } return 0; }",
+
+	// errors
+	"5 + true;", "5 + true; 5;", "-true", "true + false;", "5; true + false; 5",
+	"if (10 > 1) { true + false; }", "if (10 > 1) { if (10 > 1) { true + false; } return 1; }",
+	"foobar", "[1, 2][true]", "{[1]: 2}", `"a" - "b"`, "1 < \"a\"",
+
+	// lets
+	"let a = 5; a;", "let a = 5 * 5;", "let a = 5; let b = a; let c = a + b; c;", "let a = 1; let a = a + 1; a",
+
+	// strings, arrays and hashes
+	`"Hello" + " " + "World!"`, `"ab" * 3`, `"a" == "a"`,
+	"[1, 2 * 2, 3 + 3]", "[0,1,2][2]", "[0,1,2][3]", "[0,1,2][-1]", `["a","b","c"][1]`,
+	"{1: 1}[1]", `{true: 1, false: 2}[1 > 2]`, `{true: "t", "true": "s"}["true"]`, `{"a": 1, "a": 2}`,
+	`{"b": 1, "a": 2}.a`, `{"b": 1}.c`, "[1].a", "[[1, 2], {3: [4]}] == [[1, 2], {3: [4]}]",
+
+	// functions
+	"fn(x) { x + 2; };", "let identity = fn(x) { x; }; identity(5);", "let identity = fn(x) { return x; }; identity(5);",
+	"let double = fn(x) { x * 2; }; double(5);", "let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+	"fn(x) { x; }(5)", "fn() { }()", "fn() { 1; let a = 2; }()", "let f = fn() { return 1; 2 }; f() + f()",
+	"let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(100)",
+	"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)",
+	"let f = fn() { g() }; let g = fn() { 3 }; f()",
+	"let f = fn() { let a = 1; let b = a + 1; let a = b * 10; a }; f()",
+	"let x = 1; let f = fn() { let y = x; let x = 2; y + x }; f()",
+	"let f = fn() { y }; f(); let y = 1;", "let f = fn() { if (false) { let z = 1 } z }; f()",
+	"let f = fn(a) { a }; f()", "let f = fn(a) { a }; f(1, 2)", "fn(a) { a }()", "1(2)", "let f = fn() { 1 + true }; f(); 3",
+	"let myArray = [1, \"b\", fn() { \"1312\" }]; myArray[2]()",
+
+	// closures
+	"let newAdder = fn(a) { fn(b) { a + b } }; let addTwo = newAdder(2); addTwo(3)",
+	"let f = fn(a, b) { let c = a + b; fn(d) { fn(e) { a + b + c + d + e } } }; f(1, 2)(3)(4)",
+	"let counter = fn() { let n = 0; let next = fn() { let n = n + 1; n }; [next(), next(), n] }; counter()",
+	"let f = fn() { let g = fn() { x }; let x = 1; g() }; f()", "let f = fn() { let g = fn() { x }; g() }; f()",
+	"let f = fn() { let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } }; count(10) }; f()",
+	"let compose = fn(f, g) { fn(x) { g(f(x)) } }; compose(fn(x) { x + 1 }, fn(x) { x * 2 })(3)",
+	"let wrap = fn(f) { fn(x) { f(x) } }; wrap(wrap(len))(\"abc\")", "fn(a) { fn() { a } }(1)",
+
+	// builtins
+	`len("abc")`, "len([1, 2])", "len(1)", "len", `len("a", "b")`, "range(1, 7, 2)", "range(0)",
+	"let len = fn(x) { 1 }; len([1, 2, 3])", "let f = fn() { len([1]) }; f()", "let f = fn(len) { len }; f(1)",
+	"let fib = memo(fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }); fib(60)",
+	"let f = memo(fn(a) { a }); f([1])", "let f = memo(fn(a) { a }); f(1, 2)", "memo(1)",
+	"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; let t = spawn(fib, 15); fib(10) + wait(t)",
+	"let n = 2; let f = fn(a) { fn(b) { a * b + n } }; [wait(spawn(f(3), 4)), wait(spawn(len, [1]))]",
+	"wait(spawn(fn(a) { a / 0 }, 1))", "spawn(1)", "spawn()", "wait(1)", "wait(spawn(fn() { 1 }, 2))",
+	"let c = chan(); let f = fn(n) { if (n > 0) { send(c, n); f(n - 1) } else { close(c) } }; spawn(f, 3); [recv(c), recv(c), recv(c), recv(c)]",
+	"let c = chan(2); send(c, 1); close(c); [select([chan(), c]), select([c], 0), select([chan()], 1)]",
+	"let c = chan(1); close(c); send(c, 1)", "close(chan(1)) + 1", "recv(1)", "chan(-1)", "select(1)", "select([1])",
+	"let a = 2; let f = future(fn() { a * 3 }); [await(f), await([f, future(fn() { len([1]) })], 1000), await([])]",
+	"await([future(fn() { 1 }), future(fn() { 1 / 0 })])", "await(future(fn(a) { a }))", "future(1)", "await([1])",
+	"let k = 3; [pmap([1, 2, 3], fn(x) { x * k }), pool(2, [4, 5, 6, 7, 8], fn(x) { x + k }), pmap([], len), pool(1, [[1]], len)]",
+	"let square = memo(fn(n) { n * n }); pool(8, [1, 2, 1, 2, 3, 1, 2, 3, 3, 1, 2, 1], square)",
+	"pmap([1, 0, 2], fn(x) { 1 / x })", "pool(2, [1, 0, 0], fn(x) { 1 / x })", "pmap(1, len)", "pool(0, [], len)",
+	"let k = 2; [map([1, 2], fn(x) { x * k }), filter([1, 2, 3], fn(x) { x != 2 }), reduce([1, 2, 3], fn(a, b) { a + b }, k)]",
+	"map([1, 0], fn(x) { 1 / x })", "filter(1, len)", "reduce([1], 1)",
+	"[type(1) == INTEGER, type([]), HASH, type(len)]", "let f = fn(x) { type(x) == STRING }; [f(1), f(\"a\")]",
+
+	// what the compiler optimizes
+	"1 + 2 * 3 - -4", "-(5 - 10) == 5", "9223372036854775807 + 1", `1; "a"; fn() { }; 2`, "let a = 1",
+	"if (!true) { 1 } else { 2 }", "let x = 0; if (!x) { 1 } else { 2 }", "if (if (true) { false } else { !true }) { 1 }",
+	"let f = fn(a) { if (a) { return 1; } return 2; 3 }; [f(true), f(false)]", "let f = fn() { let a = 1 }; f()",
+	"let f = fn(a) { if (a) { return 1; } else { 2 } }; [f(true), f(false)]", "fn() { 1; return 2; 3 }()",
+}
+
+// run compiles and runs the input, a compile error is returned as an error object
+func run(t *testing.T, input string, e *evaluator.Evaluator) object.Object {
+	t.Helper()
+	return runOptimized(t, input, e, true)
+}
+
+// runOptimized runs the input compiled with or without optimizations
+func runOptimized(t *testing.T, input string, e *evaluator.Evaluator, optimize bool) object.Object {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if !assert.Empty(t, p.Errors(), "input: %q", input) {
+		t.FailNow()
+	}
+
+	c := compiler.New()
+	c.Optimize(optimize)
+	if err := c.Compile(program); err != nil {
+		if err, ok := err.(*compiler.Error); ok {
+			return &object.Error{Message: err.Diagnostics[0].Message}
+		}
+		return &object.Error{Message: err.Error()}
+	}
+
+	return New(c.Bytecode(), e).Run()
+}
+
+// eval evaluates the input with the evaluator
+func eval(t *testing.T, input string, e *evaluator.Evaluator) object.Object {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	return e.Eval(p.ParseProgram(), object.NewEnv())
+}
+
+// assertSame asserts that the objects are the same value, or errors with the same message
+func assertSame(t *testing.T, expected, actual object.Object, input string) {
+	t.Helper()
+
+	if expected == nil || actual == nil {
+		assert.Equal(t, expected, actual, "input: %q", input)
+		return
+	}
+
+	assert.Equal(t, expected.Type(), actual.Type(), "input: %q", input)
+	if err, ok := expected.(*object.Error); ok {
+		if actual, ok := actual.(*object.Error); ok {
+			assert.Equal(t, err.Message, actual.Message, "input: %q", input)
+		}
+		return
+	}
+	assert.Equal(t, expected.Inspect(), actual.Inspect(), "input: %q", input)
+}
+
+func TestCorpus(t *testing.T) {
+	e := evaluator.New(evaluator.Config{})
+	for _, input := range corpus {
+		expected := eval(t, input, e)
+		assertSame(t, expected, runOptimized(t, input, e, true), input)
+		assertSame(t, expected, runOptimized(t, input, e, false), input)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	tests := []struct {
+		input  string
+		config evaluator.Config
+	}{
+		{"9223372036854775807 + 1", evaluator.Config{CheckedIntegers: true}},
+		{`"ab" * 3`, evaluator.Config{MaxStringLength: 5}},
+		{"[1, 2, 3]", evaluator.Config{MaxArrayLength: 2}},
+		{"{1: 1, 1: 2}", evaluator.Config{MaxHashSize: 1}},
+		{"{1: 1, 2: 2}", evaluator.Config{MaxHashSize: 1}},
+		{"{}.a", evaluator.Config{StrictFields: true}},
+		{`{"a": 1}["b"]`, evaluator.Config{StrictKeys: true}},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(10)", evaluator.Config{MaxCallDepth: 5}},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(10)", evaluator.Config{MaxCallDepth: 11}},
+		{"let f = fn(n) { if (n > 0) { map([n - 1], f) } }; f(20)", evaluator.Config{MaxCallDepth: 10}},
+		{"let f = fn(x) { map([x], f) }; f(1)", evaluator.Config{}},
+	}
+
+	for _, tt := range tests {
+		e := evaluator.New(tt.config)
+		assertSame(t, eval(t, tt.input, e), run(t, tt.input, e), tt.input)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []struct {
+		input  string
+		config evaluator.Config
+	}{
+		{`/// greets
+let greet = fn(name) { println("hi " + name) }; help(greet); greet("you")`, evaluator.Config{}},
+		{`let f = memo(fn(n) { println(n); n }); f(1); f(1); f(2); help(f); help(len)`, evaluator.Config{}},
+		{`input("? ")`, evaluator.Config{}},
+		{`let f = fn() { input() }; f()`, evaluator.Config{Sandbox: &evaluator.Sandbox{}}},
+		{`len("a")`, evaluator.Config{Sandbox: &evaluator.Sandbox{Deny: []string{"len"}}}},
+	}
+
+	for _, tt := range tests {
+		var evalOut, runOut bytes.Buffer
+
+		tt.config.Stdout, tt.config.Stdin = &evalOut, strings.NewReader("yes\n")
+		expected := eval(t, tt.input, evaluator.New(tt.config))
+
+		tt.config.Stdout, tt.config.Stdin = &runOut, strings.NewReader("yes\n")
+		actual := run(t, tt.input, evaluator.New(tt.config))
+
+		assertSame(t, expected, actual, tt.input)
+		assert.Equal(t, evalOut.String(), runOut.String(), "input: %q", tt.input)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	e := evaluator.New(evaluator.Config{})
+	symbols, globals := compiler.NewSymbolTable(), make([]object.Object, compiler.GlobalsSize)
+	var constants []object.Object
+
+	for _, line := range []string{"let a = 1;", "let b = a + 1;", "a + b"} {
+		p := parser.New(lexer.New(line))
+		c := compiler.NewWithState(symbols, constants)
+		if !assert.NoError(t, c.Compile(p.ParseProgram())) {
+			return
+		}
+		constants = c.Bytecode().Constants
+
+		result := NewWithGlobals(c.Bytecode(), e, globals).Run()
+		if line == "a + b" {
+			assert.Equal(t, object.NewInteger(3), result)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	input := "let f = fn(n) { f(n + 1) }; f(0)"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	e := evaluator.New(evaluator.Config{})
+	c := compiler.New()
+	assert.NoError(t, c.Compile(program))
+
+	expected := e.EvalContext(ctx, program, object.NewEnv())
+	assert.Equal(t, "interrupted: context canceled", expected.(*object.Error).Message)
+	assertSame(t, expected, New(c.Bytecode(), e).RunContext(ctx), input)
+}
+
+func TestCall(t *testing.T) {
+	e := evaluator.New(evaluator.Config{})
+	c := compiler.New()
+	assert.NoError(t, c.Compile(parser.New(lexer.New("let add = fn(a, b) { a + b }; add")).ParseProgram()))
+	add := New(c.Bytecode(), e).Run()
+
+	call := func(fn object.Object, args ...object.Object) object.Object {
+		return NewWithGlobals(&compiler.Bytecode{Constants: c.Bytecode().Constants}, e, nil).Call(fn, args...)
+	}
+	assert.Equal(t, object.NewInteger(5), call(add, object.NewInteger(2), object.NewInteger(3)))
+	assert.Equal(t, object.NewInteger(4), call(e.Builtin("len"), &object.String{Value: "four"}))
+	assert.Equal(t, "wrong number of arguments to `add`. got=0, want=2", call(add).(*object.Error).Message)
+	assert.Equal(t, "not a function: INTEGER", call(object.NewInteger(1)).(*object.Error).Message)
+}
+
+func TestMeter(t *testing.T) {
+	input := `let f = fn(n) { if (n > 0) { [n, f(n - 1)] } else { [] } }; let g = fn() { {"a": "b" + "c"} }; g(); f(3)`
+	evalMeter, runMeter := &evaluator.Meter{}, &evaluator.Meter{}
+	assertSame(t, eval(t, input, evaluator.New(evaluator.Config{Meter: evalMeter})), run(t, input, evaluator.New(evaluator.Config{Meter: runMeter})), input)
+	assert.Equal(t, evalMeter.Objects(), runMeter.Objects())
+	assert.Equal(t, evalMeter.Depth(), runMeter.Depth())
+	assert.Greater(t, runMeter.Steps(), int64(0))
+
+	limit := func() evaluator.Config { return evaluator.Config{Meter: &evaluator.Meter{MaxObjects: 6}} }
+	assertSame(t, eval(t, input, evaluator.New(limit())), run(t, input, evaluator.New(limit())), input)
+
+	// steps are statements for the evaluator, but instructions for the virtual machine
+	result := run(t, input, evaluator.New(evaluator.Config{Meter: &evaluator.Meter{MaxSteps: 5}}))
+	assert.Equal(t, "resource limit exceeded: programs can't run more than 5 steps", result.(*object.Error).Message)
+}
+
+// benchmarks are programs exercising what the engines spend their time on, run by BenchmarkEngines
+var benchmarks = []struct {
+	name  string
+	input string
+}{
+	{"fibonacci", `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(20)`},
+	{"strings", `
+let build = fn(n, s) { if (n == 0) { s } else { build(n - 1, s + "ab" + "c") } };
+len(build(1000, ""))`},
+	{"hashes", `
+let churn = fn(n, h) {
+	if (n == 0) {
+		h
+	} else {
+		let next = {"n": n, "prev": h["n"], n: h, "keys": [n, n + 1]};
+		churn(n - 1, next)
+	}
+};
+churn(1000, {"n": 0})["n"]`},
+	{"closures", `
+let adder = fn(a) { fn(b) { a + b } };
+let compose = fn(f, g) { fn(x) { g(f(x)) } };
+let loop = fn(n, acc) {
+	if (n == 0) {
+		acc
+	} else {
+		let step = compose(adder(n), adder(1));
+		loop(n - 1, step(acc))
+	}
+};
+loop(1000, 0)`},
+}
+
+// BenchmarkEngines runs the same programs with the evaluator and on the virtual machine, the program being parsed
+// and compiled ahead.
+func BenchmarkEngines(b *testing.B) {
+	e := evaluator.New(evaluator.Config{})
+
+	for _, bench := range benchmarks {
+		program := parser.New(lexer.New(bench.input)).ParseProgram()
+		c := compiler.New()
+		if err := c.Compile(program); err != nil {
+			b.Fatalf("%s: %s", bench.name, err)
+		}
+		bytecode := c.Bytecode()
+
+		expected := e.Eval(program, object.NewEnv())
+		if actual := New(bytecode, e).Run(); actual.Inspect() != expected.Inspect() {
+			b.Fatalf("%s: got %s on the virtual machine, want %s", bench.name, actual.Inspect(), expected.Inspect())
+		}
+
+		b.Run(bench.name+"/eval", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				e.Eval(program, object.NewEnv())
+			}
+		})
+		b.Run(bench.name+"/vm", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				New(bytecode, e).Run()
+			}
+		})
+	}
+}
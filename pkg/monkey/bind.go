@@ -0,0 +1,215 @@
+package monkey
+
+import (
+	"fmt"
+	"monkey/internal/object"
+	"reflect"
+)
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+)
+
+// Bind sets the name to a Go value in the environment of the engine, for programs to use it without wrappers
+// written by hand. A function becomes a builtin, and a struct, or a pointer to one, a hash of its exported fields
+// and methods, the methods being builtins:
+//
+//	engine.Bind("db", &DB{Name: "users"}) // db.Name, db.Get("key")
+//
+// Builtins convert their arguments to the types of the parameters of the function: integers, floats, strings,
+// booleans, slices and maps from the objects of the same kind, interface{} like ToGo, Object as it is, and
+// other types from the Native objects holding them. Their value is the one of the result of the function
+// converted by FromGo, or null without results, and a non nil error as last result is the error of the call.
+// The results FromGo can't convert, like channels, are Native objects. Other values are set as converted by
+// FromGo.
+func (e *Engine) Bind(name string, value interface{}) error {
+	obj, err := bind(reflect.ValueOf(value))
+	if err != nil {
+		return fmt.Errorf("bind %s: %w", name, err)
+	}
+
+	e.set(name, obj)
+	return nil
+}
+
+// bind returns the object of a value bound by Bind
+func bind(v reflect.Value) (Object, error) {
+	switch {
+	case v.Kind() == reflect.Func && !v.IsNil():
+		return builtin(v), nil
+	case v.Kind() == reflect.Struct, v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct && !v.IsNil():
+		return bindStruct(v)
+	case !v.IsValid():
+		return object.NULL, nil
+	default:
+		return object.FromGo(v.Interface())
+	}
+}
+
+// bindStruct returns the hash of the exported fields and methods of a struct, or of a pointer to one, whose
+// methods include the ones of the pointer
+func bindStruct(v reflect.Value) (Object, error) {
+	hash := object.NewHash()
+	for i := 0; i < v.NumMethod(); i++ {
+		hash.Set(&object.String{Value: v.Type().Method(i).Name}, builtin(v.Method(i)))
+	}
+
+	s := reflect.Indirect(v)
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Type().Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		value, err := bind(s.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Name, err)
+		}
+		hash.Set(&object.String{Value: field.Name}, value)
+	}
+
+	return hash, nil
+}
+
+// builtin returns the builtin calling the function, converting its arguments and results
+func builtin(fn reflect.Value) *object.Builtin {
+	t := fn.Type()
+	params := make([]string, t.NumIn())
+	for i := range params {
+		params[i] = t.In(i).String()
+	}
+	if t.IsVariadic() {
+		params[len(params)-1] = t.In(t.NumIn()-1).Elem().String() + "..."
+	}
+
+	return &object.Builtin{Params: params, Fn: func(args ...object.Object) object.Object {
+		if t.IsVariadic() && len(args) < t.NumIn()-1 {
+			return Errorf("wrong number of arguments. got=%d, want=at least %d", len(args), t.NumIn()-1)
+		}
+		if !t.IsVariadic() && len(args) != t.NumIn() {
+			return Errorf("wrong number of arguments. got=%d, want=%d", len(args), t.NumIn())
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var param reflect.Type
+			if t.IsVariadic() && i >= t.NumIn()-1 {
+				param = t.In(t.NumIn() - 1).Elem()
+			} else {
+				param = t.In(i)
+			}
+			value, err := fromObject(arg, param)
+			if err != nil {
+				return Errorf("argument %d: %s", i+1, err)
+			}
+			in[i] = value
+		}
+
+		out := fn.Call(in)
+		if len(out) > 0 && t.Out(len(out)-1) == errorType {
+			if err := out[len(out)-1]; !err.IsNil() {
+				return Errorf("%s", err.Interface())
+			}
+			out = out[:len(out)-1]
+		}
+		if len(out) == 0 {
+			return object.NULL
+		}
+
+		result, err := object.FromGo(out[0].Interface())
+		if err != nil {
+			return &object.Native{Value: out[0].Interface()}
+		}
+		return result
+	}}
+}
+
+// fromObject returns the value of the Go type an object converts to, see Bind
+func fromObject(obj Object, t reflect.Type) (reflect.Value, error) {
+	if t == objectType {
+		return reflect.ValueOf(&obj).Elem(), nil
+	}
+	if native, ok := obj.(*object.Native); ok && native.Value != nil && reflect.TypeOf(native.Value).AssignableTo(t) {
+		return reflect.ValueOf(native.Value), nil
+	}
+	if obj == object.NULL {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map:
+			return reflect.Zero(t), nil
+		}
+	}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v := reflect.New(t).Elem()
+			if v.OverflowInt(obj.Value) {
+				return v, fmt.Errorf("%d overflows %s", obj.Value, t)
+			}
+			v.SetInt(obj.Value)
+			return v, nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			v := reflect.New(t).Elem()
+			if obj.Value < 0 || v.OverflowUint(uint64(obj.Value)) {
+				return v, fmt.Errorf("%d overflows %s", obj.Value, t)
+			}
+			v.SetUint(uint64(obj.Value))
+			return v, nil
+		case reflect.Float32, reflect.Float64:
+			return reflect.ValueOf(float64(obj.Value)).Convert(t), nil
+		}
+	case *object.Float:
+		if t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64 {
+			return reflect.ValueOf(obj.Value).Convert(t), nil
+		}
+	case *object.String:
+		if t.Kind() == reflect.String {
+			return reflect.ValueOf(obj.Value).Convert(t), nil
+		}
+	case *object.Boolean:
+		if t.Kind() == reflect.Bool {
+			return reflect.ValueOf(obj.Value).Convert(t), nil
+		}
+	case *object.Bytes:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return reflect.ValueOf(append([]byte(nil), obj.Value...)).Convert(t), nil
+		}
+	case *object.Array:
+		if t.Kind() == reflect.Slice {
+			v := reflect.MakeSlice(t, len(obj.Elements), len(obj.Elements))
+			for i, element := range obj.Elements {
+				value, err := fromObject(element, t.Elem())
+				if err != nil {
+					return v, fmt.Errorf("[%d]: %w", i, err)
+				}
+				v.Index(i).Set(value)
+			}
+			return v, nil
+		}
+	case *object.Hash:
+		if t.Kind() == reflect.Map {
+			v := reflect.MakeMapWithSize(t, len(obj.Pairs))
+			for _, pair := range obj.Pairs {
+				key, err := fromObject(pair.Key, t.Key())
+				if err != nil {
+					return v, err
+				}
+				value, err := fromObject(pair.Value, t.Elem())
+				if err != nil {
+					return v, fmt.Errorf("[%s]: %w", pair.Key.Inspect(), err)
+				}
+				v.SetMapIndex(key, value)
+			}
+			return v, nil
+		}
+	}
+
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		if value := ToGo(obj); value != nil {
+			return reflect.ValueOf(value), nil
+		}
+		return reflect.Zero(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+}
@@ -0,0 +1,78 @@
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"monkey/internal/object"
+	"reflect"
+)
+
+// Call calls the function set to the name in the environment of the engine, or the builtin of the name, with the
+// arguments and returns its value, for hosts to call the handlers and callbacks programs declare:
+//
+//	engine.Eval(`let greet = fn(name) { "hello " + name }`)
+//	value, err := engine.Call("greet", "you") // value is "hello you"
+//
+// The arguments are converted like Bind converts values, and the value like Eval does. The error is the one that
+// stopped the function.
+func (e *Engine) Call(name string, args ...interface{}) (interface{}, error) {
+	result, err := e.call(name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.ToGo(result), nil
+}
+
+// CallAs calls the function like Engine.Call does, and converts its value to T like Bind converts the arguments of
+// Go functions, failing if it can't be:
+//
+//	total, err := monkey.CallAs[int](engine, "sum", []int{1, 2})
+func CallAs[T any](e *Engine, name string, args ...interface{}) (T, error) {
+	var value T
+	result, err := e.call(name, args)
+	if err != nil {
+		return value, err
+	}
+
+	v, err := fromObject(result, reflect.TypeOf(&value).Elem())
+	if err != nil {
+		return value, fmt.Errorf("value of %s: %w", name, err)
+	}
+	reflect.ValueOf(&value).Elem().Set(v)
+	return value, nil
+}
+
+// call calls the function of the name with the arguments converted to objects, and returns the value it returned
+func (e *Engine) call(name string, args []interface{}) (Object, error) {
+	fn, ok := e.get(name)
+	if !ok {
+		fn = e.evaluator.Builtin(name)
+	}
+	if err, ok := fn.(*object.Error); ok {
+		return nil, newRuntimeError(err, "", nil)
+	}
+
+	objects := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := bind(reflect.ValueOf(arg))
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of %s: %w", i+1, name, err)
+		}
+		objects[i] = obj
+	}
+
+	ctx, cancel := e.context(context.Background())
+	defer cancel()
+
+	var result object.Object
+	if e.machine != nil {
+		result = e.machine.call(ctx, fn, objects, e.evaluator)
+	} else {
+		result = e.evaluator.CallContext(ctx, fn, objects...)
+	}
+	if err, ok := result.(*object.Error); ok {
+		return nil, newRuntimeError(err, "", ctx)
+	}
+	return result, nil
+}
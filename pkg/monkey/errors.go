@@ -0,0 +1,100 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monkey/internal/object"
+	"strings"
+)
+
+// The kinds of runtime errors, for errors.Is:
+//
+//	if errors.Is(err, monkey.ErrResourceLimit) {
+//		// the program went over the quotas of the engine
+//	}
+var (
+	ErrInterrupted   = errors.New("interrupted")             // stopped by the timeout of the engine or a context
+	ErrResourceLimit = errors.New("resource limit exceeded") // went over a quota of the engine
+	ErrStackOverflow = errors.New("stack overflow")          // went over the call depth of the engine
+)
+
+// errorKinds are the kinds of the error objects of the runtime errors, by the error they are
+var errorKinds = map[error]object.ErrorKind{
+	ErrInterrupted:   object.InterruptedError,
+	ErrResourceLimit: object.ResourceLimitError,
+	ErrStackOverflow: object.StackOverflowError,
+}
+
+// RuntimeError is the error that stopped a program, with where it happened:
+//
+//	var runtimeErr *monkey.RuntimeError
+//	if errors.As(err, &runtimeErr) {
+//		log.Printf("script failed at line %d: %s", runtimeErr.Line, runtimeErr.Message)
+//	}
+//
+// It unwraps to the error of the context that interrupted the program, if any, so that errors.Is(err,
+// context.DeadlineExceeded) tells whether the timeout of the engine stopped it.
+type RuntimeError struct {
+	Filename string // the file the program was read from, empty for Eval and Call
+	Message  string
+
+	// Line and Column are where the error happened in the source, 0 when not known, like for an error of Call
+	// itself or any error of the VM, whose bytecode doesn't keep where its instructions come from.
+	Line, Column int
+
+	// Stack holds the calls in progress when the error happened, innermost first, like "f called at line 2,
+	// column 2".
+	Stack []string
+
+	err   *object.Error
+	cause error // the error of the context that interrupted the program
+}
+
+// newRuntimeError returns the Go error of the error object that stopped a program, interrupted or not by ctx
+func newRuntimeError(err *object.Error, filename string, ctx context.Context) *RuntimeError {
+	runtimeErr := &RuntimeError{Filename: filename, Message: err.Message, Stack: err.StackLines(), err: err}
+	if err.Token != nil {
+		runtimeErr.Line, runtimeErr.Column = err.Token.Line, err.Token.Column
+	}
+	if ctx != nil && err.Kind == object.InterruptedError {
+		runtimeErr.cause = ctx.Err()
+	}
+
+	return runtimeErr
+}
+
+// Error returns the message with where the error happened, and the stack on the following lines.
+func (e *RuntimeError) Error() string {
+	var out strings.Builder
+	if e.Filename != "" {
+		out.WriteString(e.Filename + ": ")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&out, "line %d, column %d: ", e.Line, e.Column)
+	}
+	out.WriteString(e.Message)
+	for _, line := range e.Stack {
+		out.WriteString("\n\t" + line)
+	}
+
+	return out.String()
+}
+
+// Is reports whether the error is of the kind of the target, one of ErrInterrupted, ErrResourceLimit and
+// ErrStackOverflow. The interpreter raises them, never a throw of the program or a builtin of the host, whatever
+// their message.
+func (e *RuntimeError) Is(target error) bool {
+	kind, ok := errorKinds[target]
+	return ok && e.err != nil && e.err.Kind == kind
+}
+
+// Unwrap returns the error of the context that interrupted the program if it was, the error object of the
+// interpreter otherwise.
+func (e *RuntimeError) Unwrap() error {
+	if e.cause != nil {
+		return e.cause
+	}
+
+	return e.err
+}
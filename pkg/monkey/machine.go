@@ -0,0 +1,59 @@
+package monkey
+
+import (
+	"context"
+	"monkey/internal/ast"
+	"monkey/internal/compiler"
+	"monkey/internal/evaluator"
+	"monkey/internal/object"
+	"monkey/internal/vm"
+)
+
+// machine keeps the state of the compiler and of the virtual machine from one source to the next, like the repl
+// does from one line to the next
+type machine struct {
+	symbols  *compiler.SymbolTable
+	bytecode *compiler.Bytecode // of the last program, whose constants and names are the ones of every program
+	globals  []object.Object
+}
+
+func newMachine() *machine {
+	return &machine{
+		symbols:  compiler.NewSymbolTable(),
+		bytecode: &compiler.Bytecode{},
+		globals:  make([]object.Object, compiler.GlobalsSize),
+	}
+}
+
+// run compiles the program and runs it, returning the error of the compiler if it can't be compiled
+func (m *machine) run(ctx context.Context, program *ast.Program, e *evaluator.Evaluator) (object.Object, error) {
+	c := compiler.NewWithState(m.symbols, m.bytecode.Constants)
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+	m.bytecode = c.Bytecode()
+
+	return vm.NewWithGlobals(m.bytecode, e, m.globals).RunContext(ctx), nil
+}
+
+// call calls the function, a closure of the programs run so far or a builtin
+func (m *machine) call(ctx context.Context, fn object.Object, args []object.Object, e *evaluator.Evaluator) object.Object {
+	bytecode := *m.bytecode
+	bytecode.Instructions = nil
+	return vm.NewWithGlobals(&bytecode, e, m.globals).CallContext(ctx, fn, args...)
+}
+
+// get returns the value of the global of the name
+func (m *machine) get(name string) (object.Object, bool) {
+	symbol, ok := m.symbols.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || m.globals[symbol.Index] == nil {
+		return nil, false
+	}
+
+	return m.globals[symbol.Index], true
+}
+
+// set sets the global of the name to the value
+func (m *machine) set(name string, value object.Object) {
+	m.globals[m.symbols.Define(name).Index] = value
+}
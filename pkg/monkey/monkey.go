@@ -0,0 +1,281 @@
+// Package monkey embeds the Monkey interpreter in Go programs. An Engine evaluates sources one after the other in
+// the same environment, like the lines of the repl, and returns their values as Go values:
+//
+//	engine := monkey.New()
+//	value, err := engine.Eval(`let double = fn(x) { x * 2 }; double(21)`)
+//	// value is int64(42)
+//
+// The lexer, the parser and the evaluator stay internal, behind the Engine, so that they can change without
+// breaking the programs embedding Monkey.
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"monkey/internal/ast"
+	"monkey/internal/evaluator"
+	"monkey/internal/lexer"
+	"monkey/internal/module"
+	"monkey/internal/object"
+	"monkey/internal/parser"
+	"os"
+	"strings"
+	"time"
+)
+
+// Engine evaluates Monkey sources in an environment of its own, so that the lets of a source are there for the
+// next ones. An Engine evaluates one source at a time.
+type Engine struct {
+	evaluator *evaluator.Evaluator
+	meter     *evaluator.Meter // what the last evaluation used
+	timeout   time.Duration
+	env       *object.Environment // the environment of the evaluator, nil with the virtual machine
+	machine   *machine            // the state of the virtual machine, nil with the evaluator
+}
+
+type (
+	// Object is a Monkey value, as the builtins of the host get and return them. FromGo and ToGo convert them
+	// from and to Go values.
+	Object = object.Object
+
+	// BuiltinFunction is the function of a builtin, called with the arguments of the calls. It returns the value of
+	// the call, or an error made by Errorf to stop the program.
+	BuiltinFunction = object.BuiltinFunction
+)
+
+// SyntaxError is the error of a source that can't be parsed, with every problem found in it.
+type SyntaxError struct {
+	Filename string   // the file the source was read from, empty for Eval
+	Errors   []string // the problems, like "line 1, column 15: expected next token to be ), got ; instead"
+}
+
+func (e *SyntaxError) Error() string {
+	prefix := ""
+	if e.Filename != "" {
+		prefix = e.Filename + ": "
+	}
+
+	return prefix + strings.Join(e.Errors, "\n"+prefix)
+}
+
+// New returns an engine with an empty environment, configured by the options:
+//
+//	engine := monkey.New(monkey.WithTimeout(time.Second), monkey.WithStdout(&out), monkey.WithEngine(monkey.VM))
+//
+// Without options, it has the default settings of the interpreter.
+func New(opts ...Option) *Engine {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	o.config.Meter = &o.meter
+	e := &Engine{evaluator: evaluator.New(o.config), meter: o.config.Meter, timeout: o.timeout}
+	for _, name := range o.without {
+		e.evaluator.Remove(name)
+	}
+	if o.backend == VM {
+		e.machine = newMachine()
+	} else {
+		e.env = object.NewSyncEnv() // the runs of programs share it
+	}
+
+	return e
+}
+
+// RegisterBuiltin adds a builtin to the ones of the engine, or replaces the one of the same name, for programs to
+// call the host:
+//
+//	engine.RegisterBuiltin("lookup", func(args ...monkey.Object) monkey.Object {
+//		if len(args) != 1 {
+//			return monkey.Errorf("wrong number of arguments to `lookup`. got=%d, want=1", len(args))
+//		}
+//		value, err := monkey.FromGo(table[monkey.ToGo(args[0]).(string)])
+//		...
+//	})
+//
+// Builtins are registered before the engine evaluates anything.
+func (e *Engine) RegisterBuiltin(name string, fn BuiltinFunction) {
+	e.evaluator.Register(name, &object.Builtin{Fn: fn, Params: []string{"args..."}})
+	if e.machine != nil {
+		// the compiler only knows the builtins every evaluator has, the registered ones are globals of the machine
+		e.machine.set(name, e.evaluator.Builtin(name))
+	}
+}
+
+// Eval evaluates the source and returns its value, see EvalFile.
+func (e *Engine) Eval(src string) (interface{}, error) {
+	return e.eval(context.Background(), src, "")
+}
+
+// EvalContext evaluates the source like Eval, stopping the program once the context is done, for a server to stop
+// the scripts of a request it gave up on. The evaluator checks the context before every statement and every
+// iteration of a loop, the virtual machine before every jump and call. The error the program stops with is
+// ErrInterrupted, unwrapping to the error of the context. The timeout of the engine still applies.
+func (e *Engine) EvalContext(ctx context.Context, src string) (interface{}, error) {
+	return e.eval(ctx, src, "")
+}
+
+// EvalFile evaluates the source of the file and returns its value: the value of its last statement, or nil for a
+// source without statements. The modules it imports with relative paths are found from its directory. Integers are
+// int64, floats float64, arrays []interface{} and hashes maps, the values without a Go equivalent, like functions,
+// are returned as they are. The error is a *SyntaxError if the source can't be parsed, or the error that stopped the
+// program.
+func (e *Engine) EvalFile(path string) (interface{}, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.eval(context.Background(), string(src), path)
+}
+
+// EvalObject evaluates the source like Eval, but returns its value as the object of the interpreter, not converted
+// to Go, for hosts to hand it back to programs as it is, like a function.
+func (e *Engine) EvalObject(src string) (Object, error) {
+	return e.evalObject(context.Background(), src, "")
+}
+
+func (e *Engine) eval(parent context.Context, src, filename string) (interface{}, error) {
+	result, err := e.evalObject(parent, src, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.ToGo(result), nil
+}
+
+// evalObject evaluates the source and returns its value as it is
+func (e *Engine) evalObject(parent context.Context, src, filename string) (Object, error) {
+	program, err := parse(src, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := e.context(parent)
+	defer cancel()
+	if filename != "" {
+		ctx = evaluator.InFile(ctx, module.File{Name: filename})
+	}
+
+	var result object.Object
+	if e.machine != nil {
+		var err error
+		if result, err = e.machine.run(ctx, program, e.evaluator); err != nil {
+			if filename != "" {
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+			return nil, err
+		}
+	} else {
+		result = e.evaluator.EvalContext(ctx, program, e.env)
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		return nil, newRuntimeError(err, filename, ctx)
+	}
+	return result, nil
+}
+
+// Get returns the value set to the name in the environment of the engine, converted like Eval converts the value
+// of a source, and false if the sources evaluated so far didn't set the name.
+func (e *Engine) Get(name string) (interface{}, bool) {
+	value, ok := e.get(name)
+	if !ok {
+		return nil, false
+	}
+
+	return object.ToGo(value), true
+}
+
+// Lookup returns the object set to the name in the environment of the engine as it is, and false if the sources
+// evaluated so far didn't set the name.
+func (e *Engine) Lookup(name string) (Object, bool) {
+	return e.get(name)
+}
+
+// Set sets the name to the object in the environment of the engine, for the sources evaluated next to use, like
+// Bind does with the object of a Go value.
+func (e *Engine) Set(name string, value Object) {
+	e.set(name, value)
+}
+
+// Usage is what an evaluation used, see Quotas.
+type Usage struct {
+	Steps     int64 // the statements that ran, or the instructions with the virtual machine
+	Objects   int64 // the strings, arrays, hashes and functions that literals and operators created
+	CallDepth int   // how many calls were in progress at most
+}
+
+// Usage returns what the last Eval, EvalFile or Call of the engine used, whether it succeeded or not.
+func (e *Engine) Usage() Usage {
+	return Usage{Steps: e.meter.Steps(), Objects: e.meter.Objects(), CallDepth: e.meter.Depth()}
+}
+
+// parse parses the source, returning a *SyntaxError if it can't be
+func parse(src, filename string) (*ast.Program, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		err := &SyntaxError{Filename: filename}
+		for _, d := range p.Diagnostics() {
+			err.Errors = append(err.Errors, d.String())
+		}
+		return nil, err
+	}
+
+	return program, nil
+}
+
+// context returns the context of an evaluation, see timeoutContext. The usage of the evaluation starts from
+// scratch.
+func (e *Engine) context(parent context.Context) (context.Context, context.CancelFunc) {
+	e.meter.Reset()
+	return e.timeoutContext(parent)
+}
+
+// timeoutContext returns the context of an evaluation, done with the parent or after the timeout of the engine if
+// it has one
+func (e *Engine) timeoutContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if e.timeout > 0 {
+		return context.WithTimeout(parent, e.timeout)
+	}
+
+	return context.WithCancel(parent)
+}
+
+// get returns the value set to the name in the environment of the engine
+func (e *Engine) get(name string) (Object, bool) {
+	if e.machine != nil {
+		return e.machine.get(name)
+	}
+
+	return e.env.Get(name)
+}
+
+// set sets the name to the value in the environment of the engine
+func (e *Engine) set(name string, value Object) {
+	if e.machine != nil {
+		e.machine.set(name, value)
+		return
+	}
+
+	e.env.Set(name, value)
+}
+
+// FromGo returns the object of a Go value: nil is null, booleans, integers, floats and strings are the objects of
+// the same kind, slices arrays and maps and structs hashes. It fails for the values that can't be converted, like
+// functions and channels.
+func FromGo(value interface{}) (Object, error) {
+	return object.FromGo(value)
+}
+
+// ToGo returns the Go value of an object, like Eval does for the value of a source.
+func ToGo(obj Object) interface{} {
+	return object.ToGo(obj)
+}
+
+// Errorf returns an error with the formatted message, for a builtin to stop the program calling it.
+func Errorf(format string, a ...interface{}) Object {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,469 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"", nil},
+		{"1 + 2", int64(3)},
+		{`"a" + "b"`, "ab"},
+		{"!true", false},
+		{"[1, [2]]", []interface{}{int64(1), []interface{}{int64(2)}}},
+		{`{"a": 1}`, map[string]interface{}{"a": int64(1)}},
+		{"{1: if (false) { 1 }}", map[interface{}]interface{}{int64(1): nil}},
+	}
+
+	for _, tt := range tests {
+		value, err := New().Eval(tt.input)
+		assert.NoError(t, err, tt.input)
+		assert.Equal(t, tt.expected, value, tt.input)
+	}
+}
+
+func TestEvalEnvironment(t *testing.T) {
+	engine := New()
+	_, err := engine.Eval("let double = fn(x) { x * 2 };")
+	assert.NoError(t, err)
+
+	value, err := engine.Eval("double(21)")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), value)
+
+	_, err = engine.Eval(`let names = ["a", "b"];`)
+	assert.NoError(t, err)
+	value, ok := engine.Get("names")
+	assert.True(t, ok)
+	assert.Equal(t, []interface{}{"a", "b"}, value)
+	_, ok = engine.Get("missing")
+	assert.False(t, ok)
+
+	for _, backend := range []Backend{Evaluator, VM} {
+		engine := New(WithEngine(backend))
+		double, err := engine.EvalObject("fn(x) { x * 2 }")
+		assert.NoError(t, err, backend)
+		assert.EqualValues(t, "FUNCTION", double.Type(), backend)
+		engine.Set("twice", double)
+		value, err := engine.EvalObject("let n = twice(21); n")
+		assert.NoError(t, err, backend)
+		assert.Equal(t, "42", value.Inspect(), backend)
+		n, ok := engine.Lookup("n")
+		assert.True(t, ok, backend)
+		assert.Equal(t, value, n, backend)
+		_, ok = engine.Lookup("missing")
+		assert.False(t, ok, backend)
+	}
+
+	_, err = New().Eval("double(21)")
+	assert.EqualError(t, err, "line 1, column 1: identifier not found: double")
+}
+
+func TestEvalErrors(t *testing.T) {
+	_, err := New().Eval("let = 1;\nlet x = (1;")
+	var syntaxErr *SyntaxError
+	if assert.ErrorAs(t, err, &syntaxErr) {
+		assert.Len(t, syntaxErr.Errors, 4)
+		assert.Equal(t, "line 1, column 5: expected next token to be IDENT, got = instead", syntaxErr.Errors[0])
+	}
+
+	_, err = New().Eval("let f = fn() { 1 / 0 };\nf()")
+	assert.EqualError(t, err, "line 1, column 18: division by zero\n\tf called at line 2, column 2")
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	table := map[string]interface{}{"answer": 42, "names": []string{"a", "b"}}
+	engine := New()
+	engine.RegisterBuiltin("lookup", func(args ...Object) Object {
+		key, ok := ToGo(args[0]).(string)
+		if !ok {
+			return Errorf("key of `lookup` must be STRING. got %s", args[0].Type())
+		}
+		value, err := FromGo(table[key])
+		if err != nil {
+			return Errorf("%s", err)
+		}
+		return value
+	})
+
+	value, err := engine.Eval(`[lookup("answer") + 1, lookup("names")[1], lookup("none")]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(43), "b", nil}, value)
+
+	_, err = engine.Eval("lookup(1)")
+	assert.EqualError(t, err, "line 1, column 7: key of `lookup` must be STRING. got INTEGER")
+
+	machine := New(WithEngine(VM))
+	machine.RegisterBuiltin("double", func(args ...Object) Object {
+		value, _ := FromGo(ToGo(args[0]).(int64) * 2)
+		return value
+	})
+	value, err = machine.Eval("double(4) + 1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), value)
+}
+
+type store struct {
+	Name string
+	data map[string]int
+}
+
+func (s *store) Get(key string) (int, error) {
+	value, ok := s.data[key]
+	if !ok {
+		return 0, fmt.Errorf("no %s in %s", key, s.Name)
+	}
+	return value, nil
+}
+
+func (s *store) Put(key string, value int) { s.data[key] = value }
+
+func (s *store) Keys(prefix string, more ...string) []string {
+	return append([]string{prefix}, more...)
+}
+
+func TestBind(t *testing.T) {
+	engine := New()
+	s := &store{Name: "users", data: map[string]int{}}
+	assert.NoError(t, engine.Bind("db", s))
+	assert.NoError(t, engine.Bind("sum", func(xs []float64) float64 {
+		total := 0.0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	}))
+	assert.NoError(t, engine.Bind("limit", 10))
+	assert.NoError(t, engine.Bind("open", func(name string) chan int { return make(chan int) }))
+	assert.NoError(t, engine.Bind("close", func(c chan int) { close(c) }))
+
+	value, err := engine.Eval(`db.Put("a", limit); [db.Name, db.Get("a"), db.Keys("x", "y"), sum([1, 2]), close(open("c"))]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"users", int64(10), []interface{}{"x", "y"}, 3.0, nil}, value)
+	assert.Equal(t, 10, s.data["a"])
+
+	for input, message := range map[string]string{
+		`db.Get("b")`:   "line 1, column 7: no b in users",
+		`db.Put("a")`:   "line 1, column 7: wrong number of arguments. got=1, want=2",
+		`db.Put(1, 2)`:  "line 1, column 7: argument 1: cannot use INTEGER as string",
+		`db.Keys()`:     "line 1, column 8: wrong number of arguments. got=0, want=at least 1",
+		`sum([1, "a"])`: "line 1, column 4: argument 1: [1]: cannot use STRING as float64",
+	} {
+		_, err := engine.Eval(input)
+		assert.EqualError(t, err, message, input)
+	}
+
+	assert.Error(t, engine.Bind("f", struct{ F func() }{}))
+}
+
+func TestCall(t *testing.T) {
+	engine := New()
+	_, err := engine.Eval(`
+let greet = fn(name) { "hello " + name };
+let apply = fn(f, x) { f(x) };
+let fail = fn() { 1 / 0 };
+let hello = "hello";
+`)
+	assert.NoError(t, err)
+
+	value, err := engine.Call("greet", "you")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello you", value)
+
+	value, err = engine.Call("apply", func(x int) int { return x * 2 }, 21)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), value)
+
+	value, err = engine.Call("len", []int{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), value)
+
+	length, err := CallAs[int](engine, "len", "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, length)
+
+	names, err := CallAs[[]string](engine, "apply", func(s string) []string { return []string{s, s} }, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "a"}, names)
+
+	_, err = CallAs[int](engine, "greet", "you")
+	assert.EqualError(t, err, "value of greet: cannot use STRING as int")
+
+	for name, message := range map[string]string{
+		"fail":    "line 4, column 21: division by zero\n\tfail",
+		"missing": "identifier not found: missing",
+		"hello":   "not a function: STRING",
+	} {
+		_, err := engine.Call(name)
+		assert.EqualError(t, err, message, name)
+	}
+	_, err = engine.Call("greet", make(chan int))
+	assert.EqualError(t, err, "argument 1 of greet: cannot convert chan int to an object")
+}
+
+func TestOptions(t *testing.T) {
+	for _, backend := range []Backend{Evaluator, VM} {
+		var out bytes.Buffer
+		engine := New(WithEngine(backend), WithStdout(&out), WithStdin(strings.NewReader("you\n")), WithoutBuiltins("len"))
+		assert.NoError(t, engine.Bind("double", func(x int) int { return x * 2 }))
+
+		value, err := engine.Eval(`let greet = fn(name) { println("hello " + name) }; greet(input()); double(21)`)
+		assert.NoError(t, err, backend)
+		assert.Equal(t, int64(42), value, backend)
+		assert.Equal(t, "hello you\n", out.String(), backend)
+
+		_, err = engine.Call("greet", "again")
+		assert.NoError(t, err, backend)
+		assert.Equal(t, "hello you\nhello again\n", out.String(), backend)
+
+		_, err = engine.Eval(`len("a")`)
+		assert.ErrorContains(t, err, "len is disabled by the configuration of the engine", backend)
+
+		engine = New(WithEngine(backend), WithTimeout(10*time.Millisecond))
+		_, err = engine.Eval("let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(40)")
+		assert.ErrorContains(t, err, "interrupted: context deadline exceeded", backend)
+		_, err = engine.Call("fib", 40)
+		assert.ErrorContains(t, err, "interrupted: context deadline exceeded", backend)
+
+		engine = New(WithEngine(backend), WithMaxDepth(10), WithCheckedIntegers(), WithSandbox())
+		_, err = engine.Eval("let f = fn(n) { if (n > 0) { f(n - 1) } }; f(20)")
+		assert.ErrorContains(t, err, "stack overflow: more than 10 calls in progress", backend)
+		_, err = engine.Eval("9223372036854775807 + 1")
+		assert.ErrorContains(t, err, "integer overflow", backend)
+		_, err = engine.Eval("input()")
+		assert.ErrorContains(t, err, "input is not available in the sandbox", backend)
+	}
+
+	_, err := New(WithEngine(VM)).Eval("let n = 0;\nn = 1")
+	assert.EqualError(t, err, "line 2, column 3: assignments are not supported by the virtual machine yet")
+}
+
+func TestOutput(t *testing.T) {
+	var out Output
+	engine := New(WithOutput(&out))
+
+	_, err := engine.Eval(`println("a", 1); eprintln("oops")`)
+	assert.NoError(t, err)
+	assert.Equal(t, "a 1\n", out.Stdout())
+	assert.Equal(t, "oops\n", out.Stderr())
+
+	out.Reset()
+	_, err = engine.Eval(`println("b")`)
+	assert.NoError(t, err)
+	assert.Equal(t, "b\n", out.Stdout())
+	assert.Empty(t, out.Stderr())
+
+	var errOut bytes.Buffer
+	_, err = New(WithStderr(&errOut)).Eval(`eprintln("to", "stderr")`)
+	assert.NoError(t, err)
+	assert.Equal(t, "to stderr\n", errOut.String())
+}
+
+func TestQuotas(t *testing.T) {
+	const fib = "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };"
+	for _, backend := range []Backend{Evaluator, VM} {
+		engine := New(WithEngine(backend), WithQuotas(Quotas{MaxSteps: 100000, MaxObjects: 3, MaxCallDepth: 50, MaxStringLength: 4}))
+
+		value, err := engine.Eval(fib + "fib(10)")
+		assert.NoError(t, err, backend)
+		assert.Equal(t, int64(55), value, backend)
+		usage := engine.Usage()
+		assert.Greater(t, usage.Steps, int64(177), backend)
+		assert.Equal(t, int64(1), usage.Objects, backend)
+		assert.Equal(t, 10, usage.CallDepth, backend)
+
+		_, err = engine.Call("fib", 30)
+		assert.ErrorContains(t, err, "resource limit exceeded: programs can't run more than 100000 steps", backend)
+		_, err = engine.Eval("[[1], [2], [3]]")
+		assert.ErrorContains(t, err, "resource limit exceeded: programs can't create more than 3 objects", backend)
+		assert.Equal(t, int64(4), engine.Usage().Objects, backend)
+		_, err = engine.Eval("let down = fn(n) { if (n > 0) { down(n - 1) } }; down(100)")
+		assert.ErrorContains(t, err, "stack overflow: more than 50 calls in progress", backend)
+		_, err = engine.Eval(`"ab" * 3`)
+		assert.ErrorContains(t, err, "strings can't be longer than 4 bytes", backend)
+
+		engine = New(WithEngine(backend), WithQuotas(Quotas{MaxStringLength: 10, MaxArrayLength: 3}))
+		value, err = engine.Eval(`let grow = fn(s, n) { if (n == 0) { s } else { grow(join([s, s], ""), n - 1) } }; grow("ab", 2)`)
+		assert.NoError(t, err, backend)
+		assert.Equal(t, "abababab", value, backend)
+		_, err = engine.Eval(`grow("ab", 3)`)
+		assert.ErrorContains(t, err, "resource limit exceeded: strings can't be longer than 10 bytes", backend)
+		_, err = engine.Eval(`str([100, 200, 300])`)
+		assert.ErrorContains(t, err, "resource limit exceeded: strings can't be longer than 10 bytes", backend)
+		value, err = engine.Eval(`let fill = fn(xs, n) { if (n == 0) { xs } else { fill(push(xs, n), n - 1) } }; len(fill([], 3))`)
+		assert.NoError(t, err, backend)
+		assert.Equal(t, int64(3), value, backend)
+		_, err = engine.Eval(`fill([], 4)`)
+		assert.ErrorContains(t, err, "resource limit exceeded: arrays can't have more than 3 elements", backend)
+		_, err = engine.Eval(`split("a,b,c,d", ",")`)
+		assert.ErrorIs(t, err, ErrResourceLimit, backend)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	for _, backend := range []Backend{Evaluator, VM} {
+		engine := New(WithEngine(backend))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := engine.EvalContext(ctx, "let n = 1; let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(40)")
+		cancel()
+		assert.ErrorIs(t, err, ErrInterrupted, backend)
+		assert.ErrorIs(t, err, context.DeadlineExceeded, backend)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		_, err = engine.EvalContext(ctx, `len("")`)
+		assert.ErrorIs(t, err, context.Canceled, backend)
+
+		value, err := engine.EvalContext(context.Background(), "n > 0")
+		assert.NoError(t, err, backend)
+		assert.Equal(t, true, value, backend)
+	}
+}
+
+func TestRuntimeError(t *testing.T) {
+	engine := New(WithTimeout(10*time.Millisecond), WithQuotas(Quotas{MaxObjects: 1}))
+	_, err := engine.Eval("let f = fn() { 1 / 0 };\nf()")
+
+	var runtimeErr *RuntimeError
+	if assert.ErrorAs(t, err, &runtimeErr) {
+		assert.Equal(t, "division by zero", runtimeErr.Message)
+		assert.Equal(t, 1, runtimeErr.Line)
+		assert.Equal(t, 18, runtimeErr.Column)
+		assert.Equal(t, []string{"f called at line 2, column 2"}, runtimeErr.Stack)
+	}
+	assert.False(t, errors.Is(err, ErrInterrupted))
+
+	_, err = engine.Eval("let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(40)")
+	assert.ErrorIs(t, err, ErrInterrupted)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, ErrResourceLimit)
+
+	_, err = engine.Eval("[[1]]")
+	assert.ErrorIs(t, err, ErrResourceLimit)
+	assert.NotErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = engine.Call("missing")
+	if assert.ErrorAs(t, err, &runtimeErr) {
+		assert.Equal(t, "identifier not found: missing", runtimeErr.Message)
+		assert.Zero(t, runtimeErr.Line)
+	}
+
+	_, err = engine.Eval(`throw "stack overflow: thrown"`)
+	assert.EqualError(t, err, "line 1, column 1: stack overflow: thrown")
+	assert.NotErrorIs(t, err, ErrStackOverflow)
+	engine.RegisterBuiltin("fail", func(args ...Object) Object { return Errorf("interrupted: by the host") })
+	_, err = engine.Eval("fail()")
+	assert.ErrorContains(t, err, "interrupted: by the host")
+	assert.NotErrorIs(t, err, ErrInterrupted)
+
+	_, err = New(WithEngine(VM)).Eval("let f = fn() { 1 / 0 };\nf()")
+	if assert.ErrorAs(t, err, &runtimeErr) {
+		assert.Equal(t, "division by zero", runtimeErr.Message)
+		assert.Zero(t, runtimeErr.Line, "the VM doesn't know where its errors happen")
+	}
+
+	path := filepath.Join(t.TempDir(), "a.mk")
+	assert.NoError(t, os.WriteFile(path, []byte("\n-true"), 0o644))
+	_, err = New().EvalFile(path)
+	assert.EqualError(t, err, path+": line 2, column 1: unknown operator: -BOOLEAN")
+}
+
+func TestProgram(t *testing.T) {
+	for _, backend := range []Backend{Evaluator, VM} {
+		engine := New(WithEngine(backend), WithQuotas(Quotas{MaxObjects: 2}))
+		assert.NoError(t, engine.Bind("double", func(x int) int { return x * 2 }))
+		_, err := engine.Eval("let base = 100;")
+		assert.NoError(t, err, backend)
+
+		program, err := engine.Compile("let x = double(n); let pair = [n, base + x]; pair")
+		if !assert.NoError(t, err, backend) {
+			continue
+		}
+
+		var wg sync.WaitGroup
+		results := make([]interface{}, 20)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				value, err := program.Run(map[string]interface{}{"n": i, "unused": true})
+				assert.NoError(t, err, backend)
+				results[i] = value
+			}(i)
+		}
+		wg.Wait()
+		for i, result := range results {
+			assert.Equal(t, []interface{}{int64(i), int64(100 + 2*i)}, result, backend)
+		}
+
+		_, err = engine.Eval("x")
+		assert.ErrorContains(t, err, "identifier not found: x", backend)
+
+		_, err = program.Run(nil)
+		assert.ErrorContains(t, err, "identifier not found: n", backend)
+
+		program, err = engine.Compile("[[[n]]]")
+		assert.NoError(t, err, backend)
+		_, err = program.Run(map[string]interface{}{"n": 1})
+		assert.ErrorIs(t, err, ErrResourceLimit, backend)
+	}
+
+	// run with -race: the runs assign to a global of the engine at once
+	engine := New()
+	assert.NoError(t, engine.Bind("last", 0))
+	program, err := engine.Compile("last = n")
+	assert.NoError(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := program.Run(map[string]interface{}{"n": i})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	value, err := engine.Eval("last")
+	assert.NoError(t, err)
+	assert.IsType(t, int64(0), value)
+
+	_, err = New().Compile("let = 1")
+	assert.IsType(t, &SyntaxError{}, err)
+}
+
+func TestEvalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.mk")
+	assert.NoError(t, os.WriteFile(path, []byte("let x = 2;\nx * 3"), 0o644))
+
+	value, err := New().EvalFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), value)
+
+	assert.NoError(t, os.WriteFile(path, []byte("x +"), 0o644))
+	_, err = New().EvalFile(path)
+	assert.ErrorContains(t, err, path+": line 1, column")
+
+	_, err = New().EvalFile(filepath.Join(t.TempDir(), "missing.mk"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "lib.mk"), []byte("let half = fn(x) { x / 2 };"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.mk"), []byte(`import("./lib").half(8)`), 0o644))
+	value, err = New().EvalFile(filepath.Join(dir, "main.mk"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), value)
+}
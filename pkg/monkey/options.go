@@ -0,0 +1,114 @@
+package monkey
+
+import (
+	"io"
+	"monkey/internal/evaluator"
+	"time"
+)
+
+// Backend is what runs the sources of an engine.
+type Backend int
+
+const (
+	Evaluator Backend = iota // walks the trees of the sources, the default
+	VM                       // compiles the sources to bytecode run by the virtual machine, faster for busy programs
+)
+
+type (
+	// Option configures an engine, see New.
+	Option func(*options)
+
+	// options holds the settings of an engine
+	options struct {
+		config  evaluator.Config
+		meter   evaluator.Meter
+		timeout time.Duration
+		without []string
+		backend Backend
+	}
+)
+
+// WithTimeout stops every Eval, EvalFile and Call of the engine taking longer than d with an error.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithMaxDepth sets how many calls of Monkey functions can be in progress at once, a call going deeper being a
+// stack overflow error.
+func WithMaxDepth(n int) Option {
+	return func(o *options) { o.config.MaxCallDepth = n }
+}
+
+// WithStdout sets where builtins like println write to, os.Stdout by default.
+func WithStdout(w io.Writer) Option {
+	return func(o *options) { o.config.Stdout = w }
+}
+
+// WithStdin sets where the input builtin reads from, os.Stdin by default.
+func WithStdin(r io.Reader) Option {
+	return func(o *options) { o.config.Stdin = r }
+}
+
+// WithoutBuiltins takes the builtins of the names away from the programs of the engine.
+func WithoutBuiltins(names ...string) Option {
+	return func(o *options) { o.without = append(o.without, names...) }
+}
+
+// WithSandbox restricts the programs of the engine to the builtins that keep to the interpreter, taking away the
+// ones reaching out to the host like input, and keeps them from importing other programs, like a server running the
+// snippets its users send needs.
+func WithSandbox() Option {
+	return func(o *options) { o.config.Sandbox = &evaluator.Sandbox{} }
+}
+
+// WithCheckedIntegers makes integer arithmetic overflowing 64 bits an error, instead of wrapping around.
+func WithCheckedIntegers() Option {
+	return func(o *options) { o.config.CheckedIntegers = true }
+}
+
+// WithEngine sets what runs the sources of the engine, the Evaluator by default. The VM doesn't compile for loops,
+// assignments, break, continue, try and throw yet: a source using them fails with the error of the compiler,
+// pointing at the first one. The builtins registered on the engine and the other options apply to both.
+func WithEngine(backend Backend) Option {
+	return func(o *options) { o.backend = backend }
+}
+
+// WithStderr sets where eprintln writes to, os.Stderr by default.
+func WithStderr(w io.Writer) Option {
+	return func(o *options) { o.config.Stderr = w }
+}
+
+// WithOutput captures what the programs of the engine print to out, instead of printing it to the output of the
+// process, like a server attaching the output of a script to the log of a request needs.
+func WithOutput(out *Output) Option {
+	return func(o *options) {
+		o.config.Stdout = &out.stdout
+		o.config.Stderr = &out.stderr
+	}
+}
+
+// Quotas limit what each Eval, EvalFile and Call of an engine can use, to run the programs of several tenants side
+// by side. A program going over a quota stops with an error. Zero is no limit for steps and objects, and the
+// default of the interpreter for the others.
+type Quotas struct {
+	MaxSteps   int64 // how many statements can run, or instructions with the virtual machine
+	MaxObjects int64 // how many strings, arrays, hashes and functions literals and operators can create
+
+	MaxCallDepth    int // how many calls can be in progress at once
+	MaxStringLength int // how long a string can be, in bytes
+	MaxArrayLength  int // how many elements an array can have
+	MaxHashSize     int // how many pairs a hash can have
+}
+
+// WithQuotas limits what the programs of the engine use, see Engine.Usage for what they used.
+func WithQuotas(q Quotas) Option {
+	return func(o *options) {
+		o.meter.MaxSteps, o.meter.MaxObjects = q.MaxSteps, q.MaxObjects
+		if q.MaxCallDepth > 0 {
+			o.config.MaxCallDepth = q.MaxCallDepth
+		}
+		o.config.MaxStringLength = q.MaxStringLength
+		o.config.MaxArrayLength = q.MaxArrayLength
+		o.config.MaxHashSize = q.MaxHashSize
+	}
+}
@@ -0,0 +1,53 @@
+package monkey
+
+import (
+	"bytes"
+	"sync"
+)
+
+type (
+	// Output holds what programs printed, see WithOutput. It is safe to read while programs print.
+	Output struct {
+		stdout, stderr buffer
+	}
+
+	// buffer is a bytes.Buffer safe for concurrent use
+	buffer struct {
+		mu  sync.Mutex
+		buf bytes.Buffer
+	}
+)
+
+// Stdout returns what was printed by builtins like println so far.
+func (o *Output) Stdout() string {
+	return o.stdout.String()
+}
+
+// Stderr returns what was printed by eprintln so far.
+func (o *Output) Stderr() string {
+	return o.stderr.String()
+}
+
+// Reset forgets what was printed so far, to capture the output of each evaluation on its own.
+func (o *Output) Reset() {
+	o.stdout.Reset()
+	o.stderr.Reset()
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *buffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *buffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
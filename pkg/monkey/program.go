@@ -0,0 +1,111 @@
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"monkey/internal/ast"
+	"monkey/internal/compiler"
+	"monkey/internal/evaluator"
+	"monkey/internal/object"
+	"monkey/internal/vm"
+	"reflect"
+)
+
+// Program is a source compiled once by Engine.Compile, to run it many times, from several goroutines at once:
+//
+//	program, err := engine.Compile(`handle(request)`)
+//	...
+//	value, err := program.Run(map[string]interface{}{"request": r.URL.Path}) // in every request
+//
+// A Program doesn't change once compiled. Every run has an environment of its own, enclosed by the one of the
+// engine: runs see what the engine was given with Bind and the lets of its evaluations, but their own lets stay
+// theirs. Runs assigning to a global of the engine at once don't corrupt it, but the last one wins. The engine
+// mustn't evaluate anything while its programs run, since they read its environment. Every run has the quotas and
+// the timeout of the engine to itself.
+type Program struct {
+	engine  *Engine
+	program *ast.Program
+
+	// with the virtual machine, the program is compiled with the globals of the engine and the names it uses
+	bytecode      *compiler.Bytecode
+	symbols       *compiler.SymbolTable
+	engineGlobals int // how many of the globals are the ones of the engine
+}
+
+// Compile parses the source, and compiles it to bytecode if the engine runs on the virtual machine. The error is a
+// *SyntaxError if the source can't be parsed.
+func (e *Engine) Compile(src string) (*Program, error) {
+	program, err := parse(src, "")
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := &Program{engine: e, program: program}
+	if e.machine == nil {
+		return compiled, nil
+	}
+
+	// the names the program uses are declared as globals, for the variables of runs to be set, and the ones that
+	// aren't set fall back to the builtins of the same name like any global that isn't set yet
+	compiled.symbols = compiler.NewSymbolTable()
+	for _, name := range e.machine.symbols.Names() {
+		compiled.symbols.Define(name)
+	}
+	compiled.engineGlobals = len(e.machine.symbols.Names())
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			compiled.symbols.Define(ident.Value)
+		}
+		return true
+	})
+
+	c := compiler.NewWithState(compiled.symbols, e.machine.bytecode.Constants)
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+	compiled.bytecode = c.Bytecode()
+	return compiled, nil
+}
+
+// Run runs the program in a new environment with the variables set, converted like Bind converts values, and
+// returns its value like Eval does.
+func (p *Program) Run(vars map[string]interface{}) (interface{}, error) {
+	e := p.engine
+	meter := &evaluator.Meter{MaxSteps: e.meter.MaxSteps, MaxObjects: e.meter.MaxObjects}
+	measured := e.evaluator.WithMeter(meter)
+
+	objects := make(map[string]object.Object, len(vars))
+	for name, value := range vars {
+		obj, err := bind(reflect.ValueOf(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		objects[name] = obj
+	}
+
+	ctx, cancel := e.timeoutContext(context.Background())
+	defer cancel()
+
+	var result object.Object
+	if p.bytecode != nil {
+		globals := make([]object.Object, p.symbols.NumDefinitions())
+		copy(globals, e.machine.globals[:p.engineGlobals])
+		for name, obj := range objects {
+			if symbol, ok := p.symbols.Resolve(name); ok && symbol.Scope == compiler.GlobalScope {
+				globals[symbol.Index] = obj
+			}
+		}
+		result = vm.NewWithGlobals(p.bytecode, measured, globals).RunContext(ctx)
+	} else {
+		env := object.NewEnclosedEnvironment(e.env)
+		for name, obj := range objects {
+			env.Set(name, obj)
+		}
+		result = measured.EvalContext(ctx, p.program, env)
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		return nil, newRuntimeError(err, "", ctx)
+	}
+	return object.ToGo(result), nil
+}